@@ -0,0 +1,155 @@
+package queryrunner
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+)
+
+// QueryStatus is the status of a query started by StartQuery.
+type QueryStatus string
+
+const (
+	QueryStatusRunning   QueryStatus = "running"
+	QueryStatusSucceeded QueryStatus = "succeeded"
+	QueryStatusFailed    QueryStatus = "failed"
+)
+
+// QueryHandle identifies a query started by StartQuery, it is serialized as job ID to resume waiting and fetching later.
+// ID is the runner specific identifier, such as Redshift statement ID or Logs Insights query ID.
+type QueryHandle struct {
+	QueryName  string    `json:"query_name"`
+	RunnerType string    `json:"runner_type"`
+	ID         string    `json:"id"`
+	Query      string    `json:"query"`
+	StartedAt  time.Time `json:"started_at"`
+}
+
+// JobID returns the handle serialized as an opaque string.
+func (h *QueryHandle) JobID() string {
+	bs, _ := json.Marshal(h)
+	return base64.RawURLEncoding.EncodeToString(bs)
+}
+
+// ParseJobID returns the handle serialized by JobID.
+func ParseJobID(jobID string) (*QueryHandle, error) {
+	bs, err := base64.RawURLEncoding.DecodeString(jobID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid job id: %w", err)
+	}
+	var h QueryHandle
+	if err := json.Unmarshal(bs, &h); err != nil {
+		return nil, fmt.Errorf("invalid job id: %w", err)
+	}
+	if h.QueryName == "" || h.ID == "" {
+		return nil, fmt.Errorf("invalid job id: query name or id is empty")
+	}
+	return &h, nil
+}
+
+// NewQueryHandle returns QueryHandle of the query started as id.
+func (q *QueryBase) NewQueryHandle(id string, query string) *QueryHandle {
+	return &QueryHandle{
+		QueryName:  q.Name(),
+		RunnerType: q.runner.Type(),
+		ID:         id,
+		Query:      query,
+		StartedAt:  time.Now(),
+	}
+}
+
+// AsyncQuery is a PreparedQuery that can be started without waiting for the result.
+type AsyncQuery interface {
+	PreparedQuery
+	// Start starts the query and returns the handle without waiting for the result.
+	Start(ctx context.Context, variables map[string]cty.Value, functions map[string]function.Function) (*QueryHandle, error)
+	// Status returns the status of the started query, the second return value is the reason of QueryStatusFailed.
+	Status(ctx context.Context, handle *QueryHandle) (QueryStatus, string, error)
+	// Fetch waits for the started query and writes result rows to w, returned QueryResult has no rows.
+	Fetch(ctx context.Context, handle *QueryHandle, w RowWriter) (*QueryResult, error)
+}
+
+// StartQuery starts query after the variables are evaluated, the queries that query depends on are run before it is started.
+func StartQuery(ctx context.Context, queries PreparedQueries, name string, variables map[string]cty.Value, functions map[string]function.Function) (*QueryHandle, error) {
+	query, ok := queries.Get(name)
+	if !ok {
+		return nil, fmt.Errorf("query `%s` is not found", name)
+	}
+	async, ok := query.(AsyncQuery)
+	if !ok {
+		return nil, fmt.Errorf("query `%s` runner type `%s` does not support async", query.Name(), query.RunnerType())
+	}
+	if deps := queryDependencies(query); len(deps) > 0 {
+		results, err := RunQueries(ctx, queries, deps, variables, functions)
+		if err != nil {
+			return nil, err
+		}
+		variables = withQueryResults(variables, results)
+	}
+	variables, err := EvaluateVariables(query, variables)
+	if err != nil {
+		return nil, err
+	}
+	ctx, _ = retryContext(ctx, query)
+	return async.Start(ctx, variables, functions)
+}
+
+// getAsyncQuery returns the query that started the handle.
+func getAsyncQuery(queries PreparedQueries, handle *QueryHandle) (AsyncQuery, error) {
+	query, ok := queries.Get(handle.QueryName)
+	if !ok {
+		return nil, fmt.Errorf("query `%s` is not found", handle.QueryName)
+	}
+	if query.RunnerType() != handle.RunnerType {
+		return nil, fmt.Errorf("query `%s` runner type is changed from `%s` to `%s`", handle.QueryName, handle.RunnerType, query.RunnerType())
+	}
+	async, ok := query.(AsyncQuery)
+	if !ok {
+		return nil, fmt.Errorf("query `%s` runner type `%s` does not support async", query.Name(), query.RunnerType())
+	}
+	return async, nil
+}
+
+// GetQueryStatus returns the status of the query started as handle.
+func GetQueryStatus(ctx context.Context, queries PreparedQueries, handle *QueryHandle) (QueryStatus, string, error) {
+	async, err := getAsyncQuery(queries, handle)
+	if err != nil {
+		return "", "", err
+	}
+	return async.Status(ctx, handle)
+}
+
+// FetchQuery resumes waiting for the query started as handle, and writes result rows to w.
+func FetchQuery(ctx context.Context, queries PreparedQueries, handle *QueryHandle, w RowWriter) (*QueryResult, error) {
+	async, err := getAsyncQuery(queries, handle)
+	if err != nil {
+		return nil, err
+	}
+	release, err := acquireRunner(ctx, async)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	ctx, recorder := startRun(ctx, async)
+	summary, err := async.Fetch(ctx, handle, recorder.RowWriter(w))
+	if err != nil {
+		return nil, err
+	}
+	recorder.finish(summary, 0)
+	return summary, nil
+}
+
+// FetchQueryResult is same as FetchQuery, but the returned result has all rows.
+func FetchQueryResult(ctx context.Context, queries PreparedQueries, handle *QueryHandle) (*QueryResult, error) {
+	collector := &rowCollector{}
+	summary, err := FetchQuery(ctx, queries, handle, collector)
+	if err != nil {
+		return nil, err
+	}
+	return collector.QueryResult(summary), nil
+}
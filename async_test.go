@@ -0,0 +1,137 @@
+package queryrunner_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/gohcl"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/mashiike/hclconfig"
+	"github.com/mashiike/queryrunner"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+)
+
+// asyncQueryRunner keeps started queries in memory, the query finishes on the second status check.
+type asyncQueryRunner struct {
+	name    string
+	started map[string]string
+	checked map[string]int
+}
+
+func (r *asyncQueryRunner) Name() string {
+	return r.name
+}
+
+func (r *asyncQueryRunner) Type() string {
+	return "async"
+}
+
+func (r *asyncQueryRunner) Prepare(base *queryrunner.QueryBase) (queryrunner.PreparedQuery, hcl.Diagnostics) {
+	q := &asyncPreparedQuery{
+		QueryBase: base,
+		runner:    r,
+	}
+	diags := gohcl.DecodeBody(base.Remain(), base.NewEvalContext(nil, nil), q)
+	return q, diags
+}
+
+type asyncPreparedQuery struct {
+	*queryrunner.QueryBase
+	runner *asyncQueryRunner
+
+	Query hcl.Expression `hcl:"query"`
+}
+
+func (q *asyncPreparedQuery) Run(ctx context.Context, variables map[string]cty.Value, functions map[string]function.Function) (*queryrunner.QueryResult, error) {
+	var query string
+	if diags := gohcl.DecodeExpression(q.Query, q.NewEvalContext(variables, functions), &query); diags.HasErrors() {
+		return nil, diags
+	}
+	return queryrunner.NewQueryResult(q.Name(), query, []string{"query"}, [][]string{{query}}), nil
+}
+
+func (q *asyncPreparedQuery) Start(ctx context.Context, variables map[string]cty.Value, functions map[string]function.Function) (*queryrunner.QueryHandle, error) {
+	var query string
+	if diags := gohcl.DecodeExpression(q.Query, q.NewEvalContext(variables, functions), &query); diags.HasErrors() {
+		return nil, diags
+	}
+	id := "job-" + q.Name()
+	q.runner.started[id] = query
+	return q.NewQueryHandle(id, query), nil
+}
+
+func (q *asyncPreparedQuery) Status(ctx context.Context, handle *queryrunner.QueryHandle) (queryrunner.QueryStatus, string, error) {
+	q.runner.checked[handle.ID]++
+	if q.runner.checked[handle.ID] < 2 {
+		return queryrunner.QueryStatusRunning, "", nil
+	}
+	return queryrunner.QueryStatusSucceeded, "", nil
+}
+
+func (q *asyncPreparedQuery) Fetch(ctx context.Context, handle *queryrunner.QueryHandle, w queryrunner.RowWriter) (*queryrunner.QueryResult, error) {
+	result := queryrunner.NewQueryResult(q.Name(), handle.Query, []string{"query"}, [][]string{{q.runner.started[handle.ID]}})
+	if err := result.WriteRows(w); err != nil {
+		return nil, err
+	}
+	return queryrunner.NewQueryResultWithColumns(q.Name(), handle.Query, result.Columns, nil), nil
+}
+
+func TestStartQuery(t *testing.T) {
+	runner := &asyncQueryRunner{
+		started: make(map[string]string),
+		checked: make(map[string]int),
+	}
+	err := queryrunner.Register(&queryrunner.QueryRunnerDefinition{
+		TypeName: "async",
+		BuildQueryRunnerFunc: func(name string, body hcl.Body, ctx *hcl.EvalContext) (queryrunner.QueryRunner, hcl.Diagnostics) {
+			runner.name = name
+			return runner, nil
+		},
+	})
+	require.NoError(t, err)
+	parser := hclparse.NewParser()
+	file, diags := parser.ParseHCL([]byte(`
+	query_runner "async" "default" {}
+
+	query "upstream" {
+		runner = query_runner.async.default
+		query  = "SELECT 1"
+	}
+
+	query "downstream" {
+		runner = query_runner.async.default
+		query  = "SELECT * FROM (${query.upstream.rows[0][0]}) WHERE ${var.cond}"
+	}
+	`), "config.hcl")
+	require.False(t, diags.HasErrors())
+	queries, _, diags := queryrunner.DecodeBody(file.Body, hclconfig.NewEvalContext())
+	require.False(t, diags.HasErrors(), diags.Error())
+
+	handle, err := queryrunner.StartQuery(context.Background(), queries, "downstream", map[string]cty.Value{
+		"var": cty.ObjectVal(map[string]cty.Value{
+			"cond": cty.StringVal("true"),
+		}),
+	}, nil)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"job-downstream": "SELECT * FROM (SELECT 1) WHERE true"}, runner.started)
+
+	resumed, err := queryrunner.ParseJobID(handle.JobID())
+	require.NoError(t, err)
+	status, _, err := queryrunner.GetQueryStatus(context.Background(), queries, resumed)
+	require.NoError(t, err)
+	require.Equal(t, queryrunner.QueryStatusRunning, status)
+	status, _, err = queryrunner.GetQueryStatus(context.Background(), queries, resumed)
+	require.NoError(t, err)
+	require.Equal(t, queryrunner.QueryStatusSucceeded, status)
+
+	result, err := queryrunner.FetchQueryResult(context.Background(), queries, resumed)
+	require.NoError(t, err)
+	require.Equal(t, "downstream", result.Name)
+	require.EqualValues(t, [][]interface{}{{"SELECT * FROM (SELECT 1) WHERE true"}}, result.Rows)
+
+	_, err = queryrunner.ParseJobID("invalid")
+	require.Error(t, err)
+}
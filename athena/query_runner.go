@@ -0,0 +1,509 @@
+package athena
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/athena"
+	"github.com/aws/aws-sdk-go-v2/service/athena/types"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/gohcl"
+	"github.com/mashiike/queryrunner"
+	"github.com/samber/lo"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+)
+
+const TypeName = "athena"
+
+func init() {
+	err := queryrunner.Register(&queryrunner.QueryRunnerDefinition{
+		TypeName:             TypeName,
+		BuildQueryRunnerFunc: BuildQueryRunner,
+	})
+	if err != nil {
+		panic(fmt.Errorf("register athena query runner:%w", err))
+	}
+}
+
+// Client is the subset of Athena API used by the query runner.
+type Client interface {
+	athena.GetQueryResultsAPIClient
+	StartQueryExecution(ctx context.Context, params *athena.StartQueryExecutionInput, optFns ...func(*athena.Options)) (*athena.StartQueryExecutionOutput, error)
+	GetQueryExecution(ctx context.Context, params *athena.GetQueryExecutionInput, optFns ...func(*athena.Options)) (*athena.GetQueryExecutionOutput, error)
+	StopQueryExecution(ctx context.Context, params *athena.StopQueryExecutionInput, optFns ...func(*athena.Options)) (*athena.StopQueryExecutionOutput, error)
+}
+
+func BuildQueryRunner(name string, body hcl.Body, ctx *hcl.EvalContext) (queryrunner.QueryRunner, hcl.Diagnostics) {
+	waiterSettings, body, diags := queryrunner.DecodeWaiterSettings(body, ctx)
+	retryPolicy, body, retryDiags := queryrunner.DecodeRetryPolicy(body, ctx)
+	diags = append(diags, retryDiags...)
+	queryRunner := &QueryRunner{
+		name:           name,
+		waiterSettings: waiterSettings,
+		retryPolicy:    retryPolicy,
+	}
+	diags = append(diags, gohcl.DecodeBody(body, ctx, queryRunner)...)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	optFns := make([]func(*config.LoadOptions) error, 0)
+	if queryRunner.Region != nil {
+		optFns = append(optFns, config.WithRegion(*queryRunner.Region))
+	}
+	awsCfg, err := config.LoadDefaultConfig(context.Background(), optFns...)
+	if err != nil {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "initialize aws client",
+			Detail:   fmt.Sprintf("failed load aws default config:%v", err),
+			Subject:  body.MissingItemRange().Ptr(),
+		})
+		return nil, diags
+	}
+	queryRunner.client = athena.NewFromConfig(awsCfg)
+	return queryRunner, diags
+}
+
+type QueryRunner struct {
+	client         Client
+	name           string
+	waiterSettings queryrunner.WaiterSettings
+	retryPolicy    queryrunner.RetryPolicy
+
+	Region         *string `hcl:"region"`
+	Workgroup      *string `hcl:"workgroup"`
+	Catalog        *string `hcl:"catalog"`
+	Database       *string `hcl:"database"`
+	OutputLocation *string `hcl:"output_location"`
+}
+
+func (r *QueryRunner) Name() string {
+	return r.name
+}
+
+func (r *QueryRunner) Type() string {
+	return TypeName
+}
+
+type PreparedQuery struct {
+	*queryrunner.QueryBase
+	runner *QueryRunner
+
+	SQL        hcl.Expression `hcl:"sql"`
+	Parameters hcl.Expression `hcl:"parameters,optional"`
+}
+
+func (r *QueryRunner) Prepare(base *queryrunner.QueryBase) (queryrunner.PreparedQuery, hcl.Diagnostics) {
+	log.Printf("[debug] prepare `%s` with athena query_runner", base.Name())
+	q := &PreparedQuery{
+		QueryBase: base,
+		runner:    r,
+	}
+	ctx := base.NewEvalContext(nil, nil)
+	body, diags := base.DecodeWaiterSettings(ctx)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	body, retryDiags := base.DecodeRetryPolicy(body, ctx)
+	diags = append(diags, retryDiags...)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	diags = append(diags, gohcl.DecodeBody(body, ctx, q)...)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	value, _ := q.SQL.Value(ctx)
+	if value.IsKnown() && value.Type() == cty.String && value.AsString() == "" {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid SQL template",
+			Detail:   "sql is empty",
+			Subject:  q.SQL.Range().Ptr(),
+		})
+		return nil, diags
+	}
+	diags = append(diags, queryrunner.ValidateParameters(q.SQL, q.Parameters, ctx)...)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	return q, diags
+}
+
+func (q *PreparedQuery) Run(ctx context.Context, variables map[string]cty.Value, functions map[string]function.Function) (*queryrunner.QueryResult, error) {
+	return queryrunner.CollectStream(ctx, q, variables, functions)
+}
+
+func (q *PreparedQuery) Stream(ctx context.Context, variables map[string]cty.Value, functions map[string]function.Function, w queryrunner.RowWriter) (*queryrunner.QueryResult, error) {
+	ctx = queryrunner.WithWaiterSettings(ctx, q.WaiterSettings())
+	query, executionParameters, err := q.render(variables, functions)
+	if err != nil {
+		return nil, err
+	}
+	return q.runner.RunQuery(ctx, q.Name(), query, executionParameters, w)
+}
+
+// Start starts the query execution and returns the handle without waiting for the result.
+func (q *PreparedQuery) Start(ctx context.Context, variables map[string]cty.Value, functions map[string]function.Function) (*queryrunner.QueryHandle, error) {
+	query, executionParameters, err := q.render(variables, functions)
+	if err != nil {
+		return nil, err
+	}
+	executionID, err := q.runner.StartQuery(ctx, q.Name(), query, executionParameters)
+	if err != nil {
+		return nil, err
+	}
+	return q.NewQueryHandle(executionID, query), nil
+}
+
+func (q *PreparedQuery) Status(ctx context.Context, handle *queryrunner.QueryHandle) (queryrunner.QueryStatus, string, error) {
+	return q.runner.QueryStatus(ctx, handle.ID)
+}
+
+func (q *PreparedQuery) Fetch(ctx context.Context, handle *queryrunner.QueryHandle, w queryrunner.RowWriter) (*queryrunner.QueryResult, error) {
+	ctx = queryrunner.WithWaiterSettings(ctx, q.WaiterSettings())
+	return q.runner.FetchQuery(ctx, q.Name(), handle.Query, handle.ID, w)
+}
+
+// Render returns the SQL and the execution parameters sent to Athena without running it.
+func (q *PreparedQuery) Render(ctx context.Context, variables map[string]cty.Value, functions map[string]function.Function) (*queryrunner.RenderedQuery, error) {
+	query, executionParameters, err := q.render(variables, functions)
+	if err != nil {
+		return nil, err
+	}
+	attributes := make(map[string]interface{})
+	if len(executionParameters) > 0 {
+		attributes["execution_parameters"] = executionParameters
+	}
+	if q.runner.Workgroup != nil {
+		attributes["workgroup"] = *q.runner.Workgroup
+	}
+	if q.runner.Catalog != nil {
+		attributes["catalog"] = *q.runner.Catalog
+	}
+	if q.runner.Database != nil {
+		attributes["database"] = *q.runner.Database
+	}
+	return q.NewRenderedQuery(query, attributes), nil
+}
+
+func (q *PreparedQuery) render(variables map[string]cty.Value, functions map[string]function.Function) (string, []string, error) {
+	evalCtx := q.NewEvalContext(variables, functions)
+	value, diags := q.SQL.Value(evalCtx)
+	if diags.HasErrors() {
+		return "", nil, diags
+	}
+	if !value.IsKnown() {
+		return "", nil, errors.New("SQL is unknown")
+	}
+	if value.Type() != cty.String {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid SQL template",
+			Detail:   "sql is not string",
+			Subject:  q.SQL.Range().Ptr(),
+		})
+		return "", nil, diags
+	}
+	params, diags := queryrunner.EvaluateParameters(q.Parameters, evalCtx)
+	if diags.HasErrors() {
+		return "", nil, diags
+	}
+	query := value.AsString()
+	bound, err := queryrunner.BindParameters(query, params)
+	if err != nil {
+		return "", nil, err
+	}
+	var executionParameters []string
+	if len(bound) > 0 {
+		query = queryrunner.ReplacePlaceholders(query, func(_ int, _ queryrunner.Placeholder) string {
+			return "?"
+		})
+		executionParameters = lo.Map(bound, func(p queryrunner.QueryParameter, _ int) string {
+			return parameterLiteral(p)
+		})
+	}
+	return query, executionParameters, nil
+}
+
+// parameterLiteral formats the parameter as SQL literal, Athena execution parameters are literals.
+func parameterLiteral(p queryrunner.QueryParameter) string {
+	if p.Value.IsNull() {
+		return "NULL"
+	}
+	if p.Value.Type() == cty.String {
+		return "'" + strings.ReplaceAll(p.Value.AsString(), "'", "''") + "'"
+	}
+	return p.String()
+}
+
+// RunQuery executes query and writes result rows to w, returned QueryResult has no rows.
+// executionParameters are SQL literals for `?` placeholders in query.
+func (r *QueryRunner) RunQuery(ctx context.Context, name string, query string, executionParameters []string, w queryrunner.RowWriter) (*queryrunner.QueryResult, error) {
+	executionID, err := r.StartQuery(ctx, name, query, executionParameters)
+	if err != nil {
+		return nil, err
+	}
+	return r.FetchQuery(ctx, name, query, executionID, w)
+}
+
+// StartQuery starts query execution and returns the query execution ID without waiting for the result.
+func (r *QueryRunner) StartQuery(ctx context.Context, name string, query string, executionParameters []string) (string, error) {
+	reqID := queryrunner.GetRequestID(ctx)
+	log.Printf("[info][%s] start athena query `%s`", reqID, name)
+	log.Printf("[debug][%s] query: %s", reqID, query)
+	input := &athena.StartQueryExecutionInput{
+		QueryString:         aws.String(query),
+		WorkGroup:           r.Workgroup,
+		ExecutionParameters: executionParameters,
+	}
+	if r.Catalog != nil || r.Database != nil {
+		input.QueryExecutionContext = &types.QueryExecutionContext{
+			Catalog:  r.Catalog,
+			Database: r.Database,
+		}
+	}
+	if r.OutputLocation != nil {
+		input.ResultConfiguration = &types.ResultConfiguration{
+			OutputLocation: r.OutputLocation,
+		}
+	}
+	// the same token is used for the retries, so that the query is started only once.
+	token, err := newClientRequestToken()
+	if err != nil {
+		return "", fmt.Errorf("generate client request token:%w", err)
+	}
+	input.ClientRequestToken = aws.String(token)
+	var startOutput *athena.StartQueryExecutionOutput
+	err = queryrunner.Retry(ctx, r.retryPolicy, func(ctx context.Context) error {
+		var err error
+		startOutput, err = r.client.StartQueryExecution(ctx, input)
+		return err
+	})
+	if err != nil {
+		return "", fmt.Errorf("start query execution:%w", err)
+	}
+	return aws.ToString(startOutput.QueryExecutionId), nil
+}
+
+// newClientRequestToken returns the random token for StartQueryExecution, Athena requires 32 to 128 characters.
+func newClientRequestToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// QueryStatus returns the status of the query execution.
+func (r *QueryRunner) QueryStatus(ctx context.Context, executionID string) (queryrunner.QueryStatus, string, error) {
+	var getOutput *athena.GetQueryExecutionOutput
+	err := queryrunner.Retry(ctx, r.retryPolicy, func(ctx context.Context) error {
+		var err error
+		getOutput, err = r.client.GetQueryExecution(ctx, &athena.GetQueryExecutionInput{
+			QueryExecutionId: aws.String(executionID),
+		})
+		return err
+	})
+	if err != nil {
+		return "", "", fmt.Errorf("get query execution:%w", err)
+	}
+	status := getOutput.QueryExecution.Status
+	switch status.State {
+	case types.QueryExecutionStateSucceeded:
+		return queryrunner.QueryStatusSucceeded, "", nil
+	case types.QueryExecutionStateCancelled, types.QueryExecutionStateFailed:
+		return queryrunner.QueryStatusFailed, fmt.Sprintf("query %s: %s", strings.ToLower(string(status.State)), aws.ToString(status.StateChangeReason)), nil
+	default:
+		return queryrunner.QueryStatusRunning, "", nil
+	}
+}
+
+// FetchQuery waits for the query execution and writes result rows to w, returned QueryResult has no rows.
+// the query execution is stopped when the wait is timeout or canceled.
+func (r *QueryRunner) FetchQuery(ctx context.Context, name string, query string, executionID string, w queryrunner.RowWriter) (*queryrunner.QueryResult, error) {
+	reqID := queryrunner.GetRequestID(ctx)
+	queryStart := time.Now()
+	waiter := queryrunner.NewWaiter(ctx, r.waiterSettings)
+	for waiter.Continue(ctx) {
+		elapsedTime := time.Since(queryStart)
+		log.Printf("[debug][%s] wating athena query `%s` elapsed_time=%s", reqID, name, elapsedTime)
+		var getOutput *athena.GetQueryExecutionOutput
+		err := queryrunner.Retry(ctx, r.retryPolicy, func(ctx context.Context) error {
+			var err error
+			getOutput, err = r.client.GetQueryExecution(ctx, &athena.GetQueryExecutionInput{
+				QueryExecutionId: aws.String(executionID),
+			})
+			return err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("get query execution:%w", err)
+		}
+		execution := getOutput.QueryExecution
+		switch execution.Status.State {
+		case types.QueryExecutionStateQueued, types.QueryExecutionStateRunning:
+			continue
+		case types.QueryExecutionStateCancelled:
+			return nil, fmt.Errorf("query cancelled: %s", aws.ToString(execution.Status.StateChangeReason))
+		case types.QueryExecutionStateFailed:
+			return nil, fmt.Errorf("query failed: %s", aws.ToString(execution.Status.StateChangeReason))
+		case types.QueryExecutionStateSucceeded:
+			log.Printf("[info][%s] success athena query `%s`, elapsed_time=%s", reqID, name, time.Since(queryStart))
+			return r.writeQueryResults(ctx, name, query, execution, w)
+		default:
+			return nil, fmt.Errorf("unknown query execution state: %s", execution.Status.State)
+		}
+	}
+	log.Printf("[info][%s] timeout or cancel athena query `%s`", reqID, name)
+	cancelCtx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	_, err := r.client.StopQueryExecution(cancelCtx, &athena.StopQueryExecutionInput{
+		QueryExecutionId: aws.String(executionID),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("stop query execution: %w", err)
+	}
+	return nil, errors.New("query timeout")
+}
+
+func (r *QueryRunner) writeQueryResults(ctx context.Context, name string, query string, execution *types.QueryExecution, w queryrunner.RowWriter) (*queryrunner.QueryResult, error) {
+	p := athena.NewGetQueryResultsPaginator(r.client, &athena.GetQueryResultsInput{
+		QueryExecutionId: execution.QueryExecutionId,
+	})
+	// the first row of SELECT statement results is the header row.
+	skipHeader := execution.StatementType == types.StatementTypeDml
+	var columns queryrunner.Columns
+	for p.HasMorePages() {
+		var output *athena.GetQueryResultsOutput
+		err := queryrunner.Retry(ctx, r.retryPolicy, func(ctx context.Context) error {
+			var err error
+			output, err = p.NextPage(ctx)
+			return err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("get query results:%w", err)
+		}
+		if output.ResultSet == nil {
+			continue
+		}
+		if columns == nil && output.ResultSet.ResultSetMetadata != nil {
+			columns = lo.Map(output.ResultSet.ResultSetMetadata.ColumnInfo, func(c types.ColumnInfo, _ int) queryrunner.Column {
+				return queryrunner.Column{
+					Name:     aws.ToString(c.Name),
+					Type:     columnType(aws.ToString(c.Type)),
+					Nullable: c.Nullable != types.ColumnNullableNotNull,
+				}
+			})
+			if err := w.WriteColumns(columns); err != nil {
+				return nil, fmt.Errorf("write columns:%w", err)
+			}
+		}
+		rows := output.ResultSet.Rows
+		if skipHeader && len(rows) > 0 {
+			rows = rows[1:]
+			skipHeader = false
+		}
+		for _, row := range rows {
+			values := make([]interface{}, len(columns))
+			for i, datum := range row.Data {
+				if i >= len(columns) {
+					break
+				}
+				values[i] = datumValue(columns[i], datum)
+			}
+			if err := w.WriteRow(values); err != nil {
+				return nil, fmt.Errorf("write row:%w", err)
+			}
+		}
+	}
+	result := queryrunner.NewQueryResultWithColumns(name, query, columns, nil)
+	if columns == nil {
+		result = queryrunner.NewEmptyQueryResult(name, query)
+	}
+	result.Stats = executionStats(execution)
+	return result, nil
+}
+
+// executionStats returns the statistics of the succeeded query execution.
+func executionStats(execution *types.QueryExecution) *queryrunner.Stats {
+	stats := &queryrunner.Stats{
+		QueryID: aws.ToString(execution.QueryExecutionId),
+	}
+	if s := execution.Statistics; s != nil {
+		stats.BytesScanned = aws.ToInt64(s.DataScannedInBytes)
+		stats.Extra = map[string]interface{}{
+			"engine_execution_time_in_millis": aws.ToInt64(s.EngineExecutionTimeInMillis),
+			"query_queue_time_in_millis":      aws.ToInt64(s.QueryQueueTimeInMillis),
+		}
+	}
+	return stats
+}
+
+func columnType(typeName string) queryrunner.ColumnType {
+	switch strings.ToLower(typeName) {
+	case "tinyint", "smallint", "integer", "int", "bigint":
+		return queryrunner.ColumnTypeInteger
+	case "float", "real", "double":
+		return queryrunner.ColumnTypeFloat
+	case "decimal":
+		return queryrunner.ColumnTypeDecimal
+	case "boolean":
+		return queryrunner.ColumnTypeBoolean
+	case "date", "time", "timestamp", "timestamp with time zone":
+		return queryrunner.ColumnTypeTimestamp
+	case "varbinary":
+		return queryrunner.ColumnTypeBinary
+	case "json":
+		return queryrunner.ColumnTypeJSON
+	default:
+		return queryrunner.ColumnTypeString
+	}
+}
+
+// datumValue converts VarCharValue into the Go value of the column type, it falls back to the string as is.
+func datumValue(column queryrunner.Column, datum types.Datum) interface{} {
+	if datum.VarCharValue == nil {
+		return nil
+	}
+	value := *datum.VarCharValue
+	switch column.Type {
+	case queryrunner.ColumnTypeInteger:
+		if i, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return i
+		}
+	case queryrunner.ColumnTypeFloat:
+		if f, err := strconv.ParseFloat(value, 64); err == nil {
+			return f
+		}
+	case queryrunner.ColumnTypeDecimal:
+		return json.Number(value)
+	case queryrunner.ColumnTypeBoolean:
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+	case queryrunner.ColumnTypeBinary:
+		// varbinary is returned as space separated hex, such as `68 65 6c`.
+		if b, err := hex.DecodeString(strings.ReplaceAll(value, " ", "")); err == nil {
+			return b
+		}
+	case queryrunner.ColumnTypeJSON:
+		var v interface{}
+		decoder := json.NewDecoder(strings.NewReader(value))
+		decoder.UseNumber()
+		if err := decoder.Decode(&v); err == nil {
+			return v
+		}
+	}
+	return value
+}
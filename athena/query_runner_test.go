@@ -0,0 +1,327 @@
+package athena
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/athena"
+	"github.com/aws/aws-sdk-go-v2/service/athena/types"
+	"github.com/aws/smithy-go"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/mashiike/hclconfig"
+	"github.com/mashiike/queryrunner"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+type stubClient struct {
+	startInput *athena.StartQueryExecutionInput
+	states     []types.QueryExecutionState
+	pages      []*athena.GetQueryResultsOutput
+	onGet      func()
+	getErrors  []error
+	stopped    bool
+}
+
+func (c *stubClient) StartQueryExecution(ctx context.Context, params *athena.StartQueryExecutionInput, optFns ...func(*athena.Options)) (*athena.StartQueryExecutionOutput, error) {
+	c.startInput = params
+	return &athena.StartQueryExecutionOutput{
+		QueryExecutionId: aws.String("query-execution-id"),
+	}, nil
+}
+
+func (c *stubClient) GetQueryExecution(ctx context.Context, params *athena.GetQueryExecutionInput, optFns ...func(*athena.Options)) (*athena.GetQueryExecutionOutput, error) {
+	if c.onGet != nil {
+		c.onGet()
+	}
+	if len(c.getErrors) > 0 {
+		err := c.getErrors[0]
+		c.getErrors = c.getErrors[1:]
+		return nil, err
+	}
+	state := c.states[0]
+	if len(c.states) > 1 {
+		c.states = c.states[1:]
+	}
+	return &athena.GetQueryExecutionOutput{
+		QueryExecution: &types.QueryExecution{
+			QueryExecutionId: params.QueryExecutionId,
+			StatementType:    types.StatementTypeDml,
+			Status: &types.QueryExecutionStatus{
+				State: state,
+			},
+		},
+	}, nil
+}
+
+func (c *stubClient) GetQueryResults(ctx context.Context, params *athena.GetQueryResultsInput, optFns ...func(*athena.Options)) (*athena.GetQueryResultsOutput, error) {
+	index := 0
+	if params.NextToken != nil {
+		index = len(*params.NextToken)
+	}
+	return c.pages[index], nil
+}
+
+func (c *stubClient) StopQueryExecution(ctx context.Context, params *athena.StopQueryExecutionInput, optFns ...func(*athena.Options)) (*athena.StopQueryExecutionOutput, error) {
+	c.stopped = true
+	return &athena.StopQueryExecutionOutput{}, nil
+}
+
+func loadQuery(t *testing.T, name string, client Client) *PreparedQuery {
+	t.Helper()
+	parser := hclparse.NewParser()
+	file, diags := parser.ParseHCLFile("testdata/config.hcl")
+	require.False(t, diags.HasErrors())
+	queries, _, diags := queryrunner.DecodeBody(file.Body, hclconfig.NewEvalContext("./"))
+	if !assert.False(t, diags.HasErrors()) {
+		var builder strings.Builder
+		w := hcl.NewDiagnosticTextWriter(&builder, parser.Files(), 400, false)
+		w.WriteDiagnostics(diags)
+		t.Log(builder.String())
+		t.FailNow()
+	}
+	query, ok := queries.Get(name)
+	require.True(t, ok)
+	q, ok := query.(*PreparedQuery)
+	require.True(t, ok)
+	q.runner.client = client
+	return q
+}
+
+func datum(v string) types.Datum {
+	return types.Datum{VarCharValue: aws.String(v)}
+}
+
+func TestRun(t *testing.T) {
+	metadata := &types.ResultSetMetadata{
+		ColumnInfo: []types.ColumnInfo{
+			{Name: aws.String("status"), Type: aws.String("integer"), Nullable: types.ColumnNullableNullable},
+			{Name: aws.String("cnt"), Type: aws.String("bigint"), Nullable: types.ColumnNullableNotNull},
+		},
+	}
+	client := &stubClient{
+		states: []types.QueryExecutionState{
+			types.QueryExecutionStateQueued,
+			types.QueryExecutionStateRunning,
+			types.QueryExecutionStateSucceeded,
+		},
+		pages: []*athena.GetQueryResultsOutput{
+			{
+				ResultSet: &types.ResultSet{
+					ResultSetMetadata: metadata,
+					Rows: []types.Row{
+						{Data: []types.Datum{datum("status"), datum("cnt")}},
+						{Data: []types.Datum{datum("500"), datum("12")}},
+					},
+				},
+				NextToken: aws.String("1"),
+			},
+			{
+				ResultSet: &types.ResultSet{
+					ResultSetMetadata: metadata,
+					Rows: []types.Row{
+						{Data: []types.Datum{{}, datum("3")}},
+					},
+				},
+			},
+		},
+	}
+	q := loadQuery(t, "access_logs", client)
+	result, err := q.Run(context.Background(), map[string]cty.Value{
+		"var": cty.ObjectVal(map[string]cty.Value{
+			"min_status": cty.NumberIntVal(500),
+		}),
+	}, nil)
+	require.NoError(t, err)
+	require.Equal(t, "SELECT status, count(*) AS cnt FROM access_logs WHERE status >= 500 GROUP BY 1", *client.startInput.QueryString)
+	require.Equal(t, "primary", *client.startInput.WorkGroup)
+	require.Equal(t, "default", *client.startInput.QueryExecutionContext.Database)
+	require.Equal(t, "s3://example-bucket/athena-results/", *client.startInput.ResultConfiguration.OutputLocation)
+	require.Len(t, aws.ToString(client.startInput.ClientRequestToken), 32)
+	require.EqualValues(t, queryrunner.Columns{
+		{Name: "status", Type: queryrunner.ColumnTypeInteger, Nullable: true},
+		{Name: "cnt", Type: queryrunner.ColumnTypeInteger},
+	}, result.Columns)
+	require.EqualValues(t, [][]interface{}{
+		{int64(500), int64(12)},
+		{nil, int64(3)},
+	}, result.Rows)
+	require.Equal(t, "query-execution-id", result.Stats.QueryID)
+}
+
+func TestRunCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := &stubClient{
+		states: []types.QueryExecutionState{
+			types.QueryExecutionStateRunning,
+		},
+		onGet: cancel,
+	}
+	q := loadQuery(t, "access_logs", client)
+	_, err := q.Run(ctx, map[string]cty.Value{
+		"var": cty.ObjectVal(map[string]cty.Value{
+			"min_status": cty.NumberIntVal(500),
+		}),
+	}, nil)
+	require.EqualError(t, err, "query timeout")
+	require.True(t, client.stopped)
+}
+
+func TestRunWithParameters(t *testing.T) {
+	client := &stubClient{
+		states: []types.QueryExecutionState{
+			types.QueryExecutionStateSucceeded,
+		},
+		pages: []*athena.GetQueryResultsOutput{
+			{
+				ResultSet: &types.ResultSet{
+					ResultSetMetadata: &types.ResultSetMetadata{
+						ColumnInfo: []types.ColumnInfo{
+							{Name: aws.String("status"), Type: aws.String("integer")},
+							{Name: aws.String("cnt"), Type: aws.String("bigint")},
+						},
+					},
+					Rows: []types.Row{
+						{Data: []types.Datum{datum("status"), datum("cnt")}},
+					},
+				},
+			},
+		},
+	}
+	q := loadQuery(t, "access_logs_by_path", client)
+	_, err := q.Run(context.Background(), map[string]cty.Value{
+		"var": cty.ObjectVal(map[string]cty.Value{
+			"path":       cty.StringVal("/it's"),
+			"min_status": cty.NumberIntVal(500),
+		}),
+	}, nil)
+	require.NoError(t, err)
+	require.Equal(t, "SELECT status, count(*) AS cnt FROM access_logs WHERE path = ? AND status >= ? GROUP BY 1", *client.startInput.QueryString)
+	require.EqualValues(t, []string{"'/it''s'", "500"}, client.startInput.ExecutionParameters)
+}
+
+func TestStartAndFetch(t *testing.T) {
+	client := &stubClient{
+		states: []types.QueryExecutionState{
+			types.QueryExecutionStateRunning,
+			types.QueryExecutionStateSucceeded,
+		},
+		pages: []*athena.GetQueryResultsOutput{
+			{
+				ResultSet: &types.ResultSet{
+					ResultSetMetadata: &types.ResultSetMetadata{
+						ColumnInfo: []types.ColumnInfo{
+							{Name: aws.String("status"), Type: aws.String("integer")},
+							{Name: aws.String("cnt"), Type: aws.String("bigint")},
+						},
+					},
+					Rows: []types.Row{
+						{Data: []types.Datum{datum("status"), datum("cnt")}},
+						{Data: []types.Datum{datum("500"), datum("12")}},
+					},
+				},
+			},
+		},
+	}
+	q := loadQuery(t, "access_logs", client)
+	handle, err := q.Start(context.Background(), map[string]cty.Value{
+		"var": cty.ObjectVal(map[string]cty.Value{
+			"min_status": cty.NumberIntVal(500),
+		}),
+	}, nil)
+	require.NoError(t, err)
+	require.Equal(t, "query-execution-id", handle.ID)
+	require.Equal(t, "access_logs", handle.QueryName)
+	require.Equal(t, TypeName, handle.RunnerType)
+
+	resumed, err := queryrunner.ParseJobID(handle.JobID())
+	require.NoError(t, err)
+	require.Equal(t, handle.Query, resumed.Query)
+
+	status, _, err := q.Status(context.Background(), resumed)
+	require.NoError(t, err)
+	require.Equal(t, queryrunner.QueryStatusRunning, status)
+
+	var builder strings.Builder
+	result, err := q.Fetch(context.Background(), resumed, queryrunner.NewJSONLinesRowWriter(&builder))
+	require.NoError(t, err)
+	require.Equal(t, "SELECT status, count(*) AS cnt FROM access_logs WHERE status >= 500 GROUP BY 1", result.Query)
+	require.Equal(t, `{"cnt":12,"status":500}`+"\n", builder.String())
+}
+
+func TestRunRetry(t *testing.T) {
+	throttling := &smithy.GenericAPIError{Code: "ThrottlingException", Message: "Rate exceeded"}
+	cases := []struct {
+		name      string
+		getErrors []error
+		retries   int
+		errString string
+	}{
+		{
+			name:      "throttling",
+			getErrors: []error{throttling},
+			retries:   1,
+		},
+		{
+			name:      "max attempts",
+			getErrors: []error{throttling, throttling},
+			errString: "get query execution:api error ThrottlingException: Rate exceeded",
+		},
+		{
+			name:      "access denied",
+			getErrors: []error{&smithy.GenericAPIError{Code: "AccessDeniedException", Message: "not authorized"}},
+			errString: "get query execution:api error AccessDeniedException: not authorized",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			client := &stubClient{
+				states:    []types.QueryExecutionState{types.QueryExecutionStateSucceeded},
+				getErrors: c.getErrors,
+				pages: []*athena.GetQueryResultsOutput{
+					{
+						ResultSet: &types.ResultSet{
+							ResultSetMetadata: &types.ResultSetMetadata{},
+						},
+					},
+				},
+			}
+			q := loadQuery(t, "access_logs_with_retry", client)
+			result, err := queryrunner.RunQuery(context.Background(), q, nil, nil)
+			if c.errString != "" {
+				require.EqualError(t, err, c.errString)
+				require.Empty(t, client.getErrors)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, c.retries, result.Stats.Retries)
+		})
+	}
+}
+
+func TestDatumValue(t *testing.T) {
+	cases := []struct {
+		name     string
+		column   queryrunner.Column
+		value    *string
+		expected interface{}
+	}{
+		{name: "null", column: queryrunner.Column{Type: queryrunner.ColumnTypeInteger}, expected: nil},
+		{name: "bigint", column: queryrunner.Column{Type: queryrunner.ColumnTypeInteger}, value: aws.String("12"), expected: int64(12)},
+		{name: "decimal", column: queryrunner.Column{Type: queryrunner.ColumnTypeDecimal}, value: aws.String("1.50"), expected: json.Number("1.50")},
+		{name: "varbinary", column: queryrunner.Column{Type: queryrunner.ColumnTypeBinary}, value: aws.String("68 65 6c"), expected: []byte("hel")},
+		{name: "empty varbinary", column: queryrunner.Column{Type: queryrunner.ColumnTypeBinary}, value: aws.String(""), expected: []byte{}},
+		{name: "json", column: queryrunner.Column{Type: queryrunner.ColumnTypeJSON}, value: aws.String(`{"k":1}`), expected: map[string]interface{}{"k": json.Number("1")}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			require.Equal(t, c.expected, datumValue(c.column, types.Datum{VarCharValue: c.value}))
+		})
+	}
+}
@@ -0,0 +1,30 @@
+query_runner "athena" "default" {
+  region          = "ap-northeast-1"
+  workgroup       = "primary"
+  database        = "default"
+  output_location = "s3://example-bucket/athena-results/"
+}
+
+query "access_logs" {
+  runner = query_runner.athena.default
+  sql    = "SELECT status, count(*) AS cnt FROM access_logs WHERE status >= ${var.min_status} GROUP BY 1"
+}
+
+query "access_logs_by_path" {
+  runner     = query_runner.athena.default
+  sql        = "SELECT status, count(*) AS cnt FROM access_logs WHERE path = :path AND status >= :min_status GROUP BY 1"
+  parameters = {
+    path       = var.path
+    min_status = var.min_status
+  }
+}
+
+query "access_logs_with_retry" {
+  runner = query_runner.athena.default
+  sql    = "SELECT status, count(*) AS cnt FROM access_logs GROUP BY 1"
+
+  retry {
+    max_attempts = 2
+    backoff      = "1ms"
+  }
+}
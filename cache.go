@@ -0,0 +1,280 @@
+package queryrunner
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+)
+
+func init() {
+	// values in rows are stored as interface{}, so that the concrete types must be registered.
+	gob.Register(json.Number(""))
+	gob.Register(time.Time{})
+	gob.Register(map[string]interface{}{})
+	gob.Register([]interface{}{})
+}
+
+// CacheStorage stores cached query results.
+// implement this interface to store the cache in other places, such as S3 or DynamoDB.
+type CacheStorage interface {
+	// Get returns the value of key, the second return value is false if the key is not found or expired.
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+}
+
+// MemoryCacheStorage is CacheStorage in process memory.
+type MemoryCacheStorage struct {
+	mu      sync.Mutex
+	entries map[string]memoryCacheEntry
+}
+
+type memoryCacheEntry struct {
+	value     []byte
+	expiresAt time.Time
+}
+
+func NewMemoryCacheStorage() *MemoryCacheStorage {
+	return &MemoryCacheStorage{
+		entries: make(map[string]memoryCacheEntry),
+	}
+}
+
+func (s *MemoryCacheStorage) Get(_ context.Context, key string) ([]byte, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+	if !time.Now().Before(entry.expiresAt) {
+		delete(s.entries, key)
+		return nil, false, nil
+	}
+	return entry.value, true, nil
+}
+
+func (s *MemoryCacheStorage) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for k, entry := range s.entries {
+		if !now.Before(entry.expiresAt) {
+			delete(s.entries, k)
+		}
+	}
+	s.entries[key] = memoryCacheEntry{
+		value:     value,
+		expiresAt: now.Add(ttl),
+	}
+	return nil
+}
+
+// FileCacheStorage is CacheStorage in local filesystem, each key is stored as a file in the directory.
+type FileCacheStorage struct {
+	dir string
+}
+
+func NewFileCacheStorage(dir string) *FileCacheStorage {
+	return &FileCacheStorage{
+		dir: dir,
+	}
+}
+
+func (s *FileCacheStorage) Get(_ context.Context, key string) ([]byte, bool, error) {
+	bs, err := os.ReadFile(filepath.Join(s.dir, key))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+	// the first 8 bytes is the expiration time in unix nano.
+	if len(bs) < 8 {
+		return nil, false, nil
+	}
+	expiresAt := time.Unix(0, int64(binary.BigEndian.Uint64(bs[:8])))
+	if !time.Now().Before(expiresAt) {
+		return nil, false, nil
+	}
+	return bs[8:], true, nil
+}
+
+func (s *FileCacheStorage) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(s.dir, key+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	var header [8]byte
+	binary.BigEndian.PutUint64(header[:], uint64(time.Now().Add(ttl).UnixNano()))
+	if _, err := tmp.Write(header[:]); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(value); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(s.dir, key))
+}
+
+// decodeCacheBlock decodes `cache` block in query block.
+func decodeCacheBlock(block *hcl.Block, ctx *hcl.EvalContext) (time.Duration, hcl.Diagnostics) {
+	content, diags := block.Body.Content(&hcl.BodySchema{
+		Attributes: []hcl.AttributeSchema{
+			{
+				Name:     "ttl",
+				Required: true,
+			},
+		},
+	})
+	if diags.HasErrors() {
+		return 0, diags
+	}
+	attr := content.Attributes["ttl"]
+	value, valueDiags := attr.Expr.Value(ctx)
+	diags = append(diags, valueDiags...)
+	if valueDiags.HasErrors() {
+		return 0, diags
+	}
+	if !value.IsKnown() || value.IsNull() || value.Type() != cty.String {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid cache ttl",
+			Detail:   `ttl is not string, please write as ttl = "5m"`,
+			Subject:  attr.Expr.Range().Ptr(),
+		})
+		return 0, diags
+	}
+	ttl, err := time.ParseDuration(value.AsString())
+	if err != nil || ttl <= 0 {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid cache ttl",
+			Detail:   fmt.Sprintf("ttl must be a positive duration, e.g. \"5m\": %q", value.AsString()),
+			Subject:  attr.Expr.Range().Ptr(),
+		})
+		return 0, diags
+	}
+	return ttl, diags
+}
+
+type cacheable interface {
+	cacheTTL() time.Duration
+}
+
+// queryCache is the cache entry of a query run.
+type queryCache struct {
+	storage CacheStorage
+	key     string
+	ttl     time.Duration
+}
+
+// newQueryCache returns nil if the query is not configured to cache or can not be rendered.
+// the key is the hash of the rendered query, so that the runner, query name and rendered query text and parameters are taken into account.
+func newQueryCache(ctx context.Context, query PreparedQuery, variables map[string]cty.Value, functions map[string]function.Function) (*queryCache, error) {
+	c, ok := query.(cacheable)
+	if !ok || c.cacheTTL() <= 0 {
+		return nil, nil
+	}
+	renderer, ok := query.(Renderer)
+	if !ok {
+		log.Printf("[warn] query `%s` runner type `%s` does not support cache", query.Name(), query.RunnerType())
+		return nil, nil
+	}
+	rendered, err := renderer.Render(ctx, variables, functions)
+	if err != nil {
+		return nil, err
+	}
+	bs, err := json.Marshal(rendered)
+	if err != nil {
+		return nil, fmt.Errorf("marshal rendered query: %w", err)
+	}
+	hash := sha256.Sum256(bs)
+	return &queryCache{
+		storage: GetCacheStorage(ctx),
+		key:     hex.EncodeToString(hash[:]),
+		ttl:     c.cacheTTL(),
+	}, nil
+}
+
+// Load returns the cached query result, errors of the storage are logged and treated as cache miss.
+func (c *queryCache) Load(ctx context.Context) (*QueryResult, bool) {
+	reqID := GetRequestID(ctx)
+	bs, ok, err := c.storage.Get(ctx, c.key)
+	if err != nil {
+		log.Printf("[warn][%s] get query result cache `%s`: %v", reqID, c.key, err)
+		return nil, false
+	}
+	if !ok {
+		log.Printf("[debug][%s] query result cache miss `%s`", reqID, c.key)
+		return nil, false
+	}
+	var result QueryResult
+	if err := gob.NewDecoder(bytes.NewReader(bs)).Decode(&result); err != nil {
+		log.Printf("[warn][%s] decode query result cache `%s`: %v", reqID, c.key, err)
+		return nil, false
+	}
+	if result.Columns == nil {
+		result.Columns = make(Columns, 0)
+	}
+	if result.Rows == nil {
+		result.Rows = make([][]interface{}, 0)
+	}
+	log.Printf("[info][%s] query result cache hit `%s`", reqID, result.Name)
+	return &result, true
+}
+
+// Store stores the query result, errors of the storage are logged.
+func (c *queryCache) Store(ctx context.Context, result *QueryResult) {
+	reqID := GetRequestID(ctx)
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(result); err != nil {
+		log.Printf("[warn][%s] encode query result cache `%s`: %v", reqID, c.key, err)
+		return
+	}
+	if err := c.storage.Set(ctx, c.key, buf.Bytes(), c.ttl); err != nil {
+		log.Printf("[warn][%s] set query result cache `%s`: %v", reqID, c.key, err)
+	}
+}
+
+// teeRowWriter writes rows to both writers.
+type teeRowWriter struct {
+	w   RowWriter
+	tee RowWriter
+}
+
+func (w *teeRowWriter) WriteColumns(columns Columns) error {
+	if err := w.tee.WriteColumns(columns); err != nil {
+		return err
+	}
+	return w.w.WriteColumns(columns)
+}
+
+func (w *teeRowWriter) WriteRow(row []interface{}) error {
+	if err := w.tee.WriteRow(row); err != nil {
+		return err
+	}
+	return w.w.WriteRow(row)
+}
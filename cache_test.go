@@ -0,0 +1,171 @@
+package queryrunner_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/gohcl"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/mashiike/queryrunner"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+)
+
+type countingQueryRunner struct {
+	name  string
+	count int
+}
+
+func (r *countingQueryRunner) Name() string {
+	return r.name
+}
+
+func (r *countingQueryRunner) Type() string {
+	return "counting"
+}
+
+func (r *countingQueryRunner) Prepare(base *queryrunner.QueryBase) (queryrunner.PreparedQuery, hcl.Diagnostics) {
+	q := &countingPreparedQuery{
+		QueryBase: base,
+		runner:    r,
+	}
+	diags := gohcl.DecodeBody(base.Remain(), base.NewEvalContext(nil, nil), q)
+	return q, diags
+}
+
+type countingPreparedQuery struct {
+	*queryrunner.QueryBase
+	runner *countingQueryRunner
+
+	Query hcl.Expression `hcl:"query"`
+}
+
+func (q *countingPreparedQuery) render(variables map[string]cty.Value, functions map[string]function.Function) (string, error) {
+	var query string
+	diags := gohcl.DecodeExpression(q.Query, q.NewEvalContext(variables, functions), &query)
+	if diags.HasErrors() {
+		return "", diags
+	}
+	return query, nil
+}
+
+func (q *countingPreparedQuery) Render(ctx context.Context, variables map[string]cty.Value, functions map[string]function.Function) (*queryrunner.RenderedQuery, error) {
+	query, err := q.render(variables, functions)
+	if err != nil {
+		return nil, err
+	}
+	return q.NewRenderedQuery(query, nil), nil
+}
+
+func (q *countingPreparedQuery) Run(ctx context.Context, variables map[string]cty.Value, functions map[string]function.Function) (*queryrunner.QueryResult, error) {
+	query, err := q.render(variables, functions)
+	if err != nil {
+		return nil, err
+	}
+	q.runner.count++
+	return queryrunner.NewQueryResultWithColumns(q.Name(), query, queryrunner.Columns{
+		{Name: "count", Type: queryrunner.ColumnTypeInteger},
+		{Name: "at", Type: queryrunner.ColumnTypeTimestamp},
+		{Name: "value", Type: queryrunner.ColumnTypeJSON, Nullable: true},
+	}, [][]interface{}{
+		{int64(q.runner.count), time.Date(2023, 4, 1, 0, 0, 0, 0, time.UTC), map[string]interface{}{"query": query}},
+		{int64(q.runner.count), time.Date(2023, 4, 1, 0, 0, 0, 0, time.UTC), nil},
+	}), nil
+}
+
+func loadCountingQuery(t *testing.T) (queryrunner.PreparedQuery, *countingQueryRunner) {
+	t.Helper()
+	runner := &countingQueryRunner{}
+	err := queryrunner.Register(&queryrunner.QueryRunnerDefinition{
+		TypeName: "counting",
+		BuildQueryRunnerFunc: func(name string, body hcl.Body, ctx *hcl.EvalContext) (queryrunner.QueryRunner, hcl.Diagnostics) {
+			runner.name = name
+			return runner, nil
+		},
+	})
+	require.NoError(t, err)
+	parser := hclparse.NewParser()
+	file, diags := parser.ParseHCL([]byte(`
+	query_runner "counting" "default" {}
+
+	query "cached" {
+		runner = query_runner.counting.default
+		query  = "SELECT ${var.id}"
+		cache {
+			ttl = "1m"
+		}
+	}
+	`), "config.hcl")
+	require.False(t, diags.HasErrors())
+	queries, _, diags := queryrunner.DecodeBody(file.Body, &hcl.EvalContext{})
+	require.False(t, diags.HasErrors(), diags.Error())
+	query, ok := queries.Get("cached")
+	require.True(t, ok)
+	return query, runner
+}
+
+func TestRunQueryCache(t *testing.T) {
+	storages := map[string]queryrunner.CacheStorage{
+		"memory": queryrunner.NewMemoryCacheStorage(),
+		"file":   queryrunner.NewFileCacheStorage(t.TempDir()),
+	}
+	for name, storage := range storages {
+		t.Run(name, func(t *testing.T) {
+			query, runner := loadCountingQuery(t)
+			ctx := queryrunner.WithCacheStorage(context.Background(), storage)
+			variables := func(id int64) map[string]cty.Value {
+				return map[string]cty.Value{
+					"var": cty.ObjectVal(map[string]cty.Value{
+						"id": cty.NumberIntVal(id),
+					}),
+				}
+			}
+			first, err := queryrunner.RunQuery(ctx, query, variables(1), nil)
+			require.NoError(t, err)
+			second, err := queryrunner.RunQuery(ctx, query, variables(1), nil)
+			require.NoError(t, err)
+			require.Equal(t, 1, runner.count)
+			require.EqualValues(t, first, second)
+
+			var builder strings.Builder
+			_, err = queryrunner.StreamQuery(ctx, query, variables(1), nil, queryrunner.NewJSONLinesRowWriter(&builder))
+			require.NoError(t, err)
+			require.Equal(t, 1, runner.count)
+			require.Equal(t, `{"at":"2023-04-01T00:00:00Z","count":1,"value":{"query":"SELECT 1"}}`+"\n"+`{"at":"2023-04-01T00:00:00Z","count":1,"value":null}`+"\n", builder.String())
+
+			third, err := queryrunner.RunQuery(ctx, query, variables(2), nil)
+			require.NoError(t, err)
+			require.Equal(t, 2, runner.count)
+			require.Equal(t, "SELECT 2", third.Query)
+		})
+	}
+}
+
+func TestCacheStorageExpire(t *testing.T) {
+	storages := map[string]queryrunner.CacheStorage{
+		"memory": queryrunner.NewMemoryCacheStorage(),
+		"file":   queryrunner.NewFileCacheStorage(t.TempDir()),
+	}
+	for name, storage := range storages {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			require.NoError(t, storage.Set(ctx, "alive", []byte("hoge"), time.Minute))
+			require.NoError(t, storage.Set(ctx, "expired", []byte("fuga"), time.Nanosecond))
+			time.Sleep(time.Millisecond)
+			value, ok, err := storage.Get(ctx, "alive")
+			require.NoError(t, err)
+			require.True(t, ok)
+			require.Equal(t, []byte("hoge"), value)
+			_, ok, err = storage.Get(ctx, "expired")
+			require.NoError(t, err)
+			require.False(t, ok)
+			_, ok, err = storage.Get(ctx, "not_found")
+			require.NoError(t, err)
+			require.False(t, ok)
+		})
+	}
+}
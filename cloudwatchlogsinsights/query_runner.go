@@ -15,7 +15,6 @@ import (
 	"github.com/dustin/go-humanize"
 	"github.com/hashicorp/hcl/v2"
 	"github.com/hashicorp/hcl/v2/gohcl"
-	"github.com/hashicorp/hcl/v2/hclsyntax"
 	"github.com/mashiike/queryrunner"
 	"github.com/samber/lo"
 	"github.com/zclconf/go-cty/cty"
@@ -35,10 +34,15 @@ func init() {
 }
 
 func BuildQueryRunner(name string, body hcl.Body, ctx *hcl.EvalContext) (queryrunner.QueryRunner, hcl.Diagnostics) {
+	waiterSettings, body, diags := queryrunner.DecodeWaiterSettings(body, ctx)
+	retryPolicy, body, retryDiags := queryrunner.DecodeRetryPolicy(body, ctx)
+	diags = append(diags, retryDiags...)
 	queryRunner := &QueryRunner{
-		name: name,
+		name:           name,
+		waiterSettings: waiterSettings,
+		retryPolicy:    retryPolicy,
 	}
-	diags := gohcl.DecodeBody(body, ctx, queryRunner)
+	diags = append(diags, gohcl.DecodeBody(body, ctx, queryRunner)...)
 	if diags.HasErrors() {
 		return nil, diags
 	}
@@ -64,9 +68,11 @@ func (r *QueryRunner) Type() string {
 }
 
 type QueryRunner struct {
-	client *cloudwatchlogs.Client
-	name   string
-	Region *string `hcl:"region"`
+	client         *cloudwatchlogs.Client
+	name           string
+	waiterSettings queryrunner.WaiterSettings
+	retryPolicy    queryrunner.RetryPolicy
+	Region         *string `hcl:"region"`
 }
 
 type PreparedQuery struct {
@@ -88,9 +94,17 @@ func (r *QueryRunner) Prepare(base *queryrunner.QueryBase) (queryrunner.Prepared
 		QueryBase: base,
 		runner:    r,
 	}
-	body := base.Remain()
 	ctx := base.NewEvalContext(nil, nil)
-	diags := gohcl.DecodeBody(body, ctx, q)
+	body, diags := base.DecodeWaiterSettings(ctx)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	body, retryDiags := base.DecodeRetryPolicy(body, ctx)
+	diags = append(diags, retryDiags...)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	diags = append(diags, gohcl.DecodeBody(body, ctx, q)...)
 	if diags.HasErrors() {
 		return nil, diags
 	}
@@ -113,22 +127,72 @@ func (r *QueryRunner) Prepare(base *queryrunner.QueryBase) (queryrunner.Prepared
 			Subject:  q.LogGroupNames.Range().Ptr(),
 		})
 	}
-	startTimeValue, _ := q.StartTime.Value(ctx)
-	if startTimeValue.IsKnown() && startTimeValue.IsNull() {
-		var parseDiags hcl.Diagnostics
-		q.StartTime, parseDiags = hclsyntax.ParseExpression([]byte(`now() - duration("15m")`), "default_start_time.hcl", hcl.InitialPos)
-		diags = append(diags, parseDiags...)
-	}
-	endTimeValue, _ := q.EndTime.Value(ctx)
-	if endTimeValue.IsKnown() && endTimeValue.IsNull() {
-		var parseDiags hcl.Diagnostics
-		q.EndTime, parseDiags = hclsyntax.ParseExpression([]byte(`now()`), "default_end_time.hcl", hcl.InitialPos)
-		diags = append(diags, parseDiags...)
-	}
+	var timeRangeDiags hcl.Diagnostics
+	q.StartTime, q.EndTime, timeRangeDiags = queryrunner.DefaultTimeRange(q.StartTime, q.EndTime, ctx)
+	diags = append(diags, timeRangeDiags...)
 	return q, diags
 }
 
 func (q *PreparedQuery) Run(ctx context.Context, variables map[string]cty.Value, functions map[string]function.Function) (*queryrunner.QueryResult, error) {
+	return queryrunner.CollectStream(ctx, q, variables, functions)
+}
+
+func (q *PreparedQuery) Stream(ctx context.Context, variables map[string]cty.Value, functions map[string]function.Function, w queryrunner.RowWriter) (*queryrunner.QueryResult, error) {
+	ctx = queryrunner.WithWaiterSettings(ctx, q.WaiterSettings())
+	params, err := q.render(variables, functions)
+	if err != nil {
+		return nil, err
+	}
+	return q.runner.RunQuery(ctx, q.Name(), params, q.IgnoreFields, w)
+}
+
+// Start starts the query and returns the handle without waiting for the result.
+func (q *PreparedQuery) Start(ctx context.Context, variables map[string]cty.Value, functions map[string]function.Function) (*queryrunner.QueryHandle, error) {
+	params, err := q.render(variables, functions)
+	if err != nil {
+		return nil, err
+	}
+	queryID, err := q.runner.StartQuery(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	return q.NewQueryHandle(queryID, *params.QueryString), nil
+}
+
+func (q *PreparedQuery) Status(ctx context.Context, handle *queryrunner.QueryHandle) (queryrunner.QueryStatus, string, error) {
+	return q.runner.QueryStatus(ctx, handle.ID)
+}
+
+func (q *PreparedQuery) Fetch(ctx context.Context, handle *queryrunner.QueryHandle, w queryrunner.RowWriter) (*queryrunner.QueryResult, error) {
+	ctx = queryrunner.WithWaiterSettings(ctx, q.WaiterSettings())
+	return q.runner.FetchQuery(ctx, q.Name(), handle.Query, handle.ID, q.IgnoreFields, w)
+}
+
+// Render returns the query string and the time range sent to CloudWatch Logs Insights without running it.
+func (q *PreparedQuery) Render(ctx context.Context, variables map[string]cty.Value, functions map[string]function.Function) (*queryrunner.RenderedQuery, error) {
+	params, err := q.render(variables, functions)
+	if err != nil {
+		return nil, err
+	}
+	logGroupNames := params.LogGroupNames
+	if params.LogGroupName != nil {
+		logGroupNames = []string{*params.LogGroupName}
+	}
+	attributes := map[string]interface{}{
+		"log_group_names": logGroupNames,
+		"start_time":      aws.ToInt64(params.StartTime),
+		"end_time":        aws.ToInt64(params.EndTime),
+	}
+	if params.Limit != nil {
+		attributes["limit"] = *params.Limit
+	}
+	if len(q.IgnoreFields) > 0 {
+		attributes["ignore_fields"] = q.IgnoreFields
+	}
+	return q.NewRenderedQuery(aws.ToString(params.QueryString), attributes), nil
+}
+
+func (q *PreparedQuery) render(variables map[string]cty.Value, functions map[string]function.Function) (*cloudwatchlogs.StartQueryInput, error) {
 	evalCtx := q.NewEvalContext(variables, functions)
 	queryValue, diags := q.Query.Value(evalCtx)
 	if diags.HasErrors() {
@@ -163,55 +227,10 @@ func (q *PreparedQuery) Run(ctx context.Context, variables map[string]cty.Value,
 		return nil, diags
 	}
 
-	startTimeValue, diags := q.StartTime.Value(evalCtx)
-	if diags.HasErrors() {
-		return nil, diags
-	}
-	if !startTimeValue.IsKnown() {
-		diags = append(diags, &hcl.Diagnostic{
-			Severity: hcl.DiagError,
-			Summary:  "Invalid start_time template",
-			Detail:   "start_time is unknown",
-			Subject:  q.StartTime.Range().Ptr(),
-		})
-		return nil, diags
-	}
-	if startTimeValue.Type() != cty.Number {
-		diags = append(diags, &hcl.Diagnostic{
-			Severity: hcl.DiagError,
-			Summary:  "Invalid start_time template",
-			Detail:   "start_time is not number",
-			Subject:  q.StartTime.Range().Ptr(),
-		})
-		return nil, diags
-	}
-	startTimeEpoch, _ := startTimeValue.AsBigFloat().Float64()
-	startTime := time.Unix(0, int64(startTimeEpoch*float64(time.Second)))
-
-	endTimeValue, diags := q.EndTime.Value(evalCtx)
+	startTime, endTime, diags := queryrunner.EvaluateTimeRange(q.StartTime, q.EndTime, evalCtx)
 	if diags.HasErrors() {
 		return nil, diags
 	}
-	if !endTimeValue.IsKnown() {
-		diags = append(diags, &hcl.Diagnostic{
-			Severity: hcl.DiagError,
-			Summary:  "Invalid end_time template",
-			Detail:   "end_time is unknown",
-			Subject:  q.EndTime.Range().Ptr(),
-		})
-		return nil, diags
-	}
-	if endTimeValue.Type() != cty.Number {
-		diags = append(diags, &hcl.Diagnostic{
-			Severity: hcl.DiagError,
-			Summary:  "Invalid end_time template",
-			Detail:   "end_time is not number",
-			Subject:  q.EndTime.Range().Ptr(),
-		})
-		return nil, diags
-	}
-	endTimeEpoch, _ := endTimeValue.AsBigFloat().Float64()
-	endTime := time.Unix(0, int64(endTimeEpoch*float64(time.Second)))
 
 	params := &cloudwatchlogs.StartQueryInput{
 		StartTime:   aws.Int64(startTime.Unix()),
@@ -254,14 +273,24 @@ func (q *PreparedQuery) Run(ctx context.Context, variables map[string]cty.Value,
 		})
 	}
 
-	return q.runner.RunQuery(ctx, q.Name(), params, q.IgnoreFields)
+	return params, nil
+}
+
+// RunQuery starts query and writes result rows to w, returned QueryResult has no rows.
+func (r *QueryRunner) RunQuery(ctx context.Context, name string, params *cloudwatchlogs.StartQueryInput, ignoreFields []string, w queryrunner.RowWriter) (*queryrunner.QueryResult, error) {
+	queryID, err := r.StartQuery(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	return r.FetchQuery(ctx, name, *params.QueryString, queryID, ignoreFields, w)
 }
 
-func (r *QueryRunner) RunQuery(ctx context.Context, name string, params *cloudwatchlogs.StartQueryInput, ignoreFields []string) (*queryrunner.QueryResult, error) {
+// StartQuery starts query and returns the query ID without waiting for the result.
+func (r *QueryRunner) StartQuery(ctx context.Context, params *cloudwatchlogs.StartQueryInput) (string, error) {
 	reqID := queryrunner.GetRequestID(ctx)
 	startQueryOutput, err := r.client.StartQuery(ctx, params)
 	if err != nil {
-		return nil, fmt.Errorf("start_query: %w", err)
+		return "", fmt.Errorf("start_query: %w", err)
 	}
 	var logGroupNames string
 	if params.LogGroupName != nil {
@@ -273,9 +302,38 @@ func (r *QueryRunner) RunQuery(ctx context.Context, name string, params *cloudwa
 	log.Printf("[info][%s] start cloudwatch logs insights query to %s", reqID, logGroupNames)
 	log.Printf("[info][%s] time range: %s ~ %s", reqID, time.Unix(*params.StartTime, 0).In(time.Local), time.Unix(*params.EndTime, 0).In(time.Local))
 	log.Printf("[debug][%s] query string: %s", reqID, *params.QueryString)
+	return *startQueryOutput.QueryId, nil
+}
+
+// QueryStatus returns the status of the query.
+func (r *QueryRunner) QueryStatus(ctx context.Context, queryID string) (queryrunner.QueryStatus, string, error) {
+	var getQueryResultOutput *cloudwatchlogs.GetQueryResultsOutput
+	err := queryrunner.Retry(ctx, r.retryPolicy, func(ctx context.Context) error {
+		var err error
+		getQueryResultOutput, err = r.client.GetQueryResults(ctx, &cloudwatchlogs.GetQueryResultsInput{
+			QueryId: aws.String(queryID),
+		})
+		return err
+	})
+	if err != nil {
+		return "", "", fmt.Errorf("get query results:%w", err)
+	}
+	switch getQueryResultOutput.Status {
+	case types.QueryStatusRunning, types.QueryStatusScheduled:
+		return queryrunner.QueryStatusRunning, "", nil
+	case types.QueryStatusComplete:
+		return queryrunner.QueryStatusSucceeded, "", nil
+	default:
+		return queryrunner.QueryStatusFailed, fmt.Sprintf("query status is %s", getQueryResultOutput.Status), nil
+	}
+}
+
+// FetchQuery waits for the query and writes result rows to w, returned QueryResult has no rows.
+func (r *QueryRunner) FetchQuery(ctx context.Context, name string, queryString string, queryID string, ignoreFields []string, w queryrunner.RowWriter) (*queryrunner.QueryResult, error) {
+	reqID := queryrunner.GetRequestID(ctx)
 	queryStart := time.Now()
 	getQueryResultOutput, err := r.waitQueryResult(ctx, queryStart, &cloudwatchlogs.GetQueryResultsInput{
-		QueryId: startQueryOutput.QueryId,
+		QueryId: aws.String(queryID),
 	})
 	if err != nil {
 		return nil, err
@@ -287,42 +345,56 @@ func (r *QueryRunner) RunQuery(ctx context.Context, name string, params *cloudwa
 		getQueryResultOutput.Statistics.RecordsMatched,
 		getQueryResultOutput.Statistics.RecordsScanned,
 	)
-	columnsMap := make(map[string]int)
-	rowsMap := make([]map[string]interface{}, 0, len(getQueryResultOutput.Results))
+	mw := queryrunner.NewRowMapWriter(w)
+	mw.TypeHints = map[string]queryrunner.ColumnType{
+		"@timestamp":     queryrunner.ColumnTypeTimestamp,
+		"@ingestionTime": queryrunner.ColumnTypeTimestamp,
+	}
 	ignoreFields = append([]string{"@ptr"}, ignoreFields...)
 	for _, results := range getQueryResultOutput.Results {
-		row := make(map[string]interface{}, len(results))
+		names := make([]string, 0, len(results))
+		values := make([]interface{}, 0, len(results))
 		for _, result := range results {
 			if lo.Contains(ignoreFields, *result.Field) {
 				continue
 			}
-			if _, ok := columnsMap[*result.Field]; !ok {
-				columnsMap[*result.Field] = len(columnsMap)
-			}
+			names = append(names, *result.Field)
 			if result.Value == nil {
-				row[*result.Field] = ""
+				values = append(values, nil)
 			} else {
-				row[*result.Field] = *result.Value
+				values = append(values, *result.Value)
 			}
 		}
-		rowsMap = append(rowsMap, row)
+		if err := mw.WriteFields(names, values); err != nil {
+			return nil, fmt.Errorf("write row:%w", err)
+		}
 	}
-	return queryrunner.NewQueryResultWithRowsMap(name, *params.QueryString, columnsMap, rowsMap), nil
+	queryResult := queryrunner.NewQueryResultWithColumns(name, queryString, mw.Columns(), nil)
+	queryResult.Stats = &queryrunner.Stats{
+		QueryID: queryID,
+	}
+	if s := getQueryResultOutput.Statistics; s != nil {
+		queryResult.Stats.BytesScanned = int64(s.BytesScanned)
+		queryResult.Stats.Extra = map[string]interface{}{
+			"records_matched": s.RecordsMatched,
+			"records_scanned": s.RecordsScanned,
+		}
+	}
+	return queryResult, nil
 }
 
 func (r *QueryRunner) waitQueryResult(ctx context.Context, queryStart time.Time, params *cloudwatchlogs.GetQueryResultsInput) (*cloudwatchlogs.GetQueryResultsOutput, error) {
 	reqID := queryrunner.GetRequestID(ctx)
-	waiter := &queryrunner.Waiter{
-		StartTime: queryStart,
-		MinDelay:  100 * time.Microsecond,
-		MaxDelay:  5 * time.Second,
-		Timeout:   15 * time.Minute,
-		Jitter:    200 * time.Millisecond,
-	}
+	waiter := queryrunner.NewWaiter(ctx, r.waiterSettings)
 	for waiter.Continue(ctx) {
 		elapsedTime := time.Since(queryStart)
 		log.Printf("[debug][%s] wating cloudwatch logs insights query elapsed_time=%s", reqID, elapsedTime)
-		getQueryResultOutput, err := r.client.GetQueryResults(ctx, params)
+		var getQueryResultOutput *cloudwatchlogs.GetQueryResultsOutput
+		err := queryrunner.Retry(ctx, r.retryPolicy, func(ctx context.Context) error {
+			var err error
+			getQueryResultOutput, err = r.client.GetQueryResults(ctx, params)
+			return err
+		})
 		if err != nil {
 			return nil, fmt.Errorf("get query results:%w", err)
 		}
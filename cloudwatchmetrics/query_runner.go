@@ -0,0 +1,472 @@
+package cloudwatchmetrics
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/gohcl"
+	"github.com/mashiike/queryrunner"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+)
+
+const TypeName = "cloudwatch_metrics"
+
+// DefaultPeriod is the period in seconds of the data points when `period` attribute is omitted.
+const DefaultPeriod = 60
+
+// insightsQueryID is the id of the metric data query for the Metrics Insights `query` attribute.
+const insightsQueryID = "q"
+
+func init() {
+	err := queryrunner.Register(&queryrunner.QueryRunnerDefinition{
+		TypeName:             TypeName,
+		BuildQueryRunnerFunc: BuildQueryRunner,
+	})
+	if err != nil {
+		panic(fmt.Errorf("register cloudwatch_metrics query runner:%w", err))
+	}
+}
+
+// Client is the subset of CloudWatch API used by the query runner.
+type Client interface {
+	GetMetricData(ctx context.Context, params *cloudwatch.GetMetricDataInput, optFns ...func(*cloudwatch.Options)) (*cloudwatch.GetMetricDataOutput, error)
+}
+
+func BuildQueryRunner(name string, body hcl.Body, ctx *hcl.EvalContext) (queryrunner.QueryRunner, hcl.Diagnostics) {
+	retryPolicy, body, diags := queryrunner.DecodeRetryPolicy(body, ctx)
+	queryRunner := &QueryRunner{
+		name:        name,
+		retryPolicy: retryPolicy,
+	}
+	diags = append(diags, gohcl.DecodeBody(body, ctx, queryRunner)...)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	optFns := make([]func(*config.LoadOptions) error, 0)
+	if queryRunner.Region != nil {
+		optFns = append(optFns, config.WithRegion(*queryRunner.Region))
+	}
+	awsCfg, err := config.LoadDefaultConfig(context.Background(), optFns...)
+	if err != nil {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "initialize aws client",
+			Detail:   fmt.Sprintf("failed load aws default config:%v", err),
+			Subject:  body.MissingItemRange().Ptr(),
+		})
+		return nil, diags
+	}
+	queryRunner.client = cloudwatch.NewFromConfig(awsCfg)
+	return queryRunner, diags
+}
+
+type QueryRunner struct {
+	client      Client
+	name        string
+	retryPolicy queryrunner.RetryPolicy
+
+	Region *string `hcl:"region"`
+}
+
+func (r *QueryRunner) Name() string {
+	return r.name
+}
+
+func (r *QueryRunner) Type() string {
+	return TypeName
+}
+
+type PreparedQuery struct {
+	*queryrunner.QueryBase
+	runner *QueryRunner
+
+	StartTime     hcl.Expression `hcl:"start_time"`
+	EndTime       hcl.Expression `hcl:"end_time"`
+	Query         hcl.Expression `hcl:"query"`
+	Period        *int32         `hcl:"period"`
+	MaxDatapoints *int32         `hcl:"max_datapoints"`
+
+	MetricDataQueries []*MetricDataQuery `hcl:"metric_data_query,block"`
+}
+
+// MetricDataQuery is `metric_data_query` block, the label of the block is the id of the metric data query.
+// Either `expression` or the metric of `namespace`, `metric_name` and `stat` is required.
+type MetricDataQuery struct {
+	ID         string         `hcl:"id,label"`
+	Expression hcl.Expression `hcl:"expression"`
+	Label      hcl.Expression `hcl:"label"`
+	Namespace  *string        `hcl:"namespace"`
+	MetricName *string        `hcl:"metric_name"`
+	Dimensions hcl.Expression `hcl:"dimensions"`
+	Stat       *string        `hcl:"stat"`
+	Unit       *string        `hcl:"unit"`
+	Period     *int32         `hcl:"period"`
+	ReturnData *bool          `hcl:"return_data"`
+}
+
+func (r *QueryRunner) Prepare(base *queryrunner.QueryBase) (queryrunner.PreparedQuery, hcl.Diagnostics) {
+	log.Printf("[debug] prepare `%s` with cloudwatch_metrics query_runner", base.Name())
+	q := &PreparedQuery{
+		QueryBase: base,
+		runner:    r,
+	}
+	ctx := base.NewEvalContext(nil, nil)
+	body, diags := base.DecodeRetryPolicy(base.Remain(), ctx)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	diags = append(diags, gohcl.DecodeBody(body, ctx, q)...)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	queryValue, _ := q.Query.Value(ctx)
+	hasQuery := !queryValue.IsKnown() || !queryValue.IsNull()
+	if hasQuery && len(q.MetricDataQueries) > 0 {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid query",
+			Detail:   "query attribute and metric_data_query block are exclusive",
+			Subject:  q.Query.Range().Ptr(),
+		})
+	}
+	if !hasQuery && len(q.MetricDataQueries) == 0 {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid query",
+			Detail:   "required query attribute or metric_data_query block",
+			Subject:  body.MissingItemRange().Ptr(),
+		})
+	}
+	for _, m := range q.MetricDataQueries {
+		diags = append(diags, m.validate(ctx)...)
+	}
+	var timeRangeDiags hcl.Diagnostics
+	q.StartTime, q.EndTime, timeRangeDiags = queryrunner.DefaultTimeRange(q.StartTime, q.EndTime, ctx)
+	diags = append(diags, timeRangeDiags...)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	return q, diags
+}
+
+func (m *MetricDataQuery) validate(ctx *hcl.EvalContext) hcl.Diagnostics {
+	var diags hcl.Diagnostics
+	expressionValue, _ := m.Expression.Value(ctx)
+	hasExpression := !expressionValue.IsKnown() || !expressionValue.IsNull()
+	hasMetric := m.Namespace != nil || m.MetricName != nil || m.Stat != nil
+	if hasExpression && hasMetric {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid metric_data_query",
+			Detail:   "expression and namespace, metric_name, stat are exclusive",
+			Subject:  m.Expression.Range().Ptr(),
+		})
+		return diags
+	}
+	if !hasExpression && (m.Namespace == nil || m.MetricName == nil || m.Stat == nil) {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid metric_data_query",
+			Detail:   "required expression, or namespace, metric_name and stat",
+			Subject:  m.Expression.Range().Ptr(),
+		})
+	}
+	return diags
+}
+
+func (q *PreparedQuery) Run(ctx context.Context, variables map[string]cty.Value, functions map[string]function.Function) (*queryrunner.QueryResult, error) {
+	return queryrunner.CollectStream(ctx, q, variables, functions)
+}
+
+func (q *PreparedQuery) Stream(ctx context.Context, variables map[string]cty.Value, functions map[string]function.Function, w queryrunner.RowWriter) (*queryrunner.QueryResult, error) {
+	params, err := q.render(variables, functions)
+	if err != nil {
+		return nil, err
+	}
+	return q.runner.RunQuery(ctx, q.Name(), params, w)
+}
+
+// Render returns the metric data queries and the time range sent to CloudWatch without running it.
+func (q *PreparedQuery) Render(ctx context.Context, variables map[string]cty.Value, functions map[string]function.Function) (*queryrunner.RenderedQuery, error) {
+	params, err := q.render(variables, functions)
+	if err != nil {
+		return nil, err
+	}
+	attributes := map[string]interface{}{
+		"start_time": aws.ToTime(params.StartTime).Unix(),
+		"end_time":   aws.ToTime(params.EndTime).Unix(),
+	}
+	if params.MaxDatapoints != nil {
+		attributes["max_datapoints"] = *params.MaxDatapoints
+	}
+	return q.NewRenderedQuery(queryString(params.MetricDataQueries), attributes), nil
+}
+
+func (q *PreparedQuery) period() int32 {
+	if q.Period != nil {
+		return *q.Period
+	}
+	return DefaultPeriod
+}
+
+func (q *PreparedQuery) render(variables map[string]cty.Value, functions map[string]function.Function) (*cloudwatch.GetMetricDataInput, error) {
+	evalCtx := q.NewEvalContext(variables, functions)
+	startTime, endTime, diags := queryrunner.EvaluateTimeRange(q.StartTime, q.EndTime, evalCtx)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	params := &cloudwatch.GetMetricDataInput{
+		StartTime:     aws.Time(startTime),
+		EndTime:       aws.Time(endTime),
+		MaxDatapoints: q.MaxDatapoints,
+		ScanBy:        types.ScanByTimestampAscending,
+	}
+	if len(q.MetricDataQueries) == 0 {
+		query, diags := evaluateString("query", q.Query, evalCtx)
+		if diags.HasErrors() {
+			return nil, diags
+		}
+		if query == "" {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid query template",
+				Detail:   "query is empty",
+				Subject:  q.Query.Range().Ptr(),
+			})
+			return nil, diags
+		}
+		params.MetricDataQueries = []types.MetricDataQuery{
+			{
+				Id:         aws.String(insightsQueryID),
+				Expression: aws.String(query),
+				Period:     aws.Int32(q.period()),
+			},
+		}
+		return params, nil
+	}
+	params.MetricDataQueries = make([]types.MetricDataQuery, 0, len(q.MetricDataQueries))
+	for _, m := range q.MetricDataQueries {
+		query, diags := m.render(evalCtx, q.period())
+		if diags.HasErrors() {
+			return nil, diags
+		}
+		params.MetricDataQueries = append(params.MetricDataQueries, query)
+	}
+	return params, nil
+}
+
+func (m *MetricDataQuery) render(evalCtx *hcl.EvalContext, defaultPeriod int32) (types.MetricDataQuery, hcl.Diagnostics) {
+	period := defaultPeriod
+	if m.Period != nil {
+		period = *m.Period
+	}
+	query := types.MetricDataQuery{
+		Id:         aws.String(m.ID),
+		ReturnData: m.ReturnData,
+	}
+	label, diags := evaluateOptionalString("label", m.Label, evalCtx)
+	if diags.HasErrors() {
+		return query, diags
+	}
+	query.Label = label
+	expression, diags := evaluateOptionalString("expression", m.Expression, evalCtx)
+	if diags.HasErrors() {
+		return query, diags
+	}
+	if expression != nil {
+		query.Expression = expression
+		query.Period = aws.Int32(period)
+		return query, nil
+	}
+	dimensions, diags := m.dimensions(evalCtx)
+	if diags.HasErrors() {
+		return query, diags
+	}
+	query.MetricStat = &types.MetricStat{
+		Metric: &types.Metric{
+			Namespace:  m.Namespace,
+			MetricName: m.MetricName,
+			Dimensions: dimensions,
+		},
+		Period: aws.Int32(period),
+		Stat:   m.Stat,
+	}
+	if m.Unit != nil {
+		query.MetricStat.Unit = types.StandardUnit(*m.Unit)
+	}
+	return query, nil
+}
+
+func (m *MetricDataQuery) dimensions(evalCtx *hcl.EvalContext) ([]types.Dimension, hcl.Diagnostics) {
+	value, diags := m.Dimensions.Value(evalCtx)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	if value.IsNull() {
+		return nil, nil
+	}
+	if !value.IsWhollyKnown() || !(value.Type().IsMapType() || value.Type().IsObjectType()) {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid dimensions",
+			Detail:   "dimensions must be a map of string",
+			Subject:  m.Dimensions.Range().Ptr(),
+		})
+		return nil, diags
+	}
+	dimensions := make([]types.Dimension, 0, value.LengthInt())
+	for name, v := range value.AsValueMap() {
+		if v.IsNull() || v.Type() != cty.String {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid dimensions",
+				Detail:   fmt.Sprintf("dimension `%s` is not string", name),
+				Subject:  m.Dimensions.Range().Ptr(),
+			})
+			return nil, diags
+		}
+		dimensions = append(dimensions, types.Dimension{
+			Name:  aws.String(name),
+			Value: aws.String(v.AsString()),
+		})
+	}
+	sort.Slice(dimensions, func(i, j int) bool {
+		return *dimensions[i].Name < *dimensions[j].Name
+	})
+	return dimensions, nil
+}
+
+func evaluateString(name string, expr hcl.Expression, evalCtx *hcl.EvalContext) (string, hcl.Diagnostics) {
+	value, diags := expr.Value(evalCtx)
+	if diags.HasErrors() {
+		return "", diags
+	}
+	if !value.IsKnown() || value.IsNull() || value.Type() != cty.String {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  fmt.Sprintf("Invalid %s template", name),
+			Detail:   fmt.Sprintf("%s is not string", name),
+			Subject:  expr.Range().Ptr(),
+		})
+		return "", diags
+	}
+	return value.AsString(), diags
+}
+
+func evaluateOptionalString(name string, expr hcl.Expression, evalCtx *hcl.EvalContext) (*string, hcl.Diagnostics) {
+	value, diags := expr.Value(evalCtx)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	if value.IsKnown() && value.IsNull() {
+		return nil, diags
+	}
+	str, diags := evaluateString(name, expr, evalCtx)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	return aws.String(str), diags
+}
+
+// queryString returns the human readable metric data queries, one query per line.
+func queryString(queries []types.MetricDataQuery) string {
+	if len(queries) == 1 && aws.ToString(queries[0].Id) == insightsQueryID && queries[0].Expression != nil {
+		return *queries[0].Expression
+	}
+	lines := make([]string, 0, len(queries))
+	for _, query := range queries {
+		if query.Expression != nil {
+			lines = append(lines, fmt.Sprintf("%s: %s", *query.Id, *query.Expression))
+			continue
+		}
+		metric := query.MetricStat.Metric
+		parts := []string{aws.ToString(metric.Namespace), aws.ToString(metric.MetricName), aws.ToString(query.MetricStat.Stat)}
+		for _, d := range metric.Dimensions {
+			parts = append(parts, fmt.Sprintf("%s=%s", aws.ToString(d.Name), aws.ToString(d.Value)))
+		}
+		lines = append(lines, fmt.Sprintf("%s: %s", *query.Id, strings.Join(parts, " ")))
+	}
+	return strings.Join(lines, "\n")
+}
+
+var columns = queryrunner.Columns{
+	{Name: "timestamp", Type: queryrunner.ColumnTypeTimestamp},
+	{Name: "label", Type: queryrunner.ColumnTypeString},
+	{Name: "value", Type: queryrunner.ColumnTypeFloat},
+}
+
+// RunQuery gets metric data and writes timestamp, label and value rows to w, returned QueryResult has no rows.
+func (r *QueryRunner) RunQuery(ctx context.Context, name string, params *cloudwatch.GetMetricDataInput, w queryrunner.RowWriter) (*queryrunner.QueryResult, error) {
+	reqID := queryrunner.GetRequestID(ctx)
+	query := queryString(params.MetricDataQueries)
+	log.Printf("[info][%s] start cloudwatch metrics query `%s`", reqID, name)
+	log.Printf("[info][%s] time range: %s ~ %s", reqID, params.StartTime.In(time.Local), params.EndTime.In(time.Local))
+	log.Printf("[debug][%s] query: %s", reqID, query)
+	queryStart := time.Now()
+	if err := w.WriteColumns(columns); err != nil {
+		return nil, fmt.Errorf("write columns:%w", err)
+	}
+	input := *params
+	pages, datapoints := 0, 0
+	partial := false
+	for {
+		var output *cloudwatch.GetMetricDataOutput
+		err := queryrunner.Retry(ctx, r.retryPolicy, func(ctx context.Context) error {
+			var err error
+			output, err = r.client.GetMetricData(ctx, &input)
+			return err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("get metric data:%w", err)
+		}
+		pages++
+		for _, m := range output.Messages {
+			log.Printf("[warn][%s] %s: %s", reqID, aws.ToString(m.Code), aws.ToString(m.Value))
+		}
+		for _, result := range output.MetricDataResults {
+			if result.StatusCode == types.StatusCodePartialData {
+				partial = true
+			}
+			label := aws.ToString(result.Label)
+			if label == "" {
+				label = aws.ToString(result.Id)
+			}
+			for i, ts := range result.Timestamps {
+				if i >= len(result.Values) {
+					break
+				}
+				if err := w.WriteRow([]interface{}{ts, label, result.Values[i]}); err != nil {
+					return nil, fmt.Errorf("write row:%w", err)
+				}
+				datapoints++
+			}
+		}
+		if output.NextToken == nil {
+			break
+		}
+		input.NextToken = output.NextToken
+	}
+	if partial {
+		log.Printf("[warn][%s] cloudwatch metrics query `%s` returned partial data", reqID, name)
+	}
+	log.Printf("[info][%s] success cloudwatch metrics query `%s`, elapsed_time=%s", reqID, name, time.Since(queryStart))
+	result := queryrunner.NewQueryResultWithColumns(name, query, columns, nil)
+	result.Stats = &queryrunner.Stats{
+		Extra: map[string]interface{}{
+			"pages":        pages,
+			"datapoints":   datapoints,
+			"partial_data": partial,
+		},
+	}
+	return result, nil
+}
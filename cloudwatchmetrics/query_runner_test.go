@@ -0,0 +1,175 @@
+package cloudwatchmetrics
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/mashiike/hclconfig"
+	"github.com/mashiike/queryrunner"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+type stubClient struct {
+	inputs []*cloudwatch.GetMetricDataInput
+	pages  []*cloudwatch.GetMetricDataOutput
+}
+
+func (c *stubClient) GetMetricData(ctx context.Context, params *cloudwatch.GetMetricDataInput, optFns ...func(*cloudwatch.Options)) (*cloudwatch.GetMetricDataOutput, error) {
+	input := *params
+	c.inputs = append(c.inputs, &input)
+	index := 0
+	if params.NextToken != nil {
+		index = len(*params.NextToken)
+	}
+	return c.pages[index], nil
+}
+
+func loadQuery(t *testing.T, name string, client Client) *PreparedQuery {
+	t.Helper()
+	parser := hclparse.NewParser()
+	file, diags := parser.ParseHCLFile("testdata/config.hcl")
+	require.False(t, diags.HasErrors())
+	queries, _, diags := queryrunner.DecodeBody(file.Body, hclconfig.NewEvalContext("./"))
+	if !assert.False(t, diags.HasErrors()) {
+		var builder strings.Builder
+		w := hcl.NewDiagnosticTextWriter(&builder, parser.Files(), 400, false)
+		w.WriteDiagnostics(diags)
+		t.Log(builder.String())
+		t.FailNow()
+	}
+	query, ok := queries.Get(name)
+	require.True(t, ok)
+	q, ok := query.(*PreparedQuery)
+	require.True(t, ok)
+	q.runner.client = client
+	return q
+}
+
+var testVariables = map[string]cty.Value{
+	"var": cty.ObjectVal(map[string]cty.Value{
+		"function_name": cty.StringVal("api"),
+	}),
+}
+
+func TestRunInsightsQuery(t *testing.T) {
+	t0 := time.Unix(1666224000, 0).UTC()
+	client := &stubClient{
+		pages: []*cloudwatch.GetMetricDataOutput{
+			{
+				MetricDataResults: []types.MetricDataResult{
+					{
+						Id:         aws.String("q"),
+						Label:      aws.String("api"),
+						Timestamps: []time.Time{t0, t0.Add(5 * time.Minute)},
+						Values:     []float64{1, 3},
+						StatusCode: types.StatusCodeComplete,
+					},
+				},
+				NextToken: aws.String("1"),
+			},
+			{
+				MetricDataResults: []types.MetricDataResult{
+					{
+						Id:         aws.String("q"),
+						Label:      aws.String("api"),
+						Timestamps: []time.Time{t0.Add(10 * time.Minute)},
+						Values:     []float64{2},
+						StatusCode: types.StatusCodeComplete,
+					},
+				},
+			},
+		},
+	}
+	q := loadQuery(t, "lambda_errors_insights", client)
+	result, err := q.Run(context.Background(), testVariables, nil)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(client.inputs))
+	input := client.inputs[0]
+	require.Equal(t, int64(1666224000), input.StartTime.Unix())
+	require.Equal(t, int64(1666224900), input.EndTime.Unix())
+	require.EqualValues(t, []types.MetricDataQuery{
+		{
+			Id:         aws.String("q"),
+			Expression: aws.String(`SELECT SUM(Errors) FROM SCHEMA("AWS/Lambda", FunctionName) WHERE FunctionName = 'api' GROUP BY FunctionName`),
+			Period:     aws.Int32(300),
+		},
+	}, input.MetricDataQueries)
+	require.Equal(t, "1", *client.inputs[1].NextToken)
+	require.EqualValues(t, []string{"timestamp", "label", "value"}, result.Columns.Names())
+	require.EqualValues(t, [][]interface{}{
+		{t0, "api", float64(1)},
+		{t0.Add(5 * time.Minute), "api", float64(3)},
+		{t0.Add(10 * time.Minute), "api", float64(2)},
+	}, result.Rows)
+	require.Equal(t, 2, result.Stats.Extra["pages"])
+}
+
+func TestRunMetricDataQueries(t *testing.T) {
+	t0 := time.Unix(1666224000, 0).UTC()
+	client := &stubClient{
+		pages: []*cloudwatch.GetMetricDataOutput{
+			{
+				MetricDataResults: []types.MetricDataResult{
+					{
+						Id:         aws.String("error_rate"),
+						Label:      aws.String("error rate of api"),
+						Timestamps: []time.Time{t0},
+						Values:     []float64{0.5},
+						StatusCode: types.StatusCodeComplete,
+					},
+				},
+			},
+		},
+	}
+	q := loadQuery(t, "lambda_error_rate", client)
+	result, err := q.Run(context.Background(), testVariables, nil)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(client.inputs))
+	dimensions := []types.Dimension{{Name: aws.String("FunctionName"), Value: aws.String("api")}}
+	require.EqualValues(t, []types.MetricDataQuery{
+		{
+			Id: aws.String("errors"),
+			MetricStat: &types.MetricStat{
+				Metric: &types.Metric{
+					Namespace:  aws.String("AWS/Lambda"),
+					MetricName: aws.String("Errors"),
+					Dimensions: dimensions,
+				},
+				Period: aws.Int32(DefaultPeriod),
+				Stat:   aws.String("Sum"),
+			},
+			ReturnData: aws.Bool(false),
+		},
+		{
+			Id: aws.String("invocations"),
+			MetricStat: &types.MetricStat{
+				Metric: &types.Metric{
+					Namespace:  aws.String("AWS/Lambda"),
+					MetricName: aws.String("Invocations"),
+					Dimensions: dimensions,
+				},
+				Period: aws.Int32(300),
+				Stat:   aws.String("Sum"),
+			},
+			ReturnData: aws.Bool(false),
+		},
+		{
+			Id:         aws.String("error_rate"),
+			Expression: aws.String("100 * errors / invocations"),
+			Label:      aws.String("error rate of api"),
+			Period:     aws.Int32(DefaultPeriod),
+		},
+	}, client.inputs[0].MetricDataQueries)
+	require.EqualValues(t, [][]interface{}{
+		{t0, "error rate of api", 0.5},
+	}, result.Rows)
+}
@@ -0,0 +1,43 @@
+query_runner "cloudwatch_metrics" "default" {
+  region = "ap-northeast-1"
+}
+
+query "lambda_errors_insights" {
+  runner     = query_runner.cloudwatch_metrics.default
+  start_time = 1666224000
+  end_time   = 1666224900
+  period     = 300
+  query      = "SELECT SUM(Errors) FROM SCHEMA(\"AWS/Lambda\", FunctionName) WHERE FunctionName = '${var.function_name}' GROUP BY FunctionName"
+}
+
+query "lambda_error_rate" {
+  runner     = query_runner.cloudwatch_metrics.default
+  start_time = 1666224000
+  end_time   = 1666224900
+
+  metric_data_query "errors" {
+    namespace   = "AWS/Lambda"
+    metric_name = "Errors"
+    stat        = "Sum"
+    dimensions = {
+      FunctionName = var.function_name
+    }
+    return_data = false
+  }
+
+  metric_data_query "invocations" {
+    namespace   = "AWS/Lambda"
+    metric_name = "Invocations"
+    stat        = "Sum"
+    period      = 300
+    dimensions = {
+      FunctionName = var.function_name
+    }
+    return_data = false
+  }
+
+  metric_data_query "error_rate" {
+    expression = "100 * errors / invocations"
+    label      = "error rate of ${var.function_name}"
+  }
+}
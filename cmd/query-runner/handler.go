@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/mashiike/hclconfig"
+	"github.com/mashiike/queryrunner"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// handle runs the queries of the payload, that is shared by Lambda handler and HTTP server.
+// when async is set, the queries are started and their job IDs are returned instead of the results.
+// when dry_run is set, the rendered queries are returned without running them.
+func handle(ctx context.Context, queries queryrunner.PreparedQueries, p *params) (*response, error) {
+	resp := &response{
+		Results: make(queryrunner.QueryResults, 0, len(p.Queries)+len(p.Fetch)),
+	}
+	if p.DryRun {
+		plans, err := queryrunner.PlanQueries(ctx, queries, p.Queries, p.MarshalCTYValues(), nil)
+		if err != nil {
+			return nil, err
+		}
+		resp.Plans = plans
+		return resp, nil
+	}
+	var results queryrunner.QueryResults
+	if p.Async {
+		for _, name := range p.Queries {
+			handle, err := queryrunner.StartQuery(ctx, queries, name, p.MarshalCTYValues(), nil)
+			if err != nil {
+				return nil, err
+			}
+			if resp.Jobs == nil {
+				resp.Jobs = make(map[string]string, len(p.Queries))
+			}
+			resp.Jobs[name] = handle.JobID()
+		}
+	} else if len(p.Queries) > 0 {
+		var err error
+		results, err = queryrunner.RunQueries(ctx, queries, p.Queries, p.MarshalCTYValues(), nil, func(opts *queryrunner.RunOptions) {
+			opts.ContinueOnError = p.ContinueOnError
+			opts.Parallelism = p.Parallelism
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, jobID := range p.Status {
+		status, err := getJobStatus(ctx, queries, jobID)
+		if err != nil {
+			return nil, err
+		}
+		if resp.Statuses == nil {
+			resp.Statuses = make(map[string]*jobStatus, len(p.Status))
+		}
+		resp.Statuses[jobID] = status
+	}
+	for _, jobID := range p.Fetch {
+		handle, err := queryrunner.ParseJobID(jobID)
+		if err != nil {
+			return nil, err
+		}
+		result, err := queryrunner.FetchQueryResult(ctx, queries, handle)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+	for _, result := range results {
+		if p.ContinueOnError {
+			if resp.Status == nil {
+				resp.Status = make(map[string]*queryState, len(results))
+			}
+			state := &queryState{
+				Status: queryrunner.QueryStatusSucceeded,
+			}
+			if result.Err != nil {
+				state.Status = queryrunner.QueryStatusFailed
+				state.Error = result.Err.Error()
+			}
+			resp.Status[result.Name] = state
+		}
+		if result.Err != nil {
+			continue
+		}
+		if result.Stats != nil {
+			if resp.Stats == nil {
+				resp.Stats = make(map[string]*queryrunner.Stats, len(results))
+			}
+			resp.Stats[result.Name] = result.Stats
+		}
+		if result.Output == nil && p.Output != nil {
+			output, err := p.Output.newOutput(result.Name)
+			if err != nil {
+				return nil, err
+			}
+			if err := queryrunner.WriteOutput(ctx, output, result); err != nil {
+				return nil, err
+			}
+			result.Output = output
+		}
+		if result.Output != nil {
+			if resp.Outputs == nil {
+				resp.Outputs = make(map[string]*queryrunner.Output)
+			}
+			resp.Outputs[result.Name] = result.Output
+			continue
+		}
+		resp.Results = append(resp.Results, result)
+	}
+	return resp, nil
+}
+
+// queryState is the status of the query run with continue_on_error.
+type queryState struct {
+	Status queryrunner.QueryStatus `json:"status"`
+	Error  string                  `json:"error,omitempty"`
+}
+
+// jobStatus is the status of the query started asynchronously.
+type jobStatus struct {
+	JobID   string                  `json:"job_id"`
+	Query   string                  `json:"query"`
+	Status  queryrunner.QueryStatus `json:"status"`
+	Message string                  `json:"message,omitempty"`
+}
+
+func getJobStatus(ctx context.Context, queries queryrunner.PreparedQueries, jobID string) (*jobStatus, error) {
+	handle, err := queryrunner.ParseJobID(jobID)
+	if err != nil {
+		return nil, err
+	}
+	status, message, err := queryrunner.GetQueryStatus(ctx, queries, handle)
+	if err != nil {
+		return nil, err
+	}
+	return &jobStatus{
+		JobID:   jobID,
+		Query:   handle.QueryName,
+		Status:  status,
+		Message: message,
+	}, nil
+}
+
+type params struct {
+	Queries   []string        `json:"queries"`
+	Variables json.RawMessage `json:"variables,omitempty"`
+	Output    *outputParams   `json:"output,omitempty"`
+	Async     bool            `json:"async,omitempty"`
+	Status    []string        `json:"status,omitempty"`
+	Fetch     []string        `json:"fetch,omitempty"`
+	// ContinueOnError keeps running the other queries when a query fails, the failure is returned in status of the response.
+	ContinueOnError bool `json:"continue_on_error,omitempty"`
+	// Parallelism is the maximum number of the queries running at once, 0 is unlimited.
+	Parallelism int `json:"parallelism,omitempty"`
+	// DryRun renders the queries and returns them in plans of the response without running them.
+	DryRun bool `json:"dry_run,omitempty"`
+
+	once  sync.Once
+	cache map[string]cty.Value
+}
+
+func (p *params) MarshalCTYValues() map[string]cty.Value {
+	p.once.Do(func() {
+		if p.Variables == nil {
+			log.Println("[debug] variables is nil ")
+			p.cache = map[string]cty.Value{
+				"var": cty.NullVal(cty.DynamicPseudoType),
+			}
+			return
+		}
+		log.Println("[debug] variables => ", string(p.Variables))
+		ctx := hclconfig.NewEvalContext()
+		src := []byte(`jsondecode(`)
+		bs, _ := json.Marshal(string(p.Variables))
+		src = append(src, bs...)
+		src = append(src, []byte(`)`)...)
+		expr, diags := hclsyntax.ParseExpression(src, "", hcl.InitialPos)
+		if diags.HasErrors() {
+			log.Println("[warn] params variables parse expression:", diags.Error())
+			return
+		}
+		value, diags := expr.Value(ctx)
+		if diags.HasErrors() {
+			log.Println("[warn] params variables eval value:", diags.Error())
+			return
+		}
+		p.cache = map[string]cty.Value{
+			"var": value,
+		}
+	})
+	return p.cache
+}
+
+// outputParams is the output of the queries without `output` block in the Lambda payload.
+type outputParams struct {
+	S3URI  string `json:"s3_uri"`
+	Format string `json:"format,omitempty"`
+}
+
+// newOutput returns the output of the query, that is <s3_uri>/<query name>.<ext>.
+func (p *outputParams) newOutput(name string) (*queryrunner.Output, error) {
+	if !strings.HasPrefix(p.S3URI, "s3://") {
+		return nil, fmt.Errorf("output s3_uri `%s` is not S3 URI", p.S3URI)
+	}
+	ext := "txt"
+	switch p.Format {
+	case "", "json", "json_lines":
+		ext = "jsonl"
+	case "csv", "tsv":
+		ext = p.Format
+	}
+	return queryrunner.NewOutput(strings.TrimSuffix(p.S3URI, "/")+"/"+name+"."+ext, p.Format)
+}
+
+type response struct {
+	Results  queryrunner.QueryResults       `json:"results"`
+	Outputs  map[string]*queryrunner.Output `json:"outputs,omitempty"`
+	Jobs     map[string]string              `json:"jobs,omitempty"`
+	Statuses map[string]*jobStatus          `json:"statuses,omitempty"`
+	Stats    map[string]*queryrunner.Stats  `json:"stats,omitempty"`
+	Status   map[string]*queryState         `json:"status,omitempty"`
+	Plans    []*queryrunner.RenderedQuery   `json:"plans,omitempty"`
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"flag"
@@ -17,17 +18,25 @@ import (
 	"github.com/aws/aws-lambda-go/lambdacontext"
 	"github.com/fatih/color"
 	"github.com/fujiwara/logutils"
+	_ "github.com/go-sql-driver/mysql"
 	"github.com/handlename/ssmwrap"
-	"github.com/hashicorp/hcl/v2"
-	"github.com/hashicorp/hcl/v2/hclsyntax"
 	"github.com/ken39arg/go-flagx"
+	_ "github.com/lib/pq"
 	"github.com/mashiike/hclconfig"
 	"github.com/mashiike/queryrunner"
+	_ "github.com/mashiike/queryrunner/athena"
 	_ "github.com/mashiike/queryrunner/cloudwatchlogsinsights"
+	_ "github.com/mashiike/queryrunner/cloudwatchmetrics"
+	_ "github.com/mashiike/queryrunner/databasesql"
+	_ "github.com/mashiike/queryrunner/dynamodbpartiql"
+	_ "github.com/mashiike/queryrunner/fixture"
+	_ "github.com/mashiike/queryrunner/localfile"
+	_ "github.com/mashiike/queryrunner/rdsdata"
 	_ "github.com/mashiike/queryrunner/redshiftdata"
 	_ "github.com/mashiike/queryrunner/s3select"
+	_ "github.com/mashiike/queryrunner/timestream"
 	"github.com/zclconf/go-cty/cty"
-	"golang.org/x/sync/errgroup"
+	_ "modernc.org/sqlite"
 )
 
 var filter = &logutils.LevelFilter{
@@ -53,14 +62,28 @@ const usage = `query-runner is a helper tool that makes querying several AWS ser
 
   usages:
     query-runner -l
+    query-runner [options] serve
     query-runner [options] <query_name1> <query_name2> ...
+    query-runner [options] @<query_group_name> ...
+    query-runner [options] status <job_id1> <job_id2> ...
+    query-runner [options] fetch <job_id1> <job_id2> ...
     cat params.json | query-runner [options]
 
   options:
     -c, --config        config dir, config format is HCL (defualt: ~/.config/query-runner/)
-    -l, --list          displays a list of formats
-    -o, --output        output format [json|table|markdown|borderless|vertical] (default:json)
+    -l, --list          displays a list of queries, their variables and query groups
+    -o, --output        output format [json|table|markdown|borderless|vertical|csv|tsv] (default:json)
     -v, --variables     variables json
+        --no-header     omits the header line of csv and tsv output
+        --output-file   writes the output to the file instead of stdout
+        --async         starts the queries without waiting, and prints their job ids
+        --dry-run       prints the rendered queries without running them
+        --stats         prints execution statistics of the queries to stderr, as JSON lines for json output
+        --keep-going    keeps running the other queries when a query fails, exits with non-zero status if any query failed
+        --parallelism   maximum number of the queries running at once (default: unlimited)
+        --addr          listen address of serve (default: :8080)
+        --cache-dir     directory to store query result cache (default: in memory)
+        --record-fixtures  records the query results to the directory as fixtures of fixture runner
     -h, --help          prints help information
         --log-level     log output level (default: info)
 `
@@ -91,11 +114,21 @@ func _main() error {
 	}
 
 	var (
-		config    string
-		logLevel  string
-		showList  bool
-		variables string
-		output    string
+		config     string
+		logLevel   string
+		showList   bool
+		variables  string
+		output     string
+		cacheDir   string
+		fixtureDir string
+		noHeader   bool
+		outputFile string
+		addr       string
+		async      bool
+		dryRun     bool
+		showStats  bool
+		keepGoing  bool
+		parallel   int
 	)
 	flag.Usage = func() { fmt.Print(usage) }
 	flag.StringVar(&config, "config", "", "")
@@ -106,6 +139,16 @@ func _main() error {
 	flag.StringVar(&output, "o", "", "")
 	flag.StringVar(&variables, "variables", "", "")
 	flag.StringVar(&variables, "v", "", "")
+	flag.BoolVar(&noHeader, "no-header", false, "")
+	flag.StringVar(&outputFile, "output-file", "", "")
+	flag.StringVar(&cacheDir, "cache-dir", "", "")
+	flag.StringVar(&fixtureDir, "record-fixtures", "", "")
+	flag.StringVar(&addr, "addr", ":8080", "")
+	flag.BoolVar(&async, "async", false, "")
+	flag.BoolVar(&dryRun, "dry-run", false, "")
+	flag.BoolVar(&showStats, "stats", false, "")
+	flag.BoolVar(&keepGoing, "keep-going", false, "")
+	flag.IntVar(&parallel, "parallelism", 0, "")
 	flag.StringVar(&logLevel, "log-level", "info", "")
 	flag.VisitAll(flagFilter(flagx.EnvToFlag))
 	flag.VisitAll(flagFilter(flagx.EnvToFlagWithPrefix("QUERY_RUNNER_")))
@@ -114,10 +157,11 @@ func _main() error {
 	if config == "" {
 		config = "~/.config/query-runner/"
 	}
-	var queries queryrunner.PreparedQueries
-	if err := hclconfig.Load(&queries, config); err != nil {
+	var cfg queryrunner.Config
+	if err := hclconfig.Load(&cfg, config); err != nil {
 		return err
 	}
+	queries := cfg.Queries
 	if strings.HasPrefix(os.Getenv("AWS_EXECUTION_ENV"), "AWS_Lambda") || os.Getenv("AWS_LAMBDA_RUNTIME_API") != "" {
 		log.Println("[info] run on AWS Lambda runtime")
 		lambda.Start(func(ctx context.Context, p *params) (*response, error) {
@@ -125,31 +169,14 @@ func _main() error {
 			if lctx, ok := lambdacontext.FromContext(ctx); ok {
 				ctx = queryrunner.WithRequestID(ctx, lctx.AwsRequestID)
 			}
-			resp := &response{
-				Results: make(queryrunner.QueryResults, len(p.Queries)),
+			if cacheDir != "" {
+				ctx = queryrunner.WithCacheStorage(ctx, queryrunner.NewFileCacheStorage(cacheDir))
 			}
-			eg, egctx := errgroup.WithContext(ctx)
-			for i, queryName := range p.Queries {
-				query, ok := queries.Get(queryName)
-				if !ok {
-					return nil, fmt.Errorf("query `%s` is not found, skip this query", queryName)
-				}
-				index := i
-				eg.Go(func() error {
-					log.Printf("[debug] start run `%s` runner type `%s`", query.Name(), query.RunnerType())
-					result, err := query.Run(egctx, p.MarshalCTYValues(), nil)
-					if err != nil {
-						return err
-					}
-					log.Printf("[debug] finish run `%s` runner type `%s`", query.Name(), query.RunnerType())
-					resp.Results[index] = result
-					return nil
-				})
-			}
-			if err := eg.Wait(); err != nil {
+			var err error
+			if p.Queries, err = cfg.Groups.Expand(p.Queries); err != nil {
 				return nil, err
 			}
-			return resp, nil
+			return handle(ctx, queries, p)
 		})
 		return nil
 	}
@@ -158,6 +185,57 @@ func _main() error {
 		fmt.Println("query list:")
 		for _, query := range queries {
 			fmt.Printf("\t%s\t%s\t%s\n", query.Name(), query.RunnerType(), query.Description())
+			for _, v := range query.Variables() {
+				input := "required"
+				if !v.Required() {
+					input = "default=" + v.DefaultString()
+				}
+				fmt.Printf("\t\tvar.%s\t%s\t%s\t%s\n", v.Name, v.TypeString(), input, v.Description)
+			}
+		}
+		if len(cfg.Groups) > 0 {
+			fmt.Println("query group list:")
+			for _, group := range cfg.Groups {
+				fmt.Printf("\t%s%s\t%s\t%s\n", queryrunner.QueryGroupPrefix, group.Name, strings.Join(group.Queries, ","), group.Description)
+			}
+		}
+		return nil
+	}
+	if flag.Arg(0) == "serve" {
+		ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP)
+		defer cancel()
+		return serve(ctx, addr, newServer(queries, cacheDir))
+	}
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP)
+	defer cancel()
+	if cacheDir != "" {
+		ctx = queryrunner.WithCacheStorage(ctx, queryrunner.NewFileCacheStorage(cacheDir))
+	}
+	if fixtureDir != "" {
+		ctx = queryrunner.WithFixtureRecorder(ctx, queryrunner.NewFixtureRecorder(fixtureDir))
+	}
+	var w io.Writer = os.Stdout
+	if outputFile != "" {
+		fp, err := os.Create(outputFile)
+		if err != nil {
+			return err
+		}
+		defer fp.Close()
+		w = fp
+		defer log.Printf("[info] query results are written to `%s`", outputFile)
+	}
+	switch flag.Arg(0) {
+	case "status":
+		return printStatuses(ctx, queries, flag.Args()[1:], w)
+	case "fetch":
+		results, err := fetchQueries(ctx, queries, flag.Args()[1:], output, noHeader, w)
+		if err != nil {
+			return err
+		}
+		if showStats {
+			if err := printStats(os.Stderr, results, output); err != nil {
+				return err
+			}
 		}
 		return nil
 	}
@@ -176,92 +254,298 @@ func _main() error {
 			return err
 		}
 	}
-	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP)
-	defer cancel()
-	eg, egctx := errgroup.WithContext(ctx)
-	for _, queryName := range p.Queries {
-		query, ok := queries.Get(queryName)
-		if !ok {
+	names, err := cfg.Groups.Expand(p.Queries)
+	if err != nil {
+		return err
+	}
+	targets := make([]string, 0, len(names))
+	for _, queryName := range names {
+		if _, ok := queries.Get(queryName); !ok {
 			log.Printf("[warn] query `%s` is not found, skip this query", queryName)
 			continue
 		}
-		eg.Go(func() error {
-			log.Printf("[debug] start run `%s` runner type `%s`", query.Name(), query.RunnerType())
-			result, err := query.Run(egctx, p.MarshalCTYValues(), nil)
-			if err != nil {
-				return err
-			}
-			log.Printf("[debug] finish run `%s` runner type `%s`", query.Name(), query.RunnerType())
-			switch output {
-			case "table":
-				io.WriteString(os.Stdout, result.ToTable())
-			case "markdown":
-				io.WriteString(os.Stdout, result.ToMarkdownTable())
-			case "borderless":
-				io.WriteString(os.Stdout, result.ToBorderlessTable())
-			case "vertical":
-				io.WriteString(os.Stdout, result.ToVertical())
-			default:
-				io.WriteString(os.Stdout, result.ToJSONLines())
-			}
-			return nil
-		})
+		targets = append(targets, queryName)
+	}
+	if dryRun || p.DryRun {
+		return planQueries(ctx, queries, targets, p.MarshalCTYValues(), w)
+	}
+	if async || p.Async {
+		return startQueries(ctx, queries, targets, p.MarshalCTYValues(), w)
+	}
+	opts := queryrunner.RunOptions{
+		ContinueOnError: keepGoing || p.ContinueOnError,
+		Parallelism:     p.Parallelism,
 	}
-	if err := eg.Wait(); err != nil {
+	if parallel > 0 {
+		opts.Parallelism = parallel
+	}
+	results, err := runQueries(ctx, queries, targets, p.MarshalCTYValues(), output, noHeader, opts, w)
+	if err != nil {
 		return err
 	}
+	if showStats {
+		if err := printStats(os.Stderr, results, output); err != nil {
+			return err
+		}
+	}
+	return results.Err()
+}
+
+// runQueries writes query results to w in the output format.
+// table formats need whole result to align columns, other formats are written as soon as rows are read.
+func runQueries(ctx context.Context, queries queryrunner.PreparedQueries, names []string, variables map[string]cty.Value, output string, noHeader bool, opts queryrunner.RunOptions, w io.Writer) (queryrunner.QueryResults, error) {
+	optFn := func(o *queryrunner.RunOptions) {
+		*o = opts
+	}
+	switch output {
+	case "table", "markdown", "borderless", "vertical", "csv", "tsv":
+	default:
+		ordered := newOrderedWriter(names, w)
+		results, err := queryrunner.StreamQueries(ctx, queries, names, variables, nil, func(query queryrunner.PreparedQuery) queryrunner.RowWriter {
+			return ordered.newRowWriter(query.Name())
+		}, optFn)
+		if flushErr := ordered.flush(); err == nil {
+			err = flushErr
+		}
+		return results, err
+	}
+	results, err := queryrunner.RunQueries(ctx, queries, names, variables, nil, optFn)
+	if err != nil {
+		return nil, err
+	}
+	return results, writeResults(results, output, noHeader, w)
+}
+
+// orderedWriter writes JSON lines of the concurrent queries grouped by query in the order of names.
+// rows of the first unfinished query are written to w directly, rows of the others are buffered until the queries before them finish.
+type orderedWriter struct {
+	mu      sync.Mutex
+	w       io.Writer
+	names   []string
+	cursor  int
+	buffers map[string]*bytes.Buffer
+	done    map[string]bool
+}
+
+func newOrderedWriter(names []string, w io.Writer) *orderedWriter {
+	o := &orderedWriter{
+		w:       w,
+		buffers: make(map[string]*bytes.Buffer, len(names)),
+		done:    make(map[string]bool, len(names)),
+	}
+	for _, name := range names {
+		if _, ok := o.buffers[name]; ok {
+			continue
+		}
+		o.names = append(o.names, name)
+		o.buffers[name] = &bytes.Buffer{}
+	}
+	return o
+}
+
+func (o *orderedWriter) newRowWriter(name string) queryrunner.RowWriter {
+	return &orderedRowWriter{
+		RowWriter: queryrunner.NewJSONLinesRowWriter(orderedQueryWriter{o: o, name: name}),
+		o:         o,
+		name:      name,
+	}
+}
+
+func (o *orderedWriter) write(name string, p []byte) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.cursor < len(o.names) && o.names[o.cursor] == name {
+		return o.w.Write(p)
+	}
+	buf, ok := o.buffers[name]
+	if !ok {
+		return o.w.Write(p)
+	}
+	return buf.Write(p)
+}
+
+// finish marks the query as finished, and writes the buffered rows of the following queries.
+func (o *orderedWriter) finish(name string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.done[name] = true
+	for o.cursor < len(o.names) {
+		current := o.names[o.cursor]
+		if err := o.flushBuffer(current); err != nil {
+			return err
+		}
+		if !o.done[current] {
+			return nil
+		}
+		o.cursor++
+	}
 	return nil
 }
 
-func flagFilter(visitFunc func(f *flag.Flag)) func(f *flag.Flag) {
-	return func(f *flag.Flag) {
-		if len(f.Name) <= 1 {
-			return
+// flush writes the rest of the buffered rows, the queries that never finished (e.g. written to `output` block) are skipped.
+func (o *orderedWriter) flush() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for ; o.cursor < len(o.names); o.cursor++ {
+		if err := o.flushBuffer(o.names[o.cursor]); err != nil {
+			return err
 		}
-		visitFunc(f)
 	}
+	return nil
 }
 
-type params struct {
-	Queries   []string        `json:"queries"`
-	Variables json.RawMessage `json:"variables,omitempty"`
+func (o *orderedWriter) flushBuffer(name string) error {
+	buf := o.buffers[name]
+	if buf.Len() == 0 {
+		return nil
+	}
+	_, err := buf.WriteTo(o.w)
+	return err
+}
 
-	once  sync.Once
-	cache map[string]cty.Value
+type orderedQueryWriter struct {
+	o    *orderedWriter
+	name string
 }
 
-func (p *params) MarshalCTYValues() map[string]cty.Value {
-	p.once.Do(func() {
-		if p.Variables == nil {
-			log.Println("[debug] variables is nil ")
-			p.cache = map[string]cty.Value{
-				"var": cty.NullVal(cty.DynamicPseudoType),
-			}
-			return
+func (w orderedQueryWriter) Write(p []byte) (int, error) {
+	return w.o.write(w.name, p)
+}
+
+// orderedRowWriter is closed by StreamQueries when the query finished.
+type orderedRowWriter struct {
+	queryrunner.RowWriter
+	o    *orderedWriter
+	name string
+}
+
+func (w *orderedRowWriter) Close() error {
+	return w.o.finish(w.name)
+}
+
+// writeResults writes query results to w in the output format, the results written to `output` block and the failed results are skipped.
+func writeResults(results queryrunner.QueryResults, output string, noHeader bool, w io.Writer) error {
+	for _, result := range results {
+		if result.Output != nil || result.Err != nil {
+			continue
 		}
-		log.Println("[debug] variables => ", string(p.Variables))
-		ctx := hclconfig.NewEvalContext()
-		src := []byte(`jsondecode(`)
-		bs, _ := json.Marshal(string(p.Variables))
-		src = append(src, bs...)
-		src = append(src, []byte(`)`)...)
-		expr, diags := hclsyntax.ParseExpression(src, "", hcl.InitialPos)
-		if diags.HasErrors() {
-			log.Println("[warn] params variables parse expression:", diags.Error())
-			return
+		switch output {
+		case "table":
+			io.WriteString(w, result.ToTable())
+		case "markdown":
+			io.WriteString(w, result.ToMarkdownTable())
+		case "borderless":
+			io.WriteString(w, result.ToBorderlessTable())
+		case "vertical":
+			io.WriteString(w, result.ToVertical())
+		case "csv":
+			io.WriteString(w, result.ToCSV(func(opts *queryrunner.CSVOptions) {
+				opts.NoHeader = noHeader
+			}))
+		case "tsv":
+			io.WriteString(w, result.ToTSV(func(opts *queryrunner.CSVOptions) {
+				opts.NoHeader = noHeader
+			}))
+		default:
+			io.WriteString(w, result.ToJSONLines())
 		}
-		value, diags := expr.Value(ctx)
-		if diags.HasErrors() {
-			log.Println("[warn] params variables eval value:", diags.Error())
-			return
+	}
+	return nil
+}
+
+// startQueries starts the queries without waiting, and writes their job IDs as JSON lines.
+func startQueries(ctx context.Context, queries queryrunner.PreparedQueries, names []string, variables map[string]cty.Value, w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	for _, name := range names {
+		handle, err := queryrunner.StartQuery(ctx, queries, name, variables, nil)
+		if err != nil {
+			return err
 		}
-		p.cache = map[string]cty.Value{
-			"var": value,
+		if err := encoder.Encode(map[string]string{
+			"query":  name,
+			"job_id": handle.JobID(),
+		}); err != nil {
+			return err
 		}
-	})
-	return p.cache
+	}
+	return nil
 }
 
-type response struct {
-	Results queryrunner.QueryResults `json:"results"`
+// planQueries writes the rendered queries as JSON lines without running them.
+func planQueries(ctx context.Context, queries queryrunner.PreparedQueries, names []string, variables map[string]cty.Value, w io.Writer) error {
+	plans, err := queryrunner.PlanQueries(ctx, queries, names, variables, nil)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(w)
+	for _, plan := range plans {
+		if err := encoder.Encode(plan); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// printStatuses writes the statuses of the jobs as JSON lines.
+func printStatuses(ctx context.Context, queries queryrunner.PreparedQueries, jobIDs []string, w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	for _, jobID := range jobIDs {
+		status, err := getJobStatus(ctx, queries, jobID)
+		if err != nil {
+			return err
+		}
+		if err := encoder.Encode(status); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fetchQueries waits for the jobs and writes their results in the output format.
+func fetchQueries(ctx context.Context, queries queryrunner.PreparedQueries, jobIDs []string, output string, noHeader bool, w io.Writer) (queryrunner.QueryResults, error) {
+	results := make(queryrunner.QueryResults, 0, len(jobIDs))
+	for _, jobID := range jobIDs {
+		handle, err := queryrunner.ParseJobID(jobID)
+		if err != nil {
+			return nil, err
+		}
+		result, err := queryrunner.FetchQueryResult(ctx, queries, handle)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+	return results, writeResults(results, output, noHeader, w)
+}
+
+// printStats writes the execution statistics of the results to w, one line per query.
+// the statistics are written as JSON lines for json output format, so that they can be parsed as well as the rows.
+func printStats(w io.Writer, results queryrunner.QueryResults, output string) error {
+	encoder := json.NewEncoder(w)
+	for _, result := range results {
+		if result.Stats == nil {
+			continue
+		}
+		switch output {
+		case "table", "markdown", "borderless", "vertical", "csv", "tsv":
+			fmt.Fprintf(w, "%s: %s\n", result.Name, result.Stats)
+			continue
+		}
+		if err := encoder.Encode(map[string]interface{}{
+			"name":  result.Name,
+			"stats": result.Stats,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func flagFilter(visitFunc func(f *flag.Flag)) func(f *flag.Flag) {
+	return func(f *flag.Flag) {
+		if len(f.Name) <= 1 {
+			return
+		}
+		visitFunc(f)
+	}
 }
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mashiike/hclconfig"
+	"github.com/mashiike/queryrunner"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunQueriesGroupsJSONLinesByQuery(t *testing.T) {
+	dir := t.TempDir()
+	config := `
+	query_runner "sql" "default" {
+		driver = "sqlite"
+		dsn    = "` + filepath.ToSlash(filepath.Join(dir, "test.db")) + `"
+	}
+
+	query "first" {
+		runner = query_runner.sql.default
+		sql    = "WITH RECURSIVE seq(n) AS (SELECT 1 UNION ALL SELECT n + 1 FROM seq WHERE n < 1000) SELECT 'first' AS query, n FROM seq"
+	}
+
+	query "second" {
+		runner = query_runner.sql.default
+		sql    = "WITH RECURSIVE seq(n) AS (SELECT 1 UNION ALL SELECT n + 1 FROM seq WHERE n < 1000) SELECT 'second' AS query, n FROM seq"
+	}
+	`
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "config.hcl"), []byte(config), 0644))
+	var queries queryrunner.PreparedQueries
+	require.NoError(t, hclconfig.Load(&queries, dir))
+
+	for _, names := range [][]string{{"first", "second"}, {"second", "first"}} {
+		var buf bytes.Buffer
+		_, err := runQueries(context.Background(), queries, names, nil, "json", false, queryrunner.RunOptions{}, &buf)
+		require.NoError(t, err)
+		var got []string
+		scanner := bufio.NewScanner(&buf)
+		for scanner.Scan() {
+			var row struct {
+				Query string `json:"query"`
+			}
+			require.NoError(t, json.Unmarshal(scanner.Bytes(), &row))
+			if len(got) == 0 || got[len(got)-1] != row.Query {
+				got = append(got, row.Query)
+			}
+		}
+		require.NoError(t, scanner.Err())
+		require.Equal(t, names, got, "rows must be grouped by query in the order of targets")
+	}
+}
+
+func TestPrintStats(t *testing.T) {
+	results := queryrunner.QueryResults{
+		{
+			Name: "first",
+			Stats: &queryrunner.Stats{
+				Duration:     1500 * time.Millisecond,
+				RowsReturned: 2,
+				QueryID:      "query-id",
+			},
+		},
+		{
+			Name: "no_stats",
+		},
+	}
+	var buf bytes.Buffer
+	require.NoError(t, printStats(&buf, results, "table"))
+	require.Equal(t, "first: duration=1.5s rows_returned=2 query_id=query-id\n", buf.String())
+
+	buf.Reset()
+	require.NoError(t, printStats(&buf, results, ""))
+	var line struct {
+		Name  string `json:"name"`
+		Stats struct {
+			Duration     string `json:"duration"`
+			RowsReturned int64  `json:"rows_returned"`
+			QueryID      string `json:"query_id"`
+		} `json:"stats"`
+	}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &line))
+	require.Equal(t, "first", line.Name)
+	require.Equal(t, "1.5s", line.Stats.Duration)
+	require.EqualValues(t, 2, line.Stats.RowsReturned)
+	require.Equal(t, "query-id", line.Stats.QueryID)
+}
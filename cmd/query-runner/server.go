@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mashiike/queryrunner"
+)
+
+// server serves the queries over HTTP.
+//
+//	GET  /queries             lists the queries
+//	POST /queries/{name}/run  runs the query with the same params as the Lambda payload, except output
+type server struct {
+	queries  queryrunner.PreparedQueries
+	cacheDir string
+}
+
+func newServer(queries queryrunner.PreparedQueries, cacheDir string) http.Handler {
+	s := &server{
+		queries:  queries,
+		cacheDir: cacheDir,
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/queries", s.serveList)
+	mux.HandleFunc("/queries/", s.serveRun)
+	return mux
+}
+
+// serve starts HTTP server and shutdowns it when ctx is done.
+func serve(ctx context.Context, addr string, handler http.Handler) error {
+	srv := &http.Server{
+		Addr:    addr,
+		Handler: handler,
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			log.Println("[warn] shutdown server:", err)
+		}
+	}()
+	log.Printf("[info] serve on %s", addr)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+type queryInfo struct {
+	Name        string         `json:"name"`
+	RunnerType  string         `json:"runner_type"`
+	Description string         `json:"description"`
+	Variables   []variableInfo `json:"variables,omitempty"`
+}
+
+type variableInfo struct {
+	Name        string          `json:"name"`
+	Type        string          `json:"type"`
+	Required    bool            `json:"required"`
+	Default     json.RawMessage `json:"default,omitempty"`
+	Description string          `json:"description,omitempty"`
+}
+
+func (s *server) serveList(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s is not allowed", r.Method))
+		return
+	}
+	infos := make([]queryInfo, 0, len(s.queries))
+	for _, query := range s.queries {
+		info := queryInfo{
+			Name:        query.Name(),
+			RunnerType:  query.RunnerType(),
+			Description: query.Description(),
+		}
+		for _, v := range query.Variables() {
+			vi := variableInfo{
+				Name:        v.Name,
+				Type:        v.TypeString(),
+				Required:    v.Required(),
+				Description: v.Description,
+			}
+			if !v.Required() {
+				vi.Default = json.RawMessage(v.DefaultString())
+			}
+			info.Variables = append(info.Variables, vi)
+		}
+		infos = append(infos, info)
+	}
+	writeJSON(w, http.StatusOK, infos)
+}
+
+func (s *server) serveRun(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/queries/"), "/run")
+	if !strings.HasSuffix(r.URL.Path, "/run") || name == "" || strings.Contains(name, "/") {
+		writeError(w, http.StatusNotFound, fmt.Errorf("path %s is not found", r.URL.Path))
+		return
+	}
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s is not allowed", r.Method))
+		return
+	}
+	format, ok := negotiateFormat(r.Header.Get("Accept"))
+	if !ok {
+		writeError(w, http.StatusNotAcceptable, fmt.Errorf("accept %s is not supported", r.Header.Get("Accept")))
+		return
+	}
+	query, ok := s.queries.Get(name)
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("query `%s` is not found", name))
+		return
+	}
+	var p params
+	if err := json.NewDecoder(r.Body).Decode(&p); err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("decode params: %w", err))
+		return
+	}
+	// the output location is given only by `output` block of the query, so that HTTP callers can not write the results to any location.
+	if p.Output != nil {
+		writeError(w, http.StatusBadRequest, errors.New("output is not allowed over HTTP, use output block of the query instead"))
+		return
+	}
+	// the query is run synchronously, so that the jobs of the other queries can not be polled or fetched over HTTP.
+	if p.Async || len(p.Status) > 0 || len(p.Fetch) > 0 {
+		writeError(w, http.StatusBadRequest, errors.New("async, status and fetch are not allowed over HTTP, the query is run synchronously"))
+		return
+	}
+	p.Queries = []string{name}
+	// the only query is run, so that its failure is returned as the error response.
+	p.ContinueOnError = false
+	if _, err := queryrunner.EvaluateVariables(query, p.MarshalCTYValues()); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	ctx := r.Context()
+	if reqID := r.Header.Get("X-Request-Id"); reqID != "" {
+		ctx = queryrunner.WithRequestID(ctx, reqID)
+	}
+	if s.cacheDir != "" {
+		ctx = queryrunner.WithCacheStorage(ctx, queryrunner.NewFileCacheStorage(s.cacheDir))
+	}
+	resp, err := handle(ctx, s.queries, &p)
+	if err != nil {
+		log.Printf("[error][%s] run query `%s`: %v", queryrunner.GetRequestID(ctx), name, err)
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	// the result written to the output location has no rows, so that the location is returned as JSON.
+	if format == "json" || len(resp.Results) == 0 {
+		writeJSON(w, http.StatusOK, resp)
+		return
+	}
+	body, err := resp.Results[0].Format(format)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Content-Type", formatContentTypes[format]+"; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, body)
+}
+
+var formatContentTypes = map[string]string{
+	"json":     "application/json",
+	"csv":      "text/csv",
+	"tsv":      "text/tab-separated-values",
+	"markdown": "text/markdown",
+	"table":    "text/plain",
+}
+
+// negotiateFormat returns the output format of the acceptable media type with the highest `q` weight in Accept header, the default is json.
+// the media types of the same weight are chosen in order of appearance, and `q=0` is not acceptable.
+func negotiateFormat(accept string) (string, bool) {
+	if strings.TrimSpace(accept) == "" {
+		return "json", true
+	}
+	var (
+		format  string
+		quality float64
+	)
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		if q <= quality {
+			continue
+		}
+		if f, ok := mediaTypeFormat(mediaType); ok {
+			format, quality = f, q
+		}
+	}
+	return format, format != ""
+}
+
+// mediaTypeFormat returns the output format of the media type.
+func mediaTypeFormat(mediaType string) (string, bool) {
+	switch mediaType {
+	case "*/*", "application/*":
+		return "json", true
+	case "text/*":
+		return "table", true
+	}
+	for format, contentType := range formatContentTypes {
+		if mediaType == contentType {
+			return format, true
+		}
+	}
+	return "", false
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Println("[warn] write response:", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{
+		"error": err.Error(),
+	})
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mashiike/hclconfig"
+	"github.com/mashiike/queryrunner"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	dir := t.TempDir()
+	config := `
+	variable "name" {
+		type    = string
+		default = "hoge"
+	}
+
+	query_runner "sql" "default" {
+		driver = "sqlite"
+		dsn    = "` + filepath.ToSlash(filepath.Join(dir, "test.db")) + `"
+	}
+
+	query "hello" {
+		runner      = query_runner.sql.default
+		description = "say hello"
+		sql         = "SELECT 1 AS id, :name AS name"
+		parameters = {
+			name = var.name
+		}
+	}
+	`
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "config.hcl"), []byte(config), 0644))
+	var queries queryrunner.PreparedQueries
+	require.NoError(t, hclconfig.Load(&queries, dir))
+	ts := httptest.NewServer(newServer(queries, ""))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func doRequest(t *testing.T, method string, url string, accept string, body string) (int, string, string) {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	require.NoError(t, err)
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	bs, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp.StatusCode, resp.Header.Get("Content-Type"), string(bs)
+}
+
+func TestServer(t *testing.T) {
+	ts := newTestServer(t)
+
+	status, _, body := doRequest(t, http.MethodGet, ts.URL+"/queries", "", "")
+	require.Equal(t, http.StatusOK, status)
+	require.JSONEq(t, `[{"name":"hello","runner_type":"sql","description":"say hello","variables":[{"name":"name","type":"string","required":false,"default":"hoge"}]}]`, body)
+
+	status, contentType, body := doRequest(t, http.MethodPost, ts.URL+"/queries/hello/run", "", `{"variables":{"name":"fuga"}}`)
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, "application/json", contentType)
+	var resp struct {
+		Results json.RawMessage `json:"results"`
+		Stats   map[string]struct {
+			RowsReturned int    `json:"rows_returned"`
+			Duration     string `json:"duration"`
+		} `json:"stats"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(body), &resp))
+	require.JSONEq(t, `{"hello":[{"id":1,"name":"fuga"}]}`, string(resp.Results))
+	require.Equal(t, 1, resp.Stats["hello"].RowsReturned)
+	require.NotEmpty(t, resp.Stats["hello"].Duration)
+
+	status, contentType, body = doRequest(t, http.MethodPost, ts.URL+"/queries/hello/run", "text/csv", "")
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, "text/csv; charset=utf-8", contentType)
+	require.Equal(t, "id,name\n1,hoge\n", body)
+
+	status, _, body = doRequest(t, http.MethodPost, ts.URL+"/queries/hello/run", "text/csv;q=0.5, text/markdown;q=0.9", "")
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, "| id | name |\n|----|------|\n|  1 | hoge |\n", body)
+
+	status, contentType, _ = doRequest(t, http.MethodPost, ts.URL+"/queries/hello/run", "text/markdown;q=0.9, application/json", "")
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, "application/json", contentType)
+
+	status, _, _ = doRequest(t, http.MethodPost, ts.URL+"/queries/hello/run", "text/csv;q=0", "")
+	require.Equal(t, http.StatusNotAcceptable, status)
+
+	status, _, body = doRequest(t, http.MethodPost, ts.URL+"/queries/hello/run", "", `{"output":{"s3_uri":"s3://other-bucket/results/"}}`)
+	require.Equal(t, http.StatusBadRequest, status)
+	require.Contains(t, body, "output is not allowed over HTTP")
+
+	for _, payload := range []string{
+		`{"async":true}`,
+		`{"status":["other"]}`,
+		`{"fetch":["other"]}`,
+	} {
+		status, _, body = doRequest(t, http.MethodPost, ts.URL+"/queries/hello/run", "", payload)
+		require.Equal(t, http.StatusBadRequest, status, payload)
+		require.Contains(t, body, "async, status and fetch are not allowed over HTTP", payload)
+	}
+
+	status, _, _ = doRequest(t, http.MethodPost, ts.URL+"/queries/hello/run", "image/png", "")
+	require.Equal(t, http.StatusNotAcceptable, status)
+
+	status, _, body = doRequest(t, http.MethodPost, ts.URL+"/queries/hello/run", "", `{"variables":{"name":["invalid"]}}`)
+	require.Equal(t, http.StatusBadRequest, status)
+	require.Contains(t, body, "not compatible with the variable's type constraint")
+
+	status, _, _ = doRequest(t, http.MethodPost, ts.URL+"/queries/not_found/run", "", "")
+	require.Equal(t, http.StatusNotFound, status)
+
+	status, _, body = doRequest(t, http.MethodPost, ts.URL+"/queries/hello/run", "text/csv", `{"variables":{"name":"fuga"},"dry_run":true}`)
+	require.Equal(t, http.StatusOK, status)
+	var plan struct {
+		Plans json.RawMessage `json:"plans"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(body), &plan))
+	require.JSONEq(t, `[{"name":"hello","runner_type":"sql","runner_name":"default","query":"SELECT 1 AS id, ? AS name","attributes":{"driver":"sqlite","args":["fuga"]}}]`, string(plan.Plans))
+
+	status, _, _ = doRequest(t, http.MethodGet, ts.URL+"/queries/hello/run", "", "")
+	require.Equal(t, http.StatusMethodNotAllowed, status)
+}
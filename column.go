@@ -0,0 +1,300 @@
+package queryrunner
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/zclconf/go-cty/cty"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+)
+
+// ColumnType is the logical type of a result column.
+type ColumnType string
+
+const (
+	ColumnTypeUnknown   ColumnType = "unknown"
+	ColumnTypeString    ColumnType = "string"
+	ColumnTypeInteger   ColumnType = "integer"
+	ColumnTypeFloat     ColumnType = "float"
+	ColumnTypeDecimal   ColumnType = "decimal"
+	ColumnTypeBoolean   ColumnType = "boolean"
+	ColumnTypeTimestamp ColumnType = "timestamp"
+	ColumnTypeBinary    ColumnType = "binary"
+	ColumnTypeJSON      ColumnType = "json"
+)
+
+// CTYType returns the cty type used for values of this column type.
+func (t ColumnType) CTYType() cty.Type {
+	switch t {
+	case ColumnTypeString, ColumnTypeTimestamp, ColumnTypeBinary:
+		return cty.String
+	case ColumnTypeInteger, ColumnTypeFloat, ColumnTypeDecimal:
+		return cty.Number
+	case ColumnTypeBoolean:
+		return cty.Bool
+	default:
+		return cty.DynamicPseudoType
+	}
+}
+
+// Column is metadata of a result column.
+type Column struct {
+	Name     string     `json:"name"`
+	Type     ColumnType `json:"type"`
+	Nullable bool       `json:"nullable"`
+}
+
+type Columns []Column
+
+// NewStringColumns returns not nullable string columns with given names.
+func NewStringColumns(names ...string) Columns {
+	columns := make(Columns, 0, len(names))
+	for _, name := range names {
+		columns = append(columns, Column{
+			Name: name,
+			Type: ColumnTypeString,
+		})
+	}
+	return columns
+}
+
+func (columns Columns) Names() []string {
+	names := make([]string, 0, len(columns))
+	for _, column := range columns {
+		names = append(names, column.Name)
+	}
+	return names
+}
+
+func (columns Columns) Types() []ColumnType {
+	types := make([]ColumnType, 0, len(columns))
+	for _, column := range columns {
+		types = append(types, column.Type)
+	}
+	return types
+}
+
+// ColumnTypeOf returns the logical column type of a cell value.
+// nil value is ColumnTypeUnknown.
+func ColumnTypeOf(v interface{}) ColumnType {
+	switch v := v.(type) {
+	case nil:
+		return ColumnTypeUnknown
+	case string:
+		return ColumnTypeString
+	case bool:
+		return ColumnTypeBoolean
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return ColumnTypeInteger
+	case float32, float64:
+		return ColumnTypeFloat
+	case json.Number:
+		if _, err := v.Int64(); err == nil {
+			return ColumnTypeInteger
+		}
+		return ColumnTypeDecimal
+	case time.Time:
+		return ColumnTypeTimestamp
+	case []byte:
+		return ColumnTypeBinary
+	default:
+		return ColumnTypeJSON
+	}
+}
+
+// mergeColumnType merges observed type of new value into current column type.
+// empty ColumnType means that no value has been observed yet.
+func mergeColumnType(current, observed ColumnType) ColumnType {
+	if observed == ColumnTypeUnknown || current == observed {
+		return current
+	}
+	if current == "" {
+		return observed
+	}
+	isNumber := func(t ColumnType) bool {
+		return t == ColumnTypeInteger || t == ColumnTypeFloat || t == ColumnTypeDecimal
+	}
+	if isNumber(current) && isNumber(observed) {
+		if current == ColumnTypeDecimal || observed == ColumnTypeDecimal {
+			return ColumnTypeDecimal
+		}
+		return ColumnTypeFloat
+	}
+	return ColumnTypeUnknown
+}
+
+// normalizeValue converts Go primitive values into the canonical cell value types:
+// nil, string, bool, int64, float64, json.Number, time.Time, []byte or JSON compatible values.
+func normalizeValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case int:
+		return int64(v)
+	case int8:
+		return int64(v)
+	case int16:
+		return int64(v)
+	case int32:
+		return int64(v)
+	case uint:
+		return normalizeUint(uint64(v))
+	case uint8:
+		return int64(v)
+	case uint16:
+		return int64(v)
+	case uint32:
+		return int64(v)
+	case uint64:
+		return normalizeUint(v)
+	case float32:
+		return float64(v)
+	default:
+		return v
+	}
+}
+
+func normalizeUint(v uint64) interface{} {
+	if v > math.MaxInt64 {
+		return json.Number(strconv.FormatUint(v, 10))
+	}
+	return int64(v)
+}
+
+// normalizeJSONNumber converts json.Number decoded with UseNumber into int64 or float64 if possible.
+func normalizeJSONNumber(v interface{}) interface{} {
+	n, ok := v.(json.Number)
+	if !ok {
+		return v
+	}
+	if i, err := n.Int64(); err == nil {
+		return i
+	}
+	if f, err := n.Float64(); err == nil && !math.IsInf(f, 0) {
+		return f
+	}
+	return n
+}
+
+// FormatValue returns the string representation of a cell value, used in table and delimited outputs.
+func FormatValue(v interface{}) string {
+	switch v := normalizeValue(v).(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case bool:
+		return strconv.FormatBool(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case json.Number:
+		return v.String()
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case []byte:
+		return hex.EncodeToString(v)
+	default:
+		bs, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprintf("%v", v)
+		}
+		return string(bs)
+	}
+}
+
+// jsonValue returns a value that can be encoded by encoding/json as is.
+func jsonValue(v interface{}) interface{} {
+	switch v := normalizeValue(v).(type) {
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return FormatValue(v)
+		}
+		return v
+	case []byte:
+		return hex.EncodeToString(v)
+	default:
+		return v
+	}
+}
+
+// ctyValue converts a cell value into cty.Value, null value is typed by column type.
+func ctyValue(column Column, v interface{}) cty.Value {
+	switch v := normalizeValue(v).(type) {
+	case nil:
+		return cty.NullVal(column.Type.CTYType())
+	case string:
+		return cty.StringVal(v)
+	case bool:
+		return cty.BoolVal(v)
+	case int64:
+		return cty.NumberIntVal(v)
+	case float64:
+		if math.IsNaN(v) {
+			return cty.StringVal(FormatValue(v))
+		}
+		return cty.NumberFloatVal(v)
+	case json.Number:
+		if n, err := cty.ParseNumberVal(v.String()); err == nil {
+			return n
+		}
+		return cty.StringVal(v.String())
+	case time.Time, []byte:
+		return cty.StringVal(FormatValue(v))
+	default:
+		bs, err := json.Marshal(v)
+		if err != nil {
+			return cty.StringVal(FormatValue(v))
+		}
+		ty, err := ctyjson.ImpliedType(bs)
+		if err != nil {
+			return cty.StringVal(string(bs))
+		}
+		value, err := ctyjson.Unmarshal(bs, ty)
+		if err != nil {
+			return cty.StringVal(string(bs))
+		}
+		return value
+	}
+}
+
+// decodeJSONObject decodes JSON object keeping the order of keys, numbers are decoded as int64 or float64 if possible.
+func decodeJSONObject(bs []byte) ([]string, map[string]interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(bs))
+	decoder.UseNumber()
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, nil, err
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '{' {
+		return nil, nil, fmt.Errorf("expected JSON object, actual %v", token)
+	}
+	keys := make([]string, 0)
+	values := make(map[string]interface{})
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, nil, err
+		}
+		key, ok := token.(string)
+		if !ok {
+			return nil, nil, fmt.Errorf("expected object key, actual %v", token)
+		}
+		var v interface{}
+		if err := decoder.Decode(&v); err != nil {
+			return nil, nil, err
+		}
+		if _, ok := values[key]; !ok {
+			keys = append(keys, key)
+		}
+		values[key] = normalizeJSONNumber(v)
+	}
+	if _, err := decoder.Token(); err != nil {
+		return nil, nil, err
+	}
+	return keys, values, nil
+}
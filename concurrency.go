@@ -0,0 +1,110 @@
+package queryrunner
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// concurrencyLimiter limits the number of concurrent query runs.
+type concurrencyLimiter struct {
+	slots chan struct{}
+}
+
+func newConcurrencyLimiter(n int) *concurrencyLimiter {
+	if n <= 0 {
+		return nil
+	}
+	return &concurrencyLimiter{
+		slots: make(chan struct{}, n),
+	}
+}
+
+// acquire waits for a free slot, the returned function releases the slot.
+// nil limiter is unlimited.
+func (l *concurrencyLimiter) acquire(ctx context.Context) (func(), error) {
+	if l == nil {
+		return func() {}, nil
+	}
+	select {
+	case l.slots <- struct{}{}:
+	default:
+		log.Printf("[debug][%s] waiting for a free slot, %d queries are running", GetRequestID(ctx), cap(l.slots))
+		select {
+		case l.slots <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	return func() { <-l.slots }, nil
+}
+
+type concurrencyLimited interface {
+	concurrencyLimiter() *concurrencyLimiter
+}
+
+func (q *QueryBase) concurrencyLimiter() *concurrencyLimiter {
+	if q == nil {
+		return nil
+	}
+	return q.limiter
+}
+
+// acquireRunner waits until the query runner of the query can run the query, up to `max_concurrency` of the query_runner block.
+func acquireRunner(ctx context.Context, query PreparedQuery) (func(), error) {
+	var limiter *concurrencyLimiter
+	if l, ok := query.(concurrencyLimited); ok {
+		limiter = l.concurrencyLimiter()
+	}
+	release, err := limiter.acquire(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("query `%s` waiting for query runner: %w", query.Name(), err)
+	}
+	return release, nil
+}
+
+// decodeMaxConcurrency decodes `max_concurrency` attribute of query_runner block, the remain body is returned for the query runner.
+func decodeMaxConcurrency(body hcl.Body, ctx *hcl.EvalContext) (int, hcl.Body, hcl.Diagnostics) {
+	content, remain, diags := body.PartialContent(&hcl.BodySchema{
+		Attributes: []hcl.AttributeSchema{
+			{
+				Name: "max_concurrency",
+			},
+		},
+	})
+	if diags.HasErrors() {
+		return 0, remain, diags
+	}
+	attr, ok := content.Attributes["max_concurrency"]
+	if !ok {
+		return 0, remain, diags
+	}
+	value, valueDiags := attr.Expr.Value(ctx)
+	diags = append(diags, valueDiags...)
+	if valueDiags.HasErrors() {
+		return 0, remain, diags
+	}
+	if !value.IsKnown() || value.IsNull() || value.Type() != cty.Number || !value.AsBigFloat().IsInt() {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid max_concurrency",
+			Detail:   "max_concurrency is not integer, please write as max_concurrency = 5",
+			Subject:  attr.Expr.Range().Ptr(),
+		})
+		return 0, remain, diags
+	}
+	i, _ := value.AsBigFloat().Int64()
+	if i < 1 {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid max_concurrency",
+			Detail:   fmt.Sprintf("max_concurrency must be greater than or equal to 1: %d", i),
+			Subject:  attr.Expr.Range().Ptr(),
+		})
+		return 0, remain, diags
+	}
+	return int(i), remain, diags
+}
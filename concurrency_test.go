@@ -0,0 +1,112 @@
+package queryrunner_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/mashiike/queryrunner"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+)
+
+// concurrencyRecorder records the maximum number of the queries running at once by `running()` function.
+type concurrencyRecorder struct {
+	mu      sync.Mutex
+	running int
+	max     int
+}
+
+func (r *concurrencyRecorder) functions() map[string]function.Function {
+	return map[string]function.Function{
+		"running": function.New(&function.Spec{
+			Type: function.StaticReturnType(cty.String),
+			Impl: func(_ []cty.Value, _ cty.Type) (cty.Value, error) {
+				r.mu.Lock()
+				r.running++
+				if r.running > r.max {
+					r.max = r.running
+				}
+				r.mu.Unlock()
+				time.Sleep(20 * time.Millisecond)
+				r.mu.Lock()
+				r.running--
+				r.mu.Unlock()
+				return cty.StringVal("done"), nil
+			},
+		}),
+	}
+}
+
+func TestRunQueriesConcurrency(t *testing.T) {
+	queries, diags := decodeVariablesConfig(t, `
+	query_runner "dummy" "limited" {
+		columns         = ["status"]
+		max_concurrency = 1
+	}
+
+	query_runner "dummy" "default" {
+		columns = ["status"]
+	}
+
+	query "first" {
+		runner = query_runner.dummy.limited
+		rows   = [[ running() ]]
+	}
+
+	query "second" {
+		runner = query_runner.dummy.limited
+		rows   = [[ running() ]]
+	}
+
+	query "third" {
+		runner = query_runner.dummy.default
+		rows   = [[ running() ]]
+	}
+
+	query "fourth" {
+		runner = query_runner.dummy.default
+		rows   = [[ running() ]]
+	}
+	`)
+	if !assert.False(t, diags.HasErrors()) {
+		t.Log(diags.Error())
+		t.FailNow()
+	}
+	variables := map[string]cty.Value{
+		"var": cty.NullVal(cty.DynamicPseudoType),
+	}
+
+	recorder := &concurrencyRecorder{}
+	results, err := queryrunner.RunQueries(context.Background(), queries, []string{"first", "second"}, variables, recorder.functions())
+	require.NoError(t, err)
+	require.Equal(t, 2, len(results))
+	require.Equal(t, 1, recorder.max)
+
+	recorder = &concurrencyRecorder{}
+	_, err = queryrunner.RunQueries(context.Background(), queries, []string{"third", "fourth"}, variables, recorder.functions())
+	require.NoError(t, err)
+	require.Equal(t, 2, recorder.max)
+
+	recorder = &concurrencyRecorder{}
+	_, err = queryrunner.RunQueries(context.Background(), queries, []string{"third", "fourth"}, variables, recorder.functions(), func(opts *queryrunner.RunOptions) {
+		opts.Parallelism = 1
+	})
+	require.NoError(t, err)
+	require.Equal(t, 1, recorder.max)
+}
+
+func TestDecodeBodyInvalidMaxConcurrency(t *testing.T) {
+	_, diags := decodeVariablesConfig(t, `
+	query_runner "dummy" "default" {
+		columns         = ["id"]
+		max_concurrency = 0
+	}
+	`)
+	require.True(t, diags.HasErrors())
+	require.Equal(t, "max_concurrency must be greater than or equal to 1: 0", diags.Errs()[0].(*hcl.Diagnostic).Detail)
+}
@@ -42,3 +42,48 @@ func GetRequestID(ctx context.Context) string {
 	}
 	return "-"
 }
+
+var cacheStorageContextKey contextKey = "__queryrunner_cache_storage"
+
+var defaultCacheStorage CacheStorage = NewMemoryCacheStorage()
+
+// WithCacheStorage sets the storage of query result cache, the default is in process memory.
+func WithCacheStorage(ctx context.Context, storage CacheStorage) context.Context {
+	return context.WithValue(ctx, cacheStorageContextKey, storage)
+}
+
+func GetCacheStorage(ctx context.Context) CacheStorage {
+	if storage, ok := ctx.Value(cacheStorageContextKey).(CacheStorage); ok {
+		return storage
+	}
+	return defaultCacheStorage
+}
+
+var s3ClientContextKey contextKey = "__queryrunner_s3_client"
+
+// WithS3Client sets the S3 client to write outputs, the default is created from the default aws config.
+func WithS3Client(ctx context.Context, client S3Client) context.Context {
+	return context.WithValue(ctx, s3ClientContextKey, client)
+}
+
+func GetS3Client(ctx context.Context) (S3Client, error) {
+	if client, ok := ctx.Value(s3ClientContextKey).(S3Client); ok {
+		return client, nil
+	}
+	return loadDefaultS3Client(ctx)
+}
+
+var fixtureRecorderContextKey contextKey = "__queryrunner_fixture_recorder"
+
+// WithFixtureRecorder records the results of RunQuery and StreamQuery as fixtures, the default is not to record.
+func WithFixtureRecorder(ctx context.Context, recorder *FixtureRecorder) context.Context {
+	return context.WithValue(ctx, fixtureRecorderContextKey, recorder)
+}
+
+// GetFixtureRecorder returns nil if the results are not recorded.
+func GetFixtureRecorder(ctx context.Context) *FixtureRecorder {
+	if recorder, ok := ctx.Value(fixtureRecorderContextKey).(*FixtureRecorder); ok {
+		return recorder
+	}
+	return nil
+}
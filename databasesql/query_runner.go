@@ -0,0 +1,337 @@
+package databasesql
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/gohcl"
+	"github.com/mashiike/queryrunner"
+	"github.com/samber/lo"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+)
+
+const TypeName = "sql"
+
+func init() {
+	err := queryrunner.Register(&queryrunner.QueryRunnerDefinition{
+		TypeName:             TypeName,
+		BuildQueryRunnerFunc: BuildQueryRunner,
+	})
+	if err != nil {
+		panic(fmt.Errorf("register sql query runner:%w", err))
+	}
+}
+
+// BuildQueryRunner builds the query runner for database/sql.
+// the driver must be registered by importing the driver package, e.g. `_ "github.com/lib/pq"`.
+func BuildQueryRunner(name string, body hcl.Body, ctx *hcl.EvalContext) (queryrunner.QueryRunner, hcl.Diagnostics) {
+	queryRunner := &QueryRunner{
+		name: name,
+	}
+	diags := gohcl.DecodeBody(body, ctx, queryRunner)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	drivers := sql.Drivers()
+	if !lo.Contains(drivers, queryRunner.Driver) {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid driver",
+			Detail:   fmt.Sprintf("driver `%s` is not registered, available drivers are [%s]", queryRunner.Driver, strings.Join(drivers, ", ")),
+			Subject:  body.MissingItemRange().Ptr(),
+		})
+		return nil, diags
+	}
+	db, err := sql.Open(queryRunner.Driver, queryRunner.DSN)
+	if err != nil {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "initialize database client",
+			Detail:   fmt.Sprintf("failed open database:%v", err),
+			Subject:  body.MissingItemRange().Ptr(),
+		})
+		return nil, diags
+	}
+	queryRunner.db = db
+	return queryRunner, diags
+}
+
+type QueryRunner struct {
+	db   *sql.DB
+	name string
+
+	Driver string `hcl:"driver"`
+	DSN    string `hcl:"dsn"`
+}
+
+func (r *QueryRunner) Name() string {
+	return r.name
+}
+
+func (r *QueryRunner) Type() string {
+	return TypeName
+}
+
+type PreparedQuery struct {
+	*queryrunner.QueryBase
+	runner *QueryRunner
+
+	SQL        hcl.Expression `hcl:"sql"`
+	Parameters hcl.Expression `hcl:"parameters,optional"`
+}
+
+func (r *QueryRunner) Prepare(base *queryrunner.QueryBase) (queryrunner.PreparedQuery, hcl.Diagnostics) {
+	log.Printf("[debug] prepare `%s` with sql query_runner", base.Name())
+	q := &PreparedQuery{
+		QueryBase: base,
+		runner:    r,
+	}
+	body := base.Remain()
+	ctx := base.NewEvalContext(nil, nil)
+	diags := gohcl.DecodeBody(body, ctx, q)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	value, _ := q.SQL.Value(ctx)
+	if value.IsKnown() && value.Type() == cty.String && value.AsString() == "" {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid SQL template",
+			Detail:   "sql is empty",
+			Subject:  q.SQL.Range().Ptr(),
+		})
+		return nil, diags
+	}
+	diags = append(diags, queryrunner.ValidateParameters(q.SQL, q.Parameters, ctx)...)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	return q, diags
+}
+
+func (q *PreparedQuery) Run(ctx context.Context, variables map[string]cty.Value, functions map[string]function.Function) (*queryrunner.QueryResult, error) {
+	return queryrunner.CollectStream(ctx, q, variables, functions)
+}
+
+func (q *PreparedQuery) Stream(ctx context.Context, variables map[string]cty.Value, functions map[string]function.Function, w queryrunner.RowWriter) (*queryrunner.QueryResult, error) {
+	query, args, err := q.render(variables, functions)
+	if err != nil {
+		return nil, err
+	}
+	return q.runner.RunQuery(ctx, q.Name(), query, args, w)
+}
+
+// Render returns the SQL and the arguments sent to the database without running it.
+func (q *PreparedQuery) Render(ctx context.Context, variables map[string]cty.Value, functions map[string]function.Function) (*queryrunner.RenderedQuery, error) {
+	query, args, err := q.render(variables, functions)
+	if err != nil {
+		return nil, err
+	}
+	attributes := map[string]interface{}{
+		"driver": q.runner.Driver,
+	}
+	if len(args) > 0 {
+		attributes["args"] = args
+	}
+	return q.NewRenderedQuery(query, attributes), nil
+}
+
+func (q *PreparedQuery) render(variables map[string]cty.Value, functions map[string]function.Function) (string, []interface{}, error) {
+	evalCtx := q.NewEvalContext(variables, functions)
+	value, diags := q.SQL.Value(evalCtx)
+	if diags.HasErrors() {
+		return "", nil, diags
+	}
+	if !value.IsKnown() {
+		return "", nil, errors.New("SQL is unknown")
+	}
+	if value.Type() != cty.String {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid SQL template",
+			Detail:   "sql is not string",
+			Subject:  q.SQL.Range().Ptr(),
+		})
+		return "", nil, diags
+	}
+	params, diags := queryrunner.EvaluateParameters(q.Parameters, evalCtx)
+	if diags.HasErrors() {
+		return "", nil, diags
+	}
+	query := value.AsString()
+	bound, err := queryrunner.BindParameters(query, params)
+	if err != nil {
+		return "", nil, err
+	}
+	var args []interface{}
+	if len(bound) > 0 {
+		query = queryrunner.ReplacePlaceholders(query, func(index int, _ queryrunner.Placeholder) string {
+			return q.runner.bindVar(index)
+		})
+		args = lo.Map(bound, func(p queryrunner.QueryParameter, _ int) interface{} {
+			return p.GoValue()
+		})
+	}
+	return query, args, nil
+}
+
+// bindVar returns the placeholder of the driver for the index-th parameter.
+func (r *QueryRunner) bindVar(index int) string {
+	switch r.Driver {
+	case "postgres", "pgx", "pgx/v5":
+		return "$" + strconv.Itoa(index+1)
+	default:
+		return "?"
+	}
+}
+
+// RunQuery executes query with args and writes result rows to w, returned QueryResult has no rows.
+func (r *QueryRunner) RunQuery(ctx context.Context, name string, query string, args []interface{}, w queryrunner.RowWriter) (*queryrunner.QueryResult, error) {
+	reqID := queryrunner.GetRequestID(ctx)
+	log.Printf("[info][%s] start sql query `%s` with driver `%s`", reqID, name, r.Driver)
+	log.Printf("[debug][%s] query: %s", reqID, query)
+	queryStart := time.Now()
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query context:%w", err)
+	}
+	defer rows.Close()
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, fmt.Errorf("column types:%w", err)
+	}
+	if len(columnTypes) == 0 {
+		log.Printf("[info][%s] success sql query `%s` without result set, elapsed_time=%s", reqID, name, time.Since(queryStart))
+		return queryrunner.NewEmptyQueryResult(name, query), nil
+	}
+	columns := make(queryrunner.Columns, 0, len(columnTypes))
+	for _, ct := range columnTypes {
+		nullable, ok := ct.Nullable()
+		columns = append(columns, queryrunner.Column{
+			Name:     ct.Name(),
+			Type:     columnType(ct.DatabaseTypeName()),
+			Nullable: nullable || !ok,
+		})
+	}
+	if err := w.WriteColumns(columns); err != nil {
+		return nil, fmt.Errorf("write columns:%w", err)
+	}
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		dest := make([]interface{}, len(columns))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("scan row:%w", err)
+		}
+		for i := range values {
+			values[i] = convertValue(columns[i], values[i])
+		}
+		if err := w.WriteRow(values); err != nil {
+			return nil, fmt.Errorf("write row:%w", err)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("read rows:%w", err)
+	}
+	log.Printf("[info][%s] success sql query `%s`, elapsed_time=%s", reqID, name, time.Since(queryStart))
+	return queryrunner.NewQueryResultWithColumns(name, query, columns, nil), nil
+}
+
+// columnType maps the database type name reported by the driver, the names differ for each database.
+// when the database reports no type name, such as expressions in SQLite, the type is unknown.
+func columnType(typeName string) queryrunner.ColumnType {
+	typeName = strings.ToUpper(strings.TrimSpace(typeName))
+	if index := strings.IndexByte(typeName, '('); index >= 0 {
+		typeName = strings.TrimSpace(typeName[:index])
+	}
+	typeName = strings.TrimPrefix(typeName, "UNSIGNED ")
+	switch typeName {
+	case "":
+		return queryrunner.ColumnTypeUnknown
+	case "TINYINT", "SMALLINT", "MEDIUMINT", "INT", "INTEGER", "BIGINT", "INT2", "INT4", "INT8", "SERIAL", "BIGSERIAL", "YEAR":
+		return queryrunner.ColumnTypeInteger
+	case "FLOAT", "FLOAT4", "FLOAT8", "REAL", "DOUBLE", "DOUBLE PRECISION":
+		return queryrunner.ColumnTypeFloat
+	case "DECIMAL", "NUMERIC", "MONEY":
+		return queryrunner.ColumnTypeDecimal
+	case "BOOL", "BOOLEAN":
+		return queryrunner.ColumnTypeBoolean
+	case "DATE", "TIME", "TIMETZ", "DATETIME", "TIMESTAMP", "TIMESTAMPTZ":
+		return queryrunner.ColumnTypeTimestamp
+	case "BLOB", "TINYBLOB", "MEDIUMBLOB", "LONGBLOB", "BINARY", "VARBINARY", "BYTEA":
+		return queryrunner.ColumnTypeBinary
+	case "JSON", "JSONB":
+		return queryrunner.ColumnTypeJSON
+	default:
+		return queryrunner.ColumnTypeString
+	}
+}
+
+// convertValue converts the scanned value into the Go value of the column type.
+// drivers return values in their own representation, e.g. []byte for every type or int64 for boolean,
+// so that the value is converted as far as possible, and falls back to the value as is.
+func convertValue(column queryrunner.Column, v interface{}) interface{} {
+	switch v := v.(type) {
+	case []byte:
+		if column.Type == queryrunner.ColumnTypeBinary {
+			return v
+		}
+		return convertString(column, string(v))
+	case string:
+		return convertString(column, v)
+	case int64:
+		switch column.Type {
+		case queryrunner.ColumnTypeBoolean:
+			return v != 0
+		case queryrunner.ColumnTypeFloat:
+			return float64(v)
+		case queryrunner.ColumnTypeDecimal:
+			return json.Number(strconv.FormatInt(v, 10))
+		}
+	case float64:
+		if column.Type == queryrunner.ColumnTypeDecimal {
+			return json.Number(strconv.FormatFloat(v, 'f', -1, 64))
+		}
+	}
+	return v
+}
+
+func convertString(column queryrunner.Column, value string) interface{} {
+	switch column.Type {
+	case queryrunner.ColumnTypeInteger:
+		if i, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return i
+		}
+	case queryrunner.ColumnTypeFloat:
+		if f, err := strconv.ParseFloat(value, 64); err == nil {
+			return f
+		}
+	case queryrunner.ColumnTypeDecimal:
+		if _, err := strconv.ParseFloat(value, 64); err == nil {
+			return json.Number(value)
+		}
+	case queryrunner.ColumnTypeBoolean:
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+	case queryrunner.ColumnTypeJSON:
+		var v interface{}
+		decoder := json.NewDecoder(strings.NewReader(value))
+		decoder.UseNumber()
+		if err := decoder.Decode(&v); err == nil {
+			return v
+		}
+	}
+	return value
+}
@@ -0,0 +1,216 @@
+package databasesql_test
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/mashiike/hclconfig"
+	"github.com/mashiike/queryrunner"
+	_ "github.com/mashiike/queryrunner/databasesql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+	_ "modernc.org/sqlite"
+)
+
+func setupDatabase(t *testing.T) {
+	t.Helper()
+	dsn := filepath.Join(t.TempDir(), "test.db")
+	t.Setenv("QUERYRUNNER_SQL_DSN", dsn)
+	db, err := sql.Open("sqlite", dsn)
+	require.NoError(t, err)
+	defer db.Close()
+	_, err = db.Exec(`
+CREATE TABLE users (
+	id         INTEGER NOT NULL PRIMARY KEY,
+	name       TEXT NOT NULL,
+	score      REAL,
+	active     BOOLEAN,
+	created_at TEXT,
+	avatar     BLOB,
+	tags       JSON
+);
+INSERT INTO users VALUES
+	(1, 'hoge', 1.5, 1, '2023-04-01T00:00:00Z', x'0102', '["a","b"]'),
+	(2, 'fuga', NULL, 0, NULL, NULL, NULL),
+	(3, 'piyo', 3, 1, NULL, NULL, '{"k":1}');
+`)
+	require.NoError(t, err)
+}
+
+func loadQuery(t *testing.T) queryrunner.PreparedQuery {
+	t.Helper()
+	parser := hclparse.NewParser()
+	file, diags := parser.ParseHCLFile("testdata/config.hcl")
+	require.False(t, diags.HasErrors())
+	queries, _, diags := queryrunner.DecodeBody(file.Body, hclconfig.NewEvalContext("./"))
+	if !assert.False(t, diags.HasErrors()) {
+		var builder strings.Builder
+		w := hcl.NewDiagnosticTextWriter(&builder, parser.Files(), 400, false)
+		w.WriteDiagnostics(diags)
+		t.Log(builder.String())
+		t.FailNow()
+	}
+	query, ok := queries.Get("users")
+	require.True(t, ok)
+	return query
+}
+
+func TestRun(t *testing.T) {
+	setupDatabase(t)
+	q := loadQuery(t)
+	result, err := q.Run(context.Background(), map[string]cty.Value{
+		"var": cty.ObjectVal(map[string]cty.Value{
+			"min_id": cty.NumberIntVal(2),
+		}),
+	}, nil)
+	require.NoError(t, err)
+	require.Equal(t, "SELECT id, name, score, active, created_at, avatar, tags, 1 + 1 AS expr FROM users WHERE id >= 2 ORDER BY id", result.Query)
+	require.EqualValues(t, []string{"id", "name", "score", "active", "created_at", "avatar", "tags", "expr"}, result.Columns.Names())
+	require.EqualValues(t, []queryrunner.ColumnType{
+		queryrunner.ColumnTypeInteger,
+		queryrunner.ColumnTypeString,
+		queryrunner.ColumnTypeFloat,
+		queryrunner.ColumnTypeBoolean,
+		queryrunner.ColumnTypeString,
+		queryrunner.ColumnTypeBinary,
+		queryrunner.ColumnTypeJSON,
+		queryrunner.ColumnTypeUnknown,
+	}, result.Columns.Types())
+	require.EqualValues(t, [][]interface{}{
+		{int64(2), "fuga", nil, false, nil, nil, nil, int64(2)},
+		{int64(3), "piyo", float64(3), true, nil, nil, map[string]interface{}{"k": json.Number("1")}, int64(2)},
+	}, result.Rows)
+}
+
+func TestStreamQuery(t *testing.T) {
+	setupDatabase(t)
+	q := loadQuery(t)
+	var builder strings.Builder
+	result, err := queryrunner.StreamQuery(context.Background(), q, map[string]cty.Value{
+		"var": cty.ObjectVal(map[string]cty.Value{
+			"min_id": cty.NumberIntVal(3),
+		}),
+	}, nil, queryrunner.NewJSONLinesRowWriter(&builder))
+	require.NoError(t, err)
+	require.Nil(t, result.Rows)
+	require.JSONEq(t, `{"id":3,"name":"piyo","score":3,"active":true,"created_at":null,"avatar":null,"tags":{"k":1},"expr":2}`, builder.String())
+}
+
+func TestRunWithParameters(t *testing.T) {
+	setupDatabase(t)
+	parser := hclparse.NewParser()
+	file, diags := parser.ParseHCLFile("testdata/config.hcl")
+	require.False(t, diags.HasErrors())
+	queries, _, diags := queryrunner.DecodeBody(file.Body, hclconfig.NewEvalContext("./"))
+	require.False(t, diags.HasErrors())
+	q, ok := queries.Get("user_by_name")
+	require.True(t, ok)
+	result, err := q.Run(context.Background(), map[string]cty.Value{
+		"var": cty.ObjectVal(map[string]cty.Value{
+			"name": cty.StringVal("hoge' OR '1' = '1"),
+		}),
+	}, nil)
+	require.NoError(t, err)
+	require.EqualValues(t, [][]interface{}{
+		{int64(3), "piyo"},
+	}, result.Rows)
+}
+
+func TestDecodeBodyUndefinedParameter(t *testing.T) {
+	t.Setenv("QUERYRUNNER_SQL_DSN", filepath.Join(t.TempDir(), "test.db"))
+	parser := hclparse.NewParser()
+	file, diags := parser.ParseHCL([]byte(`
+query_runner "sql" "default" {
+  driver = "sqlite"
+  dsn    = must_env("QUERYRUNNER_SQL_DSN")
+}
+
+query "users" {
+  runner     = query_runner.sql.default
+  sql        = "SELECT * FROM users WHERE id = :id AND name = :name"
+  parameters = {
+    id = 1
+  }
+}
+`), "config.hcl")
+	require.False(t, diags.HasErrors())
+	_, _, diags = queryrunner.DecodeBody(file.Body, hclconfig.NewEvalContext("./"))
+	require.True(t, diags.HasErrors())
+	require.Equal(t, "placeholder `:name` is not defined in parameters", diags.Errs()[0].(*hcl.Diagnostic).Detail)
+}
+
+func TestRenderWithoutParameters(t *testing.T) {
+	t.Setenv("QUERYRUNNER_SQL_DSN", filepath.Join(t.TempDir(), "test.db"))
+	parser := hclparse.NewParser()
+	file, diags := parser.ParseHCL([]byte(`
+query_runner "sql" "default" {
+  driver = "sqlite"
+  dsn    = must_env("QUERYRUNNER_SQL_DSN")
+}
+
+query "time_literal" {
+  runner = query_runner.sql.default
+  sql    = "SELECT '12:30'::time AS t, :raw AS raw"
+}
+`), "config.hcl")
+	require.False(t, diags.HasErrors())
+	queries, _, diags := queryrunner.DecodeBody(file.Body, hclconfig.NewEvalContext("./"))
+	require.False(t, diags.HasErrors(), diags.Error())
+	q, ok := queries.Get("time_literal")
+	require.True(t, ok)
+	rendered, err := queryrunner.PlanQuery(context.Background(), q, nil, nil)
+	require.NoError(t, err)
+	require.Equal(t, "SELECT '12:30'::time AS t, :raw AS raw", rendered.Query)
+	require.NotContains(t, rendered.Attributes, "args")
+}
+
+func TestDecodeBodyWaiterSettingsNotSupported(t *testing.T) {
+	t.Setenv("QUERYRUNNER_SQL_DSN", filepath.Join(t.TempDir(), "test.db"))
+	parser := hclparse.NewParser()
+	file, diags := parser.ParseHCL([]byte(`
+query_runner "sql" "default" {
+  driver = "sqlite"
+  dsn    = must_env("QUERYRUNNER_SQL_DSN")
+}
+
+query "users" {
+  runner  = query_runner.sql.default
+  sql     = "SELECT * FROM users"
+  timeout = "10s"
+}
+`), "config.hcl")
+	require.False(t, diags.HasErrors())
+	_, _, diags = queryrunner.DecodeBody(file.Body, hclconfig.NewEvalContext("./"))
+	require.True(t, diags.HasErrors())
+	require.Equal(t, "Unsupported argument", diags.Errs()[0].(*hcl.Diagnostic).Summary)
+}
+
+func TestDecodeBodyRetryNotSupported(t *testing.T) {
+	t.Setenv("QUERYRUNNER_SQL_DSN", filepath.Join(t.TempDir(), "test.db"))
+	parser := hclparse.NewParser()
+	file, diags := parser.ParseHCL([]byte(`
+query_runner "sql" "default" {
+  driver = "sqlite"
+  dsn    = must_env("QUERYRUNNER_SQL_DSN")
+}
+
+query "users" {
+  runner = query_runner.sql.default
+  sql    = "SELECT * FROM users"
+  retry {
+    max_attempts = 3
+  }
+}
+`), "config.hcl")
+	require.False(t, diags.HasErrors())
+	_, _, diags = queryrunner.DecodeBody(file.Body, hclconfig.NewEvalContext("./"))
+	require.True(t, diags.HasErrors())
+	require.Equal(t, "Unsupported block type", diags.Errs()[0].(*hcl.Diagnostic).Summary)
+}
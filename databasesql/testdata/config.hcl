@@ -0,0 +1,18 @@
+query_runner "sql" "default" {
+  driver = "sqlite"
+  dsn    = must_env("QUERYRUNNER_SQL_DSN")
+}
+
+query "users" {
+  runner = query_runner.sql.default
+  sql    = "SELECT id, name, score, active, created_at, avatar, tags, 1 + 1 AS expr FROM users WHERE id >= ${var.min_id} ORDER BY id"
+}
+
+query "user_by_name" {
+  runner     = query_runner.sql.default
+  sql        = "SELECT id, name FROM users WHERE name = :name OR id = :id ORDER BY id"
+  parameters = {
+    name = var.name
+    id   = 3
+  }
+}
@@ -0,0 +1,371 @@
+package queryrunner
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+	"golang.org/x/sync/errgroup"
+)
+
+// Dependencies returns names of the queries referred as `query.<name>` in the query body.
+func (q *QueryBase) Dependencies() []string {
+	if q == nil {
+		return nil
+	}
+	return q.dependencies
+}
+
+type dependent interface {
+	Dependencies() []string
+}
+
+type dependencyResolver interface {
+	resolveDependencies(queries PreparedQueries) hcl.Diagnostics
+	dependencyRange(name string) hcl.Range
+}
+
+// queryDependencies returns names of the queries that the query depends on.
+func queryDependencies(query PreparedQuery) []string {
+	if d, ok := query.(dependent); ok {
+		return d.Dependencies()
+	}
+	return nil
+}
+
+// referencedQueryTraversals returns `query.*` traversals in the body.
+func referencedQueryTraversals(body hcl.Body) []hcl.Traversal {
+	traversals, ok := bodyTraversals(body)
+	if !ok {
+		return nil
+	}
+	referenced := make([]hcl.Traversal, 0)
+	for _, traversal := range traversals {
+		if traversal.RootName() == "query" {
+			referenced = append(referenced, traversal)
+		}
+	}
+	return referenced
+}
+
+// resolveDependencies resolves `query.*` traversals of the body to the query names.
+func (q *QueryBase) resolveDependencies(queries PreparedQueries) hcl.Diagnostics {
+	var diags hcl.Diagnostics
+	q.dependencies = nil
+	q.dependencyRanges = make(map[string]hcl.Range)
+	for _, traversal := range q.queryTraversals {
+		query, err := TraversalQuery(traversal, queries)
+		if err != nil {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid Relation",
+				Detail:   fmt.Sprintf(`%s, please write as query.<name>.rows`, err.Error()),
+				Subject:  traversal.SourceRange().Ptr(),
+			})
+			continue
+		}
+		if _, ok := q.dependencyRanges[query.Name()]; ok {
+			continue
+		}
+		q.dependencies = append(q.dependencies, query.Name())
+		q.dependencyRanges[query.Name()] = traversal.SourceRange()
+	}
+	return diags
+}
+
+func (q *QueryBase) dependencyRange(name string) hcl.Range {
+	return q.dependencyRanges[name]
+}
+
+// resolveQueryDependencies resolves dependencies of all queries and detects dependency cycles.
+func resolveQueryDependencies(queries PreparedQueries) hcl.Diagnostics {
+	var diags hcl.Diagnostics
+	for _, query := range queries {
+		if r, ok := query.(dependencyResolver); ok {
+			diags = append(diags, r.resolveDependencies(queries)...)
+		}
+	}
+	if diags.HasErrors() {
+		return diags
+	}
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[string]int, len(queries))
+	path := make([]string, 0, len(queries))
+	var visit func(query PreparedQuery) bool
+	visit = func(query PreparedQuery) bool {
+		switch state[query.Name()] {
+		case visiting:
+			start := 0
+			for i, name := range path {
+				if name == query.Name() {
+					start = i
+				}
+			}
+			cycle := append(append([]string{}, path[start:]...), query.Name())
+			var subject *hcl.Range
+			if last, ok := queries.Get(path[len(path)-1]); ok {
+				if r, ok := last.(dependencyResolver); ok {
+					subject = r.dependencyRange(query.Name()).Ptr()
+				}
+			}
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Dependency cycle",
+				Detail:   fmt.Sprintf("query dependency cycle found: %s", strings.Join(cycle, " -> ")),
+				Subject:  subject,
+			})
+			return false
+		case visited:
+			return true
+		}
+		state[query.Name()] = visiting
+		path = append(path, query.Name())
+		for _, name := range queryDependencies(query) {
+			dep, _ := queries.Get(name)
+			if !visit(dep) {
+				return false
+			}
+		}
+		path = path[:len(path)-1]
+		state[query.Name()] = visited
+		return true
+	}
+	for _, query := range queries {
+		if !visit(query) {
+			break
+		}
+	}
+	return diags
+}
+
+// withQueryResults returns a copy of variables with `query` object of the results.
+func withQueryResults(variables map[string]cty.Value, results QueryResults) map[string]cty.Value {
+	upstream := make(map[string]cty.Value, len(results))
+	for _, result := range results {
+		upstream[result.Name] = result.MarshalCTYValue()
+	}
+	copied := make(map[string]cty.Value, len(variables)+1)
+	for key, value := range variables {
+		copied[key] = value
+	}
+	copied["query"] = cty.ObjectVal(upstream)
+	return copied
+}
+
+type queryNode struct {
+	query    PreparedQuery
+	target   bool
+	upstream bool
+	done     chan struct{}
+	summary  *QueryResult
+	result   *QueryResult
+	err      error
+}
+
+// planQueries returns the queries of names and the queries they depend on.
+func planQueries(queries PreparedQueries, names []string) (map[string]*queryNode, error) {
+	nodes := make(map[string]*queryNode, len(names))
+	var visit func(name string) error
+	visit = func(name string) error {
+		if _, ok := nodes[name]; ok {
+			return nil
+		}
+		query, ok := queries.Get(name)
+		if !ok {
+			return fmt.Errorf("query `%s` is not found", name)
+		}
+		nodes[name] = &queryNode{
+			query: query,
+			done:  make(chan struct{}),
+		}
+		for _, dep := range queryDependencies(query) {
+			if err := visit(dep); err != nil {
+				return err
+			}
+			nodes[dep].upstream = true
+		}
+		return nil
+	}
+	for _, name := range names {
+		if err := visit(name); err != nil {
+			return nil, err
+		}
+		nodes[name].target = true
+	}
+	return nodes, nil
+}
+
+// RunOptions is the options of StreamQueries and RunQueries.
+type RunOptions struct {
+	// ContinueOnError keeps running the other queries when a query fails, the error is set to Err of its result instead of returned.
+	// the queries that depend on the failed query also fail.
+	ContinueOnError bool
+	// Parallelism is the maximum number of the queries running at once, 0 is unlimited.
+	// the queries of a query runner with `max_concurrency` are also limited by it.
+	Parallelism int
+}
+
+// StreamQueries runs the queries of names with the queries they depend on, rows of the queries of names are written to the RowWriter returned by newWriter.
+// if the RowWriter implements io.Closer, it is closed when the query finished, whether it succeeded or not.
+// the queries with `output` block are written to the output location instead, and their results have Output.
+// each query runs as soon as its dependencies are finished, so that independent queries run concurrently.
+// the results of the dependencies are given as `query.<name>` variable, see QueryResult.MarshalCTYValue.
+// variables of all queries are evaluated before any query runs. the returned results are in the order of names and have no rows.
+// by default, the first error cancels the other queries and is returned, see RunOptions.ContinueOnError.
+func StreamQueries(ctx context.Context, queries PreparedQueries, names []string, variables map[string]cty.Value, functions map[string]function.Function, newWriter func(query PreparedQuery) RowWriter, optFns ...func(*RunOptions)) (QueryResults, error) {
+	var opts RunOptions
+	for _, optFn := range optFns {
+		optFn(&opts)
+	}
+	nodes, err := planQueries(queries, names)
+	if err != nil {
+		return nil, err
+	}
+	for _, node := range nodes {
+		if _, err := EvaluateVariables(node.query, variables); err != nil {
+			if !opts.ContinueOnError {
+				return nil, err
+			}
+			node.err = err
+		}
+	}
+	limiter := newConcurrencyLimiter(opts.Parallelism)
+	eg, egctx := errgroup.WithContext(ctx)
+	if opts.ContinueOnError {
+		// the failed query must not cancel the others.
+		eg, egctx = &errgroup.Group{}, ctx
+	}
+	for _, node := range nodes {
+		node := node
+		eg.Go(func() error {
+			err := node.run(egctx, nodes, limiter, variables, functions, newWriter)
+			if err == nil {
+				return nil
+			}
+			if !opts.ContinueOnError {
+				return err
+			}
+			log.Printf("[error][%s] query `%s` failed: %v", GetRequestID(ctx), node.query.Name(), err)
+			node.err = err
+			close(node.done)
+			return nil
+		})
+	}
+	if err := eg.Wait(); err != nil {
+		return nil, err
+	}
+	results := make(QueryResults, 0, len(names))
+	for _, name := range names {
+		node := nodes[name]
+		if node.err != nil {
+			results = append(results, &QueryResult{
+				Name: name,
+				Err:  node.err,
+			})
+			continue
+		}
+		results = append(results, node.summary)
+	}
+	return results, nil
+}
+
+// run runs the query after its dependencies are finished and a slot of limiter is acquired, and closes done when it succeeded.
+func (node *queryNode) run(ctx context.Context, nodes map[string]*queryNode, limiter *concurrencyLimiter, variables map[string]cty.Value, functions map[string]function.Function, newWriter func(query PreparedQuery) RowWriter) error {
+	if node.err != nil {
+		return node.err
+	}
+	deps := queryDependencies(node.query)
+	if len(deps) > 0 {
+		upstream := make(QueryResults, 0, len(deps))
+		for _, dep := range deps {
+			select {
+			case <-nodes[dep].done:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			if nodes[dep].err != nil {
+				return fmt.Errorf("query `%s` depends on failed query `%s`", node.query.Name(), dep)
+			}
+			upstream = append(upstream, nodes[dep].result)
+		}
+		variables = withQueryResults(variables, upstream)
+	}
+	release, err := limiter.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+	// the query with `output` block is written to the output location instead of newWriter.
+	output := node.target && hasOutput(node.query)
+	collector := &rowCollector{}
+	var target, w RowWriter
+	switch {
+	case node.target && !output && node.upstream:
+		target = newWriter(node.query)
+		w = &teeRowWriter{w: target, tee: collector}
+	case node.target && !output:
+		target = newWriter(node.query)
+		w = target
+	default:
+		w = collector
+	}
+	log.Printf("[debug] start run `%s` runner type `%s`", node.query.Name(), node.query.RunnerType())
+	summary, err := StreamQuery(ctx, node.query, variables, functions, w)
+	if closer, ok := target.(io.Closer); ok {
+		if closeErr := closer.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		return err
+	}
+	log.Printf("[debug] finish run `%s` runner type `%s`", node.query.Name(), node.query.RunnerType())
+	node.summary = summary
+	if node.upstream {
+		node.result = collector.QueryResult(summary)
+	}
+	if output {
+		node.summary, err = writeQueryOutput(ctx, node.query, variables, functions, collector.QueryResult(summary))
+		if err != nil {
+			return err
+		}
+	}
+	close(node.done)
+	return nil
+}
+
+// RunQueries is same as StreamQueries, but the returned results have all rows.
+func RunQueries(ctx context.Context, queries PreparedQueries, names []string, variables map[string]cty.Value, functions map[string]function.Function, optFns ...func(*RunOptions)) (QueryResults, error) {
+	var mu sync.Mutex
+	collectors := make(map[string]*rowCollector, len(names))
+	summaries, err := StreamQueries(ctx, queries, names, variables, functions, func(query PreparedQuery) RowWriter {
+		mu.Lock()
+		defer mu.Unlock()
+		collector := &rowCollector{}
+		collectors[query.Name()] = collector
+		return collector
+	}, optFns...)
+	if err != nil {
+		return nil, err
+	}
+	results := make(QueryResults, 0, len(summaries))
+	for i, summary := range summaries {
+		collector, ok := collectors[names[i]]
+		if !ok || summary.Err != nil {
+			results = append(results, summary)
+			continue
+		}
+		results = append(results, collector.QueryResult(summary))
+	}
+	return results, nil
+}
@@ -0,0 +1,146 @@
+package queryrunner_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/mashiike/queryrunner"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestRunQueriesWithDependencies(t *testing.T) {
+	queries, diags := decodeVariablesConfig(t, `
+	query_runner "dummy" "default" {
+		columns = ["name"]
+	}
+
+	query "groups" {
+		runner = query_runner.dummy.default
+		rows = [
+			[ "/aws/lambda/hoge" ],
+			[ "/aws/lambda/fuga" ],
+		]
+	}
+
+	query "logs" {
+		runner = query_runner.dummy.default
+		rows = [for r in query.groups.rows : [ "logs of ${r[0]}" ]]
+	}
+
+	query "count" {
+		runner = query_runner.dummy.default
+		rows = [
+			[ "${query.logs.rows[1][0]} in ${query.groups.rows[0][0]}" ],
+		]
+	}
+	`)
+	if !assert.False(t, diags.HasErrors()) {
+		t.Log(diags.Error())
+		t.FailNow()
+	}
+	query, ok := queries.Get("count")
+	require.True(t, ok)
+	require.ElementsMatch(t, []string{"logs", "groups"}, query.(interface{ Dependencies() []string }).Dependencies())
+
+	variables := map[string]cty.Value{
+		"var": cty.NullVal(cty.DynamicPseudoType),
+	}
+	results, err := queryrunner.RunQueries(context.Background(), queries, []string{"count", "logs"}, variables, nil)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(results))
+	require.Equal(t, "count", results[0].Name)
+	require.EqualValues(t, [][]interface{}{{"logs of /aws/lambda/fuga in /aws/lambda/hoge"}}, results[0].Rows)
+	require.Equal(t, "logs", results[1].Name)
+	require.EqualValues(t, [][]interface{}{{"logs of /aws/lambda/hoge"}, {"logs of /aws/lambda/fuga"}}, results[1].Rows)
+
+	_, err = queryrunner.RunQueries(context.Background(), queries, []string{"not_found"}, variables, nil)
+	require.EqualError(t, err, "query `not_found` is not found")
+}
+
+func TestRunQueriesContinueOnError(t *testing.T) {
+	queries, diags := decodeVariablesConfig(t, `
+	query_runner "dummy" "default" {
+		columns = ["name"]
+	}
+
+	query "broken" {
+		runner = query_runner.dummy.default
+		rows = "not rows"
+	}
+
+	query "downstream" {
+		runner = query_runner.dummy.default
+		rows = query.broken.rows
+	}
+
+	query "hello" {
+		runner = query_runner.dummy.default
+		rows = [[ "hello" ]]
+	}
+	`)
+	if !assert.False(t, diags.HasErrors()) {
+		t.Log(diags.Error())
+		t.FailNow()
+	}
+	variables := map[string]cty.Value{
+		"var": cty.NullVal(cty.DynamicPseudoType),
+	}
+	names := []string{"broken", "downstream", "hello"}
+	_, err := queryrunner.RunQueries(context.Background(), queries, names, variables, nil)
+	require.Error(t, err)
+
+	results, err := queryrunner.RunQueries(context.Background(), queries, names, variables, nil, func(opts *queryrunner.RunOptions) {
+		opts.ContinueOnError = true
+	})
+	require.NoError(t, err)
+	require.Equal(t, 3, len(results))
+	require.Error(t, results[0].Err)
+	require.EqualError(t, results[1].Err, "query `downstream` depends on failed query `broken`")
+	require.NoError(t, results[2].Err)
+	require.EqualValues(t, [][]interface{}{{"hello"}}, results[2].Rows)
+	require.True(t, strings.HasPrefix(results.Err().Error(), "2 of 3 queries failed: query `broken`: "))
+}
+
+func TestDecodeBodyDependencyCycle(t *testing.T) {
+	_, diags := decodeVariablesConfig(t, `
+	query_runner "dummy" "default" {
+		columns = ["name"]
+	}
+
+	query "first" {
+		runner = query_runner.dummy.default
+		rows = query.third.rows
+	}
+
+	query "second" {
+		runner = query_runner.dummy.default
+		rows = query.first.rows
+	}
+
+	query "third" {
+		runner = query_runner.dummy.default
+		rows = query.second.rows
+	}
+	`)
+	require.True(t, diags.HasErrors())
+	require.Equal(t, "query dependency cycle found: first -> third -> second -> first", diags.Errs()[0].(*hcl.Diagnostic).Detail)
+}
+
+func TestDecodeBodyDependencyNotFound(t *testing.T) {
+	_, diags := decodeVariablesConfig(t, `
+	query_runner "dummy" "default" {
+		columns = ["name"]
+	}
+
+	query "first" {
+		runner = query_runner.dummy.default
+		rows = query.unknown.rows
+	}
+	`)
+	require.True(t, diags.HasErrors())
+	require.True(t, strings.HasPrefix(diags.Errs()[0].(*hcl.Diagnostic).Detail, "query.unknown is not found"))
+}
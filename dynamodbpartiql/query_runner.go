@@ -0,0 +1,417 @@
+package dynamodbpartiql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/gohcl"
+	"github.com/mashiike/queryrunner"
+	"github.com/samber/lo"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+)
+
+const TypeName = "dynamodb_partiql"
+
+// DefaultMaxItems is the maximum number of items read by a query when `max_items` is not set.
+const DefaultMaxItems = 1000
+
+func init() {
+	err := queryrunner.Register(&queryrunner.QueryRunnerDefinition{
+		TypeName:             TypeName,
+		BuildQueryRunnerFunc: BuildQueryRunner,
+	})
+	if err != nil {
+		panic(fmt.Errorf("register dynamodb_partiql query runner:%w", err))
+	}
+}
+
+// Client is the subset of DynamoDB API used by the query runner.
+type Client interface {
+	ExecuteStatement(ctx context.Context, params *dynamodb.ExecuteStatementInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ExecuteStatementOutput, error)
+}
+
+func BuildQueryRunner(name string, body hcl.Body, ctx *hcl.EvalContext) (queryrunner.QueryRunner, hcl.Diagnostics) {
+	retryPolicy, body, diags := queryrunner.DecodeRetryPolicy(body, ctx)
+	queryRunner := &QueryRunner{
+		name:        name,
+		retryPolicy: retryPolicy,
+	}
+	diags = append(diags, gohcl.DecodeBody(body, ctx, queryRunner)...)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	if queryRunner.MaxItems != nil && *queryRunner.MaxItems < 1 {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid max_items",
+			Detail:   fmt.Sprintf("max_items must be greater than or equal to 1: %d", *queryRunner.MaxItems),
+			Subject:  body.MissingItemRange().Ptr(),
+		})
+		return nil, diags
+	}
+	optFns := make([]func(*config.LoadOptions) error, 0)
+	if queryRunner.Region != nil {
+		optFns = append(optFns, config.WithRegion(*queryRunner.Region))
+	}
+	awsCfg, err := config.LoadDefaultConfig(context.Background(), optFns...)
+	if err != nil {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "initialize aws client",
+			Detail:   fmt.Sprintf("failed load aws default config:%v", err),
+			Subject:  body.MissingItemRange().Ptr(),
+		})
+		return nil, diags
+	}
+	queryRunner.client = dynamodb.NewFromConfig(awsCfg)
+	return queryRunner, diags
+}
+
+type QueryRunner struct {
+	client      Client
+	name        string
+	retryPolicy queryrunner.RetryPolicy
+
+	Region   *string `hcl:"region"`
+	MaxItems *int    `hcl:"max_items"`
+}
+
+func (r *QueryRunner) Name() string {
+	return r.name
+}
+
+func (r *QueryRunner) Type() string {
+	return TypeName
+}
+
+type PreparedQuery struct {
+	*queryrunner.QueryBase
+	runner *QueryRunner
+
+	Statement      hcl.Expression `hcl:"statement"`
+	Parameters     hcl.Expression `hcl:"parameters,optional"`
+	MaxItems       *int           `hcl:"max_items"`
+	ConsistentRead *bool          `hcl:"consistent_read"`
+}
+
+func (r *QueryRunner) Prepare(base *queryrunner.QueryBase) (queryrunner.PreparedQuery, hcl.Diagnostics) {
+	log.Printf("[debug] prepare `%s` with dynamodb_partiql query_runner", base.Name())
+	q := &PreparedQuery{
+		QueryBase: base,
+		runner:    r,
+	}
+	ctx := base.NewEvalContext(nil, nil)
+	body, diags := base.DecodeRetryPolicy(base.Remain(), ctx)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	diags = append(diags, gohcl.DecodeBody(body, ctx, q)...)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	value, _ := q.Statement.Value(ctx)
+	if value.IsKnown() && value.Type() == cty.String && value.AsString() == "" {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid statement template",
+			Detail:   "statement is empty",
+			Subject:  q.Statement.Range().Ptr(),
+		})
+		return nil, diags
+	}
+	if q.MaxItems != nil && *q.MaxItems < 1 {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid max_items",
+			Detail:   fmt.Sprintf("max_items must be greater than or equal to 1: %d", *q.MaxItems),
+			Subject:  body.MissingItemRange().Ptr(),
+		})
+		return nil, diags
+	}
+	diags = append(diags, queryrunner.ValidateParameters(q.Statement, q.Parameters, ctx)...)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	return q, diags
+}
+
+func (q *PreparedQuery) Run(ctx context.Context, variables map[string]cty.Value, functions map[string]function.Function) (*queryrunner.QueryResult, error) {
+	return queryrunner.CollectStream(ctx, q, variables, functions)
+}
+
+func (q *PreparedQuery) Stream(ctx context.Context, variables map[string]cty.Value, functions map[string]function.Function, w queryrunner.RowWriter) (*queryrunner.QueryResult, error) {
+	statement, parameters, err := q.render(variables, functions)
+	if err != nil {
+		return nil, err
+	}
+	return q.runner.RunQuery(ctx, q.Name(), statement, parameters, q.maxItems(), aws.ToBool(q.ConsistentRead), w)
+}
+
+// Render returns the statement and the parameters sent to DynamoDB without running it.
+func (q *PreparedQuery) Render(ctx context.Context, variables map[string]cty.Value, functions map[string]function.Function) (*queryrunner.RenderedQuery, error) {
+	statement, parameters, err := q.render(variables, functions)
+	if err != nil {
+		return nil, err
+	}
+	attributes := map[string]interface{}{
+		"max_items": q.maxItems(),
+	}
+	if len(parameters) > 0 {
+		attributes["parameters"] = lo.Map(parameters, func(av types.AttributeValue, _ int) interface{} {
+			return plainValue(av)
+		})
+	}
+	return q.NewRenderedQuery(statement, attributes), nil
+}
+
+// maxItems returns `max_items` of the query, that overrides the query runner.
+func (q *PreparedQuery) maxItems() int {
+	if q.MaxItems != nil {
+		return *q.MaxItems
+	}
+	if q.runner.MaxItems != nil {
+		return *q.runner.MaxItems
+	}
+	return DefaultMaxItems
+}
+
+func (q *PreparedQuery) render(variables map[string]cty.Value, functions map[string]function.Function) (string, []types.AttributeValue, error) {
+	evalCtx := q.NewEvalContext(variables, functions)
+	value, diags := q.Statement.Value(evalCtx)
+	if diags.HasErrors() {
+		return "", nil, diags
+	}
+	if !value.IsKnown() {
+		return "", nil, errors.New("statement is unknown")
+	}
+	if value.Type() != cty.String {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid statement template",
+			Detail:   "statement is not string",
+			Subject:  q.Statement.Range().Ptr(),
+		})
+		return "", nil, diags
+	}
+	params, diags := queryrunner.EvaluateParameters(q.Parameters, evalCtx)
+	if diags.HasErrors() {
+		return "", nil, diags
+	}
+	statement := value.AsString()
+	bound, err := queryrunner.BindParameters(statement, params)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(bound) == 0 {
+		return statement, nil, nil
+	}
+	// PartiQL parameters are positional `?`.
+	statement = queryrunner.ReplacePlaceholders(statement, func(_ int, _ queryrunner.Placeholder) string {
+		return "?"
+	})
+	parameters := make([]types.AttributeValue, 0, len(bound))
+	for _, p := range bound {
+		av, err := attributeValue(p.Value)
+		if err != nil {
+			return "", nil, fmt.Errorf("parameter `%s`: %w", p.Name, err)
+		}
+		parameters = append(parameters, av)
+	}
+	return statement, parameters, nil
+}
+
+// RunQuery executes the statement and writes the items to w, returned QueryResult has no rows.
+// the pages are read by NextToken until maxItems items are written, the rest of the items are truncated.
+func (r *QueryRunner) RunQuery(ctx context.Context, name string, statement string, parameters []types.AttributeValue, maxItems int, consistentRead bool, w queryrunner.RowWriter) (*queryrunner.QueryResult, error) {
+	reqID := queryrunner.GetRequestID(ctx)
+	log.Printf("[info][%s] start dynamodb partiql query `%s`", reqID, name)
+	log.Printf("[debug][%s] statement: %s", reqID, statement)
+	queryStart := time.Now()
+	mw := queryrunner.NewRowMapWriter(w)
+	var (
+		nextToken     *string
+		items         int
+		pages         int
+		capacityUnits float64
+		truncated     bool
+	)
+	for {
+		input := &dynamodb.ExecuteStatementInput{
+			Statement:              aws.String(statement),
+			Parameters:             parameters,
+			ConsistentRead:         aws.Bool(consistentRead),
+			NextToken:              nextToken,
+			ReturnConsumedCapacity: types.ReturnConsumedCapacityTotal,
+		}
+		var output *dynamodb.ExecuteStatementOutput
+		var err error
+		if nextToken == nil {
+			// the first request may write items, so it is not retried.
+			output, err = r.client.ExecuteStatement(ctx, input)
+		} else {
+			err = queryrunner.Retry(ctx, r.retryPolicy, func(ctx context.Context) error {
+				var err error
+				output, err = r.client.ExecuteStatement(ctx, input)
+				return err
+			})
+		}
+		if err != nil {
+			return nil, fmt.Errorf("execute statement:%w", err)
+		}
+		pages++
+		if output.ConsumedCapacity != nil {
+			capacityUnits += aws.ToFloat64(output.ConsumedCapacity.CapacityUnits)
+		}
+		for _, item := range output.Items {
+			if items >= maxItems {
+				truncated = true
+				break
+			}
+			if err := mw.WriteRowMap(itemRowMap(item)); err != nil {
+				return nil, fmt.Errorf("write row:%w", err)
+			}
+			items++
+		}
+		nextToken = output.NextToken
+		if nextToken == nil || truncated {
+			break
+		}
+		if items >= maxItems {
+			truncated = true
+			break
+		}
+	}
+	if truncated {
+		log.Printf("[warn][%s] dynamodb partiql query `%s` is truncated to %d items, please set max_items to read more", reqID, name, maxItems)
+	}
+	log.Printf("[info][%s] success dynamodb partiql query `%s`, elapsed_time=%s", reqID, name, time.Since(queryStart))
+	result := queryrunner.NewQueryResultWithColumns(name, statement, mw.Columns(), nil)
+	if items == 0 {
+		result = queryrunner.NewEmptyQueryResult(name, statement)
+	}
+	result.Stats = &queryrunner.Stats{
+		Extra: map[string]interface{}{
+			"pages":                   pages,
+			"consumed_capacity_units": capacityUnits,
+			"truncated":               truncated,
+		},
+	}
+	return result, nil
+}
+
+// itemRowMap flattens the item into the row map by the top-level attributes, nested maps, lists and sets are JSON text.
+func itemRowMap(item map[string]types.AttributeValue) map[string]interface{} {
+	rowMap := make(map[string]interface{}, len(item))
+	for name, av := range item {
+		switch av := av.(type) {
+		case *types.AttributeValueMemberM, *types.AttributeValueMemberL,
+			*types.AttributeValueMemberSS, *types.AttributeValueMemberNS, *types.AttributeValueMemberBS:
+			bs, err := json.Marshal(plainValue(av))
+			if err != nil {
+				rowMap[name] = nil
+				continue
+			}
+			rowMap[name] = string(bs)
+		case *types.AttributeValueMemberN:
+			// integers are int64, the other numbers are kept as json.Number for the precision of DynamoDB numbers.
+			n := json.Number(av.Value)
+			if i, err := n.Int64(); err == nil {
+				rowMap[name] = i
+				continue
+			}
+			rowMap[name] = n
+		default:
+			rowMap[name] = plainValue(av)
+		}
+	}
+	return rowMap
+}
+
+// plainValue converts the attribute value into the Go value, numbers are json.Number to keep the precision.
+func plainValue(av types.AttributeValue) interface{} {
+	switch av := av.(type) {
+	case *types.AttributeValueMemberS:
+		return av.Value
+	case *types.AttributeValueMemberN:
+		return json.Number(av.Value)
+	case *types.AttributeValueMemberBOOL:
+		return av.Value
+	case *types.AttributeValueMemberB:
+		return av.Value
+	case *types.AttributeValueMemberNULL:
+		return nil
+	case *types.AttributeValueMemberM:
+		m := make(map[string]interface{}, len(av.Value))
+		for key, value := range av.Value {
+			m[key] = plainValue(value)
+		}
+		return m
+	case *types.AttributeValueMemberL:
+		return lo.Map(av.Value, func(value types.AttributeValue, _ int) interface{} {
+			return plainValue(value)
+		})
+	case *types.AttributeValueMemberSS:
+		return av.Value
+	case *types.AttributeValueMemberNS:
+		return lo.Map(av.Value, func(value string, _ int) json.Number {
+			return json.Number(value)
+		})
+	case *types.AttributeValueMemberBS:
+		return av.Value
+	default:
+		return nil
+	}
+}
+
+// attributeValue converts the parameter value into the attribute value.
+func attributeValue(v cty.Value) (types.AttributeValue, error) {
+	if v.IsNull() {
+		return &types.AttributeValueMemberNULL{Value: true}, nil
+	}
+	if !v.IsKnown() {
+		return nil, errors.New("value is unknown")
+	}
+	t := v.Type()
+	switch {
+	case t == cty.String:
+		return &types.AttributeValueMemberS{Value: v.AsString()}, nil
+	case t == cty.Number:
+		return &types.AttributeValueMemberN{Value: v.AsBigFloat().Text('f', -1)}, nil
+	case t == cty.Bool:
+		return &types.AttributeValueMemberBOOL{Value: v.True()}, nil
+	case t.IsListType() || t.IsTupleType() || t.IsSetType():
+		values := make([]types.AttributeValue, 0, v.LengthInt())
+		for it := v.ElementIterator(); it.Next(); {
+			_, elem := it.Element()
+			av, err := attributeValue(elem)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, av)
+		}
+		return &types.AttributeValueMemberL{Value: values}, nil
+	case t.IsMapType() || t.IsObjectType():
+		values := make(map[string]types.AttributeValue, v.LengthInt())
+		for it := v.ElementIterator(); it.Next(); {
+			key, elem := it.Element()
+			av, err := attributeValue(elem)
+			if err != nil {
+				return nil, err
+			}
+			values[key.AsString()] = av
+		}
+		return &types.AttributeValueMemberM{Value: values}, nil
+	default:
+		return nil, fmt.Errorf("unsupported type %s", t.FriendlyName())
+	}
+}
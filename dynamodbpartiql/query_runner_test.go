@@ -0,0 +1,116 @@
+package dynamodbpartiql
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/mashiike/hclconfig"
+	"github.com/mashiike/queryrunner"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+type stubClient struct {
+	inputs []*dynamodb.ExecuteStatementInput
+	pages  []*dynamodb.ExecuteStatementOutput
+}
+
+func (c *stubClient) ExecuteStatement(ctx context.Context, params *dynamodb.ExecuteStatementInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ExecuteStatementOutput, error) {
+	c.inputs = append(c.inputs, params)
+	index := 0
+	if params.NextToken != nil {
+		index = len(*params.NextToken)
+	}
+	return c.pages[index], nil
+}
+
+func loadQuery(t *testing.T, name string, client Client) *PreparedQuery {
+	t.Helper()
+	parser := hclparse.NewParser()
+	file, diags := parser.ParseHCLFile("testdata/config.hcl")
+	require.False(t, diags.HasErrors())
+	queries, _, diags := queryrunner.DecodeBody(file.Body, hclconfig.NewEvalContext("./"))
+	if !assert.False(t, diags.HasErrors()) {
+		var builder strings.Builder
+		w := hcl.NewDiagnosticTextWriter(&builder, parser.Files(), 400, false)
+		w.WriteDiagnostics(diags)
+		t.Log(builder.String())
+		t.FailNow()
+	}
+	query, ok := queries.Get(name)
+	require.True(t, ok)
+	q, ok := query.(*PreparedQuery)
+	require.True(t, ok)
+	q.runner.client = client
+	return q
+}
+
+func TestRun(t *testing.T) {
+	client := &stubClient{
+		pages: []*dynamodb.ExecuteStatementOutput{
+			{
+				Items: []map[string]types.AttributeValue{
+					{
+						"order_id": &types.AttributeValueMemberS{Value: "o-1"},
+						"amount":   &types.AttributeValueMemberN{Value: "1200"},
+						"items": &types.AttributeValueMemberL{Value: []types.AttributeValue{
+							&types.AttributeValueMemberM{Value: map[string]types.AttributeValue{
+								"sku": &types.AttributeValueMemberS{Value: "A-1"},
+								"qty": &types.AttributeValueMemberN{Value: "2"},
+							}},
+						}},
+					},
+					{
+						"order_id": &types.AttributeValueMemberS{Value: "o-2"},
+						"amount":   &types.AttributeValueMemberN{Value: "300"},
+						"gift":     &types.AttributeValueMemberBOOL{Value: true},
+					},
+				},
+				ConsumedCapacity: &types.ConsumedCapacity{CapacityUnits: aws.Float64(1.5)},
+				NextToken:        aws.String("1"),
+			},
+			{
+				Items: []map[string]types.AttributeValue{
+					{
+						"order_id": &types.AttributeValueMemberS{Value: "o-3"},
+						"tags":     &types.AttributeValueMemberSS{Value: []string{"a", "b"}},
+					},
+					{
+						"order_id": &types.AttributeValueMemberS{Value: "o-4"},
+					},
+				},
+				NextToken: aws.String("11"),
+			},
+		},
+	}
+	q := loadQuery(t, "orders", client)
+	result, err := q.Run(context.Background(), map[string]cty.Value{
+		"var": cty.ObjectVal(map[string]cty.Value{
+			"customer_id": cty.StringVal("c-1"),
+		}),
+	}, nil)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(client.inputs))
+	require.Equal(t, `SELECT * FROM "orders" WHERE customer_id = ? AND status IN [?]`, *client.inputs[0].Statement)
+	require.EqualValues(t, []types.AttributeValue{
+		&types.AttributeValueMemberS{Value: "c-1"},
+		&types.AttributeValueMemberS{Value: "shipped"},
+	}, client.inputs[0].Parameters)
+	require.Equal(t, "1", *client.inputs[1].NextToken)
+	require.EqualValues(t, []string{"amount", "items", "order_id", "gift", "tags"}, result.Columns.Names())
+	require.Equal(t, queryrunner.ColumnTypeInteger, result.Columns[0].Type)
+	require.EqualValues(t, [][]interface{}{
+		{int64(1200), `[{"qty":2,"sku":"A-1"}]`, "o-1", nil, nil},
+		{int64(300), nil, "o-2", true, nil},
+		{nil, nil, "o-3", nil, `["a","b"]`},
+	}, result.Rows)
+	require.Equal(t, true, result.Stats.Extra["truncated"])
+	require.Equal(t, 1.5, result.Stats.Extra["consumed_capacity_units"])
+}
@@ -0,0 +1,13 @@
+query_runner "dynamodb_partiql" "default" {
+  region    = "ap-northeast-1"
+  max_items = 3
+}
+
+query "orders" {
+  runner     = query_runner.dynamodb_partiql.default
+  statement  = "SELECT * FROM \"orders\" WHERE customer_id = :customer_id AND status IN [:statuses]"
+  parameters = {
+    customer_id = var.customer_id
+    statuses    = "shipped"
+  }
+}
@@ -0,0 +1,175 @@
+package queryrunner
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Fixture is the recorded query result, that is written by FixtureRecorder and replayed by the `fixture` query runner.
+// cell values are encoded as JSON, and decoded by the column types.
+type Fixture struct {
+	Name    string          `json:"name"`
+	Query   string          `json:"query"`
+	Columns Columns         `json:"columns"`
+	Rows    [][]interface{} `json:"rows"`
+}
+
+// NewFixture returns the fixture of the query result.
+func NewFixture(result *QueryResult) *Fixture {
+	columns := result.Columns
+	if columns == nil {
+		columns = make(Columns, 0)
+	}
+	rows := make([][]interface{}, 0, len(result.Rows))
+	for _, row := range result.Rows {
+		values := make([]interface{}, 0, len(row))
+		for _, v := range row {
+			values = append(values, jsonValue(v))
+		}
+		rows = append(rows, values)
+	}
+	return &Fixture{
+		Name:    result.Name,
+		Query:   result.Query,
+		Columns: columns,
+		Rows:    rows,
+	}
+}
+
+// ReadFixture reads the fixture written by WriteFixture.
+func ReadFixture(r io.Reader) (*Fixture, error) {
+	decoder := json.NewDecoder(r)
+	decoder.UseNumber()
+	var fixture Fixture
+	if err := decoder.Decode(&fixture); err != nil {
+		return nil, err
+	}
+	if fixture.Columns == nil {
+		return nil, fmt.Errorf("fixture `%s` has no columns", fixture.Name)
+	}
+	return &fixture, nil
+}
+
+// WriteFixture writes the fixture as indented JSON.
+func WriteFixture(w io.Writer, fixture *Fixture) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(fixture)
+}
+
+// QueryResult returns the query result of the fixture, cell values are converted to the canonical types of the column types.
+func (f *Fixture) QueryResult() (*QueryResult, error) {
+	rows := make([][]interface{}, 0, len(f.Rows))
+	for i, row := range f.Rows {
+		if len(row) != len(f.Columns) {
+			return nil, fmt.Errorf("row %d has %d values, but %d columns", i, len(row), len(f.Columns))
+		}
+		values := make([]interface{}, 0, len(row))
+		for j, v := range row {
+			value, err := fixtureValue(f.Columns[j], v)
+			if err != nil {
+				return nil, fmt.Errorf("row %d column `%s`: %w", i, f.Columns[j].Name, err)
+			}
+			values = append(values, value)
+		}
+		rows = append(rows, values)
+	}
+	return NewQueryResultWithColumns(f.Name, f.Query, f.Columns, rows), nil
+}
+
+// fixtureValue converts a cell value decoded from JSON by the column type.
+// timestamp and binary values that are not written from time.Time or []byte are kept as string.
+func fixtureValue(column Column, v interface{}) (interface{}, error) {
+	if v == nil {
+		return nil, nil
+	}
+	switch column.Type {
+	case ColumnTypeInteger, ColumnTypeFloat:
+		n, ok := v.(json.Number)
+		if !ok {
+			return v, nil
+		}
+		if column.Type == ColumnTypeInteger {
+			if i, err := n.Int64(); err == nil {
+				return i, nil
+			}
+		}
+		if f, err := n.Float64(); err == nil {
+			return f, nil
+		}
+		return n, nil
+	case ColumnTypeTimestamp:
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("timestamp is not string: %v", v)
+		}
+		// the runners emitting the backend's string form, such as "2023-01-01 00:00:00.000", are replayed as it is.
+		if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+			return t, nil
+		}
+		return s, nil
+	case ColumnTypeBinary:
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("binary is not string: %v", v)
+		}
+		if b, err := hex.DecodeString(s); err == nil {
+			return b, nil
+		}
+		return s, nil
+	case ColumnTypeDecimal, ColumnTypeString, ColumnTypeBoolean:
+		return v, nil
+	default:
+		return normalizeJSONNumber(v), nil
+	}
+}
+
+// FixtureRecorder records query results as fixture files in the directory, the file name is `<query name>.json`.
+type FixtureRecorder struct {
+	dir string
+}
+
+func NewFixtureRecorder(dir string) *FixtureRecorder {
+	return &FixtureRecorder{
+		dir: dir,
+	}
+}
+
+// Path returns the fixture file path of the query.
+func (r *FixtureRecorder) Path(name string) string {
+	return filepath.Join(r.dir, name+".json")
+}
+
+// Record writes the query result to the fixture file, the existing file is overwritten.
+func (r *FixtureRecorder) Record(result *QueryResult) error {
+	var buf bytes.Buffer
+	if err := WriteFixture(&buf, NewFixture(result)); err != nil {
+		return fmt.Errorf("encode fixture `%s`: %w", result.Name, err)
+	}
+	if err := os.MkdirAll(r.dir, 0755); err != nil {
+		return err
+	}
+	path := r.Path(result.Name)
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		return err
+	}
+	log.Printf("[info] query `%s` result is recorded to `%s`", result.Name, path)
+	return nil
+}
+
+// recordFixture records the result if ctx has FixtureRecorder.
+func recordFixture(ctx context.Context, result *QueryResult) error {
+	recorder := GetFixtureRecorder(ctx)
+	if recorder == nil {
+		return nil
+	}
+	return recorder.Record(result)
+}
@@ -0,0 +1,422 @@
+package fixture
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/gohcl"
+	"github.com/mashiike/queryrunner"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+)
+
+const TypeName = "fixture"
+
+// DefaultDir is the directory of the recorded fixtures, when `dir` is omitted in the query runner block.
+const DefaultDir = "fixtures"
+
+func init() {
+	err := queryrunner.Register(&queryrunner.QueryRunnerDefinition{
+		TypeName:             TypeName,
+		BuildQueryRunnerFunc: BuildQueryRunner,
+	})
+	if err != nil {
+		panic(fmt.Errorf("register fixture query runner:%w", err))
+	}
+}
+
+func BuildQueryRunner(name string, body hcl.Body, ctx *hcl.EvalContext) (queryrunner.QueryRunner, hcl.Diagnostics) {
+	queryRunner := &QueryRunner{
+		name: name,
+	}
+	diags := gohcl.DecodeBody(body, ctx, queryRunner)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	if queryRunner.Dir == nil {
+		dir := DefaultDir
+		queryRunner.Dir = &dir
+	}
+	return queryRunner, diags
+}
+
+type QueryRunner struct {
+	name string
+	Dir  *string `hcl:"dir"`
+}
+
+func (r *QueryRunner) Name() string {
+	return r.name
+}
+
+func (r *QueryRunner) Type() string {
+	return TypeName
+}
+
+// PreparedQuery returns the rows of `rows` attribute, `file` attribute or the recorded fixture `<dir>/<query name>.json`.
+type PreparedQuery struct {
+	*queryrunner.QueryBase
+	runner *QueryRunner
+
+	Query   hcl.Expression `hcl:"query"`
+	Columns []string       `hcl:"columns,optional"`
+	Rows    hcl.Expression `hcl:"rows"`
+	File    hcl.Expression `hcl:"file"`
+}
+
+func (r *QueryRunner) Prepare(base *queryrunner.QueryBase) (queryrunner.PreparedQuery, hcl.Diagnostics) {
+	log.Printf("[debug] prepare `%s` with fixture query_runner", base.Name())
+	q := &PreparedQuery{
+		QueryBase: base,
+		runner:    r,
+	}
+	ctx := base.NewEvalContext(nil, nil)
+	diags := gohcl.DecodeBody(base.Remain(), ctx, q)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	if isSet(q.Rows, ctx) && isSet(q.File, ctx) {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid fixture",
+			Detail:   "rows and file attributes are exclusive",
+			Subject:  q.File.Range().Ptr(),
+		})
+		return nil, diags
+	}
+	return q, diags
+}
+
+func isSet(expr hcl.Expression, ctx *hcl.EvalContext) bool {
+	value, _ := expr.Value(ctx)
+	return !value.IsKnown() || !value.IsNull()
+}
+
+type runQueryParameters struct {
+	name    string
+	query   string
+	columns []string
+	rows    cty.Value
+	file    string
+}
+
+func (q *PreparedQuery) Run(ctx context.Context, variables map[string]cty.Value, functions map[string]function.Function) (*queryrunner.QueryResult, error) {
+	return queryrunner.CollectStream(ctx, q, variables, functions)
+}
+
+func (q *PreparedQuery) Stream(ctx context.Context, variables map[string]cty.Value, functions map[string]function.Function, w queryrunner.RowWriter) (*queryrunner.QueryResult, error) {
+	params, err := q.render(variables, functions)
+	if err != nil {
+		return nil, err
+	}
+	return q.runner.RunQuery(ctx, params, w)
+}
+
+// Render returns the query and the fixture file without reading it.
+func (q *PreparedQuery) Render(ctx context.Context, variables map[string]cty.Value, functions map[string]function.Function) (*queryrunner.RenderedQuery, error) {
+	params, err := q.render(variables, functions)
+	if err != nil {
+		return nil, err
+	}
+	attributes := map[string]interface{}{}
+	if params.file != "" {
+		attributes["file"] = params.file
+	} else {
+		attributes["rows"] = params.rows.LengthInt()
+	}
+	if len(params.columns) > 0 {
+		attributes["columns"] = params.columns
+	}
+	return q.NewRenderedQuery(params.query, attributes), nil
+}
+
+func (q *PreparedQuery) render(variables map[string]cty.Value, functions map[string]function.Function) (*runQueryParameters, error) {
+	evalCtx := q.NewEvalContext(variables, functions)
+	params := &runQueryParameters{
+		name:    q.Name(),
+		columns: q.Columns,
+	}
+	query, diags := evaluateOptionalString("query", q.Query, evalCtx)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	params.query = query
+	rows, diags := q.Rows.Value(evalCtx)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	if !rows.IsNull() {
+		if !rows.IsWhollyKnown() || !(rows.Type().IsTupleType() || rows.Type().IsListType()) {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid rows",
+				Detail:   "rows must be a list of objects or lists",
+				Subject:  q.Rows.Range().Ptr(),
+			})
+			return nil, diags
+		}
+		params.rows = rows
+		return params, nil
+	}
+	file, diags := evaluateOptionalString("file", q.File, evalCtx)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	if file == "" {
+		file = filepath.Join(*q.runner.Dir, q.Name()+".json")
+	}
+	params.file = file
+	return params, nil
+}
+
+func evaluateOptionalString(name string, expr hcl.Expression, evalCtx *hcl.EvalContext) (string, hcl.Diagnostics) {
+	value, diags := expr.Value(evalCtx)
+	if diags.HasErrors() {
+		return "", diags
+	}
+	if value.IsKnown() && value.IsNull() {
+		return "", diags
+	}
+	if !value.IsKnown() || value.Type() != cty.String {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  fmt.Sprintf("Invalid %s template", name),
+			Detail:   fmt.Sprintf("%s is not string", name),
+			Subject:  expr.Range().Ptr(),
+		})
+		return "", diags
+	}
+	return value.AsString(), diags
+}
+
+// RunQuery writes the fixture rows to w, returned QueryResult has no rows.
+func (r *QueryRunner) RunQuery(ctx context.Context, params *runQueryParameters, w queryrunner.RowWriter) (*queryrunner.QueryResult, error) {
+	reqID := queryrunner.GetRequestID(ctx)
+	log.Printf("[info][%s] start fixture `%s`", reqID, params.name)
+	queryStart := time.Now()
+	mw := queryrunner.NewRowMapWriter(w)
+	var recorded *queryrunner.QueryResult
+	var err error
+	switch {
+	case params.file == "":
+		log.Printf("[debug][%s] inline rows: %d", reqID, params.rows.LengthInt())
+		err = writeInlineRows(mw, params.columns, params.rows)
+	case strings.EqualFold(filepath.Ext(params.file), ".csv"):
+		log.Printf("[debug][%s] csv file: %s", reqID, params.file)
+		err = writeCSVFile(mw, params.file)
+	case isJSONLinesFile(params.file):
+		log.Printf("[debug][%s] json lines file: %s", reqID, params.file)
+		err = writeJSONLinesFile(mw, params.file)
+	default:
+		log.Printf("[debug][%s] json file: %s", reqID, params.file)
+		recorded, err = writeJSONFile(mw, params.file)
+	}
+	if err != nil {
+		return nil, err
+	}
+	columns := mw.Columns()
+	query := params.query
+	if recorded != nil {
+		if err := recorded.WriteRows(w); err != nil {
+			return nil, err
+		}
+		columns = recorded.Columns
+		if query == "" {
+			query = recorded.Query
+		}
+	}
+	log.Printf("[info][%s] success fixture `%s`, elapsed_time=%s", reqID, params.name, time.Since(queryStart))
+	return &queryrunner.QueryResult{
+		Name:    params.name,
+		Query:   query,
+		Columns: columns,
+		Stats: &queryrunner.Stats{
+			Extra: map[string]interface{}{
+				"source": source(params),
+			},
+		},
+	}, nil
+}
+
+func source(params *runQueryParameters) string {
+	if params.file == "" {
+		return "rows"
+	}
+	return params.file
+}
+
+// writeInlineRows writes the rows of `rows` attribute, object rows without `columns` are written in the sorted order of the keys.
+func writeInlineRows(mw *queryrunner.RowMapWriter, columns []string, rows cty.Value) error {
+	i := 0
+	for it := rows.ElementIterator(); it.Next(); i++ {
+		_, row := it.Element()
+		ty := row.Type()
+		names := columns
+		var values []cty.Value
+		switch {
+		case !row.IsNull() && (ty.IsObjectType() || ty.IsMapType()):
+			valueMap := row.AsValueMap()
+			if len(names) == 0 {
+				names = make([]string, 0, len(valueMap))
+				for name := range valueMap {
+					names = append(names, name)
+				}
+				sort.Strings(names)
+			}
+			values = make([]cty.Value, 0, len(names))
+			for _, name := range names {
+				v, ok := valueMap[name]
+				if !ok {
+					v = cty.NullVal(cty.DynamicPseudoType)
+				}
+				values = append(values, v)
+			}
+		case !row.IsNull() && (ty.IsTupleType() || ty.IsListType()):
+			values = row.AsValueSlice()
+			if len(values) != len(names) {
+				return fmt.Errorf("rows[%d] has %d values, but columns has %d names", i, len(values), len(names))
+			}
+		default:
+			return fmt.Errorf("rows[%d] is not object or list", i)
+		}
+		fields := make([]interface{}, 0, len(values))
+		for _, v := range values {
+			field, err := goValue(v)
+			if err != nil {
+				return fmt.Errorf("rows[%d]: %w", i, err)
+			}
+			fields = append(fields, field)
+		}
+		if err := mw.WriteFields(names, fields); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// goValue converts cty.Value to the cell value, numbers are int64 or float64 and the others are JSON compatible values.
+func goValue(value cty.Value) (interface{}, error) {
+	if value.IsNull() {
+		return nil, nil
+	}
+	bs, err := ctyjson.Marshal(value, value.Type())
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(bs))
+	decoder.UseNumber()
+	var v interface{}
+	if err := decoder.Decode(&v); err != nil {
+		return nil, err
+	}
+	if n, ok := v.(json.Number); ok {
+		if i, err := n.Int64(); err == nil {
+			return i, nil
+		}
+		return n.Float64()
+	}
+	return v, nil
+}
+
+// writeCSVFile writes the rows of the CSV file, the first line is the header.
+func writeCSVFile(mw *queryrunner.RowMapWriter, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	reader := csv.NewReader(f)
+	header, err := reader.Read()
+	if err != nil {
+		return fmt.Errorf("read csv header %s: %w", path, err)
+	}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("read csv %s: %w", path, err)
+		}
+		values := make([]interface{}, 0, len(record))
+		for _, v := range record {
+			values = append(values, v)
+		}
+		if err := mw.WriteFields(header, values); err != nil {
+			return err
+		}
+	}
+}
+
+func isJSONLinesFile(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".jsonl" || ext == ".ndjson"
+}
+
+func writeJSONLinesFile(mw *queryrunner.RowMapWriter, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	decoder := json.NewDecoder(f)
+	for {
+		var line json.RawMessage
+		err := decoder.Decode(&line)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("read json lines %s: %w", path, err)
+		}
+		if err := mw.WriteJSONLine(line); err != nil {
+			return fmt.Errorf("read json lines %s: %w", path, err)
+		}
+	}
+}
+
+// writeJSONFile writes the rows of the JSON file that is an array of objects,
+// or returns the fixture recorded by FixtureRecorder without writing, that keeps the column types.
+func writeJSONFile(mw *queryrunner.RowMapWriter, path string) (*queryrunner.QueryResult, error) {
+	bs, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("fixture %s is not found, record it with --record-fixtures option", path)
+		}
+		return nil, err
+	}
+	if trimmed := bytes.TrimSpace(bs); len(trimmed) > 0 && trimmed[0] == '{' {
+		fixture, err := queryrunner.ReadFixture(bytes.NewReader(bs))
+		if err != nil {
+			return nil, fmt.Errorf("read fixture %s: %w", path, err)
+		}
+		result, err := fixture.QueryResult()
+		if err != nil {
+			return nil, fmt.Errorf("read fixture %s: %w", path, err)
+		}
+		return result, nil
+	}
+	var lines []json.RawMessage
+	if err := json.Unmarshal(bs, &lines); err != nil {
+		return nil, fmt.Errorf("read json %s: %w", path, err)
+	}
+	for _, line := range lines {
+		if err := mw.WriteJSONLine(line); err != nil {
+			return nil, fmt.Errorf("read json %s: %w", path, err)
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,119 @@
+package fixture
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/mashiike/hclconfig"
+	"github.com/mashiike/queryrunner"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func loadQuery(t *testing.T, name string) *PreparedQuery {
+	t.Helper()
+	parser := hclparse.NewParser()
+	file, diags := parser.ParseHCLFile("testdata/config.hcl")
+	require.False(t, diags.HasErrors())
+	queries, _, diags := queryrunner.DecodeBody(file.Body, hclconfig.NewEvalContext("./"))
+	if !assert.False(t, diags.HasErrors()) {
+		var builder strings.Builder
+		w := hcl.NewDiagnosticTextWriter(&builder, parser.Files(), 400, false)
+		w.WriteDiagnostics(diags)
+		t.Log(builder.String())
+		t.FailNow()
+	}
+	query, ok := queries.Get(name)
+	require.True(t, ok)
+	q, ok := query.(*PreparedQuery)
+	require.True(t, ok)
+	return q
+}
+
+func TestRunInline(t *testing.T) {
+	q := loadQuery(t, "inline")
+	result, err := q.Run(context.Background(), map[string]cty.Value{
+		"var": cty.ObjectVal(map[string]cty.Value{
+			"team": cty.StringVal("dev"),
+		}),
+	}, nil)
+	require.NoError(t, err)
+	require.Equal(t, "SELECT * FROM users WHERE team = 'dev'", result.Query)
+	require.EqualValues(t, []string{"id", "name", "score"}, result.Columns.Names())
+	require.EqualValues(t, []queryrunner.ColumnType{queryrunner.ColumnTypeInteger, queryrunner.ColumnTypeString, queryrunner.ColumnTypeFloat}, result.Columns.Types())
+	require.EqualValues(t, [][]interface{}{
+		{int64(1), "alice", 1.5},
+		{int64(2), "bob", nil},
+	}, result.Rows)
+
+	q = loadQuery(t, "inline_columns")
+	result, err = q.Run(context.Background(), nil, nil)
+	require.NoError(t, err)
+	require.EqualValues(t, []string{"name", "id", "tags"}, result.Columns.Names())
+	require.EqualValues(t, [][]interface{}{
+		{"alice", int64(1), []interface{}{"admin"}},
+		{"bob", int64(2), nil},
+	}, result.Rows)
+}
+
+func TestRunFile(t *testing.T) {
+	q := loadQuery(t, "users_csv")
+	result, err := q.Run(context.Background(), nil, nil)
+	require.NoError(t, err)
+	require.EqualValues(t, []string{"id", "name"}, result.Columns.Names())
+	require.EqualValues(t, [][]interface{}{
+		{"1", "alice"},
+		{"2", "bob"},
+	}, result.Rows)
+	require.Equal(t, "testdata/users.csv", result.Stats.Extra["source"])
+
+	q = loadQuery(t, "events_jsonl")
+	result, err = q.Run(context.Background(), nil, nil)
+	require.NoError(t, err)
+	require.EqualValues(t, []string{"event", "user", "count", "amount"}, result.Columns.Names())
+	require.EqualValues(t, [][]interface{}{
+		{"login", "alice", int64(1), nil},
+		{"purchase", "bob", int64(2), 10.5},
+	}, result.Rows)
+
+	q = loadQuery(t, "recorded")
+	result, err = q.Run(context.Background(), nil, nil)
+	require.NoError(t, err)
+	require.Equal(t, "SELECT id, at FROM events", result.Query)
+	require.EqualValues(t, queryrunner.Columns{
+		{Name: "id", Type: queryrunner.ColumnTypeInteger},
+		{Name: "at", Type: queryrunner.ColumnTypeTimestamp, Nullable: true},
+	}, result.Columns)
+	require.EqualValues(t, [][]interface{}{
+		{int64(1), time.Date(2023, 4, 1, 0, 0, 0, 0, time.UTC)},
+		{int64(2), nil},
+	}, result.Rows)
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	dir := t.TempDir()
+	ctx := queryrunner.WithFixtureRecorder(context.Background(), queryrunner.NewFixtureRecorder(dir))
+	variables := map[string]cty.Value{
+		"var": cty.ObjectVal(map[string]cty.Value{
+			"team": cty.StringVal("dev"),
+			"dir":  cty.StringVal(dir),
+		}),
+	}
+	var builder strings.Builder
+	_, err := queryrunner.StreamQuery(ctx, loadQuery(t, "inline"), variables, nil, queryrunner.NewJSONLinesRowWriter(&builder))
+	require.NoError(t, err)
+
+	recorded, err := queryrunner.RunQuery(context.Background(), loadQuery(t, "replay"), variables, nil)
+	require.NoError(t, err)
+	require.Equal(t, "SELECT * FROM users WHERE team = 'dev'", recorded.Query)
+	require.EqualValues(t, []string{"id", "name", "score"}, recorded.Columns.Names())
+	require.EqualValues(t, [][]interface{}{
+		{int64(1), "alice", 1.5},
+		{int64(2), "bob", nil},
+	}, recorded.Rows)
+}
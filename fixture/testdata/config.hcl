@@ -0,0 +1,40 @@
+query_runner "fixture" "default" {
+  dir = "testdata/fixtures"
+}
+
+query "inline" {
+  runner = query_runner.fixture.default
+  query  = "SELECT * FROM users WHERE team = '${var.team}'"
+  rows = [
+    { id = 1, name = "alice", score = 1.5 },
+    { id = 2, name = "bob", score = null },
+  ]
+}
+
+query "inline_columns" {
+  runner  = query_runner.fixture.default
+  columns = ["name", "id", "tags"]
+  rows = [
+    ["alice", 1, ["admin"]],
+    { id = 2, name = "bob" },
+  ]
+}
+
+query "users_csv" {
+  runner = query_runner.fixture.default
+  file   = "testdata/users.csv"
+}
+
+query "events_jsonl" {
+  runner = query_runner.fixture.default
+  file   = "testdata/events.jsonl"
+}
+
+query "recorded" {
+  runner = query_runner.fixture.default
+}
+
+query "replay" {
+  runner = query_runner.fixture.default
+  file   = "${var.dir}/inline.json"
+}
@@ -0,0 +1,73 @@
+package queryrunner_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mashiike/queryrunner"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestFixtureRecorder(t *testing.T) {
+	query, _ := loadCountingQuery(t)
+	dir := t.TempDir()
+	recorder := queryrunner.NewFixtureRecorder(dir)
+	ctx := queryrunner.WithCacheStorage(context.Background(), queryrunner.NewMemoryCacheStorage())
+	ctx = queryrunner.WithFixtureRecorder(ctx, recorder)
+	variables := map[string]cty.Value{
+		"var": cty.ObjectVal(map[string]cty.Value{
+			"id": cty.NumberIntVal(1),
+		}),
+	}
+	result, err := queryrunner.RunQuery(ctx, query, variables, nil)
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(dir, "cached.json"), recorder.Path("cached"))
+
+	fp, err := os.Open(recorder.Path("cached"))
+	require.NoError(t, err)
+	defer fp.Close()
+	fixture, err := queryrunner.ReadFixture(fp)
+	require.NoError(t, err)
+	replayed, err := fixture.QueryResult()
+	require.NoError(t, err)
+	require.Equal(t, "SELECT 1", replayed.Query)
+	require.EqualValues(t, result.Columns, replayed.Columns)
+	require.EqualValues(t, result.Rows, replayed.Rows)
+
+	require.NoError(t, os.Remove(recorder.Path("cached")))
+	var builder strings.Builder
+	_, err = queryrunner.StreamQuery(ctx, query, variables, nil, queryrunner.NewJSONLinesRowWriter(&builder))
+	require.NoError(t, err)
+	_, err = os.Stat(recorder.Path("cached"))
+	require.NoError(t, err, "cache hit result is also recorded")
+}
+
+func TestFixtureRoundTrip(t *testing.T) {
+	columns := queryrunner.Columns{
+		{Name: "time", Type: queryrunner.ColumnTypeTimestamp, Nullable: true},
+		{Name: "data", Type: queryrunner.ColumnTypeBinary, Nullable: true},
+		{Name: "count", Type: queryrunner.ColumnTypeInteger, Nullable: true},
+	}
+	rows := [][]interface{}{
+		// time.Time and []byte, such as sql runner.
+		{time.Date(2023, 1, 1, 0, 0, 0, 123000000, time.UTC), []byte("hel"), int64(1)},
+		// the backend's string form, such as cloudwatch_logs_insights @timestamp and redshift_data timestamp.
+		{"2023-01-01 00:00:00.000", "68 65 6c", int64(2)},
+		{nil, nil, nil},
+	}
+	result := queryrunner.NewQueryResultWithColumns("events", "SELECT * FROM events", columns, rows)
+	var buf bytes.Buffer
+	require.NoError(t, queryrunner.WriteFixture(&buf, queryrunner.NewFixture(result)))
+	fixture, err := queryrunner.ReadFixture(&buf)
+	require.NoError(t, err)
+	replayed, err := fixture.QueryResult()
+	require.NoError(t, err)
+	require.EqualValues(t, columns, replayed.Columns)
+	require.EqualValues(t, rows, replayed.Rows)
+}
@@ -8,7 +8,13 @@ import (
 	"github.com/mashiike/hclconfig"
 )
 
+// DecodeBody decodes query_runner, query and variable blocks. query_group blocks are validated, see Config to get them.
 func DecodeBody(body hcl.Body, ctx *hcl.EvalContext) (PreparedQueries, hcl.Body, hcl.Diagnostics) {
+	queries, _, remain, diags := decodeBody(body, ctx)
+	return queries, remain, diags
+}
+
+func decodeBody(body hcl.Body, ctx *hcl.EvalContext) (PreparedQueries, QueryGroups, hcl.Body, hcl.Diagnostics) {
 	schema := &hcl.BodySchema{
 		Blocks: []hcl.BlockHeaderSchema{
 			{
@@ -19,46 +25,81 @@ func DecodeBody(body hcl.Body, ctx *hcl.EvalContext) (PreparedQueries, hcl.Body,
 				Type:       "query",
 				LabelNames: []string{"name"},
 			},
+			{
+				Type:       "variable",
+				LabelNames: []string{"name"},
+			},
+			{
+				Type:       "query_group",
+				LabelNames: []string{"name"},
+			},
 		},
 	}
 	content, remain, diags := body.PartialContent(schema)
-	diags = append(diags, hclconfig.RestrictUniqueBlockLabels(content, "query_runner", "query")...)
+	diags = append(diags, hclconfig.RestrictUniqueBlockLabels(content, "query_runner", "query", "variable", "query_group")...)
 
 	queryRunnerBlocks := make(hcl.Blocks, 0)
 	queryBlocks := make(hcl.Blocks, 0)
+	groupBlocks := make(hcl.Blocks, 0)
+	var variables Variables
 	for _, block := range content.Blocks {
 		switch block.Type {
+		case "variable":
+			v, decodeDiags := DecodeVariable(block, ctx)
+			diags = append(diags, decodeDiags...)
+			if v != nil {
+				variables = append(variables, v)
+			}
 		case "query_runner":
 			queryRunnerBlocks = append(queryRunnerBlocks, block)
 		case "query":
 			queryBlocks = append(queryBlocks, block)
+		case "query_group":
+			groupBlocks = append(groupBlocks, block)
 		}
 	}
 	runners := make(QueryRunners, 0, len(queryRunnerBlocks))
+	// the queries of the same query runner share the limiter of `max_concurrency`.
+	limiters := make(map[string]*concurrencyLimiter, len(queryRunnerBlocks))
 	for _, block := range queryRunnerBlocks {
 		runnerType := block.Labels[0]
 		runnerName := block.Labels[1]
-		query, buildDiags := NewQueryRunner(runnerType, runnerName, block.Body, ctx)
+		maxConcurrency, runnerBody, limitDiags := decodeMaxConcurrency(block.Body, ctx)
+		diags = append(diags, limitDiags...)
+		query, buildDiags := NewQueryRunner(runnerType, runnerName, runnerBody, ctx)
 		diags = append(diags, buildDiags...)
 		runners = append(runners, query)
+		limiters[runnerType+"."+runnerName] = newConcurrencyLimiter(maxConcurrency)
 	}
 	if diags.HasErrors() {
-		return nil, remain, diags
+		return nil, nil, remain, diags
 	}
 	queries := make(PreparedQueries, 0, len(queryBlocks))
 	for _, block := range queryBlocks {
 		base := &QueryBase{
 			name: block.Labels[0],
 		}
-		query, decodeDiags := base.DecodeBody(block.Body, ctx, runners)
+		query, decodeDiags := base.decodeBody(block.Body, ctx, runners, variables)
 		diags = append(diags, decodeDiags...)
 		if decodeDiags.HasErrors() {
 			continue
 		}
+		base.limiter = limiters[base.runner.Type()+"."+base.runner.Name()]
 		queries = append(queries, query)
 	}
-
-	return queries, remain, diags
+	if diags.HasErrors() {
+		return queries, nil, remain, diags
+	}
+	diags = append(diags, resolveQueryDependencies(queries)...)
+	groups := make(QueryGroups, 0, len(groupBlocks))
+	for _, block := range groupBlocks {
+		group, decodeDiags := decodeQueryGroupBlock(block, ctx, queries)
+		diags = append(diags, decodeDiags...)
+		if group != nil {
+			groups = append(groups, group)
+		}
+	}
+	return queries, groups, remain, diags
 }
 
 func TraversalQuery(traversal hcl.Traversal, queries PreparedQueries) (PreparedQuery, error) {
@@ -36,7 +36,12 @@ func (r *dummyQueryRunner) Prepare(base *queryrunner.QueryBase) (queryrunner.Pre
 		QueryBase: base,
 		columns:   r.Columns,
 	}
-	diags := gohcl.DecodeBody(base.Remain(), base.NewEvalContext(nil, nil), q)
+	// dummy query runner accepts the waiter attributes and `retry` block as the polling query runners.
+	ctx := base.NewEvalContext(nil, nil)
+	body, diags := base.DecodeWaiterSettings(ctx)
+	body, retryDiags := base.DecodeRetryPolicy(body, ctx)
+	diags = append(diags, retryDiags...)
+	diags = append(diags, gohcl.DecodeBody(body, ctx, q)...)
 	return q, diags
 
 }
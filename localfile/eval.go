@@ -0,0 +1,799 @@
+package localfile
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// evalEnv is the record and the aggregated values that expressions are evaluated with.
+type evalEnv struct {
+	rec        record
+	alias      string
+	aggregates []interface{}
+}
+
+// expr is the node of SQL expression, the value is nil, string, bool, int64, float64, time.Time or JSON compatible values.
+type expr interface {
+	eval(env *evalEnv) (interface{}, error)
+}
+
+type literalExpr struct {
+	value interface{}
+}
+
+func (e *literalExpr) eval(_ *evalEnv) (interface{}, error) {
+	return e.value, nil
+}
+
+type pathExpr struct {
+	steps []pathStep
+}
+
+// lastName returns the name of the last step, that is used as the column name.
+func (e *pathExpr) lastName() string {
+	step := e.steps[len(e.steps)-1]
+	if step.isIndex {
+		return ""
+	}
+	return step.name
+}
+
+func (e *pathExpr) eval(env *evalEnv) (interface{}, error) {
+	if env.rec == nil {
+		return nil, nil
+	}
+	steps := e.steps
+	if first := steps[0]; len(steps) > 1 && !first.quoted && !first.isIndex &&
+		(strings.EqualFold(first.name, "S3Object") || (env.alias != "" && strings.EqualFold(first.name, env.alias))) {
+		steps = steps[1:]
+	}
+	if steps[0].isIndex {
+		return nil, nil
+	}
+	v, ok := env.rec.get(steps[0].name, steps[0].quoted)
+	if !ok {
+		return nil, nil
+	}
+	for _, step := range steps[1:] {
+		v = stepValue(v, step)
+	}
+	return v, nil
+}
+
+// stepValue returns the value of the object key or the array index, it returns nil when not found.
+func stepValue(v interface{}, step pathStep) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if step.isIndex {
+			return nil
+		}
+		if value, ok := v[step.name]; ok {
+			return normalize(value)
+		}
+		if step.quoted {
+			return nil
+		}
+		for key, value := range v {
+			if strings.EqualFold(key, step.name) {
+				return normalize(value)
+			}
+		}
+	case []interface{}:
+		if step.isIndex && step.index < len(v) {
+			return normalize(v[step.index])
+		}
+	}
+	return nil
+}
+
+type negateExpr struct {
+	x expr
+}
+
+func (e *negateExpr) eval(env *evalEnv) (interface{}, error) {
+	v, err := e.x.eval(env)
+	if err != nil || v == nil {
+		return nil, err
+	}
+	switch n := toNumber(v).(type) {
+	case int64:
+		return -n, nil
+	case float64:
+		return -n, nil
+	}
+	return nil, fmt.Errorf("can not negate %v", v)
+}
+
+type notExpr struct {
+	x expr
+}
+
+func (e *notExpr) eval(env *evalEnv) (interface{}, error) {
+	v, err := e.x.eval(env)
+	if err != nil || v == nil {
+		return nil, err
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return nil, fmt.Errorf("NOT operand is not boolean: %v", v)
+	}
+	return !b, nil
+}
+
+// logicalExpr is AND or OR with three-valued logic, where nil is unknown.
+type logicalExpr struct {
+	op    string
+	left  expr
+	right expr
+}
+
+func (e *logicalExpr) eval(env *evalEnv) (interface{}, error) {
+	left, err := evalBool(e.left, env)
+	if err != nil {
+		return nil, err
+	}
+	if left != nil && *left == (e.op == "OR") {
+		return *left, nil
+	}
+	right, err := evalBool(e.right, env)
+	if err != nil {
+		return nil, err
+	}
+	if right != nil && *right == (e.op == "OR") {
+		return *right, nil
+	}
+	if left == nil || right == nil {
+		return nil, nil
+	}
+	return e.op == "AND", nil
+}
+
+func evalBool(e expr, env *evalEnv) (*bool, error) {
+	v, err := e.eval(env)
+	if err != nil || v == nil {
+		return nil, err
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return nil, fmt.Errorf("%v is not boolean", v)
+	}
+	return &b, nil
+}
+
+type binaryExpr struct {
+	op    string
+	left  expr
+	right expr
+}
+
+func (e *binaryExpr) eval(env *evalEnv) (interface{}, error) {
+	left, err := e.left.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	right, err := e.right.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	if left == nil || right == nil {
+		return nil, nil
+	}
+	switch e.op {
+	case "||":
+		return toString(left) + toString(right), nil
+	case "+", "-", "*", "/", "%":
+		return arithmetic(e.op, left, right)
+	}
+	c, ok := compare(left, right)
+	if !ok {
+		return nil, nil
+	}
+	switch e.op {
+	case "=":
+		return c == 0, nil
+	case "<>", "!=":
+		return c != 0, nil
+	case "<":
+		return c < 0, nil
+	case "<=":
+		return c <= 0, nil
+	case ">":
+		return c > 0, nil
+	default:
+		return c >= 0, nil
+	}
+}
+
+type isNullExpr struct {
+	x   expr
+	not bool
+}
+
+func (e *isNullExpr) eval(env *evalEnv) (interface{}, error) {
+	v, err := e.x.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	return (v == nil) != e.not, nil
+}
+
+type inExpr struct {
+	x    expr
+	list []expr
+	not  bool
+}
+
+func (e *inExpr) eval(env *evalEnv) (interface{}, error) {
+	v, err := e.x.eval(env)
+	if err != nil || v == nil {
+		return nil, err
+	}
+	unknown := false
+	for _, item := range e.list {
+		candidate, err := item.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		if candidate == nil {
+			unknown = true
+			continue
+		}
+		if c, ok := compare(v, candidate); ok && c == 0 {
+			return !e.not, nil
+		}
+	}
+	if unknown {
+		return nil, nil
+	}
+	return e.not, nil
+}
+
+type betweenExpr struct {
+	x    expr
+	low  expr
+	high expr
+	not  bool
+}
+
+func (e *betweenExpr) eval(env *evalEnv) (interface{}, error) {
+	values := make([]interface{}, 0, 3)
+	for _, x := range []expr{e.x, e.low, e.high} {
+		v, err := x.eval(env)
+		if err != nil || v == nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	low, ok := compare(values[0], values[1])
+	if !ok {
+		return nil, nil
+	}
+	high, ok := compare(values[0], values[2])
+	if !ok {
+		return nil, nil
+	}
+	return (low >= 0 && high <= 0) != e.not, nil
+}
+
+type likeExpr struct {
+	x       expr
+	pattern expr
+	escape  expr
+	not     bool
+
+	cache map[string]*regexp.Regexp
+}
+
+func (e *likeExpr) eval(env *evalEnv) (interface{}, error) {
+	v, err := e.x.eval(env)
+	if err != nil || v == nil {
+		return nil, err
+	}
+	pattern, err := e.pattern.eval(env)
+	if err != nil || pattern == nil {
+		return nil, err
+	}
+	escape := ""
+	if e.escape != nil {
+		value, err := e.escape.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		escape = toString(value)
+		if utf8.RuneCountInString(escape) != 1 {
+			return nil, fmt.Errorf("ESCAPE must be a single character: %q", escape)
+		}
+	}
+	re, err := e.compile(toString(pattern), escape)
+	if err != nil {
+		return nil, err
+	}
+	return re.MatchString(toString(v)) != e.not, nil
+}
+
+// compile converts LIKE pattern into the regular expression, `%` matches any string and `_` matches any character.
+func (e *likeExpr) compile(pattern string, escape string) (*regexp.Regexp, error) {
+	key := escape + "\x00" + pattern
+	if re, ok := e.cache[key]; ok {
+		return re, nil
+	}
+	var builder strings.Builder
+	builder.WriteString("(?s)^")
+	escaped := false
+	for _, r := range pattern {
+		switch {
+		case escaped:
+			builder.WriteString(regexp.QuoteMeta(string(r)))
+			escaped = false
+		case escape != "" && string(r) == escape:
+			escaped = true
+		case r == '%':
+			builder.WriteString(".*")
+		case r == '_':
+			builder.WriteString(".")
+		default:
+			builder.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	builder.WriteString("$")
+	re, err := regexp.Compile(builder.String())
+	if err != nil {
+		return nil, err
+	}
+	if e.cache == nil {
+		e.cache = make(map[string]*regexp.Regexp)
+	}
+	e.cache[key] = re
+	return re, nil
+}
+
+type castExpr struct {
+	x   expr
+	typ string
+}
+
+var timestampLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+func (e *castExpr) eval(env *evalEnv) (interface{}, error) {
+	v, err := e.x.eval(env)
+	if err != nil || v == nil {
+		return nil, err
+	}
+	switch e.typ {
+	case "INT":
+		switch n := toNumber(v).(type) {
+		case int64:
+			return n, nil
+		case float64:
+			return int64(n), nil
+		}
+	case "FLOAT":
+		switch n := toNumber(v).(type) {
+		case int64:
+			return float64(n), nil
+		case float64:
+			return n, nil
+		}
+	case "DECIMAL":
+		if n := toNumber(v); n != nil {
+			return n, nil
+		}
+	case "STRING":
+		return toString(v), nil
+	case "BOOL":
+		switch b := v.(type) {
+		case bool:
+			return b, nil
+		case string:
+			if parsed, err := strconv.ParseBool(strings.TrimSpace(b)); err == nil {
+				return parsed, nil
+			}
+		}
+	case "TIMESTAMP":
+		switch t := v.(type) {
+		case time.Time:
+			return t, nil
+		case string:
+			for _, layout := range timestampLayouts {
+				if parsed, err := time.Parse(layout, strings.TrimSpace(t)); err == nil {
+					return parsed, nil
+				}
+			}
+		}
+	}
+	return nil, fmt.Errorf("can not cast %v as %s", v, e.typ)
+}
+
+type callExpr struct {
+	name string
+	fn   sqlFunction
+	args []expr
+}
+
+// sqlFunction is the scalar function of SQL.
+type sqlFunction struct {
+	minArgs int
+	maxArgs int
+	call    func(args []interface{}) (interface{}, error)
+	// acceptNull passes nil args to call, otherwise the result is nil when any arg is nil.
+	acceptNull bool
+}
+
+var sqlFunctions = map[string]sqlFunction{
+	"LOWER": {minArgs: 1, maxArgs: 1, call: func(args []interface{}) (interface{}, error) {
+		return strings.ToLower(toString(args[0])), nil
+	}},
+	"UPPER": {minArgs: 1, maxArgs: 1, call: func(args []interface{}) (interface{}, error) {
+		return strings.ToUpper(toString(args[0])), nil
+	}},
+	"TRIM": {minArgs: 1, maxArgs: 1, call: func(args []interface{}) (interface{}, error) {
+		return strings.TrimSpace(toString(args[0])), nil
+	}},
+	"CHAR_LENGTH":      {minArgs: 1, maxArgs: 1, call: charLength},
+	"CHARACTER_LENGTH": {minArgs: 1, maxArgs: 1, call: charLength},
+	"SUBSTRING":        {minArgs: 2, maxArgs: 3, call: substring},
+	"COALESCE": {minArgs: 1, maxArgs: math.MaxInt32, acceptNull: true, call: func(args []interface{}) (interface{}, error) {
+		for _, arg := range args {
+			if arg != nil {
+				return arg, nil
+			}
+		}
+		return nil, nil
+	}},
+	"NULLIF": {minArgs: 2, maxArgs: 2, acceptNull: true, call: func(args []interface{}) (interface{}, error) {
+		if args[0] == nil || args[1] == nil {
+			return args[0], nil
+		}
+		if c, ok := compare(args[0], args[1]); ok && c == 0 {
+			return nil, nil
+		}
+		return args[0], nil
+	}},
+}
+
+func charLength(args []interface{}) (interface{}, error) {
+	return int64(utf8.RuneCountInString(toString(args[0]))), nil
+}
+
+// substring returns the characters from the 1-based start position, with the length when given.
+func substring(args []interface{}) (interface{}, error) {
+	runes := []rune(toString(args[0]))
+	start, ok := toNumber(args[1]).(int64)
+	if !ok {
+		return nil, fmt.Errorf("SUBSTRING start is not integer: %v", args[1])
+	}
+	end := int64(len(runes)) + 1
+	if len(args) == 3 {
+		length, ok := toNumber(args[2]).(int64)
+		if !ok || length < 0 {
+			return nil, fmt.Errorf("SUBSTRING length is not non-negative integer: %v", args[2])
+		}
+		end = start + length
+	}
+	if start < 1 {
+		start = 1
+	}
+	if end > int64(len(runes))+1 {
+		end = int64(len(runes)) + 1
+	}
+	if start >= end {
+		return "", nil
+	}
+	return string(runes[start-1 : end-1]), nil
+}
+
+func (e *callExpr) eval(env *evalEnv) (interface{}, error) {
+	if len(e.args) < e.fn.minArgs || len(e.args) > e.fn.maxArgs {
+		return nil, fmt.Errorf("%s: invalid number of arguments %d", e.name, len(e.args))
+	}
+	args := make([]interface{}, 0, len(e.args))
+	for _, arg := range e.args {
+		v, err := arg.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		if v == nil && !e.fn.acceptNull {
+			return nil, nil
+		}
+		args = append(args, v)
+	}
+	v, err := e.fn.call(args)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", e.name, err)
+	}
+	return v, nil
+}
+
+// aggregateExpr is COUNT, SUM, AVG, MIN or MAX, the value is taken from evalEnv.aggregates by index.
+type aggregateExpr struct {
+	fn    string
+	x     expr
+	index int
+}
+
+func (e *aggregateExpr) eval(env *evalEnv) (interface{}, error) {
+	if e.index >= len(env.aggregates) {
+		return nil, fmt.Errorf("aggregate function %s is not available here", e.fn)
+	}
+	return env.aggregates[e.index], nil
+}
+
+// aggregateState accumulates the values of aggregateExpr over the records.
+type aggregateState struct {
+	expr  *aggregateExpr
+	count int64
+	sum   interface{}
+	value interface{}
+}
+
+func (s *aggregateState) add(env *evalEnv) error {
+	if s.expr.x == nil {
+		s.count++
+		return nil
+	}
+	v, err := s.expr.x.eval(env)
+	if err != nil || v == nil {
+		return err
+	}
+	s.count++
+	switch s.expr.fn {
+	case "SUM", "AVG":
+		n := toNumber(v)
+		if n == nil {
+			return fmt.Errorf("%s: %v is not number", s.expr.fn, v)
+		}
+		if s.sum == nil {
+			s.sum = n
+			return nil
+		}
+		s.sum, err = arithmetic("+", s.sum, n)
+		return err
+	case "MIN", "MAX":
+		if s.value == nil {
+			s.value = v
+			return nil
+		}
+		c, ok := compare(v, s.value)
+		if !ok {
+			return fmt.Errorf("%s: can not compare %v and %v", s.expr.fn, v, s.value)
+		}
+		if (s.expr.fn == "MIN" && c < 0) || (s.expr.fn == "MAX" && c > 0) {
+			s.value = v
+		}
+	}
+	return nil
+}
+
+func (s *aggregateState) result() interface{} {
+	switch s.expr.fn {
+	case "COUNT":
+		return s.count
+	case "SUM":
+		return s.sum
+	case "AVG":
+		if s.count == 0 {
+			return nil
+		}
+		switch sum := s.sum.(type) {
+		case int64:
+			return float64(sum) / float64(s.count)
+		case float64:
+			return sum / float64(s.count)
+		}
+		return nil
+	default:
+		return s.value
+	}
+}
+
+// normalize converts the value read from the file into the value type of expressions.
+func normalize(v interface{}) interface{} {
+	switch v := v.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		if f, err := v.Float64(); err == nil {
+			return f
+		}
+		return v.String()
+	case int:
+		return int64(v)
+	case int8:
+		return int64(v)
+	case int16:
+		return int64(v)
+	case int32:
+		return int64(v)
+	case uint8:
+		return int64(v)
+	case uint16:
+		return int64(v)
+	case uint32:
+		return int64(v)
+	case uint64:
+		if v > math.MaxInt64 {
+			return float64(v)
+		}
+		return int64(v)
+	case float32:
+		return float64(v)
+	case []byte:
+		return string(v)
+	default:
+		return v
+	}
+}
+
+// toNumber returns int64 or float64 of v, strings are parsed as number. it returns nil when v is not number.
+func toNumber(v interface{}) interface{} {
+	switch v := v.(type) {
+	case int64, float64:
+		return v
+	case string:
+		s := strings.TrimSpace(v)
+		if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return i
+		}
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return f
+		}
+	}
+	return nil
+}
+
+func toString(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	default:
+		bs, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		return string(bs)
+	}
+}
+
+func isNumber(v interface{}) bool {
+	switch v.(type) {
+	case int64, float64:
+		return true
+	}
+	return false
+}
+
+// compare returns the order of a and b, ok is false when they are not comparable.
+// The string is compared with the number as number, such as the CSV field.
+func compare(a interface{}, b interface{}) (int, bool) {
+	if isNumber(a) || isNumber(b) {
+		x, y := toNumber(a), toNumber(b)
+		if x == nil || y == nil {
+			return 0, false
+		}
+		if i, ok := x.(int64); ok {
+			if j, ok := y.(int64); ok {
+				return compareOrdered(i, j), true
+			}
+		}
+		return compareOrdered(toFloat(x), toFloat(y)), true
+	}
+	switch a := a.(type) {
+	case string:
+		if b, ok := b.(string); ok {
+			return strings.Compare(a, b), true
+		}
+	case bool:
+		if b, ok := b.(bool); ok {
+			switch {
+			case a == b:
+				return 0, true
+			case !a:
+				return -1, true
+			default:
+				return 1, true
+			}
+		}
+	case time.Time:
+		switch b := b.(type) {
+		case time.Time:
+			return compareOrdered(a.UnixNano(), b.UnixNano()), true
+		case string:
+			for _, layout := range timestampLayouts {
+				if parsed, err := time.Parse(layout, b); err == nil {
+					return compareOrdered(a.UnixNano(), parsed.UnixNano()), true
+				}
+			}
+		}
+	}
+	return 0, false
+}
+
+func compareOrdered[T int64 | float64](a T, b T) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func toFloat(n interface{}) float64 {
+	switch n := n.(type) {
+	case int64:
+		return float64(n)
+	case float64:
+		return n
+	}
+	return math.NaN()
+}
+
+func arithmetic(op string, a interface{}, b interface{}) (interface{}, error) {
+	x, y := toNumber(a), toNumber(b)
+	if x == nil || y == nil {
+		return nil, fmt.Errorf("%v %s %v: operand is not number", a, op, b)
+	}
+	i, xInt := x.(int64)
+	j, yInt := y.(int64)
+	if xInt && yInt {
+		switch op {
+		case "+":
+			return i + j, nil
+		case "-":
+			return i - j, nil
+		case "*":
+			return i * j, nil
+		case "/", "%":
+			if j == 0 {
+				return nil, fmt.Errorf("%d %s %d: division by zero", i, op, j)
+			}
+			if op == "/" {
+				return i / j, nil
+			}
+			return i % j, nil
+		}
+	}
+	f, g := toFloat(x), toFloat(y)
+	switch op {
+	case "+":
+		return f + g, nil
+	case "-":
+		return f - g, nil
+	case "*":
+		return f * g, nil
+	case "/":
+		if g == 0 {
+			return nil, fmt.Errorf("%v %s %v: division by zero", f, op, g)
+		}
+		return f / g, nil
+	default:
+		if g == 0 {
+			return nil, fmt.Errorf("%v %s %v: division by zero", f, op, g)
+		}
+		return math.Mod(f, g), nil
+	}
+}
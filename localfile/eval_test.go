@@ -0,0 +1,138 @@
+package localfile
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/mashiike/queryrunner"
+	"github.com/stretchr/testify/require"
+)
+
+// evalItem parses `SELECT <expression> FROM S3Object s` and evaluates the expression with the record.
+func evalItem(t *testing.T, expression string, rec record) (interface{}, error) {
+	t.Helper()
+	stmt, err := parseSelect("SELECT " + expression + " FROM S3Object s")
+	require.NoError(t, err)
+	return stmt.items[0].expr.eval(&evalEnv{rec: rec, alias: stmt.alias})
+}
+
+func TestEval(t *testing.T) {
+	rec, err := newJSONRecord(json.RawMessage(`{"name": "50%_off", "n": 3, "f": 1.5, "s": "10", "empty": null}`))
+	require.NoError(t, err)
+	cases := []struct {
+		name       string
+		expression string
+		expected   interface{}
+		errString  string
+	}{
+		// LIKE
+		{name: "like underscore", expression: `'a.c' LIKE 'a_c'`, expected: true},
+		{name: "like meta character", expression: `'abc' LIKE 'a.c'`, expected: false},
+		{name: "like escaped percent", expression: `s.name LIKE '50!%!_off' ESCAPE '!'`, expected: true},
+		{name: "like escaped wildcard", expression: `'50x_off' LIKE '50!%%' ESCAPE '!'`, expected: false},
+		{name: "like escaped escape", expression: `'a!b' LIKE 'a!!b' ESCAPE '!'`, expected: true},
+		{name: "not like", expression: `s.name NOT LIKE '50\%%' ESCAPE '\'`, expected: false},
+		{name: "like null", expression: `s.empty LIKE '%'`, expected: nil},
+		{name: "like invalid escape", expression: `s.name LIKE '%' ESCAPE '!!'`, errString: `ESCAPE must be a single character: "!!"`},
+		// BETWEEN and IN
+		{name: "between", expression: `s.n BETWEEN 1 AND 3`, expected: true},
+		{name: "not between", expression: `s.n NOT BETWEEN 1 AND 2`, expected: true},
+		{name: "between string as number", expression: `s.s BETWEEN 9 AND 10.5`, expected: true},
+		{name: "between null", expression: `s.n BETWEEN NULL AND 5`, expected: nil},
+		{name: "in", expression: `s.n IN (1, 2, 3)`, expected: true},
+		{name: "not in", expression: `s.n NOT IN (1, 2)`, expected: true},
+		{name: "in not found", expression: `s.n IN (1, 2)`, expected: false},
+		{name: "in found with null", expression: `s.n IN (NULL, 3)`, expected: true},
+		{name: "in not found with null", expression: `s.n IN (1, NULL)`, expected: nil},
+		{name: "not in with null", expression: `s.n NOT IN (1, NULL)`, expected: nil},
+		{name: "in null", expression: `s.empty IN (1, 2)`, expected: nil},
+		// CAST
+		{name: "cast float to int", expression: `CAST(s.f AS INT)`, expected: int64(1)},
+		{name: "cast string to float", expression: `CAST(s.s AS FLOAT)`, expected: float64(10)},
+		{name: "cast null", expression: `CAST(s.empty AS INT)`, expected: nil},
+		{name: "cast invalid int", expression: `CAST('abc' AS INT)`, errString: "can not cast abc as INT"},
+		{name: "cast invalid bool", expression: `CAST('maybe' AS BOOL)`, errString: "can not cast maybe as BOOL"},
+		{name: "cast invalid timestamp", expression: `CAST('2023-13-01' AS TIMESTAMP)`, errString: "can not cast 2023-13-01 as TIMESTAMP"},
+		// NULL three-valued logic
+		{name: "null and false", expression: `s.empty = 1 AND 1 = 2`, expected: false},
+		{name: "null and true", expression: `s.empty = 1 AND 1 = 1`, expected: nil},
+		{name: "null or true", expression: `s.empty = 1 OR 1 = 1`, expected: true},
+		{name: "null or false", expression: `s.empty = 1 OR 1 = 2`, expected: nil},
+		{name: "not null", expression: `NOT s.empty`, expected: nil},
+		{name: "null equals null", expression: `NULL = NULL`, expected: nil},
+		{name: "is null", expression: `s.empty IS NULL`, expected: true},
+		{name: "missing is not null", expression: `s.missing IS NOT NULL`, expected: false},
+		{name: "null concat", expression: `s.name || NULL`, expected: nil},
+		// arithmetic
+		{name: "int plus float", expression: `s.n + s.f`, expected: 4.5},
+		{name: "int times int", expression: `s.n * 2`, expected: int64(6)},
+		{name: "int division", expression: `7 / 2`, expected: int64(3)},
+		{name: "float division", expression: `7 / 2.0`, expected: 3.5},
+		{name: "float modulo", expression: `7 % 2.5`, expected: 2.0},
+		{name: "string as number", expression: `s.s + 1`, expected: int64(11)},
+		{name: "negate float", expression: `-s.f`, expected: -1.5},
+		{name: "arithmetic with null", expression: `s.n + s.empty`, expected: nil},
+		{name: "int division by zero", expression: `1 / 0`, errString: "1 / 0: division by zero"},
+		{name: "float division by zero", expression: `1.5 / 0`, errString: "1.5 / 0: division by zero"},
+		{name: "not number", expression: `'a' + 1`, errString: "a + 1: operand is not number"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			actual, err := evalItem(t, c.expression, rec)
+			if c.errString != "" {
+				require.EqualError(t, err, c.errString)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, c.expected, actual)
+		})
+	}
+}
+
+func TestExecutorLimit(t *testing.T) {
+	records := make([]record, 0, 3)
+	for _, raw := range []string{`{"n": 1}`, `{"n": 2}`, `{"n": 3}`} {
+		rec, err := newJSONRecord(json.RawMessage(raw))
+		require.NoError(t, err)
+		records = append(records, rec)
+	}
+	cases := []struct {
+		sql      string
+		expected string
+	}{
+		{
+			sql:      "SELECT s.n FROM S3Object s LIMIT 0",
+			expected: "",
+		},
+		{
+			sql:      "SELECT s.n FROM S3Object s LIMIT 2",
+			expected: `{"n":1}` + "\n" + `{"n":2}` + "\n",
+		},
+		{
+			sql:      "SELECT COUNT(*) AS cnt FROM S3Object s LIMIT 0",
+			expected: "",
+		},
+		{
+			sql:      "SELECT COUNT(*) AS cnt FROM S3Object s LIMIT 1",
+			expected: `{"cnt":3}` + "\n",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.sql, func(t *testing.T) {
+			stmt, err := parseSelect(c.sql)
+			require.NoError(t, err)
+			var builder strings.Builder
+			ex := newExecutor(stmt, queryrunner.NewRowMapWriter(queryrunner.NewJSONLinesRowWriter(&builder)))
+			for _, rec := range records {
+				err := ex.process(rec)
+				if err == errStopScan {
+					break
+				}
+				require.NoError(t, err)
+			}
+			require.NoError(t, ex.finish())
+			require.Equal(t, c.expected, builder.String())
+		})
+	}
+}
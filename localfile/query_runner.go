@@ -0,0 +1,575 @@
+package localfile
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/dustin/go-humanize"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/gohcl"
+	"github.com/mashiike/queryrunner"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+)
+
+const TypeName = "local_file"
+
+func init() {
+	err := queryrunner.Register(&queryrunner.QueryRunnerDefinition{
+		TypeName:             TypeName,
+		BuildQueryRunnerFunc: BuildQueryRunner,
+	})
+	if err != nil {
+		panic(fmt.Errorf("register local_file query runner:%w", err))
+	}
+}
+
+func BuildQueryRunner(name string, body hcl.Body, ctx *hcl.EvalContext) (queryrunner.QueryRunner, hcl.Diagnostics) {
+	queryRunner := &QueryRunner{
+		name: name,
+	}
+	diags := gohcl.DecodeBody(body, ctx, queryRunner)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	return queryRunner, diags
+}
+
+type QueryRunner struct {
+	name string
+}
+
+func (r *QueryRunner) Name() string {
+	return r.name
+}
+
+func (r *QueryRunner) Type() string {
+	return TypeName
+}
+
+type PreparedQuery struct {
+	*queryrunner.QueryBase
+	runner *QueryRunner
+
+	Expression      hcl.Expression `hcl:"expression"`
+	Path            hcl.Expression `hcl:"path"`
+	CompressionType *string        `hcl:"compression_type"`
+	ContinueOnError bool           `hcl:"continue_on_error,optional"`
+
+	CSVBlock     *QueryCSVBlock     `hcl:"csv,block"`
+	JSONBlock    *QueryJSONBlock    `hcl:"json,block"`
+	ParquetBlock *QueryParquetBlock `hcl:"parquet,block"`
+
+	inputSerialization *inputSerialization
+}
+
+// QueryCSVBlock is `csv` block, the same as s3_select runner.
+// quote_character, quote_escape_character and record_delimiter accept only the default values.
+type QueryCSVBlock struct {
+	AllowQuotedRecordDelimiter *bool   `hcl:"allow_quoted_record_delimiter"`
+	FileHeaderInfo             *string `hcl:"file_header_info"`
+	FieldDelimiter             *string `hcl:"field_delimiter"`
+	QuoteCharacter             *string `hcl:"quote_character"`
+	QuoteEscapeCharacter       *string `hcl:"quote_escape_character"`
+	RecordDelimiter            *string `hcl:"record_delimiter"`
+}
+
+type QueryJSONBlock struct {
+	Type string `hcl:"type"`
+}
+
+type QueryParquetBlock struct{}
+
+const (
+	compressionTypeNone  = "NONE"
+	compressionTypeGzip  = "GZIP"
+	compressionTypeBzip2 = "BZIP2"
+
+	fileHeaderInfoUse    = "USE"
+	fileHeaderInfoIgnore = "IGNORE"
+	fileHeaderInfoNone   = "NONE"
+
+	jsonTypeDocument = "DOCUMENT"
+	jsonTypeLines    = "LINES"
+)
+
+// inputSerialization is the format of the files, that is validated in Prepare.
+type inputSerialization struct {
+	CompressionType string
+	CSV             *csvInput
+	JSON            *jsonInput
+	Parquet         bool
+}
+
+type csvInput struct {
+	FileHeaderInfo string
+	FieldDelimiter rune
+}
+
+type jsonInput struct {
+	Type string
+}
+
+// oneOf returns the value in candidates that equals to v case-insensitively.
+func oneOf(v string, candidates ...string) (string, bool) {
+	for _, c := range candidates {
+		if strings.EqualFold(v, c) {
+			return c, true
+		}
+	}
+	return "", false
+}
+
+func mustBe(candidates ...string) string {
+	return fmt.Sprintf("Must be %s or %s", strings.Join(candidates[:len(candidates)-1], ","), candidates[len(candidates)-1])
+}
+
+func (r *QueryRunner) Prepare(base *queryrunner.QueryBase) (queryrunner.PreparedQuery, hcl.Diagnostics) {
+	log.Printf("[debug] prepare `%s` with local_file query_runner", base.Name())
+	q := &PreparedQuery{
+		QueryBase: base,
+		runner:    r,
+	}
+	body := base.Remain()
+	ctx := base.NewEvalContext(nil, nil)
+	diags := gohcl.DecodeBody(body, ctx, q)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	expressionValue, _ := q.Expression.Value(ctx)
+	if expressionValue.IsKnown() && (expressionValue.IsNull() || expressionValue.Type() == cty.String && expressionValue.AsString() == "") {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid expression template",
+			Detail:   "expression is empty",
+			Subject:  q.Expression.Range().Ptr(),
+		})
+		return nil, diags
+	}
+	pathValue, _ := q.Path.Value(ctx)
+	if pathValue.IsKnown() && (pathValue.IsNull() || pathValue.Type() == cty.String && pathValue.AsString() == "") {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid path template",
+			Detail:   "required attribute `path`",
+			Subject:  q.Path.Range().Ptr(),
+		})
+		return nil, diags
+	}
+
+	q.inputSerialization = &inputSerialization{
+		CompressionType: compressionTypeNone,
+	}
+	if q.CompressionType != nil {
+		compressionType, ok := oneOf(*q.CompressionType, compressionTypeNone, compressionTypeGzip, compressionTypeBzip2)
+		if !ok {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid compression_type",
+				Detail:   mustBe(compressionTypeNone, compressionTypeGzip, compressionTypeBzip2),
+				Subject:  body.MissingItemRange().Ptr(),
+			})
+			return nil, diags
+		}
+		q.inputSerialization.CompressionType = compressionType
+	}
+
+	blockCount := 0
+	if q.CSVBlock != nil {
+		blockCount++
+		csv, csvDiags := q.CSVBlock.input()
+		diags = append(diags, csvDiags...)
+		if csvDiags.HasErrors() {
+			return nil, diags
+		}
+		q.inputSerialization.CSV = csv
+	}
+	if q.JSONBlock != nil {
+		blockCount++
+		jsonType, ok := oneOf(q.JSONBlock.Type, jsonTypeDocument, jsonTypeLines)
+		if !ok {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid json.type",
+				Detail:   mustBe(jsonTypeDocument, jsonTypeLines),
+				Subject:  body.MissingItemRange().Ptr(),
+			})
+			return nil, diags
+		}
+		q.inputSerialization.JSON = &jsonInput{
+			Type: jsonType,
+		}
+	}
+	if q.ParquetBlock != nil {
+		blockCount++
+		q.inputSerialization.Parquet = true
+		if q.inputSerialization.CompressionType != compressionTypeNone {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid compression_type",
+				Detail:   "compression_type of parquet must be NONE, the columns are compressed in the parquet file",
+				Subject:  body.MissingItemRange().Ptr(),
+			})
+		}
+	}
+	if blockCount == 0 {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Require input serialization",
+			Detail:   "Input serialization are required: csv, json or parquet block must be inserted.",
+			Subject:  body.MissingItemRange().Ptr(),
+		})
+	}
+	if blockCount > 1 {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid input serialization",
+			Detail:   "Only one csv, json or parquet block can be defined",
+			Subject:  body.MissingItemRange().Ptr(),
+		})
+	}
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	return q, diags
+}
+
+func (b *QueryCSVBlock) input() (*csvInput, hcl.Diagnostics) {
+	var diags hcl.Diagnostics
+	input := &csvInput{
+		FileHeaderInfo: fileHeaderInfoNone,
+		FieldDelimiter: ',',
+	}
+	if b.FileHeaderInfo != nil {
+		fileHeaderInfo, ok := oneOf(*b.FileHeaderInfo, fileHeaderInfoUse, fileHeaderInfoIgnore, fileHeaderInfoNone)
+		if !ok {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid csv.file_header_info",
+				Detail:   mustBe(fileHeaderInfoUse, fileHeaderInfoIgnore, fileHeaderInfoNone),
+			})
+			return nil, diags
+		}
+		input.FileHeaderInfo = fileHeaderInfo
+	}
+	if b.FieldDelimiter != nil {
+		if utf8.RuneCountInString(*b.FieldDelimiter) != 1 {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid csv.field_delimiter",
+				Detail:   "field_delimiter must be a single character",
+			})
+			return nil, diags
+		}
+		input.FieldDelimiter, _ = utf8.DecodeRuneInString(*b.FieldDelimiter)
+	}
+	unsupported := map[string]struct {
+		value    *string
+		defaults []string
+	}{
+		"quote_character":        {b.QuoteCharacter, []string{`"`}},
+		"quote_escape_character": {b.QuoteEscapeCharacter, []string{`"`}},
+		"record_delimiter":       {b.RecordDelimiter, []string{"\n", "\r\n"}},
+	}
+	for name, attr := range unsupported {
+		if attr.value == nil {
+			continue
+		}
+		if _, ok := oneOf(*attr.value, attr.defaults...); !ok {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  fmt.Sprintf("Invalid csv.%s", name),
+				Detail:   fmt.Sprintf("local_file runner supports only %q as %s", attr.defaults, name),
+			})
+		}
+	}
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	return input, diags
+}
+
+type runQueryParameters struct {
+	name               string
+	expression         string
+	path               string
+	inputSerialization *inputSerialization
+	continueOnError    bool
+}
+
+func (q *PreparedQuery) Run(ctx context.Context, variables map[string]cty.Value, functions map[string]function.Function) (*queryrunner.QueryResult, error) {
+	return queryrunner.CollectStream(ctx, q, variables, functions)
+}
+
+func (q *PreparedQuery) Stream(ctx context.Context, variables map[string]cty.Value, functions map[string]function.Function, w queryrunner.RowWriter) (*queryrunner.QueryResult, error) {
+	params, err := q.render(variables, functions)
+	if err != nil {
+		return nil, err
+	}
+	return q.runner.RunQuery(ctx, params, w)
+}
+
+// Render returns the expression and the path pattern of the files without running it.
+func (q *PreparedQuery) Render(ctx context.Context, variables map[string]cty.Value, functions map[string]function.Function) (*queryrunner.RenderedQuery, error) {
+	params, err := q.render(variables, functions)
+	if err != nil {
+		return nil, err
+	}
+	attributes := map[string]interface{}{
+		"path":                params.path,
+		"input_serialization": params.inputSerialization.attributes(),
+	}
+	return q.NewRenderedQuery(params.expression, attributes), nil
+}
+
+// attributes returns the input serialization in the shape of the query block.
+func (in *inputSerialization) attributes() map[string]interface{} {
+	attributes := map[string]interface{}{
+		"compression_type": in.CompressionType,
+	}
+	if in.CSV != nil {
+		attributes["csv"] = map[string]interface{}{
+			"file_header_info": in.CSV.FileHeaderInfo,
+			"field_delimiter":  string(in.CSV.FieldDelimiter),
+		}
+	}
+	if in.JSON != nil {
+		attributes["json"] = map[string]interface{}{
+			"type": in.JSON.Type,
+		}
+	}
+	if in.Parquet {
+		attributes["parquet"] = map[string]interface{}{}
+	}
+	return attributes
+}
+
+func (q *PreparedQuery) render(variables map[string]cty.Value, functions map[string]function.Function) (*runQueryParameters, error) {
+	evalCtx := q.NewEvalContext(variables, functions)
+	expression, diags := evaluateString("expression", q.Expression, evalCtx)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	path, diags := evaluateString("path", q.Path, evalCtx)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	if _, err := parseSelect(expression); err != nil {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid expression",
+			Detail:   err.Error(),
+			Subject:  q.Expression.Range().Ptr(),
+		})
+		return nil, diags
+	}
+	if _, err := filepath.Match(path, ""); err != nil {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid path",
+			Detail:   err.Error(),
+			Subject:  q.Path.Range().Ptr(),
+		})
+		return nil, diags
+	}
+	params := &runQueryParameters{
+		name:               q.Name(),
+		expression:         expression,
+		path:               path,
+		inputSerialization: q.inputSerialization,
+		continueOnError:    q.ContinueOnError,
+	}
+	return params, nil
+}
+
+func evaluateString(name string, expr hcl.Expression, evalCtx *hcl.EvalContext) (string, hcl.Diagnostics) {
+	value, diags := expr.Value(evalCtx)
+	if diags.HasErrors() {
+		return "", diags
+	}
+	if !value.IsKnown() {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  fmt.Sprintf("Invalid %s template", name),
+			Detail:   fmt.Sprintf("%s is unknown", name),
+			Subject:  expr.Range().Ptr(),
+		})
+		return "", diags
+	}
+	if value.IsNull() || value.Type() != cty.String {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  fmt.Sprintf("Invalid %s template", name),
+			Detail:   fmt.Sprintf("%s is not string", name),
+			Subject:  expr.Range().Ptr(),
+		})
+		return "", diags
+	}
+	if value.AsString() == "" {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  fmt.Sprintf("Invalid %s template", name),
+			Detail:   fmt.Sprintf("%s is empty", name),
+			Subject:  expr.Range().Ptr(),
+		})
+		return "", diags
+	}
+	return value.AsString(), diags
+}
+
+// RunQuery evaluates the expression over the files matched with the path pattern and writes result rows to w, returned QueryResult has no rows.
+func (r *QueryRunner) RunQuery(ctx context.Context, params *runQueryParameters, w queryrunner.RowWriter) (*queryrunner.QueryResult, error) {
+	reqID := queryrunner.GetRequestID(ctx)
+	log.Printf("[info][%s] start local file expression `%s`", reqID, params.name)
+	log.Printf("[info][%s] location: %s", reqID, params.path)
+	log.Printf("[debug][%s] expression: %s", reqID, params.expression)
+	stmt, err := parseSelect(params.expression)
+	if err != nil {
+		return nil, fmt.Errorf("parse expression: %w", err)
+	}
+	paths, err := filepath.Glob(params.path)
+	if err != nil {
+		return nil, fmt.Errorf("glob %s: %w", params.path, err)
+	}
+	queryStart := time.Now()
+	ex := newExecutor(stmt, queryrunner.NewRowMapWriter(w))
+	totalScanSize := uint64(0)
+	totalRecords := 0
+	fileCount := 0
+	for _, path := range paths {
+		if ex.done() {
+			break
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if info.IsDir() {
+			continue
+		}
+		log.Printf("[debug][%s] start select file: %s (%s)", reqID, path, humanize.Bytes(uint64(info.Size())))
+		records, err := scanFile(path, params.inputSerialization, stmt.from, ex.process)
+		totalScanSize += uint64(info.Size())
+		totalRecords += records
+		fileCount++
+		if err != nil && err != errStopScan {
+			if params.continueOnError {
+				log.Printf("[warn][%s] select file failed: %s: %v", reqID, path, err)
+				continue
+			}
+			return nil, fmt.Errorf("select file: %s : %w", path, err)
+		}
+	}
+	if err := ex.finish(); err != nil {
+		return nil, err
+	}
+	log.Printf("[info][%s] total scan size: %s, total records: %d, total file count: %d, elapsed_time=%s", reqID, humanize.Bytes(totalScanSize), totalRecords, fileCount, time.Since(queryStart))
+
+	result := queryrunner.NewQueryResultWithColumns(params.name, params.expression, ex.mw.Columns(), nil)
+	result.Stats = &queryrunner.Stats{
+		BytesScanned: int64(totalScanSize),
+		Extra: map[string]interface{}{
+			"file_count":      fileCount,
+			"records_scanned": totalRecords,
+		},
+	}
+	return result, nil
+}
+
+// executor evaluates the statement for each record and writes the selected rows.
+type executor struct {
+	stmt    *selectStatement
+	mw      *queryrunner.RowMapWriter
+	states  []*aggregateState
+	written int
+}
+
+func newExecutor(stmt *selectStatement, mw *queryrunner.RowMapWriter) *executor {
+	ex := &executor{
+		stmt: stmt,
+		mw:   mw,
+	}
+	for _, agg := range stmt.aggregates {
+		ex.states = append(ex.states, &aggregateState{expr: agg})
+	}
+	return ex
+}
+
+// done reports whether LIMIT is reached.
+func (ex *executor) done() bool {
+	return len(ex.states) == 0 && ex.stmt.limit >= 0 && ex.written >= ex.stmt.limit
+}
+
+func (ex *executor) process(rec record) error {
+	if ex.done() {
+		return errStopScan
+	}
+	env := &evalEnv{rec: rec, alias: ex.stmt.alias}
+	if ex.stmt.where != nil {
+		matched, err := evalBool(ex.stmt.where, env)
+		if err != nil {
+			return fmt.Errorf("WHERE: %w", err)
+		}
+		if matched == nil || !*matched {
+			return nil
+		}
+	}
+	if len(ex.states) > 0 {
+		for _, state := range ex.states {
+			if err := state.add(env); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := ex.write(env); err != nil {
+		return err
+	}
+	if ex.done() {
+		return errStopScan
+	}
+	return nil
+}
+
+// finish writes the row of the aggregate functions.
+func (ex *executor) finish() error {
+	if len(ex.states) == 0 || ex.stmt.limit == 0 {
+		return nil
+	}
+	env := &evalEnv{alias: ex.stmt.alias}
+	for _, state := range ex.states {
+		env.aggregates = append(env.aggregates, state.result())
+	}
+	return ex.write(env)
+}
+
+func (ex *executor) write(env *evalEnv) error {
+	names := make([]string, 0, len(ex.stmt.items))
+	values := make([]interface{}, 0, len(ex.stmt.items))
+	for _, item := range ex.stmt.items {
+		if item.star {
+			fieldNames, fieldValues := env.rec.fields()
+			names = append(names, fieldNames...)
+			values = append(values, fieldValues...)
+			continue
+		}
+		v, err := item.expr.eval(env)
+		if err != nil {
+			return err
+		}
+		names = append(names, item.name)
+		values = append(values, v)
+	}
+	ex.written++
+	return ex.mw.WriteFields(names, values)
+}
@@ -0,0 +1,119 @@
+package localfile
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	goparquet "github.com/fraugster/parquet-go"
+	"github.com/fraugster/parquet-go/parquetschema"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/mashiike/hclconfig"
+	"github.com/mashiike/queryrunner"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func loadQuery(t *testing.T, name string) *PreparedQuery {
+	t.Helper()
+	parser := hclparse.NewParser()
+	file, diags := parser.ParseHCLFile("testdata/config.hcl")
+	require.False(t, diags.HasErrors())
+	queries, _, diags := queryrunner.DecodeBody(file.Body, hclconfig.NewEvalContext("./"))
+	if !assert.False(t, diags.HasErrors()) {
+		var builder strings.Builder
+		w := hcl.NewDiagnosticTextWriter(&builder, parser.Files(), 400, false)
+		w.WriteDiagnostics(diags)
+		t.Log(builder.String())
+		t.FailNow()
+	}
+	query, ok := queries.Get(name)
+	require.True(t, ok)
+	q, ok := query.(*PreparedQuery)
+	require.True(t, ok)
+	return q
+}
+
+func TestRunCSV(t *testing.T) {
+	q := loadQuery(t, "server_errors")
+	result, err := q.Run(context.Background(), nil, nil)
+	require.NoError(t, err)
+	require.EqualValues(t, []string{"time", "status", "path"}, result.Columns.Names())
+	require.Equal(t, queryrunner.ColumnTypeInteger, result.Columns[1].Type)
+	require.EqualValues(t, [][]interface{}{
+		{"2022-10-20T00:00:02Z", int64(503), "/api/users"},
+		{"2022-10-20T00:00:03Z", int64(500), "/api/items"},
+	}, result.Rows)
+	require.Equal(t, 1, result.Stats.Extra["file_count"])
+}
+
+func TestRunJSONLines(t *testing.T) {
+	q := loadQuery(t, "purchases")
+	_, err := q.Run(context.Background(), map[string]cty.Value{
+		"var": cty.ObjectVal(map[string]cty.Value{
+			"event": cty.StringVal("purchase"),
+		}),
+	}, nil)
+	require.ErrorContains(t, err, "`name` is not aggregated, it can not be selected with aggregate functions")
+
+	q = loadQuery(t, "purchase_totals")
+	result, err := q.Run(context.Background(), map[string]cty.Value{
+		"var": cty.ObjectVal(map[string]cty.Value{
+			"event": cty.StringVal("purchase"),
+		}),
+	}, nil)
+	require.NoError(t, err)
+	require.EqualValues(t, []string{"total", "events"}, result.Columns.Names())
+	require.EqualValues(t, [][]interface{}{
+		{int64(5), int64(2)},
+	}, result.Rows)
+
+	q = loadQuery(t, "all_events")
+	result, err = q.Run(context.Background(), nil, nil)
+	require.NoError(t, err)
+	require.EqualValues(t, []string{"user", "event", "count", "tags"}, result.Columns.Names())
+	require.Equal(t, 3, len(result.Rows))
+	require.Equal(t, 3, result.Stats.Extra["records_scanned"])
+}
+
+func writeParquet(t *testing.T, path string, schema string, rows []map[string]interface{}) {
+	t.Helper()
+	sd, err := parquetschema.ParseSchemaDefinition(schema)
+	require.NoError(t, err)
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	defer f.Close()
+	fw := goparquet.NewFileWriter(f, goparquet.WithSchemaDefinition(sd))
+	for _, row := range rows {
+		require.NoError(t, fw.AddData(row))
+	}
+	require.NoError(t, fw.Close())
+}
+
+func TestRunParquet(t *testing.T) {
+	dir := t.TempDir()
+	writeParquet(t, filepath.Join(dir, "scores.parquet"), `message scores {
+		required binary name (STRING);
+		required double score;
+	}`, []map[string]interface{}{
+		{"name": []byte("alice"), "score": 1.5},
+		{"name": []byte("bob"), "score": 0.5},
+		{"name": []byte("carol"), "score": 2.0},
+	})
+	q := loadQuery(t, "parquet")
+	result, err := q.Run(context.Background(), map[string]cty.Value{
+		"var": cty.ObjectVal(map[string]cty.Value{
+			"dir": cty.StringVal(dir),
+		}),
+	}, nil)
+	require.NoError(t, err)
+	require.EqualValues(t, []string{"name", "double_score"}, result.Columns.Names())
+	require.EqualValues(t, [][]interface{}{
+		{"alice", float64(3)},
+		{"carol", float64(4)},
+	}, result.Rows)
+}
@@ -0,0 +1,339 @@
+package localfile
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	goparquet "github.com/fraugster/parquet-go"
+)
+
+// record is a row of the file that SQL expressions refer.
+type record interface {
+	// get returns the value of the top-level field, ok is false when the field is missing.
+	get(name string, quoted bool) (interface{}, bool)
+	// fields returns the field names and the values in the order of the record, that is used for `SELECT *`.
+	fields() ([]string, []interface{})
+}
+
+// csvRecord is the CSV row, the fields are referred by the header name or the position such as `_1`.
+type csvRecord struct {
+	header []string
+	values []string
+}
+
+func (r *csvRecord) get(name string, quoted bool) (interface{}, bool) {
+	if strings.HasPrefix(name, "_") {
+		if position, err := strconv.Atoi(name[1:]); err == nil {
+			if position < 1 || position > len(r.values) {
+				return nil, false
+			}
+			return r.values[position-1], true
+		}
+	}
+	for i, h := range r.header {
+		if i >= len(r.values) {
+			break
+		}
+		if h == name || (!quoted && strings.EqualFold(h, name)) {
+			return r.values[i], true
+		}
+	}
+	return nil, false
+}
+
+func (r *csvRecord) fields() ([]string, []interface{}) {
+	names := make([]string, len(r.values))
+	values := make([]interface{}, len(r.values))
+	for i, v := range r.values {
+		if i < len(r.header) {
+			names[i] = r.header[i]
+		} else {
+			names[i] = fmt.Sprintf("_%d", i+1)
+		}
+		values[i] = v
+	}
+	return names, values
+}
+
+// objectRecord is the JSON object or the Parquet row.
+type objectRecord struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+func newObjectRecord(values map[string]interface{}) *objectRecord {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return &objectRecord{keys: keys, values: values}
+}
+
+func (r *objectRecord) get(name string, quoted bool) (interface{}, bool) {
+	if v, ok := r.values[name]; ok {
+		return normalize(v), true
+	}
+	if quoted {
+		return nil, false
+	}
+	for _, key := range r.keys {
+		if strings.EqualFold(key, name) {
+			return normalize(r.values[key]), true
+		}
+	}
+	return nil, false
+}
+
+func (r *objectRecord) fields() ([]string, []interface{}) {
+	values := make([]interface{}, len(r.keys))
+	for i, key := range r.keys {
+		values[i] = r.values[key]
+	}
+	return r.keys, values
+}
+
+// scalarRecord is the JSON value other than object, that is referred as `_1`.
+type scalarRecord struct {
+	value interface{}
+}
+
+func (r *scalarRecord) get(name string, _ bool) (interface{}, bool) {
+	if name != "_1" {
+		return nil, false
+	}
+	return normalize(r.value), true
+}
+
+func (r *scalarRecord) fields() ([]string, []interface{}) {
+	return []string{"_1"}, []interface{}{r.value}
+}
+
+func newValueRecord(v interface{}) record {
+	if m, ok := v.(map[string]interface{}); ok {
+		return newObjectRecord(m)
+	}
+	return &scalarRecord{value: v}
+}
+
+// newJSONRecord returns the record of the JSON value, the keys of the object keep the order in the JSON text.
+func newJSONRecord(raw json.RawMessage) (record, error) {
+	if trimmed := bytes.TrimSpace(raw); len(trimmed) == 0 || trimmed[0] != '{' {
+		var v interface{}
+		if err := unmarshalJSON(raw, &v); err != nil {
+			return nil, err
+		}
+		return &scalarRecord{value: v}, nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	if _, err := decoder.Token(); err != nil {
+		return nil, err
+	}
+	rec := &objectRecord{values: make(map[string]interface{})}
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		key, ok := token.(string)
+		if !ok {
+			return nil, fmt.Errorf("expected object key, actual %v", token)
+		}
+		var v interface{}
+		if err := decoder.Decode(&v); err != nil {
+			return nil, err
+		}
+		if _, ok := rec.values[key]; !ok {
+			rec.keys = append(rec.keys, key)
+		}
+		rec.values[key] = v
+	}
+	return rec, nil
+}
+
+func unmarshalJSON(raw []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+// expandFrom returns the values of the FROM clause path such as `S3Object[*].records[*]`, `[*]` iterates the array.
+func expandFrom(v interface{}, steps []pathStep) []interface{} {
+	values := []interface{}{v}
+	for _, step := range steps {
+		next := make([]interface{}, 0, len(values))
+		for _, value := range values {
+			if !step.wildcard {
+				if child := stepValue(value, step); child != nil {
+					next = append(next, child)
+				}
+				continue
+			}
+			if array, ok := value.([]interface{}); ok {
+				next = append(next, array...)
+			} else {
+				next = append(next, value)
+			}
+		}
+		values = next
+	}
+	return values
+}
+
+// hasFromPath reports whether the FROM clause has the path other than `S3Object[*]`.
+func hasFromPath(steps []pathStep) bool {
+	for i, step := range steps {
+		if !(i == 0 && step.wildcard) {
+			return true
+		}
+	}
+	return false
+}
+
+// errStopScan stops reading the records without error, such as LIMIT is reached.
+var errStopScan = errors.New("stop scan")
+
+// scanFile reads the records of the file, and returns the number of the records read.
+func scanFile(path string, input *inputSerialization, from []pathStep, fn func(record) error) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	if input.Parquet {
+		return scanParquet(f, from, fn)
+	}
+	var r io.Reader = bufio.NewReader(f)
+	switch input.CompressionType {
+	case compressionTypeGzip:
+		gr, err := gzip.NewReader(r)
+		if err != nil {
+			return 0, err
+		}
+		defer gr.Close()
+		r = gr
+	case compressionTypeBzip2:
+		r = bzip2.NewReader(r)
+	}
+	if input.CSV != nil {
+		return scanCSV(r, input.CSV, fn)
+	}
+	return scanJSON(r, input.JSON, from, fn)
+}
+
+func scanCSV(r io.Reader, input *csvInput, fn func(record) error) (int, error) {
+	reader := csv.NewReader(r)
+	reader.Comma = input.FieldDelimiter
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	var header []string
+	count := 0
+	for {
+		values, err := reader.Read()
+		if err == io.EOF {
+			return count, nil
+		}
+		if err != nil {
+			return count, err
+		}
+		if header == nil && input.FileHeaderInfo != fileHeaderInfoNone {
+			header = values
+			if input.FileHeaderInfo == fileHeaderInfoIgnore {
+				header = []string{}
+			}
+			continue
+		}
+		count++
+		if err := fn(&csvRecord{header: header, values: values}); err != nil {
+			return count, err
+		}
+	}
+}
+
+func scanJSON(r io.Reader, input *jsonInput, from []pathStep, fn func(record) error) (int, error) {
+	decoder := json.NewDecoder(r)
+	decoder.UseNumber()
+	count := 0
+	for {
+		var raw json.RawMessage
+		err := decoder.Decode(&raw)
+		if err == io.EOF {
+			return count, nil
+		}
+		if err != nil {
+			return count, err
+		}
+		if !hasFromPath(from) && !(input.Type == jsonTypeDocument && isJSONArray(raw)) {
+			rec, err := newJSONRecord(raw)
+			if err != nil {
+				return count, err
+			}
+			count++
+			if err := fn(rec); err != nil {
+				return count, err
+			}
+			continue
+		}
+		var v interface{}
+		if err := unmarshalJSON(raw, &v); err != nil {
+			return count, err
+		}
+		for _, value := range expandFrom(v, from) {
+			count++
+			if err := fn(newValueRecord(value)); err != nil {
+				return count, err
+			}
+		}
+	}
+}
+
+func isJSONArray(raw json.RawMessage) bool {
+	trimmed := bytes.TrimSpace(raw)
+	return len(trimmed) > 0 && trimmed[0] == '['
+}
+
+func scanParquet(r io.ReadSeeker, from []pathStep, fn func(record) error) (int, error) {
+	reader, err := goparquet.NewFileReader(r)
+	if err != nil {
+		return 0, err
+	}
+	keys := make([]string, 0)
+	for _, column := range reader.GetSchemaDefinition().RootColumn.Children {
+		keys = append(keys, column.SchemaElement.Name)
+	}
+	count := 0
+	for {
+		row, err := reader.NextRow()
+		if err == io.EOF {
+			return count, nil
+		}
+		if err != nil {
+			return count, err
+		}
+		if hasFromPath(from) {
+			for _, value := range expandFrom(row, from) {
+				count++
+				if err := fn(newValueRecord(value)); err != nil {
+					return count, err
+				}
+			}
+			continue
+		}
+		count++
+		if err := fn(&objectRecord{keys: keys, values: row}); err != nil {
+			return count, err
+		}
+	}
+}
@@ -0,0 +1,758 @@
+package localfile
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// selectStatement is the parsed S3 Select style SQL, such as `SELECT s.path FROM S3Object s WHERE s.status = '500' LIMIT 10`.
+type selectStatement struct {
+	items      []*selectItem
+	from       []pathStep
+	alias      string
+	where      expr
+	limit      int
+	aggregates []*aggregateExpr
+}
+
+type selectItem struct {
+	star bool
+	expr expr
+	name string
+}
+
+// pathStep is a step of the path, such as `s.name`, `s."quoted name"`, `s.tags[0]` or `S3Object[*]`.
+type pathStep struct {
+	name     string
+	quoted   bool
+	index    int
+	isIndex  bool
+	wildcard bool
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenQuotedIdent
+	tokenString
+	tokenNumber
+	tokenOperator
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func (t token) String() string {
+	if t.kind == tokenEOF {
+		return "end of SQL"
+	}
+	return fmt.Sprintf("`%s` at %d", t.text, t.pos)
+}
+
+var twoCharOperators = []string{"<>", "!=", "<=", ">=", "||"}
+
+func tokenize(src string) ([]token, error) {
+	tokens := make([]token, 0)
+	runes := []rune(src)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '-' && i+1 < len(runes) && runes[i+1] == '-':
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+			}
+		case r == '/' && i+1 < len(runes) && runes[i+1] == '*':
+			start := i
+			i += 2
+			for i+1 < len(runes) && !(runes[i] == '*' && runes[i+1] == '/') {
+				i++
+			}
+			if i+1 >= len(runes) {
+				return nil, fmt.Errorf("unterminated comment at %d", start)
+			}
+			i += 2
+		case r == '\'' || r == '"':
+			start := i
+			var builder strings.Builder
+			i++
+			for {
+				if i >= len(runes) {
+					return nil, fmt.Errorf("unterminated quote at %d", start)
+				}
+				if runes[i] == r {
+					if i+1 < len(runes) && runes[i+1] == r {
+						builder.WriteRune(r)
+						i += 2
+						continue
+					}
+					i++
+					break
+				}
+				builder.WriteRune(runes[i])
+				i++
+			}
+			kind := tokenString
+			if r == '"' {
+				kind = tokenQuotedIdent
+			}
+			tokens = append(tokens, token{kind: kind, text: builder.String(), pos: start})
+		case unicode.IsDigit(r) || (r == '.' && i+1 < len(runes) && unicode.IsDigit(runes[i+1])):
+			start := i
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.') {
+				i++
+			}
+			if i < len(runes) && (runes[i] == 'e' || runes[i] == 'E') {
+				i++
+				if i < len(runes) && (runes[i] == '+' || runes[i] == '-') {
+					i++
+				}
+				for i < len(runes) && unicode.IsDigit(runes[i]) {
+					i++
+				}
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: string(runes[start:i]), pos: start})
+		case unicode.IsLetter(r) || r == '_':
+			start := i
+			for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || runes[i] == '_') {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenIdent, text: string(runes[start:i]), pos: start})
+		default:
+			text := string(r)
+			if i+1 < len(runes) {
+				for _, op := range twoCharOperators {
+					if string(runes[i:i+2]) == op {
+						text = op
+						break
+					}
+				}
+			}
+			if len(text) == 1 && !strings.ContainsRune("=<>+-*/%(),.[];", r) {
+				return nil, fmt.Errorf("unexpected character `%c` at %d", r, i)
+			}
+			tokens = append(tokens, token{kind: tokenOperator, text: text, pos: i})
+			i += len([]rune(text))
+		}
+	}
+	tokens = append(tokens, token{kind: tokenEOF, pos: len(runes)})
+	return tokens, nil
+}
+
+type parser struct {
+	tokens      []token
+	pos         int
+	aggregates  []*aggregateExpr
+	inAggregate bool
+	inWhere     bool
+	// pathOutsideAggregate reports whether a path is parsed outside aggregate functions, such as `s.name` in `SELECT s.name, COUNT(*)`.
+	pathOutsideAggregate bool
+}
+
+// parseSelect parses the subset of S3 Select SQL: SELECT, FROM S3Object, WHERE and LIMIT clauses.
+func parseSelect(src string) (*selectStatement, error) {
+	tokens, err := tokenize(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	stmt, err := p.parseStatement()
+	if err != nil {
+		return nil, err
+	}
+	stmt.aggregates = p.aggregates
+	return stmt, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) peekAt(offset int) token {
+	if p.pos+offset >= len(p.tokens) {
+		return p.tokens[len(p.tokens)-1]
+	}
+	return p.tokens[p.pos+offset]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) isKeyword(keyword string) bool {
+	t := p.peek()
+	return t.kind == tokenIdent && strings.EqualFold(t.text, keyword)
+}
+
+func (p *parser) acceptKeyword(keyword string) bool {
+	if p.isKeyword(keyword) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expectKeyword(keyword string) error {
+	if !p.acceptKeyword(keyword) {
+		return fmt.Errorf("expected %s, actual %s", keyword, p.peek())
+	}
+	return nil
+}
+
+func (p *parser) isOperator(op string) bool {
+	t := p.peek()
+	return t.kind == tokenOperator && t.text == op
+}
+
+func (p *parser) acceptOperator(op string) bool {
+	if p.isOperator(op) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expectOperator(op string) error {
+	if !p.acceptOperator(op) {
+		return fmt.Errorf("expected `%s`, actual %s", op, p.peek())
+	}
+	return nil
+}
+
+var reservedWords = []string{"SELECT", "FROM", "WHERE", "LIMIT", "AS", "AND", "OR", "NOT"}
+
+func isReserved(t token) bool {
+	if t.kind != tokenIdent {
+		return false
+	}
+	for _, word := range reservedWords {
+		if strings.EqualFold(t.text, word) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *parser) parseStatement() (*selectStatement, error) {
+	if err := p.expectKeyword("SELECT"); err != nil {
+		return nil, err
+	}
+	stmt := &selectStatement{limit: -1}
+	// the first item that is evaluated by each record, it can not be selected with aggregate functions because GROUP BY is not supported.
+	var recordItem *selectItem
+	for {
+		p.pathOutsideAggregate = false
+		item, err := p.parseSelectItem(len(stmt.items) + 1)
+		if err != nil {
+			return nil, err
+		}
+		if recordItem == nil && (item.star || p.pathOutsideAggregate) {
+			recordItem = item
+		}
+		stmt.items = append(stmt.items, item)
+		if !p.acceptOperator(",") {
+			break
+		}
+	}
+	if recordItem != nil && len(p.aggregates) > 0 {
+		if recordItem.star {
+			return nil, fmt.Errorf("* can not be selected with aggregate functions")
+		}
+		return nil, fmt.Errorf("`%s` is not aggregated, it can not be selected with aggregate functions", recordItem.name)
+	}
+	if err := p.expectKeyword("FROM"); err != nil {
+		return nil, err
+	}
+	from := p.next()
+	if from.kind != tokenIdent || !strings.EqualFold(from.text, "S3Object") {
+		return nil, fmt.Errorf("only S3Object is supported in FROM clause, actual %s", from)
+	}
+	for {
+		if p.acceptOperator(".") {
+			t := p.next()
+			if t.kind != tokenIdent && t.kind != tokenQuotedIdent {
+				return nil, fmt.Errorf("expected name, actual %s", t)
+			}
+			stmt.from = append(stmt.from, pathStep{name: t.text, quoted: t.kind == tokenQuotedIdent})
+			continue
+		}
+		if p.isOperator("[") && p.peekAt(1).kind == tokenOperator && p.peekAt(1).text == "*" {
+			p.pos += 2
+			if err := p.expectOperator("]"); err != nil {
+				return nil, err
+			}
+			stmt.from = append(stmt.from, pathStep{wildcard: true})
+			continue
+		}
+		if p.isOperator("[") {
+			step, err := p.parseIndexStep()
+			if err != nil {
+				return nil, err
+			}
+			stmt.from = append(stmt.from, step)
+			continue
+		}
+		break
+	}
+	hasAs := p.acceptKeyword("AS")
+	if t := p.peek(); (t.kind == tokenIdent && !isReserved(t)) || t.kind == tokenQuotedIdent {
+		stmt.alias = p.next().text
+	} else if hasAs {
+		return nil, fmt.Errorf("expected alias, actual %s", t)
+	}
+	if p.acceptKeyword("WHERE") {
+		p.inWhere = true
+		where, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		p.inWhere = false
+		stmt.where = where
+	}
+	if p.acceptKeyword("LIMIT") {
+		t := p.next()
+		limit, err := strconv.Atoi(t.text)
+		if t.kind != tokenNumber || err != nil || limit < 0 {
+			return nil, fmt.Errorf("LIMIT must be a non-negative integer, actual %s", t)
+		}
+		stmt.limit = limit
+	}
+	p.acceptOperator(";")
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, fmt.Errorf("unexpected %s", t)
+	}
+	return stmt, nil
+}
+
+func (p *parser) parseSelectItem(position int) (*selectItem, error) {
+	if p.acceptOperator("*") {
+		return &selectItem{star: true}, nil
+	}
+	if p.peek().kind == tokenIdent && p.peekAt(1).kind == tokenOperator && p.peekAt(1).text == "." &&
+		p.peekAt(2).kind == tokenOperator && p.peekAt(2).text == "*" {
+		p.pos += 3
+		return &selectItem{star: true}, nil
+	}
+	e, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	item := &selectItem{
+		expr: e,
+		name: fmt.Sprintf("_%d", position),
+	}
+	if path, ok := e.(*pathExpr); ok {
+		if name := path.lastName(); name != "" {
+			item.name = name
+		}
+	}
+	hasAs := p.acceptKeyword("AS")
+	if t := p.peek(); (t.kind == tokenIdent && !isReserved(t)) || t.kind == tokenQuotedIdent {
+		item.name = p.next().text
+	} else if hasAs {
+		return nil, fmt.Errorf("expected alias, actual %s", t)
+	}
+	return item, nil
+}
+
+func (p *parser) parseExpr() (expr, error) {
+	return p.parseOr()
+}
+
+func (p *parser) parseOr() (expr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptKeyword("OR") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicalExpr{op: "OR", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (expr, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptKeyword("AND") {
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicalExpr{op: "AND", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseNot() (expr, error) {
+	if p.acceptKeyword("NOT") {
+		x, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &notExpr{x: x}, nil
+	}
+	return p.parseComparison()
+}
+
+var comparisonOperators = []string{"=", "<>", "!=", "<", "<=", ">", ">="}
+
+func (p *parser) parseComparison() (expr, error) {
+	left, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	for _, op := range comparisonOperators {
+		if !p.acceptOperator(op) {
+			continue
+		}
+		right, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		return &binaryExpr{op: op, left: left, right: right}, nil
+	}
+	if p.acceptKeyword("IS") {
+		not := p.acceptKeyword("NOT")
+		if !p.acceptKeyword("NULL") && !p.acceptKeyword("MISSING") {
+			return nil, fmt.Errorf("expected NULL or MISSING, actual %s", p.peek())
+		}
+		return &isNullExpr{x: left, not: not}, nil
+	}
+	not := false
+	if p.isKeyword("NOT") {
+		following := p.peekAt(1)
+		if following.kind == tokenIdent && (strings.EqualFold(following.text, "LIKE") || strings.EqualFold(following.text, "IN") || strings.EqualFold(following.text, "BETWEEN")) {
+			p.pos++
+			not = true
+		}
+	}
+	switch {
+	case p.acceptKeyword("LIKE"):
+		pattern, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		like := &likeExpr{x: left, pattern: pattern, not: not}
+		if p.acceptKeyword("ESCAPE") {
+			like.escape, err = p.parseAdditive()
+			if err != nil {
+				return nil, err
+			}
+		}
+		return like, nil
+	case p.acceptKeyword("IN"):
+		if err := p.expectOperator("("); err != nil {
+			return nil, err
+		}
+		in := &inExpr{x: left, not: not}
+		for {
+			e, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			in.list = append(in.list, e)
+			if !p.acceptOperator(",") {
+				break
+			}
+		}
+		if err := p.expectOperator(")"); err != nil {
+			return nil, err
+		}
+		return in, nil
+	case p.acceptKeyword("BETWEEN"):
+		low, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectKeyword("AND"); err != nil {
+			return nil, err
+		}
+		high, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		return &betweenExpr{x: left, low: low, high: high, not: not}, nil
+	}
+	return left, nil
+}
+
+func (p *parser) parseAdditive() (expr, error) {
+	left, err := p.parseMultiplicative()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		var op string
+		switch {
+		case p.acceptOperator("+"):
+			op = "+"
+		case p.acceptOperator("-"):
+			op = "-"
+		case p.acceptOperator("||"):
+			op = "||"
+		default:
+			return left, nil
+		}
+		right, err := p.parseMultiplicative()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryExpr{op: op, left: left, right: right}
+	}
+}
+
+func (p *parser) parseMultiplicative() (expr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		var op string
+		switch {
+		case p.acceptOperator("*"):
+			op = "*"
+		case p.acceptOperator("/"):
+			op = "/"
+		case p.acceptOperator("%"):
+			op = "%"
+		default:
+			return left, nil
+		}
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryExpr{op: op, left: left, right: right}
+	}
+}
+
+func (p *parser) parseUnary() (expr, error) {
+	if p.acceptOperator("-") {
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &negateExpr{x: x}, nil
+	}
+	if p.acceptOperator("+") {
+		return p.parseUnary()
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (expr, error) {
+	t := p.peek()
+	switch t.kind {
+	case tokenNumber:
+		p.pos++
+		if i, err := strconv.ParseInt(t.text, 10, 64); err == nil {
+			return &literalExpr{value: i}, nil
+		}
+		f, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %s", t)
+		}
+		return &literalExpr{value: f}, nil
+	case tokenString:
+		p.pos++
+		return &literalExpr{value: t.text}, nil
+	case tokenQuotedIdent:
+		return p.parsePath()
+	case tokenOperator:
+		if p.acceptOperator("(") {
+			e, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expectOperator(")"); err != nil {
+				return nil, err
+			}
+			return e, nil
+		}
+	case tokenIdent:
+		switch {
+		case p.acceptKeyword("TRUE"):
+			return &literalExpr{value: true}, nil
+		case p.acceptKeyword("FALSE"):
+			return &literalExpr{value: false}, nil
+		case p.acceptKeyword("NULL"), p.acceptKeyword("MISSING"):
+			return &literalExpr{value: nil}, nil
+		}
+		if isReserved(t) {
+			break
+		}
+		if following := p.peekAt(1); following.kind == tokenOperator && following.text == "(" {
+			return p.parseCall()
+		}
+		return p.parsePath()
+	}
+	return nil, fmt.Errorf("unexpected %s", t)
+}
+
+func (p *parser) parsePath() (expr, error) {
+	if !p.inAggregate {
+		p.pathOutsideAggregate = true
+	}
+	first := p.next()
+	path := &pathExpr{
+		steps: []pathStep{{name: first.text, quoted: first.kind == tokenQuotedIdent}},
+	}
+	for {
+		if p.isOperator(".") && p.peekAt(1).kind != tokenOperator {
+			p.pos++
+			t := p.next()
+			if t.kind != tokenIdent && t.kind != tokenQuotedIdent {
+				return nil, fmt.Errorf("expected name, actual %s", t)
+			}
+			path.steps = append(path.steps, pathStep{name: t.text, quoted: t.kind == tokenQuotedIdent})
+			continue
+		}
+		if p.isOperator("[") {
+			step, err := p.parseIndexStep()
+			if err != nil {
+				return nil, err
+			}
+			path.steps = append(path.steps, step)
+			continue
+		}
+		return path, nil
+	}
+}
+
+func (p *parser) parseIndexStep() (pathStep, error) {
+	if err := p.expectOperator("["); err != nil {
+		return pathStep{}, err
+	}
+	t := p.next()
+	var step pathStep
+	switch t.kind {
+	case tokenNumber:
+		index, err := strconv.Atoi(t.text)
+		if err != nil || index < 0 {
+			return step, fmt.Errorf("index must be a non-negative integer, actual %s", t)
+		}
+		step = pathStep{index: index, isIndex: true}
+	case tokenString:
+		step = pathStep{name: t.text, quoted: true}
+	default:
+		return step, fmt.Errorf("expected index, actual %s", t)
+	}
+	if err := p.expectOperator("]"); err != nil {
+		return step, err
+	}
+	return step, nil
+}
+
+var castTypes = map[string]string{
+	"INT":       "INT",
+	"INTEGER":   "INT",
+	"BIGINT":    "INT",
+	"SMALLINT":  "INT",
+	"FLOAT":     "FLOAT",
+	"REAL":      "FLOAT",
+	"DOUBLE":    "FLOAT",
+	"DECIMAL":   "DECIMAL",
+	"NUMERIC":   "DECIMAL",
+	"STRING":    "STRING",
+	"VARCHAR":   "STRING",
+	"CHAR":      "STRING",
+	"BOOL":      "BOOL",
+	"BOOLEAN":   "BOOL",
+	"TIMESTAMP": "TIMESTAMP",
+}
+
+func (p *parser) parseCall() (expr, error) {
+	nameToken := p.next()
+	name := strings.ToUpper(nameToken.text)
+	p.pos++ // (
+	switch name {
+	case "CAST":
+		x, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectKeyword("AS"); err != nil {
+			return nil, err
+		}
+		t := p.next()
+		typ, ok := castTypes[strings.ToUpper(t.text)]
+		if t.kind != tokenIdent || !ok {
+			return nil, fmt.Errorf("unsupported CAST type %s", t)
+		}
+		if err := p.expectOperator(")"); err != nil {
+			return nil, err
+		}
+		return &castExpr{x: x, typ: typ}, nil
+	case "COUNT", "SUM", "AVG", "MIN", "MAX":
+		if p.inWhere {
+			return nil, fmt.Errorf("aggregate function %s is not allowed in WHERE clause", name)
+		}
+		if p.inAggregate {
+			return nil, fmt.Errorf("aggregate function %s can not be nested", name)
+		}
+		agg := &aggregateExpr{fn: name, index: len(p.aggregates)}
+		if name == "COUNT" && p.acceptOperator("*") {
+			if err := p.expectOperator(")"); err != nil {
+				return nil, err
+			}
+			p.aggregates = append(p.aggregates, agg)
+			return agg, nil
+		}
+		p.inAggregate = true
+		x, err := p.parseExpr()
+		p.inAggregate = false
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectOperator(")"); err != nil {
+			return nil, err
+		}
+		agg.x = x
+		p.aggregates = append(p.aggregates, agg)
+		return agg, nil
+	}
+	fn, ok := sqlFunctions[name]
+	if !ok {
+		return nil, fmt.Errorf("unsupported function %s", nameToken)
+	}
+	call := &callExpr{name: name, fn: fn}
+	if p.acceptOperator(")") {
+		return call, nil
+	}
+	for {
+		arg, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		call.args = append(call.args, arg)
+		if name == "SUBSTRING" && (p.isKeyword("FROM") || p.isKeyword("FOR")) {
+			p.pos++
+			continue
+		}
+		if !p.acceptOperator(",") {
+			break
+		}
+	}
+	if err := p.expectOperator(")"); err != nil {
+		return nil, err
+	}
+	return call, nil
+}
@@ -0,0 +1,50 @@
+query_runner "local_file" "default" {}
+
+query "server_errors" {
+  runner           = query_runner.local_file.default
+  path             = "testdata/access_log/*.csv.gz"
+  compression_type = "GZIP"
+  csv {
+    file_header_info = "USE"
+  }
+  expression = <<EOQ
+SELECT s.time, CAST(s.status AS INT) AS status, s.path
+FROM S3Object s
+WHERE CAST(s.status AS INT) >= 500 AND s.path LIKE '/api/%'
+LIMIT 2
+EOQ
+}
+
+query "purchases" {
+  runner = query_runner.local_file.default
+  path   = "testdata/events.jsonl"
+  json {
+    type = "LINES"
+  }
+  expression = "SELECT s.user.name, SUM(s.\"count\") AS total, COUNT(*) AS events FROM S3Object s WHERE s.event = '${var.event}' AND s.user.id = 'u-1'"
+}
+
+query "purchase_totals" {
+  runner = query_runner.local_file.default
+  path   = "testdata/events.jsonl"
+  json {
+    type = "LINES"
+  }
+  expression = "SELECT SUM(s.\"count\") AS total, COUNT(*) AS events FROM S3Object s WHERE s.event = '${var.event}'"
+}
+
+query "all_events" {
+  runner = query_runner.local_file.default
+  path   = "testdata/events.jsonl"
+  json {
+    type = "LINES"
+  }
+  expression = "SELECT * FROM S3Object"
+}
+
+query "parquet" {
+  runner = query_runner.local_file.default
+  path   = "${var.dir}/*.parquet"
+  parquet {}
+  expression = "SELECT s.name, s.score * 2 AS double_score FROM S3Object s WHERE s.score > 1"
+}
@@ -0,0 +1,266 @@
+package queryrunner
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/samber/lo"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+)
+
+// OutputFormats are the formats of QueryResult.Format.
+var OutputFormats = []string{"json", "json_lines", "table", "markdown", "borderless", "vertical", "csv", "tsv"}
+
+// Output is the location where the query result is written instead of the response.
+// Location is a S3 URI as s3://bucket/key or a local file path.
+type Output struct {
+	Location string `json:"location"`
+	Format   string `json:"format"`
+}
+
+// NewOutput returns Output after the format is validated, the default format is json_lines.
+func NewOutput(location string, format string) (*Output, error) {
+	if location == "" {
+		return nil, errors.New("output location is empty")
+	}
+	if format == "" {
+		format = "json_lines"
+	}
+	if !lo.Contains(OutputFormats, format) {
+		return nil, fmt.Errorf("unknown output format `%s`, supported formats are %s", format, strings.Join(OutputFormats, ","))
+	}
+	if strings.HasPrefix(location, "s3://") {
+		if _, _, err := parseS3URI(location); err != nil {
+			return nil, err
+		}
+	}
+	return &Output{
+		Location: location,
+		Format:   format,
+	}, nil
+}
+
+// WriteOutput writes the query result in the output format to the location.
+// the S3 client is taken from ctx, see WithS3Client.
+func WriteOutput(ctx context.Context, output *Output, result *QueryResult) error {
+	body, err := result.Format(output.Format)
+	if err != nil {
+		return err
+	}
+	reqID := GetRequestID(ctx)
+	if !strings.HasPrefix(output.Location, "s3://") {
+		if err := os.MkdirAll(filepath.Dir(output.Location), 0755); err != nil {
+			return fmt.Errorf("write output `%s`: %w", output.Location, err)
+		}
+		if err := os.WriteFile(output.Location, []byte(body), 0644); err != nil {
+			return fmt.Errorf("write output `%s`: %w", output.Location, err)
+		}
+		log.Printf("[info][%s] query `%s` result is written to `%s`", reqID, result.Name, output.Location)
+		return nil
+	}
+	bucket, key, err := parseS3URI(output.Location)
+	if err != nil {
+		return err
+	}
+	client, err := GetS3Client(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader([]byte(body)),
+		ContentType: aws.String(outputContentType(output.Format)),
+	})
+	if err != nil {
+		return fmt.Errorf("put output `%s`: %w", output.Location, err)
+	}
+	log.Printf("[info][%s] query `%s` result is written to `%s`", reqID, result.Name, output.Location)
+	return nil
+}
+
+func outputContentType(format string) string {
+	switch format {
+	case "json", "json_lines":
+		return "application/x-ndjson"
+	case "csv":
+		return "text/csv"
+	case "tsv":
+		return "text/tab-separated-values"
+	}
+	return "text/plain"
+}
+
+func parseS3URI(uri string) (string, string, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "", "", fmt.Errorf("parse s3 uri `%s`: %w", uri, err)
+	}
+	key := strings.TrimPrefix(u.Path, "/")
+	if u.Scheme != "s3" || u.Host == "" || key == "" {
+		return "", "", fmt.Errorf("invalid s3 uri `%s`, please write as s3://bucket/key", uri)
+	}
+	return u.Host, key, nil
+}
+
+// S3Client is the subset of S3 API used to write outputs.
+type S3Client interface {
+	PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+}
+
+var (
+	defaultS3Client   S3Client
+	defaultS3ClientMu sync.Mutex
+)
+
+func loadDefaultS3Client(ctx context.Context) (S3Client, error) {
+	defaultS3ClientMu.Lock()
+	defer defaultS3ClientMu.Unlock()
+	if defaultS3Client != nil {
+		return defaultS3Client, nil
+	}
+	awsCfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("load aws default config: %w", err)
+	}
+	defaultS3Client = s3.NewFromConfig(awsCfg)
+	return defaultS3Client, nil
+}
+
+// outputBlock is `output` block in query block.
+type outputBlock struct {
+	location hcl.Expression
+	format   string
+}
+
+// decodeOutputBlock decodes `output` block, the location is rendered when the query runs.
+func decodeOutputBlock(block *hcl.Block, ctx *hcl.EvalContext) (*outputBlock, hcl.Diagnostics) {
+	content, diags := block.Body.Content(&hcl.BodySchema{
+		Attributes: []hcl.AttributeSchema{
+			{
+				Name: "s3_uri",
+			},
+			{
+				Name: "path",
+			},
+			{
+				Name: "format",
+			},
+		},
+	})
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	o := &outputBlock{
+		format: "json_lines",
+	}
+	s3URI, hasS3URI := content.Attributes["s3_uri"]
+	path, hasPath := content.Attributes["path"]
+	switch {
+	case hasS3URI && hasPath:
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid output",
+			Detail:   "s3_uri and path are exclusive, please write either of them",
+			Subject:  path.Range.Ptr(),
+		})
+		return nil, diags
+	case hasS3URI:
+		o.location = s3URI.Expr
+	case hasPath:
+		o.location = path.Expr
+	default:
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid output",
+			Detail:   "s3_uri or path is required",
+			Subject:  block.Body.MissingItemRange().Ptr(),
+		})
+		return nil, diags
+	}
+	if attr, ok := content.Attributes["format"]; ok {
+		value, valueDiags := attr.Expr.Value(ctx)
+		diags = append(diags, valueDiags...)
+		if valueDiags.HasErrors() {
+			return nil, diags
+		}
+		if !value.IsKnown() || value.IsNull() || value.Type() != cty.String || !lo.Contains(OutputFormats, value.AsString()) {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid output",
+				Detail:   fmt.Sprintf("format must be one of %s", strings.Join(OutputFormats, ",")),
+				Subject:  attr.Expr.Range().Ptr(),
+			})
+			return nil, diags
+		}
+		o.format = value.AsString()
+	}
+	return o, diags
+}
+
+// RenderOutput returns Output of the `output` block rendered with variables, it returns nil when the query has no `output` block.
+func (q *QueryBase) RenderOutput(variables map[string]cty.Value, functions map[string]function.Function) (*Output, error) {
+	if q == nil || q.output == nil {
+		return nil, nil
+	}
+	value, diags := q.output.location.Value(q.NewEvalContext(variables, functions))
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	if !value.IsKnown() || value.IsNull() || value.Type() != cty.String {
+		return nil, fmt.Errorf("query `%s`: output location is not string", q.Name())
+	}
+	return NewOutput(value.AsString(), q.output.format)
+}
+
+func (q *QueryBase) hasOutput() bool {
+	return q != nil && q.output != nil
+}
+
+type outputRenderer interface {
+	RenderOutput(variables map[string]cty.Value, functions map[string]function.Function) (*Output, error)
+	hasOutput() bool
+}
+
+// hasOutput returns true if the query has `output` block.
+func hasOutput(query PreparedQuery) bool {
+	r, ok := query.(outputRenderer)
+	return ok && r.hasOutput()
+}
+
+// writeQueryOutput writes the result to the location of `output` block, and returns the result without rows.
+// it returns nil when the query has no `output` block.
+func writeQueryOutput(ctx context.Context, query PreparedQuery, variables map[string]cty.Value, functions map[string]function.Function, result *QueryResult) (*QueryResult, error) {
+	r, ok := query.(outputRenderer)
+	if !ok {
+		return nil, nil
+	}
+	variables, err := EvaluateVariables(query, variables)
+	if err != nil {
+		return nil, err
+	}
+	output, err := r.RenderOutput(variables, functions)
+	if err != nil || output == nil {
+		return nil, err
+	}
+	if err := WriteOutput(ctx, output, result); err != nil {
+		return nil, err
+	}
+	summary := *result
+	summary.Rows = nil
+	summary.Output = output
+	return &summary, nil
+}
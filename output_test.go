@@ -0,0 +1,120 @@
+package queryrunner_test
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/mashiike/queryrunner"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+type stubS3Client struct {
+	objects map[string]string
+}
+
+func (c *stubS3Client) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	bs, err := io.ReadAll(params.Body)
+	if err != nil {
+		return nil, err
+	}
+	c.objects["s3://"+*params.Bucket+"/"+*params.Key] = string(bs)
+	return &s3.PutObjectOutput{}, nil
+}
+
+func TestRunQueriesWithOutput(t *testing.T) {
+	dir := t.TempDir()
+	queries, diags := decodeVariablesConfig(t, `
+	variable "date" {
+		type = string
+	}
+
+	query_runner "dummy" "default" {
+		columns = ["id", "name"]
+	}
+
+	query "to_s3" {
+		runner = query_runner.dummy.default
+		rows = [
+			[ "1", "hoge" ],
+			[ "2", "fuga" ],
+		]
+		output {
+			s3_uri = "s3://example-bucket/results/${var.date}/to_s3.csv"
+			format = "csv"
+		}
+	}
+
+	query "to_file" {
+		runner = query_runner.dummy.default
+		rows = [
+			[ "3", var.date ],
+		]
+		output {
+			path = "`+filepath.ToSlash(dir)+`/${var.date}/to_file.jsonl"
+		}
+	}
+
+	query "inline" {
+		runner = query_runner.dummy.default
+		rows = [
+			[ "4", "piyo" ],
+		]
+	}
+	`)
+	if !assert.False(t, diags.HasErrors()) {
+		t.Log(diags.Error())
+		t.FailNow()
+	}
+	client := &stubS3Client{
+		objects: make(map[string]string),
+	}
+	ctx := queryrunner.WithS3Client(context.Background(), client)
+	results, err := queryrunner.RunQueries(ctx, queries, []string{"to_s3", "to_file", "inline"}, map[string]cty.Value{
+		"var": cty.ObjectVal(map[string]cty.Value{
+			"date": cty.StringVal("2023-04-01"),
+		}),
+	}, nil)
+	require.NoError(t, err)
+	require.Equal(t, 3, len(results))
+
+	require.Equal(t, &queryrunner.Output{Location: "s3://example-bucket/results/2023-04-01/to_s3.csv", Format: "csv"}, results[0].Output)
+	require.Nil(t, results[0].Rows)
+	require.Equal(t, map[string]string{
+		"s3://example-bucket/results/2023-04-01/to_s3.csv": "id,name\n1,hoge\n2,fuga\n",
+	}, client.objects)
+
+	location := filepath.ToSlash(dir) + "/2023-04-01/to_file.jsonl"
+	require.Equal(t, &queryrunner.Output{Location: location, Format: "json_lines"}, results[1].Output)
+	bs, err := os.ReadFile(location)
+	require.NoError(t, err)
+	require.Equal(t, `{"id":"3","name":"2023-04-01"}`+"\n", string(bs))
+
+	require.Nil(t, results[2].Output)
+	require.EqualValues(t, [][]interface{}{{"4", "piyo"}}, results[2].Rows)
+}
+
+func TestDecodeBodyInvalidOutput(t *testing.T) {
+	_, diags := decodeVariablesConfig(t, `
+	query_runner "dummy" "default" {
+		columns = ["id"]
+	}
+
+	query "invalid" {
+		runner = query_runner.dummy.default
+		rows = []
+		output {
+			s3_uri = "s3://example-bucket/invalid.json"
+			path   = "invalid.json"
+		}
+	}
+	`)
+	require.True(t, diags.HasErrors())
+	require.Equal(t, "s3_uri and path are exclusive, please write either of them", diags.Errs()[0].(*hcl.Diagnostic).Detail)
+}
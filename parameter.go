@@ -0,0 +1,292 @@
+package queryrunner
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// Placeholder is a named bind parameter placeholder `:name` in SQL.
+// Start and End are byte offsets of the placeholder including the leading colon.
+type Placeholder struct {
+	Name  string
+	Start int
+	End   int
+}
+
+// FindPlaceholders returns `:name` placeholders in SQL.
+// string literals, quoted identifiers, comments and `::` type casts are skipped.
+func FindPlaceholders(sql string) []Placeholder {
+	var placeholders []Placeholder
+	for i := 0; i < len(sql); i++ {
+		switch c := sql[i]; c {
+		case '\'', '"', '`':
+			i = skipQuoted(sql, i, c)
+		case '-':
+			if strings.HasPrefix(sql[i:], "--") {
+				i = skipUntil(sql, i, "\n")
+			}
+		case '/':
+			if strings.HasPrefix(sql[i:], "/*") {
+				i = skipUntil(sql, i, "*/")
+			}
+		case ':':
+			if i+1 < len(sql) && sql[i+1] == ':' {
+				i++
+				continue
+			}
+			if i > 0 && isPlaceholderChar(sql[i-1]) {
+				continue
+			}
+			end := i + 1
+			for end < len(sql) && isPlaceholderChar(sql[end]) {
+				end++
+			}
+			if end == i+1 || isDigit(sql[i+1]) {
+				continue
+			}
+			placeholders = append(placeholders, Placeholder{
+				Name:  sql[i+1 : end],
+				Start: i,
+				End:   end,
+			})
+			i = end - 1
+		}
+	}
+	return placeholders
+}
+
+// PlaceholderNames returns unique placeholder names in SQL, in order of appearance.
+func PlaceholderNames(sql string) []string {
+	names := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, p := range FindPlaceholders(sql) {
+		if seen[p.Name] {
+			continue
+		}
+		seen[p.Name] = true
+		names = append(names, p.Name)
+	}
+	return names
+}
+
+// ReplacePlaceholders replaces each placeholder in SQL by the string returned from fn.
+// fn receives the index of the placeholder, which starts from 0.
+func ReplacePlaceholders(sql string, fn func(index int, p Placeholder) string) string {
+	var builder strings.Builder
+	last := 0
+	for i, p := range FindPlaceholders(sql) {
+		builder.WriteString(sql[last:p.Start])
+		builder.WriteString(fn(i, p))
+		last = p.End
+	}
+	builder.WriteString(sql[last:])
+	return builder.String()
+}
+
+func skipQuoted(sql string, start int, quote byte) int {
+	for i := start + 1; i < len(sql); i++ {
+		if sql[i] != quote {
+			continue
+		}
+		// doubled quote is an escaped quote.
+		if i+1 < len(sql) && sql[i+1] == quote {
+			i++
+			continue
+		}
+		return i
+	}
+	return len(sql)
+}
+
+func skipUntil(sql string, start int, terminator string) int {
+	index := strings.Index(sql[start+1:], terminator)
+	if index < 0 {
+		return len(sql)
+	}
+	return start + 1 + index + len(terminator) - 1
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+func isPlaceholderChar(c byte) bool {
+	return c == '_' || isDigit(c) || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
+
+// ValidateParameters checks that all placeholders in the SQL template are defined in parameters, at Prepare time.
+// the check is skipped for the parts which can not be known until run, such as interpolations or dynamic parameters.
+// when parameters is not set, SQL is sent as it is, so the check is skipped too.
+func ValidateParameters(sqlExpr hcl.Expression, parametersExpr hcl.Expression, ctx *hcl.EvalContext) hcl.Diagnostics {
+	var diags hcl.Diagnostics
+	if value, valueDiags := parametersExpr.Value(ctx); !valueDiags.HasErrors() && value.IsNull() {
+		return diags
+	}
+	names := make(map[string]bool)
+	pairs, mapDiags := hcl.ExprMap(parametersExpr)
+	if mapDiags.HasErrors() {
+		return diags
+	}
+	for _, pair := range pairs {
+		key, keyDiags := pair.Key.Value(ctx)
+		if keyDiags.HasErrors() || !key.IsKnown() || key.Type() != cty.String {
+			return diags
+		}
+		names[key.AsString()] = true
+	}
+	for _, name := range PlaceholderNames(staticTemplateText(sqlExpr)) {
+		if names[name] {
+			continue
+		}
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid parameters",
+			Detail:   fmt.Sprintf("placeholder `:%s` is not defined in parameters", name),
+			Subject:  sqlExpr.Range().Ptr(),
+		})
+	}
+	return diags
+}
+
+// staticTemplateText returns the literal parts of the template, the other parts are replaced by a space.
+func staticTemplateText(expr hcl.Expression) string {
+	switch expr := expr.(type) {
+	case *hclsyntax.TemplateExpr:
+		var builder strings.Builder
+		for _, part := range expr.Parts {
+			literal, ok := part.(*hclsyntax.LiteralValueExpr)
+			if ok && literal.Val.Type() == cty.String && !literal.Val.IsNull() {
+				builder.WriteString(literal.Val.AsString())
+				continue
+			}
+			builder.WriteString(" ")
+		}
+		return builder.String()
+	case *hclsyntax.LiteralValueExpr:
+		if expr.Val.Type() == cty.String && !expr.Val.IsNull() {
+			return expr.Val.AsString()
+		}
+	}
+	return ""
+}
+
+// QueryParameter is a bind parameter value for a placeholder.
+type QueryParameter struct {
+	Name  string
+	Value cty.Value
+}
+
+// EvaluateParameters evaluates the parameters attribute, the result is nil when the attribute is not set.
+func EvaluateParameters(expr hcl.Expression, ctx *hcl.EvalContext) (map[string]cty.Value, hcl.Diagnostics) {
+	value, diags := expr.Value(ctx)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	if value.IsNull() {
+		return nil, diags
+	}
+	params := make(map[string]cty.Value)
+	if !value.IsWhollyKnown() {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid parameters",
+			Detail:   "parameters is unknown",
+			Subject:  expr.Range().Ptr(),
+		})
+		return nil, diags
+	}
+	if !value.Type().IsObjectType() && !value.Type().IsMapType() {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid parameters",
+			Detail:   "parameters is not map",
+			Subject:  expr.Range().Ptr(),
+		})
+		return nil, diags
+	}
+	for name, v := range value.AsValueMap() {
+		if !v.Type().IsPrimitiveType() && v.Type() != cty.DynamicPseudoType {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid parameters",
+				Detail:   fmt.Sprintf("parameter `%s` is not string, number or bool", name),
+				Subject:  expr.Range().Ptr(),
+			})
+			continue
+		}
+		params[name] = v
+	}
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	return params, diags
+}
+
+// BindParameters returns parameters for each placeholder in SQL, in order of appearance.
+// placeholders are not detected when params is nil, that is the parameters attribute is not set.
+func BindParameters(sql string, params map[string]cty.Value) ([]QueryParameter, error) {
+	if params == nil {
+		return nil, nil
+	}
+	placeholders := FindPlaceholders(sql)
+	bound := make([]QueryParameter, 0, len(placeholders))
+	for _, p := range placeholders {
+		value, ok := params[p.Name]
+		if !ok {
+			return nil, fmt.Errorf("placeholder `:%s` is not defined in parameters", p.Name)
+		}
+		bound = append(bound, QueryParameter{
+			Name:  p.Name,
+			Value: value,
+		})
+	}
+	return bound, nil
+}
+
+// GoValue returns the parameter value as nil, string, bool, int64 or float64.
+func (p QueryParameter) GoValue() interface{} {
+	v := p.Value
+	if v.IsNull() {
+		return nil
+	}
+	switch v.Type() {
+	case cty.String:
+		return v.AsString()
+	case cty.Bool:
+		return v.True()
+	case cty.Number:
+		bf := v.AsBigFloat()
+		if bf.IsInt() {
+			if i, accuracy := bf.Int64(); accuracy == 0 {
+				return i
+			}
+		}
+		f, _ := bf.Float64()
+		return f
+	}
+	return nil
+}
+
+// String returns the parameter value as text, null is empty string.
+func (p QueryParameter) String() string {
+	v := p.Value
+	if v.IsNull() {
+		return ""
+	}
+	switch v.Type() {
+	case cty.String:
+		return v.AsString()
+	case cty.Bool:
+		if v.True() {
+			return "true"
+		}
+		return "false"
+	case cty.Number:
+		return v.AsBigFloat().Text('f', -1)
+	}
+	return ""
+}
@@ -0,0 +1,140 @@
+package queryrunner_test
+
+import (
+	"testing"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/mashiike/queryrunner"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestFindPlaceholders(t *testing.T) {
+	cases := []struct {
+		name     string
+		sql      string
+		expected []string
+	}{
+		{
+			name:     "simple",
+			sql:      "SELECT * FROM users WHERE id = :user_id AND status = :status",
+			expected: []string{"user_id", "status"},
+		},
+		{
+			name:     "repeated",
+			sql:      "SELECT :a, :b, :a",
+			expected: []string{"a", "b"},
+		},
+		{
+			name:     "skip literals and comments",
+			sql:      "SELECT ':quoted', \"col:name\", '12:30' -- :comment\n/* :block */ FROM t WHERE x = :x",
+			expected: []string{"x"},
+		},
+		{
+			name:     "skip casts",
+			sql:      "SELECT created_at::date, :v::int FROM t",
+			expected: []string{"v"},
+		},
+		{
+			name:     "escaped quote",
+			sql:      "SELECT 'it''s :not' || :yes",
+			expected: []string{"yes"},
+		},
+		{
+			name:     "no placeholder",
+			sql:      "SELECT arr[1:2], a:b FROM t",
+			expected: []string{},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			require.EqualValues(t, c.expected, queryrunner.PlaceholderNames(c.sql))
+		})
+	}
+}
+
+func TestReplacePlaceholders(t *testing.T) {
+	actual := queryrunner.ReplacePlaceholders("SELECT * FROM t WHERE a = :a AND b = ':b' AND c = :c", func(index int, p queryrunner.Placeholder) string {
+		return "?"
+	})
+	require.Equal(t, "SELECT * FROM t WHERE a = ? AND b = ':b' AND c = ?", actual)
+}
+
+func TestValidateParameters(t *testing.T) {
+	cases := []struct {
+		name       string
+		sql        string
+		parameters string
+		errDetails []string
+	}{
+		{
+			name:       "defined",
+			sql:        `"SELECT * FROM t WHERE id = :id"`,
+			parameters: `{ id = var.id }`,
+		},
+		{
+			name:       "not defined",
+			sql:        `"SELECT * FROM t WHERE id = :id AND name = :name"`,
+			parameters: `{ id = var.id }`,
+			errDetails: []string{"placeholder `:name` is not defined in parameters"},
+		},
+		{
+			name:       "no parameters",
+			sql:        `"SELECT * FROM t WHERE id = :id"`,
+			parameters: `null`,
+		},
+		{
+			name:       "empty parameters",
+			sql:        `"SELECT * FROM t WHERE id = :id"`,
+			parameters: `{}`,
+			errDetails: []string{"placeholder `:id` is not defined in parameters"},
+		},
+		{
+			name:       "interpolation is skipped",
+			sql:        `"SELECT * FROM ${var.table} WHERE id = :id"`,
+			parameters: `{ "id" = 1 }`,
+		},
+		{
+			name:       "dynamic parameters are skipped",
+			sql:        `"SELECT * FROM t WHERE id = :id"`,
+			parameters: `var.parameters`,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			sqlExpr, diags := hclsyntax.ParseTemplate([]byte(c.sql[1:len(c.sql)-1]), "sql.hcl", hcl.InitialPos)
+			require.False(t, diags.HasErrors())
+			parametersExpr, diags := hclsyntax.ParseExpression([]byte(c.parameters), "parameters.hcl", hcl.InitialPos)
+			require.False(t, diags.HasErrors())
+			diags = queryrunner.ValidateParameters(sqlExpr, parametersExpr, &hcl.EvalContext{})
+			details := make([]string, 0)
+			for _, diag := range diags {
+				details = append(details, diag.Detail)
+			}
+			if c.errDetails == nil {
+				c.errDetails = []string{}
+			}
+			require.EqualValues(t, c.errDetails, details)
+		})
+	}
+}
+
+func TestBindParameters(t *testing.T) {
+	bound, err := queryrunner.BindParameters("SELECT :a, :b, :a", map[string]cty.Value{
+		"a": cty.NumberIntVal(1),
+		"b": cty.StringVal("hoge"),
+	})
+	require.NoError(t, err)
+	require.EqualValues(t, []interface{}{int64(1), "hoge", int64(1)}, []interface{}{
+		bound[0].GoValue(), bound[1].GoValue(), bound[2].GoValue(),
+	})
+	_, err = queryrunner.BindParameters("SELECT :a, :c", map[string]cty.Value{
+		"a": cty.NumberIntVal(1),
+	})
+	require.EqualError(t, err, "placeholder `:c` is not defined in parameters")
+
+	bound, err = queryrunner.BindParameters("SELECT '12:30'::time, :a", nil)
+	require.NoError(t, err)
+	require.Empty(t, bound)
+}
@@ -4,8 +4,10 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"time"
 
 	"github.com/hashicorp/hcl/v2"
+	"github.com/mashiike/hclconfig"
 	"github.com/zclconf/go-cty/cty"
 	"github.com/zclconf/go-cty/cty/function"
 )
@@ -14,11 +16,55 @@ type PreparedQuery interface {
 	Name() string
 	Description() string
 	RunnerType() string
+	// Variables returns declared variables referred by the query, it is nil when no variable is declared.
+	Variables() Variables
 	Run(ctx context.Context, variables map[string]cty.Value, functions map[string]function.Function) (*QueryResult, error)
 }
 
 type PreparedQueries []PreparedQuery
 
+// RunQuery runs query after the variables are evaluated by the declared variables of the query.
+// missing or invalid variables are reported before the query runs.
+// if the query has `cache` block, the result is returned from the cache storage of ctx while it is not expired.
+// transient errors are retried by the `retry` block of the query, and the number of retries and Stats are set to the result.
+// the result is recorded as a fixture if ctx has FixtureRecorder.
+func RunQuery(ctx context.Context, query PreparedQuery, variables map[string]cty.Value, functions map[string]function.Function) (*QueryResult, error) {
+	variables, err := EvaluateVariables(query, variables)
+	if err != nil {
+		return nil, err
+	}
+	cache, err := newQueryCache(ctx, query, variables, functions)
+	if err != nil {
+		return nil, err
+	}
+	if cache != nil {
+		if result, ok := cache.Load(ctx); ok {
+			if err := recordFixture(ctx, result); err != nil {
+				return nil, err
+			}
+			return result, nil
+		}
+	}
+	release, err := acquireRunner(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	ctx, recorder := startRun(ctx, query)
+	result, err := query.Run(ctx, variables, functions)
+	if err != nil {
+		return nil, err
+	}
+	recorder.finish(result, len(result.Rows))
+	if cache != nil {
+		cache.Store(ctx, result)
+	}
+	if err := recordFixture(ctx, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
 func (queries PreparedQueries) Get(name string) (PreparedQuery, bool) {
 	for _, query := range queries {
 		if query.Name() != name {
@@ -45,6 +91,16 @@ type QueryBase struct {
 	body        hcl.Body
 	remain      hcl.Body
 	evalCtx     *hcl.EvalContext
+	variables   Variables
+	cache       time.Duration
+	output      *outputBlock
+	waiter      WaiterSettings
+	retry       RetryPolicy
+	limiter     *concurrencyLimiter
+
+	queryTraversals  []hcl.Traversal
+	dependencies     []string
+	dependencyRanges map[string]hcl.Range
 }
 
 func (q *QueryBase) Name() string {
@@ -63,6 +119,51 @@ func (q *QueryBase) RunnerType() string {
 	return q.runner.Type()
 }
 
+func (q *QueryBase) cacheTTL() time.Duration {
+	if q == nil {
+		return 0
+	}
+	return q.cache
+}
+
+// WaiterSettings returns the settings of waiting for the query, that override the settings of the query runner.
+func (q *QueryBase) WaiterSettings() WaiterSettings {
+	if q == nil {
+		return WaiterSettings{}
+	}
+	return q.waiter
+}
+
+// DecodeWaiterSettings decodes the waiter attributes of the query block in Remain, the remain body is returned for the other attributes.
+// only the query runners polling the query status call it, so the others report the waiter attributes as unsupported.
+func (q *QueryBase) DecodeWaiterSettings(ctx *hcl.EvalContext) (hcl.Body, hcl.Diagnostics) {
+	waiter, remain, diags := DecodeWaiterSettings(q.remain, ctx)
+	q.waiter = waiter
+	return remain, diags
+}
+
+// DecodeRetryPolicy decodes `retry` block of the query block in body, the remain body is returned for the other attributes and blocks.
+// only the query runners calling Retry call it, so the others report `retry` block as unsupported.
+func (q *QueryBase) DecodeRetryPolicy(body hcl.Body, ctx *hcl.EvalContext) (hcl.Body, hcl.Diagnostics) {
+	policy, remain, diags := DecodeRetryPolicy(body, ctx)
+	q.retry = policy
+	return remain, diags
+}
+
+func (q *QueryBase) retryPolicy() RetryPolicy {
+	if q == nil {
+		return RetryPolicy{}
+	}
+	return q.retry
+}
+
+func (q *QueryBase) Variables() Variables {
+	if q == nil {
+		return nil
+	}
+	return q.variables
+}
+
 func (q *QueryBase) NewEvalContext(variables map[string]cty.Value, functions map[string]function.Function) *hcl.EvalContext {
 	ctx := q.evalCtx.NewChild()
 	ctx.Variables = variables
@@ -79,6 +180,10 @@ func (q *QueryBase) Remain() hcl.Body {
 }
 
 func (q *QueryBase) DecodeBody(body hcl.Body, ctx *hcl.EvalContext, queryRunners QueryRunners) (PreparedQuery, hcl.Diagnostics) {
+	return q.decodeBody(body, ctx, queryRunners, nil)
+}
+
+func (q *QueryBase) decodeBody(body hcl.Body, ctx *hcl.EvalContext, queryRunners QueryRunners, declared Variables) (PreparedQuery, hcl.Diagnostics) {
 	q.body = body
 	q.evalCtx = ctx
 
@@ -92,9 +197,30 @@ func (q *QueryBase) DecodeBody(body hcl.Body, ctx *hcl.EvalContext, queryRunners
 				Required: true,
 			},
 		},
+		Blocks: []hcl.BlockHeaderSchema{
+			{
+				Type: "cache",
+			},
+			{
+				Type: "output",
+			},
+		},
 	}
 	content, remain, diags := body.PartialContent(schema)
 	q.remain = remain
+	diags = append(diags, hclconfig.RestrictOnlyOneBlock(content, "cache", "output")...)
+	for _, block := range content.Blocks {
+		switch block.Type {
+		case "cache":
+			ttl, cacheDiags := decodeCacheBlock(block, ctx)
+			diags = append(diags, cacheDiags...)
+			q.cache = ttl
+		case "output":
+			output, outputDiags := decodeOutputBlock(block, ctx)
+			diags = append(diags, outputDiags...)
+			q.output = output
+		}
+	}
 	for _, attr := range content.Attributes {
 		switch attr.Name {
 		case "description":
@@ -200,6 +326,12 @@ func (q *QueryBase) DecodeBody(body hcl.Body, ctx *hcl.EvalContext, queryRunners
 			}
 		}
 	}
+	if declared != nil {
+		var variablesDiags hcl.Diagnostics
+		q.variables, variablesDiags = referencedVariables(body, declared)
+		diags = append(diags, variablesDiags...)
+	}
+	q.queryTraversals = referencedQueryTraversals(body)
 	if diags.HasErrors() {
 		return nil, diags
 	}
@@ -0,0 +1,153 @@
+package queryrunner
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// QueryGroupPrefix is the prefix of the query group name given as a query name, e.g. `@triage`.
+const QueryGroupPrefix = "@"
+
+// QueryGroup is the named set of queries declared by `query_group` block, that are run together.
+type QueryGroup struct {
+	Name        string
+	Description string
+	// Queries is the names of the queries in the group.
+	Queries []string
+}
+
+type QueryGroups []*QueryGroup
+
+func (groups QueryGroups) Get(name string) (*QueryGroup, bool) {
+	for _, group := range groups {
+		if group.Name != name {
+			continue
+		}
+		return group, true
+	}
+	return nil, false
+}
+
+// Expand replaces the names of `@<group name>` with the query names of the group, the duplicated names are removed.
+func (groups QueryGroups) Expand(names []string) ([]string, error) {
+	expanded := make([]string, 0, len(names))
+	seen := make(map[string]bool, len(names))
+	add := func(name string) {
+		if seen[name] {
+			return
+		}
+		seen[name] = true
+		expanded = append(expanded, name)
+	}
+	for _, name := range names {
+		if !strings.HasPrefix(name, QueryGroupPrefix) {
+			add(name)
+			continue
+		}
+		group, ok := groups.Get(strings.TrimPrefix(name, QueryGroupPrefix))
+		if !ok {
+			return nil, fmt.Errorf("query_group `%s` is not found", strings.TrimPrefix(name, QueryGroupPrefix))
+		}
+		for _, queryName := range group.Queries {
+			add(queryName)
+		}
+	}
+	return expanded, nil
+}
+
+// Config is the queries and the query groups of the configuration.
+type Config struct {
+	Queries PreparedQueries
+	Groups  QueryGroups
+}
+
+func (cfg *Config) DecodeBody(body hcl.Body, ctx *hcl.EvalContext) hcl.Diagnostics {
+	var diags hcl.Diagnostics
+	if cfg == nil {
+		panic("config is nil")
+	}
+	cfg.Queries, cfg.Groups, _, diags = decodeBody(body, ctx)
+	return diags
+}
+
+func decodeQueryGroupBlock(block *hcl.Block, ctx *hcl.EvalContext, queries PreparedQueries) (*QueryGroup, hcl.Diagnostics) {
+	content, diags := block.Body.Content(&hcl.BodySchema{
+		Attributes: []hcl.AttributeSchema{
+			{
+				Name:     "queries",
+				Required: true,
+			},
+			{
+				Name: "description",
+			},
+		},
+	})
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	group := &QueryGroup{
+		Name: block.Labels[0],
+	}
+	if attr, ok := content.Attributes["description"]; ok {
+		value, valueDiags := attr.Expr.Value(ctx)
+		diags = append(diags, valueDiags...)
+		if valueDiags.HasErrors() {
+			return nil, diags
+		}
+		if !value.IsKnown() || value.IsNull() || value.Type() != cty.String {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid description",
+				Detail:   "description is not string",
+				Subject:  attr.Expr.Range().Ptr(),
+			})
+			return nil, diags
+		}
+		group.Description = value.AsString()
+	}
+	attr := content.Attributes["queries"]
+	exprs, listDiags := hcl.ExprList(attr.Expr)
+	diags = append(diags, listDiags...)
+	if listDiags.HasErrors() {
+		return nil, diags
+	}
+	for _, expr := range exprs {
+		traversal, traversalDiags := hcl.AbsTraversalForExpr(expr)
+		if traversalDiags.HasErrors() {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid query_group queries",
+				Detail:   "queries must be a list of query, please write as queries = [query.<name>]",
+				Subject:  expr.Range().Ptr(),
+			})
+			continue
+		}
+		query, err := TraversalQuery(traversal, queries)
+		if err != nil {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid query_group queries",
+				Detail:   fmt.Sprintf("%s, please write as queries = [query.<name>]", err.Error()),
+				Subject:  expr.Range().Ptr(),
+			})
+			continue
+		}
+		group.Queries = append(group.Queries, query.Name())
+	}
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	if len(group.Queries) == 0 {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid query_group queries",
+			Detail:   "queries is empty, the query group must have at least one query",
+			Subject:  attr.Expr.Range().Ptr(),
+		})
+		return nil, diags
+	}
+	return group, diags
+}
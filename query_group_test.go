@@ -0,0 +1,95 @@
+package queryrunner_test
+
+import (
+	"testing"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/gohcl"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/mashiike/hclconfig"
+	"github.com/mashiike/queryrunner"
+	"github.com/stretchr/testify/require"
+)
+
+func decodeGroupConfig(t *testing.T, src string) (*queryrunner.Config, hcl.Diagnostics) {
+	t.Helper()
+	err := queryrunner.Register(&queryrunner.QueryRunnerDefinition{
+		TypeName: "dummy",
+		BuildQueryRunnerFunc: func(name string, body hcl.Body, ctx *hcl.EvalContext) (queryrunner.QueryRunner, hcl.Diagnostics) {
+			runner := &dummyQueryRunner{
+				name: name,
+			}
+			diags := gohcl.DecodeBody(body, ctx, runner)
+			return runner, diags
+		},
+	})
+	require.NoError(t, err)
+	parser := hclparse.NewParser()
+	file, diags := parser.ParseHCL([]byte(src), "config.hcl")
+	require.False(t, diags.HasErrors())
+	var cfg queryrunner.Config
+	diags = cfg.DecodeBody(file.Body, hclconfig.NewEvalContext())
+	return &cfg, diags
+}
+
+func TestQueryGroup(t *testing.T) {
+	cfg, diags := decodeGroupConfig(t, `
+	query_runner "dummy" "default" {
+		columns = ["name"]
+	}
+
+	query "lambda_logs" {
+		runner = query_runner.dummy.default
+		rows   = [[ "lambda" ]]
+	}
+
+	query "alb_5xx" {
+		runner = query_runner.dummy.default
+		rows   = [[ "alb" ]]
+	}
+
+	query "errors" {
+		runner = query_runner.dummy.default
+		rows   = [[ "errors" ]]
+	}
+
+	query_group "triage" {
+		description = "incident triage"
+		queries     = [query.lambda_logs, query.alb_5xx, query.errors]
+	}
+	`)
+	if diags.HasErrors() {
+		t.Fatal(diags.Error())
+	}
+	require.Equal(t, 3, len(cfg.Queries))
+	group, ok := cfg.Groups.Get("triage")
+	require.True(t, ok)
+	require.Equal(t, "incident triage", group.Description)
+	require.Equal(t, []string{"lambda_logs", "alb_5xx", "errors"}, group.Queries)
+
+	names, err := cfg.Groups.Expand([]string{"alb_5xx", "@triage"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"alb_5xx", "lambda_logs", "errors"}, names)
+
+	_, err = cfg.Groups.Expand([]string{"@not_found"})
+	require.EqualError(t, err, "query_group `not_found` is not found")
+}
+
+func TestDecodeBodyInvalidQueryGroup(t *testing.T) {
+	_, diags := decodeGroupConfig(t, `
+	query_runner "dummy" "default" {
+		columns = ["name"]
+	}
+
+	query "lambda_logs" {
+		runner = query_runner.dummy.default
+		rows   = [[ "lambda" ]]
+	}
+
+	query_group "triage" {
+		queries = [query.lambda_logs, query.not_found]
+	}
+	`)
+	require.True(t, diags.HasErrors())
+	require.Equal(t, "query.not_found is not found, please write as queries = [query.<name>]", diags.Errs()[0].(*hcl.Diagnostic).Detail)
+}
@@ -2,6 +2,7 @@ package queryrunner
 
 import (
 	"bytes"
+	"encoding/csv"
 	"encoding/json"
 	"fmt"
 	"log"
@@ -16,20 +17,42 @@ import (
 type QueryResult struct {
 	Name    string
 	Query   string
-	Columns []string
-	Rows    [][]string
+	Columns Columns
+	Rows    [][]interface{}
+	// Output is the location where the rows were written instead of Rows, see `output` block.
+	Output *Output
+	// Stats is the execution statistics, it is nil if the result is not returned by RunQuery, StreamQuery or FetchQuery.
+	Stats *Stats
+	// Err is the error of the failed query, that is set only with RunOptions.ContinueOnError.
+	Err error
 }
 
 func NewEmptyQueryResult(name string, query string) *QueryResult {
 	return &QueryResult{
 		Name:    name,
 		Query:   query,
-		Columns: make([]string, 0),
-		Rows:    make([][]string, 0),
+		Columns: make(Columns, 0),
+		Rows:    make([][]interface{}, 0),
 	}
 }
 
+// NewQueryResult returns a QueryResult that all columns are string.
 func NewQueryResult(name string, query string, columns []string, rows [][]string) *QueryResult {
+	return &QueryResult{
+		Name:    name,
+		Query:   query,
+		Columns: NewStringColumns(columns...),
+		Rows: lo.Map(rows, func(row []string, _ int) []interface{} {
+			return lo.Map(row, func(v string, _ int) interface{} {
+				return v
+			})
+		}),
+	}
+}
+
+// NewQueryResultWithColumns returns a QueryResult with typed columns.
+// Each row must be same length as columns, cell values are nil, string, bool, integer, float, json.Number, time.Time, []byte or JSON compatible values.
+func NewQueryResultWithColumns(name string, query string, columns Columns, rows [][]interface{}) *QueryResult {
 	return &QueryResult{
 		Name:    name,
 		Query:   query,
@@ -39,25 +62,23 @@ func NewQueryResult(name string, query string, columns []string, rows [][]string
 }
 
 func NewQueryResultWithJSONLines(name string, query string, lines [][]byte) *QueryResult {
-	columnsMap := make(map[string]int)
-	rowsMap := make([]map[string]interface{}, 0, len(lines))
+	collector := &rowCollector{}
+	mw := NewRowMapWriter(collector)
 	for _, line := range lines {
-		var v map[string]interface{}
-		log.Println("[debug] NewQueryResultWithJSONLines:", string(line))
-		if err := json.Unmarshal(line, &v); err == nil {
-			rowsMap = append(rowsMap, v)
-			for columnName := range v {
-				if _, ok := columnsMap[columnName]; !ok {
-					columnsMap[columnName] = len(columnsMap)
-				}
-			}
-		} else {
+		if err := mw.WriteJSONLine(line); err != nil {
 			log.Println("[warn] unmarshal err", err)
 		}
 	}
-	return NewQueryResultWithRowsMap(name, query, columnsMap, rowsMap)
+	log.Printf("[debug] NewQueryResultWithJSONLines: `%s` %d lines", name, len(lines))
+	return collector.QueryResult(&QueryResult{
+		Name:    name,
+		Query:   query,
+		Columns: mw.Columns(),
+	})
 }
 
+// NewQueryResultWithRowsMap returns a QueryResult, column types are inferred from values.
+// missing value in a row is treated as null.
 func NewQueryResultWithRowsMap(name, query string, columnsMap map[string]int, rowsMap []map[string]interface{}) *QueryResult {
 	queryResults := &QueryResult{
 		Name:  name,
@@ -67,33 +88,51 @@ func NewQueryResultWithRowsMap(name, query string, columnsMap map[string]int, ro
 	sort.Slice(columnsEntries, func(i, j int) bool {
 		return columnsEntries[i].Value < columnsEntries[j].Value
 	})
-	rows := make([][]string, 0, len(rowsMap))
+	columns := lo.Map(columnsEntries, func(e lo.Entry[string, int], _ int) Column {
+		return Column{
+			Name: e.Key,
+		}
+	})
+	rows := make([][]interface{}, 0, len(rowsMap))
 	for _, rowMap := range rowsMap {
-		row := make([]string, 0, len(columnsEntries))
-		for _, e := range columnsEntries {
-			if v, ok := rowMap[e.Key]; ok {
-				row = append(row, fmt.Sprintf("%v", v))
-			} else {
-				row = append(row, "")
+		row := make([]interface{}, 0, len(columnsEntries))
+		for i, e := range columnsEntries {
+			v := normalizeValue(rowMap[e.Key])
+			if v == nil {
+				columns[i].Nullable = true
 			}
+			columns[i].Type = mergeColumnType(columns[i].Type, ColumnTypeOf(v))
+			row = append(row, v)
 		}
 		rows = append(rows, row)
 	}
+	for i := range columns {
+		if columns[i].Type == "" {
+			columns[i].Type = ColumnTypeUnknown
+		}
+	}
 	queryResults.Rows = rows
-	queryResults.Columns = lo.Map(columnsEntries, func(e lo.Entry[string, int], _ int) string {
-		return e.Key
-	})
+	queryResults.Columns = columns
 	return queryResults
 }
 
+// stringRows returns rows formatted as string.
+func (qr *QueryResult) stringRows() [][]string {
+	return lo.Map(qr.Rows, func(row []interface{}, _ int) []string {
+		return lo.Map(row, func(v interface{}, _ int) string {
+			return FormatValue(v)
+		})
+	})
+}
+
 func (qr *QueryResult) ToTable(optFns ...func(*tablewriter.Table)) string {
 	var buf bytes.Buffer
 	table := tablewriter.NewWriter(&buf)
-	table.SetHeader(qr.Columns)
+	table.SetHeader(qr.Columns.Names())
 	for _, optFn := range optFns {
 		optFn(table)
 	}
-	table.AppendBulk(qr.Rows)
+	table.AppendBulk(qr.stringRows())
 	table.Render()
 	return buf.String()
 }
@@ -103,7 +142,7 @@ func (qr *QueryResult) ToVertical() string {
 	for i, row := range qr.Rows {
 		fmt.Fprintf(&builder, "********* %d. row *********\n", i+1)
 		for j, column := range qr.Columns {
-			fmt.Fprintf(&builder, "  %s: %s\n", column, row[j])
+			fmt.Fprintf(&builder, "  %s: %s\n", column.Name, FormatValue(row[j]))
 		}
 	}
 	return builder.String()
@@ -132,32 +171,81 @@ func (qr *QueryResult) ToMarkdownTable() string {
 	)
 }
 
-func (qr *QueryResult) ToJSONLines() string {
+// CSVOptions is the options of ToCSV and ToTSV.
+type CSVOptions struct {
+	// Delimiter is the field delimiter, ',' for ToCSV and '\t' for ToTSV by default.
+	Delimiter rune
+	// NoHeader omits the header line of column names.
+	NoHeader bool
+}
+
+// ToCSV returns rows as CSV, fields are quoted as RFC 4180 when needed and null is an empty field.
+func (qr *QueryResult) ToCSV(optFns ...func(*CSVOptions)) string {
+	opts := &CSVOptions{
+		Delimiter: ',',
+	}
+	for _, optFn := range optFns {
+		optFn(opts)
+	}
+	if len(qr.Columns) == 0 {
+		return ""
+	}
 	var builder strings.Builder
-	encoder := json.NewEncoder(&builder)
-	for _, row := range qr.toJSON() {
-		encoder.Encode(row)
+	w := csv.NewWriter(&builder)
+	w.Comma = opts.Delimiter
+	if !opts.NoHeader {
+		w.Write(qr.Columns.Names())
+	}
+	w.WriteAll(qr.stringRows())
+	if err := w.Error(); err != nil {
+		log.Println("[warn] write csv:", err)
 	}
 	return builder.String()
 }
 
-func (qr *QueryResult) toJSON() []map[string]string {
-	columns := make([]string, 0, len(qr.Columns))
-	duplicate := make(map[string]int, len(qr.Columns))
-	for _, column := range qr.Columns {
-		if index, ok := duplicate[column]; ok {
-			columns = append(columns, fmt.Sprintf("%s%d", column, index))
-			duplicate[column]++
-		} else {
-			columns = append(columns, column)
-			duplicate[column] = 1
-		}
+// ToTSV returns rows as TSV, that is ToCSV with tab delimiter.
+func (qr *QueryResult) ToTSV(optFns ...func(*CSVOptions)) string {
+	return qr.ToCSV(append([]func(*CSVOptions){
+		func(opts *CSVOptions) {
+			opts.Delimiter = '\t'
+		},
+	}, optFns...)...)
+}
+
+func (qr *QueryResult) ToJSONLines() string {
+	var builder strings.Builder
+	qr.WriteRows(NewJSONLinesRowWriter(&builder))
+	return builder.String()
+}
+
+// Format returns the result in the output format, json is same as json_lines.
+func (qr *QueryResult) Format(format string) (string, error) {
+	switch format {
+	case "json", "json_lines":
+		return qr.ToJSONLines(), nil
+	case "table":
+		return qr.ToTable(), nil
+	case "markdown":
+		return qr.ToMarkdownTable(), nil
+	case "borderless":
+		return qr.ToBorderlessTable(), nil
+	case "vertical":
+		return qr.ToVertical(), nil
+	case "csv":
+		return qr.ToCSV(), nil
+	case "tsv":
+		return qr.ToTSV(), nil
 	}
-	ret := make([]map[string]string, 0, len(qr.Rows))
+	return "", fmt.Errorf("unknown output format `%s`", format)
+}
+
+func (qr *QueryResult) toJSON() []map[string]interface{} {
+	columns := jsonColumnNames(qr.Columns)
+	ret := make([]map[string]interface{}, 0, len(qr.Rows))
 	for _, row := range qr.Rows {
-		v := make(map[string]string, len(qr.Columns))
+		v := make(map[string]interface{}, len(qr.Columns))
 		for i, column := range columns {
-			v[column] = row[i]
+			v[column] = jsonValue(row[i])
 		}
 		ret = append(ret, v)
 	}
@@ -170,19 +258,23 @@ func (qr *QueryResult) MarshalJSON() ([]byte, error) {
 
 func (qr *QueryResult) MarshalCTYValue() cty.Value {
 	columns := cty.ListValEmpty(cty.String)
-	rows := cty.ListValEmpty(cty.List(cty.String))
+	columnTypes := cty.ListValEmpty(cty.String)
+	rows := cty.EmptyTupleVal
 	if len(qr.Columns) > 0 {
-		columns = cty.ListVal(lo.Map(qr.Columns, func(column string, _ int) cty.Value {
-			return cty.StringVal(column)
+		columns = cty.ListVal(lo.Map(qr.Columns, func(column Column, _ int) cty.Value {
+			return cty.StringVal(column.Name)
+		}))
+		columnTypes = cty.ListVal(lo.Map(qr.Columns, func(column Column, _ int) cty.Value {
+			return cty.StringVal(string(column.Type))
 		}))
 	}
 	if len(qr.Rows) > 0 {
-		rows = cty.ListVal(lo.Map(qr.Rows, func(row []string, _ int) cty.Value {
+		rows = cty.TupleVal(lo.Map(qr.Rows, func(row []interface{}, _ int) cty.Value {
 			if len(row) == 0 {
-				return cty.ListValEmpty(cty.String)
+				return cty.EmptyTupleVal
 			}
-			return cty.ListVal(lo.Map(row, func(v string, _ int) cty.Value {
-				return cty.StringVal(v)
+			return cty.TupleVal(lo.Map(row, func(v interface{}, i int) cty.Value {
+				return ctyValue(qr.Columns[i], v)
 			}))
 		}))
 	}
@@ -190,17 +282,34 @@ func (qr *QueryResult) MarshalCTYValue() cty.Value {
 		"name":             cty.StringVal(qr.Name),
 		"query":            cty.StringVal(qr.Query),
 		"columns":          columns,
+		"column_types":     columnTypes,
 		"rows":             rows,
 		"table":            cty.StringVal(qr.ToTable()),
 		"markdown_table":   cty.StringVal(qr.ToMarkdownTable()),
 		"borderless_table": cty.StringVal(qr.ToBorderlessTable()),
 		"vertical_table":   cty.StringVal(qr.ToVertical()),
 		"json_lines":       cty.StringVal(qr.ToJSONLines()),
+		"csv":              cty.StringVal(qr.ToCSV()),
+		"stats":            qr.Stats.MarshalCTYValue(),
 	})
 }
 
 type QueryResults []*QueryResult
 
+// Err returns the error of the failed queries, it is nil if all queries succeeded.
+func (qrs QueryResults) Err() error {
+	var msgs []string
+	for _, qr := range qrs {
+		if qr.Err != nil {
+			msgs = append(msgs, fmt.Sprintf("query `%s`: %v", qr.Name, qr.Err))
+		}
+	}
+	if len(msgs) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%d of %d queries failed: %s", len(msgs), len(qrs), strings.Join(msgs, ", "))
+}
+
 func (qrs QueryResults) MarshalJSON() ([]byte, error) {
 	m := make(map[string]*QueryResult, len(qrs))
 	for _, qr := range qrs {
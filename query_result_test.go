@@ -1,6 +1,7 @@
 package queryrunner_test
 
 import (
+	"encoding/json"
 	"strings"
 	"testing"
 
@@ -18,14 +19,18 @@ func TestNewQueryResultWithJSONLines(t *testing.T) {
 	}
 	qr := queryrunner.NewQueryResultWithJSONLines("dummy", "SELECT * FROM dummy", lines)
 	expected := &queryrunner.QueryResult{
-		Name:    "dummy",
-		Query:   "SELECT * FROM dummy",
-		Columns: []string{"name", "age", "memo"},
-		Rows: [][]string{
-			{"hoge", "", ""},
-			{"fuga", "18", ""},
-			{"piyo", "82", ""},
-			{"tora", "", "animal"},
+		Name:  "dummy",
+		Query: "SELECT * FROM dummy",
+		Columns: queryrunner.Columns{
+			{Name: "name", Type: queryrunner.ColumnTypeString},
+			{Name: "age", Type: queryrunner.ColumnTypeInteger, Nullable: true},
+			{Name: "memo", Type: queryrunner.ColumnTypeString, Nullable: true},
+		},
+		Rows: [][]interface{}{
+			{"hoge", nil, nil},
+			{"fuga", int64(18), nil},
+			{"piyo", int64(82), nil},
+			{"tora", nil, "animal"},
 		},
 	}
 	require.EqualValues(t, expected, qr)
@@ -98,17 +103,24 @@ func TestQueryReusltMarshalCTYValue(t *testing.T) {
 			cty.StringVal("Sign"),
 			cty.StringVal("Rating"),
 		}),
-		"rows": cty.ListVal([]cty.Value{
-			cty.ListVal([]cty.Value{cty.StringVal("A"), cty.StringVal("The Good"), cty.StringVal("500")}),
-			cty.ListVal([]cty.Value{cty.StringVal("B"), cty.StringVal("The Very very Bad Man"), cty.StringVal("288")}),
-			cty.ListVal([]cty.Value{cty.StringVal("C"), cty.StringVal("The Ugly"), cty.StringVal("120")}),
-			cty.ListVal([]cty.Value{cty.StringVal("D"), cty.StringVal("The Gopher"), cty.StringVal("800")}),
+		"column_types": cty.ListVal([]cty.Value{
+			cty.StringVal("string"),
+			cty.StringVal("string"),
+			cty.StringVal("string"),
+		}),
+		"rows": cty.TupleVal([]cty.Value{
+			cty.TupleVal([]cty.Value{cty.StringVal("A"), cty.StringVal("The Good"), cty.StringVal("500")}),
+			cty.TupleVal([]cty.Value{cty.StringVal("B"), cty.StringVal("The Very very Bad Man"), cty.StringVal("288")}),
+			cty.TupleVal([]cty.Value{cty.StringVal("C"), cty.StringVal("The Ugly"), cty.StringVal("120")}),
+			cty.TupleVal([]cty.Value{cty.StringVal("D"), cty.StringVal("The Gopher"), cty.StringVal("800")}),
 		}),
 		"table":            cty.StringVal(table),
 		"markdown_table":   cty.StringVal(markdownTable),
 		"borderless_table": cty.StringVal(borderlessTable),
 		"vertical_table":   cty.StringVal(verticalTable),
 		"json_lines":       cty.StringVal(jsonLines),
+		"csv":              cty.StringVal("Name,Sign,Rating\nA,The Good,500\nB,The Very very Bad Man,288\nC,The Ugly,120\nD,The Gopher,800\n"),
+		"stats":            cty.NullVal(cty.DynamicPseudoType),
 	}), value)
 }
 
@@ -119,12 +131,15 @@ func TestQueryEmptyReusltMarshalCTYValue(t *testing.T) {
 		"name":             cty.StringVal("empty"),
 		"query":            cty.StringVal(""),
 		"columns":          cty.ListValEmpty(cty.String),
-		"rows":             cty.ListValEmpty(cty.List(cty.String)),
+		"column_types":     cty.ListValEmpty(cty.String),
+		"rows":             cty.EmptyTupleVal,
 		"table":            cty.StringVal("+\n+\n"),
 		"markdown_table":   cty.StringVal(""),
 		"borderless_table": cty.StringVal(""),
 		"vertical_table":   cty.StringVal(""),
 		"json_lines":       cty.StringVal(""),
+		"csv":              cty.StringVal(""),
+		"stats":            cty.NullVal(cty.DynamicPseudoType),
 	}), value)
 }
 
@@ -144,3 +159,84 @@ func TestQueryReusltMarshalJSON(t *testing.T) {
 	expected := ` [{"?column?":"1","?column?1":"2","?column?2":"3"},{"?column?":"4","?column?1":"5","?column?2":"6"}]`
 	require.JSONEq(t, expected, string(bs))
 }
+
+func TestTypedQueryReusltMarshal(t *testing.T) {
+	qr := queryrunner.NewQueryResultWithColumns(
+		"typed_result",
+		"dummy",
+		queryrunner.Columns{
+			{Name: "id", Type: queryrunner.ColumnTypeInteger},
+			{Name: "score", Type: queryrunner.ColumnTypeFloat, Nullable: true},
+			{Name: "price", Type: queryrunner.ColumnTypeDecimal},
+			{Name: "active", Type: queryrunner.ColumnTypeBoolean, Nullable: true},
+			{Name: "memo", Type: queryrunner.ColumnTypeString, Nullable: true},
+		},
+		[][]interface{}{
+			{int64(1), 1.5, json.Number("100.10"), true, "hoge"},
+			{int64(2), nil, json.Number("0.01"), nil, nil},
+		},
+	)
+	bs, err := qr.MarshalJSON()
+	require.NoError(t, err)
+	expected := `[
+		{"id":1,"score":1.5,"price":100.10,"active":true,"memo":"hoge"},
+		{"id":2,"score":null,"price":0.01,"active":null,"memo":null}
+	]`
+	require.JSONEq(t, expected, string(bs))
+
+	value := qr.MarshalCTYValue()
+	require.EqualValues(t, cty.TupleVal([]cty.Value{
+		cty.TupleVal([]cty.Value{
+			cty.NumberIntVal(1),
+			cty.NumberFloatVal(1.5),
+			cty.MustParseNumberVal("100.10"),
+			cty.True,
+			cty.StringVal("hoge"),
+		}),
+		cty.TupleVal([]cty.Value{
+			cty.NumberIntVal(2),
+			cty.NullVal(cty.Number),
+			cty.MustParseNumberVal("0.01"),
+			cty.NullVal(cty.Bool),
+			cty.NullVal(cty.String),
+		}),
+	}), value.GetAttr("rows"))
+	require.EqualValues(t, cty.ListVal([]cty.Value{
+		cty.StringVal("integer"),
+		cty.StringVal("float"),
+		cty.StringVal("decimal"),
+		cty.StringVal("boolean"),
+		cty.StringVal("string"),
+	}), value.GetAttr("column_types"))
+	require.Equal(t, strings.TrimSpace(`
++----+-------+--------+--------+------+
+| ID | SCORE | PRICE  | ACTIVE | MEMO |
++----+-------+--------+--------+------+
+|  1 |   1.5 | 100.10 | true   | hoge |
+|  2 |       |   0.01 |        |      |
++----+-------+--------+--------+------+
+`), strings.TrimSpace(qr.ToTable()))
+}
+
+func TestQueryResultToCSV(t *testing.T) {
+	qr := queryrunner.NewQueryResultWithColumns(
+		"csv_result",
+		"dummy",
+		queryrunner.Columns{
+			{Name: "id", Type: queryrunner.ColumnTypeInteger},
+			{Name: "memo", Type: queryrunner.ColumnTypeString, Nullable: true},
+		},
+		[][]interface{}{
+			{int64(1), `say "hello", world`},
+			{int64(2), "multi\nline"},
+			{int64(3), nil},
+		},
+	)
+	require.Equal(t, "id,memo\n1,\"say \"\"hello\"\", world\"\n2,\"multi\nline\"\n3,\n", qr.ToCSV())
+	require.Equal(t, "1\t\"say \"\"hello\"\", world\"\n2\t\"multi\nline\"\n3\t\n", qr.ToTSV(func(opts *queryrunner.CSVOptions) {
+		opts.NoHeader = true
+	}))
+	require.Equal(t, "id;memo\n1;\"say \"\"hello\"\", world\"\n2;\"multi\nline\"\n3;\n", qr.ToCSV(func(opts *queryrunner.CSVOptions) {
+		opts.Delimiter = ';'
+	}))
+}
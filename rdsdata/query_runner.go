@@ -0,0 +1,378 @@
+package rdsdata
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/rdsdata"
+	"github.com/aws/aws-sdk-go-v2/service/rdsdata/types"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/gohcl"
+	"github.com/mashiike/queryrunner"
+	"github.com/samber/lo"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+)
+
+const TypeName = "rds_data"
+
+func init() {
+	err := queryrunner.Register(&queryrunner.QueryRunnerDefinition{
+		TypeName:             TypeName,
+		BuildQueryRunnerFunc: BuildQueryRunner,
+	})
+	if err != nil {
+		panic(fmt.Errorf("register rds_data query runner:%w", err))
+	}
+}
+
+// Client is the subset of RDS Data API used by the query runner.
+type Client interface {
+	ExecuteStatement(ctx context.Context, params *rdsdata.ExecuteStatementInput, optFns ...func(*rdsdata.Options)) (*rdsdata.ExecuteStatementOutput, error)
+}
+
+func BuildQueryRunner(name string, body hcl.Body, ctx *hcl.EvalContext) (queryrunner.QueryRunner, hcl.Diagnostics) {
+	queryRunner := &QueryRunner{
+		name: name,
+	}
+	diags := gohcl.DecodeBody(body, ctx, queryRunner)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	optFns := make([]func(*config.LoadOptions) error, 0)
+	if queryRunner.Region != nil {
+		optFns = append(optFns, config.WithRegion(*queryRunner.Region))
+	}
+	awsCfg, err := config.LoadDefaultConfig(context.Background(), optFns...)
+	if err != nil {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "initialize aws client",
+			Detail:   fmt.Sprintf("failed load aws default config:%v", err),
+			Subject:  body.MissingItemRange().Ptr(),
+		})
+		return nil, diags
+	}
+	queryRunner.client = rdsdata.NewFromConfig(awsCfg)
+	return queryRunner, diags
+}
+
+type QueryRunner struct {
+	client Client
+	name   string
+
+	Region      *string `hcl:"region"`
+	ResourceARN string  `hcl:"resource_arn"`
+	SecretARN   string  `hcl:"secret_arn"`
+	Database    string  `hcl:"database"`
+	Schema      *string `hcl:"schema"`
+}
+
+func (r *QueryRunner) Name() string {
+	return r.name
+}
+
+func (r *QueryRunner) Type() string {
+	return TypeName
+}
+
+type PreparedQuery struct {
+	*queryrunner.QueryBase
+	runner *QueryRunner
+
+	SQL        hcl.Expression `hcl:"sql"`
+	Parameters hcl.Expression `hcl:"parameters,optional"`
+}
+
+func (r *QueryRunner) Prepare(base *queryrunner.QueryBase) (queryrunner.PreparedQuery, hcl.Diagnostics) {
+	log.Printf("[debug] prepare `%s` with rds_data query_runner", base.Name())
+	q := &PreparedQuery{
+		QueryBase: base,
+		runner:    r,
+	}
+	body := base.Remain()
+	ctx := base.NewEvalContext(nil, nil)
+	diags := gohcl.DecodeBody(body, ctx, q)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	value, _ := q.SQL.Value(ctx)
+	if value.IsKnown() && value.Type() == cty.String && value.AsString() == "" {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid SQL template",
+			Detail:   "sql is empty",
+			Subject:  q.SQL.Range().Ptr(),
+		})
+		return nil, diags
+	}
+	diags = append(diags, queryrunner.ValidateParameters(q.SQL, q.Parameters, ctx)...)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	return q, diags
+}
+
+func (q *PreparedQuery) Run(ctx context.Context, variables map[string]cty.Value, functions map[string]function.Function) (*queryrunner.QueryResult, error) {
+	return queryrunner.CollectStream(ctx, q, variables, functions)
+}
+
+func (q *PreparedQuery) Stream(ctx context.Context, variables map[string]cty.Value, functions map[string]function.Function, w queryrunner.RowWriter) (*queryrunner.QueryResult, error) {
+	query, parameters, err := q.render(variables, functions)
+	if err != nil {
+		return nil, err
+	}
+	return q.runner.RunQuery(ctx, q.Name(), query, parameters, w)
+}
+
+// Render returns the SQL and the parameters sent to the RDS Data API without running it.
+func (q *PreparedQuery) Render(ctx context.Context, variables map[string]cty.Value, functions map[string]function.Function) (*queryrunner.RenderedQuery, error) {
+	query, parameters, err := q.render(variables, functions)
+	if err != nil {
+		return nil, err
+	}
+	attributes := map[string]interface{}{
+		"database": q.runner.Database,
+	}
+	if q.runner.Schema != nil {
+		attributes["schema"] = *q.runner.Schema
+	}
+	if len(parameters) > 0 {
+		attributes["parameters"] = lo.SliceToMap(parameters, func(p types.SqlParameter) (string, interface{}) {
+			return aws.ToString(p.Name), fieldValue(queryrunner.Column{}, p.Value)
+		})
+	}
+	return q.NewRenderedQuery(query, attributes), nil
+}
+
+func (q *PreparedQuery) render(variables map[string]cty.Value, functions map[string]function.Function) (string, []types.SqlParameter, error) {
+	evalCtx := q.NewEvalContext(variables, functions)
+	value, diags := q.SQL.Value(evalCtx)
+	if diags.HasErrors() {
+		return "", nil, diags
+	}
+	if !value.IsKnown() {
+		return "", nil, errors.New("SQL is unknown")
+	}
+	if value.Type() != cty.String {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid SQL template",
+			Detail:   "sql is not string",
+			Subject:  q.SQL.Range().Ptr(),
+		})
+		return "", nil, diags
+	}
+	params, diags := queryrunner.EvaluateParameters(q.Parameters, evalCtx)
+	if diags.HasErrors() {
+		return "", nil, diags
+	}
+	query := value.AsString()
+	parameters, err := sqlParameters(query, params)
+	if err != nil {
+		return "", nil, err
+	}
+	return query, parameters, nil
+}
+
+// sqlParameters returns RDS Data API parameters for `:name` placeholders in query.
+func sqlParameters(query string, params map[string]cty.Value) ([]types.SqlParameter, error) {
+	bound, err := queryrunner.BindParameters(query, params)
+	if err != nil {
+		return nil, err
+	}
+	parameters := make([]types.SqlParameter, 0, len(bound))
+	seen := make(map[string]bool, len(bound))
+	for _, p := range bound {
+		if seen[p.Name] {
+			continue
+		}
+		seen[p.Name] = true
+		field, err := parameterField(p)
+		if err != nil {
+			return nil, err
+		}
+		parameters = append(parameters, types.SqlParameter{
+			Name:  aws.String(p.Name),
+			Value: field,
+		})
+	}
+	if len(parameters) == 0 {
+		return nil, nil
+	}
+	return parameters, nil
+}
+
+// parameterField converts the parameter value into the typed Field.
+func parameterField(p queryrunner.QueryParameter) (types.Field, error) {
+	v := p.Value
+	if v.IsNull() {
+		return &types.FieldMemberIsNull{Value: true}, nil
+	}
+	switch v.Type() {
+	case cty.String:
+		return &types.FieldMemberStringValue{Value: v.AsString()}, nil
+	case cty.Bool:
+		return &types.FieldMemberBooleanValue{Value: v.True()}, nil
+	case cty.Number:
+		bf := v.AsBigFloat()
+		if bf.IsInt() {
+			if i, accuracy := bf.Int64(); accuracy == 0 {
+				return &types.FieldMemberLongValue{Value: i}, nil
+			}
+		}
+		f, _ := bf.Float64()
+		return &types.FieldMemberDoubleValue{Value: f}, nil
+	default:
+		return nil, fmt.Errorf("parameter `%s` is %s, rds data api supports string, number, bool and null parameter", p.Name, v.Type().FriendlyName())
+	}
+}
+
+// RunQuery executes query and writes result rows to w, returned QueryResult has no rows.
+// parameters are passed to the RDS Data API for `:name` placeholders in query.
+func (r *QueryRunner) RunQuery(ctx context.Context, name string, query string, parameters []types.SqlParameter, w queryrunner.RowWriter) (*queryrunner.QueryResult, error) {
+	reqID := queryrunner.GetRequestID(ctx)
+	log.Printf("[info][%s] start rds data query `%s`", reqID, name)
+	log.Printf("[debug][%s] query: %s", reqID, query)
+	queryStart := time.Now()
+	output, err := r.client.ExecuteStatement(ctx, &rdsdata.ExecuteStatementInput{
+		ResourceArn:           aws.String(r.ResourceARN),
+		SecretArn:             aws.String(r.SecretARN),
+		Database:              aws.String(r.Database),
+		Schema:                r.Schema,
+		Sql:                   aws.String(query),
+		Parameters:            parameters,
+		IncludeResultMetadata: true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("execute statement:%w", err)
+	}
+	log.Printf("[info][%s] success rds data query `%s`, elapsed_time=%s", reqID, name, time.Since(queryStart))
+	stats := &queryrunner.Stats{
+		Extra: map[string]interface{}{
+			"number_of_records_updated": output.NumberOfRecordsUpdated,
+		},
+	}
+	if len(output.ColumnMetadata) == 0 {
+		result := queryrunner.NewEmptyQueryResult(name, query)
+		result.Stats = stats
+		return result, nil
+	}
+	columns := lo.Map(output.ColumnMetadata, func(c types.ColumnMetadata, _ int) queryrunner.Column {
+		name := aws.ToString(c.Label)
+		if name == "" {
+			name = aws.ToString(c.Name)
+		}
+		return queryrunner.Column{
+			Name:     name,
+			Type:     columnType(c.TypeName),
+			Nullable: c.Nullable != columnNoNulls,
+		}
+	})
+	if err := w.WriteColumns(columns); err != nil {
+		return nil, fmt.Errorf("write columns:%w", err)
+	}
+	for _, record := range output.Records {
+		row := make([]interface{}, len(columns))
+		for i, f := range record {
+			if i >= len(columns) {
+				break
+			}
+			row[i] = fieldValue(columns[i], f)
+		}
+		if err := w.WriteRow(row); err != nil {
+			return nil, fmt.Errorf("write row:%w", err)
+		}
+	}
+	result := queryrunner.NewQueryResultWithColumns(name, query, columns, nil)
+	result.Stats = stats
+	return result, nil
+}
+
+// columnNoNulls is ColumnMetadata.Nullable value for the column that does not allow NULL.
+const columnNoNulls = 0
+
+func columnType(typeName *string) queryrunner.ColumnType {
+	if typeName == nil {
+		return queryrunner.ColumnTypeUnknown
+	}
+	switch strings.ToLower(*typeName) {
+	case "int", "int2", "int4", "int8", "tinyint", "smallint", "mediumint", "integer", "bigint", "serial", "bigserial", "int unsigned", "bigint unsigned":
+		return queryrunner.ColumnTypeInteger
+	case "float", "float4", "float8", "real", "double", "double precision":
+		return queryrunner.ColumnTypeFloat
+	case "numeric", "decimal":
+		return queryrunner.ColumnTypeDecimal
+	case "bool", "boolean", "bit":
+		return queryrunner.ColumnTypeBoolean
+	case "date", "time", "timetz", "datetime", "timestamp", "timestamptz":
+		return queryrunner.ColumnTypeTimestamp
+	case "bytea", "binary", "varbinary", "blob", "tinyblob", "mediumblob", "longblob":
+		return queryrunner.ColumnTypeBinary
+	case "json", "jsonb":
+		return queryrunner.ColumnTypeJSON
+	default:
+		return queryrunner.ColumnTypeString
+	}
+}
+
+func fieldValue(column queryrunner.Column, f types.Field) interface{} {
+	switch f := f.(type) {
+	case *types.FieldMemberBlobValue:
+		return f.Value
+	case *types.FieldMemberBooleanValue:
+		return f.Value
+	case *types.FieldMemberDoubleValue:
+		return f.Value
+	case *types.FieldMemberIsNull:
+		return nil
+	case *types.FieldMemberLongValue:
+		return f.Value
+	case *types.FieldMemberArrayValue:
+		return arrayValue(f.Value)
+	case *types.FieldMemberStringValue:
+		switch column.Type {
+		case queryrunner.ColumnTypeDecimal:
+			return json.Number(f.Value)
+		case queryrunner.ColumnTypeJSON:
+			var v interface{}
+			decoder := json.NewDecoder(strings.NewReader(f.Value))
+			decoder.UseNumber()
+			if err := decoder.Decode(&v); err != nil {
+				return f.Value
+			}
+			return v
+		default:
+			return f.Value
+		}
+	default:
+		return nil
+	}
+}
+
+// arrayValue converts the array value, such as PostgreSQL array, into the slice.
+func arrayValue(a types.ArrayValue) interface{} {
+	switch a := a.(type) {
+	case *types.ArrayValueMemberArrayValues:
+		return lo.Map(a.Value, func(v types.ArrayValue, _ int) interface{} {
+			return arrayValue(v)
+		})
+	case *types.ArrayValueMemberBooleanValues:
+		return a.Value
+	case *types.ArrayValueMemberDoubleValues:
+		return a.Value
+	case *types.ArrayValueMemberLongValues:
+		return a.Value
+	case *types.ArrayValueMemberStringValues:
+		return a.Value
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,102 @@
+package rdsdata
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/rdsdata"
+	"github.com/aws/aws-sdk-go-v2/service/rdsdata/types"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/mashiike/hclconfig"
+	"github.com/mashiike/queryrunner"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+type stubClient struct {
+	inputs []*rdsdata.ExecuteStatementInput
+	output *rdsdata.ExecuteStatementOutput
+}
+
+func (c *stubClient) ExecuteStatement(ctx context.Context, params *rdsdata.ExecuteStatementInput, optFns ...func(*rdsdata.Options)) (*rdsdata.ExecuteStatementOutput, error) {
+	c.inputs = append(c.inputs, params)
+	return c.output, nil
+}
+
+func loadQuery(t *testing.T, name string, client Client) *PreparedQuery {
+	t.Helper()
+	parser := hclparse.NewParser()
+	file, diags := parser.ParseHCLFile("testdata/config.hcl")
+	require.False(t, diags.HasErrors())
+	queries, _, diags := queryrunner.DecodeBody(file.Body, hclconfig.NewEvalContext("./"))
+	if !assert.False(t, diags.HasErrors()) {
+		var builder strings.Builder
+		w := hcl.NewDiagnosticTextWriter(&builder, parser.Files(), 400, false)
+		w.WriteDiagnostics(diags)
+		t.Log(builder.String())
+		t.FailNow()
+	}
+	query, ok := queries.Get(name)
+	require.True(t, ok)
+	q, ok := query.(*PreparedQuery)
+	require.True(t, ok)
+	q.runner.client = client
+	return q
+}
+
+func TestRun(t *testing.T) {
+	client := &stubClient{
+		output: &rdsdata.ExecuteStatementOutput{
+			ColumnMetadata: []types.ColumnMetadata{
+				{Name: aws.String("order_id"), Label: aws.String("order_id"), TypeName: aws.String("int4"), Nullable: columnNoNulls},
+				{Name: aws.String("amount"), Label: aws.String("amount"), TypeName: aws.String("numeric"), Nullable: 1},
+				{Name: aws.String("tags"), TypeName: aws.String("_text"), Nullable: 1},
+				{Name: aws.String("detail"), Label: aws.String("detail"), TypeName: aws.String("jsonb"), Nullable: 1},
+			},
+			Records: [][]types.Field{
+				{
+					&types.FieldMemberLongValue{Value: 1},
+					&types.FieldMemberStringValue{Value: "1200.50"},
+					&types.FieldMemberArrayValue{Value: &types.ArrayValueMemberStringValues{Value: []string{"a", "b"}}},
+					&types.FieldMemberStringValue{Value: `{"qty":2}`},
+				},
+				{
+					&types.FieldMemberLongValue{Value: 2},
+					&types.FieldMemberIsNull{Value: true},
+					&types.FieldMemberIsNull{Value: true},
+					&types.FieldMemberIsNull{Value: true},
+				},
+			},
+		},
+	}
+	q := loadQuery(t, "orders", client)
+	result, err := q.Run(context.Background(), map[string]cty.Value{
+		"var": cty.ObjectVal(map[string]cty.Value{
+			"customer_id": cty.StringVal("c-1"),
+		}),
+	}, nil)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(client.inputs))
+	input := client.inputs[0]
+	require.Equal(t, "SELECT * FROM orders WHERE customer_id = :customer_id AND amount >= :min_amount", *input.Sql)
+	require.Equal(t, "app", *input.Database)
+	require.Equal(t, "public", *input.Schema)
+	require.True(t, input.IncludeResultMetadata)
+	require.EqualValues(t, []types.SqlParameter{
+		{Name: aws.String("customer_id"), Value: &types.FieldMemberStringValue{Value: "c-1"}},
+		{Name: aws.String("min_amount"), Value: &types.FieldMemberLongValue{Value: 1000}},
+	}, input.Parameters)
+	require.EqualValues(t, []string{"order_id", "amount", "tags", "detail"}, result.Columns.Names())
+	require.Equal(t, queryrunner.ColumnTypeInteger, result.Columns[0].Type)
+	require.False(t, result.Columns[0].Nullable)
+	require.Equal(t, queryrunner.ColumnTypeDecimal, result.Columns[1].Type)
+	require.EqualValues(t, [][]interface{}{
+		{int64(1), json.Number("1200.50"), []string{"a", "b"}, map[string]interface{}{"qty": json.Number("2")}},
+		{int64(2), nil, nil, nil},
+	}, result.Rows)
+}
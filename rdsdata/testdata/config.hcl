@@ -0,0 +1,16 @@
+query_runner "rds_data" "default" {
+  region       = "ap-northeast-1"
+  resource_arn = "arn:aws:rds:ap-northeast-1:123456789012:cluster:app"
+  secret_arn   = "arn:aws:secretsmanager:ap-northeast-1:123456789012:secret:app-AbCdEf"
+  database     = "app"
+  schema       = "public"
+}
+
+query "orders" {
+  runner     = query_runner.rds_data.default
+  sql        = "SELECT * FROM orders WHERE customer_id = :customer_id AND amount >= :min_amount"
+  parameters = {
+    customer_id = var.customer_id
+    min_amount  = 1000
+  }
+}
@@ -2,9 +2,11 @@ package redshiftdata
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
+	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -45,9 +47,15 @@ func BuildQueryRunner(name string, body hcl.Body, ctx *hcl.EvalContext) (queryru
 		return nil, diags
 	}
 	client := redshiftdata.NewFromConfig(awsCfg)
+	waiterSettings, body, waiterDiags := queryrunner.DecodeWaiterSettings(body, ctx)
+	diags = append(diags, waiterDiags...)
+	retryPolicy, body, retryDiags := queryrunner.DecodeRetryPolicy(body, ctx)
+	diags = append(diags, retryDiags...)
 	queryRunner := &QueryRunner{
-		client: client,
-		name:   name,
+		client:         client,
+		name:           name,
+		waiterSettings: waiterSettings,
+		retryPolicy:    retryPolicy,
 	}
 	decodeDiags := gohcl.DecodeBody(body, ctx, queryRunner)
 	diags = append(diags, decodeDiags...)
@@ -103,8 +111,10 @@ func BuildQueryRunner(name string, body hcl.Body, ctx *hcl.EvalContext) (queryru
 }
 
 type QueryRunner struct {
-	client *redshiftdata.Client
-	name   string
+	client         *redshiftdata.Client
+	name           string
+	waiterSettings queryrunner.WaiterSettings
+	retryPolicy    queryrunner.RetryPolicy
 
 	ClusterIdentifier *string `hcl:"cluster_identifier"`
 	Database          *string `hcl:"database"`
@@ -127,7 +137,8 @@ type PreparedQuery struct {
 	*queryrunner.QueryBase
 	runner *QueryRunner
 
-	SQL hcl.Expression `hcl:"sql"`
+	SQL        hcl.Expression `hcl:"sql"`
+	Parameters hcl.Expression `hcl:"parameters,optional"`
 }
 
 func (r *QueryRunner) Prepare(base *queryrunner.QueryBase) (queryrunner.PreparedQuery, hcl.Diagnostics) {
@@ -136,9 +147,17 @@ func (r *QueryRunner) Prepare(base *queryrunner.QueryBase) (queryrunner.Prepared
 		QueryBase: base,
 		runner:    r,
 	}
-	body := base.Remain()
 	ctx := base.NewEvalContext(nil, nil)
-	diags := gohcl.DecodeBody(body, ctx, q)
+	body, diags := base.DecodeWaiterSettings(ctx)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	body, retryDiags := base.DecodeRetryPolicy(body, ctx)
+	diags = append(diags, retryDiags...)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	diags = append(diags, gohcl.DecodeBody(body, ctx, q)...)
 	if diags.HasErrors() {
 		return nil, diags
 	}
@@ -152,17 +171,71 @@ func (r *QueryRunner) Prepare(base *queryrunner.QueryBase) (queryrunner.Prepared
 		})
 		return nil, diags
 	}
+	diags = append(diags, queryrunner.ValidateParameters(q.SQL, q.Parameters, ctx)...)
+	if diags.HasErrors() {
+		return nil, diags
+	}
 	return q, diags
 }
 
 func (q *PreparedQuery) Run(ctx context.Context, variables map[string]cty.Value, functions map[string]function.Function) (*queryrunner.QueryResult, error) {
+	return queryrunner.CollectStream(ctx, q, variables, functions)
+}
+
+func (q *PreparedQuery) Stream(ctx context.Context, variables map[string]cty.Value, functions map[string]function.Function, w queryrunner.RowWriter) (*queryrunner.QueryResult, error) {
+	ctx = queryrunner.WithWaiterSettings(ctx, q.WaiterSettings())
+	query, parameters, err := q.render(variables, functions)
+	if err != nil {
+		return nil, err
+	}
+	return q.runner.RunQuery(ctx, q.Name(), query, parameters, w)
+}
+
+// Start executes the statement and returns the handle without waiting for the result.
+func (q *PreparedQuery) Start(ctx context.Context, variables map[string]cty.Value, functions map[string]function.Function) (*queryrunner.QueryHandle, error) {
+	query, parameters, err := q.render(variables, functions)
+	if err != nil {
+		return nil, err
+	}
+	id, err := q.runner.StartQuery(ctx, q.Name(), query, parameters)
+	if err != nil {
+		return nil, err
+	}
+	return q.NewQueryHandle(id, query), nil
+}
+
+func (q *PreparedQuery) Status(ctx context.Context, handle *queryrunner.QueryHandle) (queryrunner.QueryStatus, string, error) {
+	return q.runner.QueryStatus(ctx, handle.ID)
+}
+
+func (q *PreparedQuery) Fetch(ctx context.Context, handle *queryrunner.QueryHandle, w queryrunner.RowWriter) (*queryrunner.QueryResult, error) {
+	ctx = queryrunner.WithWaiterSettings(ctx, q.WaiterSettings())
+	return q.runner.FetchQuery(ctx, q.Name(), handle.Query, handle.ID, w)
+}
+
+// Render returns the SQL and the parameters sent to the Redshift Data API without running it.
+func (q *PreparedQuery) Render(ctx context.Context, variables map[string]cty.Value, functions map[string]function.Function) (*queryrunner.RenderedQuery, error) {
+	query, parameters, err := q.render(variables, functions)
+	if err != nil {
+		return nil, err
+	}
+	attributes := make(map[string]interface{})
+	if len(parameters) > 0 {
+		attributes["parameters"] = lo.SliceToMap(parameters, func(p types.SqlParameter) (string, string) {
+			return aws.ToString(p.Name), aws.ToString(p.Value)
+		})
+	}
+	return q.NewRenderedQuery(query, attributes), nil
+}
+
+func (q *PreparedQuery) render(variables map[string]cty.Value, functions map[string]function.Function) (string, []types.SqlParameter, error) {
 	evalCtx := q.NewEvalContext(variables, functions)
 	value, diags := q.SQL.Value(evalCtx)
 	if diags.HasErrors() {
-		return nil, diags
+		return "", nil, diags
 	}
 	if !value.IsKnown() {
-		return nil, errors.New("SQL is unknown")
+		return "", nil, errors.New("SQL is unknown")
 	}
 	if value.Type() != cty.String {
 		diags = append(diags, &hcl.Diagnostic{
@@ -171,18 +244,66 @@ func (q *PreparedQuery) Run(ctx context.Context, variables map[string]cty.Value,
 			Detail:   "sql is not string",
 			Subject:  q.SQL.Range().Ptr(),
 		})
-		return nil, diags
+		return "", nil, diags
+	}
+	params, diags := queryrunner.EvaluateParameters(q.Parameters, evalCtx)
+	if diags.HasErrors() {
+		return "", nil, diags
+	}
+	query := value.AsString()
+	parameters, err := sqlParameters(query, params)
+	if err != nil {
+		return "", nil, err
 	}
-	return q.runner.RunQuery(ctx, q.Name(), value.AsString())
+	return query, parameters, nil
 }
 
-func (r *QueryRunner) RunQuery(ctx context.Context, stmtName string, query string) (*queryrunner.QueryResult, error) {
+// sqlParameters returns Redshift Data API parameters for `:name` placeholders in query.
+func sqlParameters(query string, params map[string]cty.Value) ([]types.SqlParameter, error) {
+	bound, err := queryrunner.BindParameters(query, params)
+	if err != nil {
+		return nil, err
+	}
+	parameters := make([]types.SqlParameter, 0, len(bound))
+	seen := make(map[string]bool, len(bound))
+	for _, p := range bound {
+		if seen[p.Name] {
+			continue
+		}
+		seen[p.Name] = true
+		if p.Value.IsNull() {
+			return nil, fmt.Errorf("parameter `%s` is null, redshift data api does not support null parameter", p.Name)
+		}
+		parameters = append(parameters, types.SqlParameter{
+			Name:  aws.String(p.Name),
+			Value: aws.String(p.String()),
+		})
+	}
+	if len(parameters) == 0 {
+		return nil, nil
+	}
+	return parameters, nil
+}
+
+// RunQuery executes query and writes result rows to w, returned QueryResult has no rows.
+// parameters are passed to the Redshift Data API for `:name` placeholders in query.
+func (r *QueryRunner) RunQuery(ctx context.Context, stmtName string, query string, parameters []types.SqlParameter, w queryrunner.RowWriter) (*queryrunner.QueryResult, error) {
+	id, err := r.StartQuery(ctx, stmtName, query, parameters)
+	if err != nil {
+		return nil, err
+	}
+	return r.FetchQuery(ctx, stmtName, query, id, w)
+}
+
+// StartQuery executes query and returns the statement ID without waiting for the result.
+func (r *QueryRunner) StartQuery(ctx context.Context, stmtName string, query string, parameters []types.SqlParameter) (string, error) {
 	reqID := queryrunner.GetRequestID(ctx)
 	log.Printf("[info][%s] start redshift data query `%s`", reqID, stmtName)
 	log.Printf("[debug][%s] query: %s", reqID, query)
 	executeOutput, err := r.client.ExecuteStatement(ctx, &redshiftdata.ExecuteStatementInput{
 		Database:          r.Database,
 		Sql:               aws.String(query),
+		Parameters:        parameters,
 		ClusterIdentifier: r.ClusterIdentifier,
 		DbUser:            r.DbUser,
 		SecretArn:         r.SecretsARN,
@@ -190,21 +311,50 @@ func (r *QueryRunner) RunQuery(ctx context.Context, stmtName string, query strin
 		WorkgroupName:     r.WorkgroupName,
 	})
 	if err != nil {
-		return nil, fmt.Errorf("execute statement:%w", err)
+		return "", fmt.Errorf("execute statement:%w", err)
 	}
-	queryStart := time.Now()
-	waiter := &queryrunner.Waiter{
-		StartTime: queryStart,
-		MinDelay:  100 * time.Microsecond,
-		MaxDelay:  5 * time.Second,
-		Timeout:   15 * time.Minute,
-		Jitter:    200 * time.Millisecond,
+	return *executeOutput.Id, nil
+}
+
+// QueryStatus returns the status of the statement.
+func (r *QueryRunner) QueryStatus(ctx context.Context, id string) (queryrunner.QueryStatus, string, error) {
+	var describeOutput *redshiftdata.DescribeStatementOutput
+	err := queryrunner.Retry(ctx, r.retryPolicy, func(ctx context.Context) error {
+		var err error
+		describeOutput, err = r.client.DescribeStatement(ctx, &redshiftdata.DescribeStatementInput{
+			Id: aws.String(id),
+		})
+		return err
+	})
+	if err != nil {
+		return "", "", fmt.Errorf("describe statement:%w", err)
 	}
+	switch describeOutput.Status {
+	case types.StatusStringFinished:
+		return queryrunner.QueryStatusSucceeded, "", nil
+	case types.StatusStringAborted, types.StatusStringFailed:
+		return queryrunner.QueryStatusFailed, fmt.Sprintf("query %s: %s", strings.ToLower(string(describeOutput.Status)), aws.ToString(describeOutput.Error)), nil
+	default:
+		return queryrunner.QueryStatusRunning, "", nil
+	}
+}
+
+// FetchQuery waits for the statement and writes result rows to w, returned QueryResult has no rows.
+// the statement is cancelled when the wait is timeout or canceled.
+func (r *QueryRunner) FetchQuery(ctx context.Context, stmtName string, query string, id string, w queryrunner.RowWriter) (*queryrunner.QueryResult, error) {
+	reqID := queryrunner.GetRequestID(ctx)
+	queryStart := time.Now()
+	waiter := queryrunner.NewWaiter(ctx, r.waiterSettings)
 	for waiter.Continue(ctx) {
 		elapsedTime := time.Since(queryStart)
 		log.Printf("[debug][%s] wating redshift query `%s` elapsed_time=%s", reqID, stmtName, elapsedTime)
-		describeOutput, err := r.client.DescribeStatement(ctx, &redshiftdata.DescribeStatementInput{
-			Id: executeOutput.Id,
+		var describeOutput *redshiftdata.DescribeStatementOutput
+		err := queryrunner.Retry(ctx, r.retryPolicy, func(ctx context.Context) error {
+			var err error
+			describeOutput, err = r.client.DescribeStatement(ctx, &redshiftdata.DescribeStatementInput{
+				Id: aws.String(id),
+			})
+			return err
 		})
 		if err != nil {
 			return nil, fmt.Errorf("describe statement:%w", err)
@@ -218,60 +368,130 @@ func (r *QueryRunner) RunQuery(ctx context.Context, stmtName string, query strin
 		if describeOutput.Status == types.StatusStringFinished {
 			log.Printf("[info][%s] success redshift data query `%s`, elapsed_time=%s", reqID, stmtName, time.Since(queryStart))
 			if !*describeOutput.HasResultSet {
-				return queryrunner.NewEmptyQueryResult(stmtName, query), nil
+				result := queryrunner.NewEmptyQueryResult(stmtName, query)
+				result.Stats = statementStats(describeOutput)
+				return result, nil
 			}
 			p := redshiftdata.NewGetStatementResultPaginator(r.client, &redshiftdata.GetStatementResultInput{
-				Id: executeOutput.Id,
+				Id: aws.String(id),
 			})
-			var columns []string
-			var rows [][]string
+			var columns queryrunner.Columns
 			for p.HasMorePages() {
-				result, err := p.NextPage(ctx)
+				var result *redshiftdata.GetStatementResultOutput
+				err := queryrunner.Retry(ctx, r.retryPolicy, func(ctx context.Context) error {
+					var err error
+					result, err = p.NextPage(ctx)
+					return err
+				})
 				if err != nil {
 					return nil, fmt.Errorf("get statement result:%w", err)
 				}
 				if columns == nil {
-					columns = make([]string, 0, len(result.ColumnMetadata))
-					for _, c := range result.ColumnMetadata {
-						columns = append(columns, *c.Label)
-					}
-				}
-				if rows == nil {
 					log.Printf("[debug][%s] total rows = %d", reqID, result.TotalNumRows)
-					rows = make([][]string, 0, result.TotalNumRows)
+					columns = lo.Map(result.ColumnMetadata, func(c types.ColumnMetadata, _ int) queryrunner.Column {
+						return queryrunner.Column{
+							Name:     *c.Label,
+							Type:     columnType(c.TypeName),
+							Nullable: c.Nullable != columnNoNulls,
+						}
+					})
+					if err := w.WriteColumns(columns); err != nil {
+						return nil, fmt.Errorf("write columns:%w", err)
+					}
 				}
 				for _, record := range result.Records {
-					rows = append(rows, lo.Map(record, func(f types.Field, _ int) string {
-						switch f := f.(type) {
-						case *types.FieldMemberBlobValue:
-							return fmt.Sprintf("%x", f.Value)
-						case *types.FieldMemberBooleanValue:
-							return fmt.Sprintf("%v", f.Value)
-						case *types.FieldMemberDoubleValue:
-							return fmt.Sprintf("%f", f.Value)
-						case *types.FieldMemberIsNull:
-							return ""
-						case *types.FieldMemberLongValue:
-							return fmt.Sprintf("%d", f.Value)
-						case *types.FieldMemberStringValue:
-							return f.Value
-						default:
-							return ""
-						}
-					}))
+					row := lo.Map(record, func(f types.Field, i int) interface{} {
+						return fieldValue(columns[i], f)
+					})
+					if err := w.WriteRow(row); err != nil {
+						return nil, fmt.Errorf("write row:%w", err)
+					}
 				}
 			}
-			return queryrunner.NewQueryResult(stmtName, query, columns, rows), nil
+			result := queryrunner.NewQueryResultWithColumns(stmtName, query, columns, nil)
+			result.Stats = statementStats(describeOutput)
+			return result, nil
 		}
 	}
 	log.Printf("[info][%s] timeout or cancel redshift data query `%s`", reqID, stmtName)
 	cancelCtx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
 	defer cancel()
-	_, err = r.client.CancelStatement(cancelCtx, &redshiftdata.CancelStatementInput{
-		Id: executeOutput.Id,
+	_, err := r.client.CancelStatement(cancelCtx, &redshiftdata.CancelStatementInput{
+		Id: aws.String(id),
 	})
 	if err != nil {
 		return nil, fmt.Errorf("cancel statement: %w", err)
 	}
 	return nil, errors.New("query timeout")
 }
+
+// columnNoNulls is ColumnMetadata.Nullable value for the column that does not allow NULL.
+const columnNoNulls = 0
+
+// statementStats returns the statistics of the finished statement.
+func statementStats(describeOutput *redshiftdata.DescribeStatementOutput) *queryrunner.Stats {
+	return &queryrunner.Stats{
+		QueryID: aws.ToString(describeOutput.Id),
+		Extra: map[string]interface{}{
+			"redshift_query_id": describeOutput.RedshiftQueryId,
+			"result_rows":       describeOutput.ResultRows,
+			"result_size":       describeOutput.ResultSize,
+		},
+	}
+}
+
+func columnType(typeName *string) queryrunner.ColumnType {
+	if typeName == nil {
+		return queryrunner.ColumnTypeUnknown
+	}
+	switch strings.ToLower(*typeName) {
+	case "int2", "int4", "int8", "smallint", "integer", "bigint", "oid":
+		return queryrunner.ColumnTypeInteger
+	case "float4", "float8", "real", "double precision", "float":
+		return queryrunner.ColumnTypeFloat
+	case "numeric", "decimal":
+		return queryrunner.ColumnTypeDecimal
+	case "bool", "boolean":
+		return queryrunner.ColumnTypeBoolean
+	case "date", "time", "timetz", "timestamp", "timestamptz":
+		return queryrunner.ColumnTypeTimestamp
+	case "varbyte", "varbinary", "binary varying", "bytea":
+		return queryrunner.ColumnTypeBinary
+	case "super":
+		return queryrunner.ColumnTypeJSON
+	default:
+		return queryrunner.ColumnTypeString
+	}
+}
+
+func fieldValue(column queryrunner.Column, f types.Field) interface{} {
+	switch f := f.(type) {
+	case *types.FieldMemberBlobValue:
+		return f.Value
+	case *types.FieldMemberBooleanValue:
+		return f.Value
+	case *types.FieldMemberDoubleValue:
+		return f.Value
+	case *types.FieldMemberIsNull:
+		return nil
+	case *types.FieldMemberLongValue:
+		return f.Value
+	case *types.FieldMemberStringValue:
+		switch column.Type {
+		case queryrunner.ColumnTypeDecimal:
+			return json.Number(f.Value)
+		case queryrunner.ColumnTypeJSON:
+			var v interface{}
+			decoder := json.NewDecoder(strings.NewReader(f.Value))
+			decoder.UseNumber()
+			if err := decoder.Decode(&v); err != nil {
+				return f.Value
+			}
+			return v
+		default:
+			return f.Value
+		}
+	default:
+		return nil
+	}
+}
@@ -31,6 +31,6 @@ func TestDecodeBody(t *testing.T) {
 		t.Log(builder.String())
 		t.FailNow()
 	}
-	require.EqualValues(t, 1, len(queries))
+	require.EqualValues(t, 2, len(queries))
 
 }
@@ -8,3 +8,11 @@ query "error_logs" {
   runner = query_runner.redshift_data.provisioned
   sql    = "SELECT * FROM hoge"
 }
+
+query "error_logs_by_user" {
+  runner     = query_runner.redshift_data.provisioned
+  sql        = "SELECT * FROM hoge WHERE user_id = :user_id"
+  parameters = {
+    user_id = var.user_id
+  }
+}
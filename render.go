@@ -0,0 +1,107 @@
+package queryrunner
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+)
+
+// RenderedQuery is the query rendered with variables, that is what is sent to the backend.
+// Attributes has the runner specific inputs other than the query text, such as parameters or time range.
+type RenderedQuery struct {
+	Name       string                 `json:"name"`
+	RunnerType string                 `json:"runner_type"`
+	RunnerName string                 `json:"runner_name"`
+	Query      string                 `json:"query"`
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+	// Output is the location of `output` block, that is set by PlanQuery.
+	Output *Output `json:"output,omitempty"`
+	// Dependencies is the names of the queries referred as `query.<name>`, that is set by PlanQuery.
+	Dependencies []string `json:"dependencies,omitempty"`
+}
+
+// Renderer is a PreparedQuery that can render the query without running it.
+type Renderer interface {
+	PreparedQuery
+	Render(ctx context.Context, variables map[string]cty.Value, functions map[string]function.Function) (*RenderedQuery, error)
+}
+
+// NewRenderedQuery returns RenderedQuery of the query with the runner information.
+func (q *QueryBase) NewRenderedQuery(query string, attributes map[string]interface{}) *RenderedQuery {
+	return &RenderedQuery{
+		Name:       q.Name(),
+		RunnerType: q.runner.Type(),
+		RunnerName: q.runner.Name(),
+		Query:      query,
+		Attributes: attributes,
+	}
+}
+
+// PlanQuery renders query with the variables evaluated as RunQuery, without running it.
+// the location of `output` block is also rendered.
+func PlanQuery(ctx context.Context, query PreparedQuery, variables map[string]cty.Value, functions map[string]function.Function) (*RenderedQuery, error) {
+	variables, err := EvaluateVariables(query, variables)
+	if err != nil {
+		return nil, err
+	}
+	renderer, ok := query.(Renderer)
+	if !ok {
+		return nil, fmt.Errorf("query `%s` runner type `%s` does not support dry run", query.Name(), query.RunnerType())
+	}
+	rendered, err := renderer.Render(ctx, variables, functions)
+	if err != nil {
+		return nil, fmt.Errorf("render query `%s`: %w", query.Name(), err)
+	}
+	if r, ok := query.(outputRenderer); ok {
+		rendered.Output, err = r.RenderOutput(variables, functions)
+		if err != nil {
+			return nil, fmt.Errorf("render query `%s` output: %w", query.Name(), err)
+		}
+	}
+	rendered.Dependencies = queryDependencies(query)
+	return rendered, nil
+}
+
+// PlanQueries renders the queries of names and the queries they depend on without running them, in the order to run.
+// the results of the dependencies are not available, so that `query.<name>` variable is the result with the rendered query and no rows.
+func PlanQueries(ctx context.Context, queries PreparedQueries, names []string, variables map[string]cty.Value, functions map[string]function.Function) ([]*RenderedQuery, error) {
+	plans := make([]*RenderedQuery, 0, len(names))
+	planned := make(map[string]*RenderedQuery, len(names))
+	var visit func(name string) error
+	visit = func(name string) error {
+		if _, ok := planned[name]; ok {
+			return nil
+		}
+		query, ok := queries.Get(name)
+		if !ok {
+			return fmt.Errorf("query `%s` is not found", name)
+		}
+		deps := queryDependencies(query)
+		upstream := make(QueryResults, 0, len(deps))
+		for _, dep := range deps {
+			if err := visit(dep); err != nil {
+				return err
+			}
+			upstream = append(upstream, NewEmptyQueryResult(dep, planned[dep].Query))
+		}
+		vars := variables
+		if len(deps) > 0 {
+			vars = withQueryResults(variables, upstream)
+		}
+		plan, err := PlanQuery(ctx, query, vars, functions)
+		if err != nil {
+			return err
+		}
+		planned[name] = plan
+		plans = append(plans, plan)
+		return nil
+	}
+	for _, name := range names {
+		if err := visit(name); err != nil {
+			return nil, err
+		}
+	}
+	return plans, nil
+}
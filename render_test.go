@@ -0,0 +1,71 @@
+package queryrunner_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/mashiike/queryrunner"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestPlanQueries(t *testing.T) {
+	runner := &countingQueryRunner{}
+	err := queryrunner.Register(&queryrunner.QueryRunnerDefinition{
+		TypeName: "counting",
+		BuildQueryRunnerFunc: func(name string, body hcl.Body, ctx *hcl.EvalContext) (queryrunner.QueryRunner, hcl.Diagnostics) {
+			runner.name = name
+			return runner, nil
+		},
+	})
+	require.NoError(t, err)
+	parser := hclparse.NewParser()
+	file, diags := parser.ParseHCL([]byte(`
+	query_runner "counting" "default" {}
+
+	query "upstream" {
+		runner = query_runner.counting.default
+		query  = "SELECT ${var.id}"
+	}
+
+	query "downstream" {
+		runner = query_runner.counting.default
+		query  = "SELECT * FROM (${query.upstream.query}) t"
+		output {
+			s3_uri = "s3://example-bucket/results/${var.id}.csv"
+			format = "csv"
+		}
+	}
+	`), "config.hcl")
+	require.False(t, diags.HasErrors())
+	queries, _, diags := queryrunner.DecodeBody(file.Body, &hcl.EvalContext{})
+	require.False(t, diags.HasErrors(), diags.Error())
+	plans, err := queryrunner.PlanQueries(context.Background(), queries, []string{"downstream"}, map[string]cty.Value{
+		"var": cty.ObjectVal(map[string]cty.Value{
+			"id": cty.NumberIntVal(1),
+		}),
+	}, nil)
+	require.NoError(t, err)
+	require.Equal(t, 0, runner.count)
+	require.EqualValues(t, []*queryrunner.RenderedQuery{
+		{
+			Name:       "upstream",
+			RunnerType: "counting",
+			RunnerName: "default",
+			Query:      "SELECT 1",
+		},
+		{
+			Name:         "downstream",
+			RunnerType:   "counting",
+			RunnerName:   "default",
+			Query:        "SELECT * FROM (SELECT 1) t",
+			Output:       &queryrunner.Output{Location: "s3://example-bucket/results/1.csv", Format: "csv"},
+			Dependencies: []string{"upstream"},
+		},
+	}, plans)
+
+	_, err = queryrunner.PlanQueries(context.Background(), queries, []string{"not_found"}, nil, nil)
+	require.EqualError(t, err, "query `not_found` is not found")
+}
@@ -0,0 +1,195 @@
+package queryrunner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsretry "github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// RetryPolicy overrides the default policy of Retry, nil fields are not overridden.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts including the first one.
+	MaxAttempts *int
+	// Backoff is the delay before the first retry, that is doubled on each retry.
+	Backoff *time.Duration
+}
+
+// DefaultRetryPolicy is used when neither query_runner nor query block has `retry` block.
+// it does not retry, because the AWS SDK already retries transient errors of each request.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: aws.Int(1),
+	Backoff:     aws.Duration(time.Second),
+}
+
+// Merge returns the policy overridden by the non-nil fields of other.
+func (p RetryPolicy) Merge(other RetryPolicy) RetryPolicy {
+	if other.MaxAttempts != nil {
+		p.MaxAttempts = other.MaxAttempts
+	}
+	if other.Backoff != nil {
+		p.Backoff = other.Backoff
+	}
+	return p
+}
+
+// DecodeRetryPolicy decodes `retry` block in body, the remain body is returned for the other attributes and blocks.
+func DecodeRetryPolicy(body hcl.Body, ctx *hcl.EvalContext) (RetryPolicy, hcl.Body, hcl.Diagnostics) {
+	content, remain, diags := body.PartialContent(&hcl.BodySchema{
+		Blocks: []hcl.BlockHeaderSchema{
+			{
+				Type: "retry",
+			},
+		},
+	})
+	if diags.HasErrors() {
+		return RetryPolicy{}, remain, diags
+	}
+	if len(content.Blocks) > 1 {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Duplicate retry block",
+			Detail:   "only one retry block is allowed",
+			Subject:  content.Blocks[1].DefRange.Ptr(),
+		})
+		return RetryPolicy{}, remain, diags
+	}
+	if len(content.Blocks) == 0 {
+		return RetryPolicy{}, remain, diags
+	}
+	policy, blockDiags := decodeRetryBlock(content.Blocks[0], ctx)
+	diags = append(diags, blockDiags...)
+	return policy, remain, diags
+}
+
+func decodeRetryBlock(block *hcl.Block, ctx *hcl.EvalContext) (RetryPolicy, hcl.Diagnostics) {
+	var policy RetryPolicy
+	content, diags := block.Body.Content(&hcl.BodySchema{
+		Attributes: []hcl.AttributeSchema{
+			{
+				Name: "max_attempts",
+			},
+			{
+				Name: "backoff",
+			},
+		},
+	})
+	if diags.HasErrors() {
+		return policy, diags
+	}
+	if attr, ok := content.Attributes["max_attempts"]; ok {
+		value, valueDiags := attr.Expr.Value(ctx)
+		diags = append(diags, valueDiags...)
+		if valueDiags.HasErrors() {
+			return policy, diags
+		}
+		if !value.IsKnown() || value.IsNull() || value.Type() != cty.Number || !value.AsBigFloat().IsInt() {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid retry max_attempts",
+				Detail:   "max_attempts is not integer, please write as max_attempts = 3",
+				Subject:  attr.Expr.Range().Ptr(),
+			})
+			return policy, diags
+		}
+		i, _ := value.AsBigFloat().Int64()
+		maxAttempts := int(i)
+		if maxAttempts < 1 {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid retry max_attempts",
+				Detail:   fmt.Sprintf("max_attempts must be greater than or equal to 1: %d", maxAttempts),
+				Subject:  attr.Expr.Range().Ptr(),
+			})
+			return policy, diags
+		}
+		policy.MaxAttempts = &maxAttempts
+	}
+	if attr, ok := content.Attributes["backoff"]; ok {
+		backoff, backoffDiags := decodeDurationAttribute(attr, ctx, true)
+		diags = append(diags, backoffDiags...)
+		if backoffDiags.HasErrors() {
+			return policy, diags
+		}
+		policy.Backoff = &backoff
+	}
+	return policy, diags
+}
+
+var retryPolicyContextKey contextKey = "__queryrunner_retry_policy"
+
+// WithRetryPolicy sets the policy of the query, that overrides the policy of the query runner in Retry.
+func WithRetryPolicy(ctx context.Context, policy RetryPolicy) context.Context {
+	return context.WithValue(ctx, retryPolicyContextKey, policy)
+}
+
+var retryCounterContextKey contextKey = "__queryrunner_retry_counter"
+
+// withRetryCounter returns the context that counts the retries in Retry.
+func withRetryCounter(ctx context.Context) (context.Context, *int64) {
+	counter := new(int64)
+	return context.WithValue(ctx, retryCounterContextKey, counter), counter
+}
+
+type retryable interface {
+	retryPolicy() RetryPolicy
+}
+
+// retryContext returns the context with the retry policy of query, and the counter of the retries in the context.
+func retryContext(ctx context.Context, query PreparedQuery) (context.Context, *int64) {
+	if r, ok := query.(retryable); ok {
+		ctx = WithRetryPolicy(ctx, r.retryPolicy())
+	}
+	return withRetryCounter(ctx)
+}
+
+func loadRetries(counter *int64) int {
+	return int(atomic.LoadInt64(counter))
+}
+
+// IsRetryableError reports whether err is transient, such as throttling, 5xx response or network error.
+// user errors such as SQL syntax error or access denied are not retryable.
+func IsRetryableError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	return awsretry.IsErrorRetryables(awsretry.DefaultRetryables).IsErrorRetryable(err) == aws.TrueTernary
+}
+
+// Retry calls fn until it succeeds or returns not retryable error, the policies are merged in order of DefaultRetryPolicy, runnerPolicy and the policy of ctx.
+// fn must be idempotent, such as polling the query status or fetching the results, requests starting a query should not be retried.
+func Retry(ctx context.Context, runnerPolicy RetryPolicy, fn func(ctx context.Context) error) error {
+	policy := DefaultRetryPolicy.Merge(runnerPolicy)
+	if queryPolicy, ok := ctx.Value(retryPolicyContextKey).(RetryPolicy); ok {
+		policy = policy.Merge(queryPolicy)
+	}
+	backoff := *policy.Backoff
+	for attempt := 1; ; attempt++ {
+		err := fn(ctx)
+		if err == nil {
+			return nil
+		}
+		if attempt >= *policy.MaxAttempts || !IsRetryableError(err) {
+			return err
+		}
+		log.Printf("[warn][%s] retry after %s, attempt %d/%d: %v", GetRequestID(ctx), backoff, attempt, *policy.MaxAttempts, err)
+		if counter, ok := ctx.Value(retryCounterContextKey).(*int64); ok {
+			atomic.AddInt64(counter, 1)
+		}
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		backoff *= 2
+	}
+}
@@ -0,0 +1,111 @@
+package queryrunner_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/smithy-go"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/mashiike/queryrunner"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsRetryableError(t *testing.T) {
+	cases := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{
+			name:     "throttling",
+			err:      &smithy.GenericAPIError{Code: "ThrottlingException"},
+			expected: true,
+		},
+		{
+			name:     "too many requests",
+			err:      &smithy.GenericAPIError{Code: "TooManyRequestsException"},
+			expected: true,
+		},
+		{
+			name:     "network",
+			err:      &net.OpError{Op: "dial", Err: errors.New("connection refused")},
+			expected: true,
+		},
+		{
+			name:     "access denied",
+			err:      &smithy.GenericAPIError{Code: "AccessDeniedException"},
+			expected: false,
+		},
+		{
+			name:     "syntax error",
+			err:      &smithy.GenericAPIError{Code: "ValidationException", Message: "syntax error at or near \"SELEC\""},
+			expected: false,
+		},
+		{
+			name:     "canceled",
+			err:      context.Canceled,
+			expected: false,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			require.Equal(t, c.expected, queryrunner.IsRetryableError(c.err))
+		})
+	}
+}
+
+func TestRetry(t *testing.T) {
+	policy := queryrunner.RetryPolicy{
+		MaxAttempts: aws.Int(3),
+		Backoff:     aws.Duration(time.Millisecond),
+	}
+	attempts := 0
+	err := queryrunner.Retry(context.Background(), policy, func(ctx context.Context) error {
+		attempts++
+		if attempts < 3 {
+			return &smithy.GenericAPIError{Code: "ThrottlingException"}
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, 3, attempts)
+
+	attempts = 0
+	ctx := queryrunner.WithRetryPolicy(context.Background(), queryrunner.RetryPolicy{MaxAttempts: aws.Int(1)})
+	err = queryrunner.Retry(ctx, policy, func(ctx context.Context) error {
+		attempts++
+		return &smithy.GenericAPIError{Code: "ThrottlingException"}
+	})
+	require.Error(t, err)
+	require.Equal(t, 1, attempts)
+
+	attempts = 0
+	err = queryrunner.Retry(context.Background(), queryrunner.RetryPolicy{}, func(ctx context.Context) error {
+		attempts++
+		return &smithy.GenericAPIError{Code: "ThrottlingException"}
+	})
+	require.Error(t, err)
+	require.Equal(t, 1, attempts, "DefaultRetryPolicy does not retry")
+}
+
+func TestDecodeBodyInvalidRetry(t *testing.T) {
+	_, diags := decodeVariablesConfig(t, `
+	query_runner "dummy" "default" {
+		columns = ["id"]
+	}
+
+	query "invalid" {
+		runner = query_runner.dummy.default
+		rows = []
+		retry {
+			max_attempts = 0
+		}
+	}
+	`)
+	require.True(t, diags.HasErrors())
+	require.Equal(t, "max_attempts must be greater than or equal to 1: 0", diags.Errs()[0].(*hcl.Diagnostic).Detail)
+}
@@ -36,10 +36,12 @@ func init() {
 }
 
 func BuildQueryRunner(name string, body hcl.Body, ctx *hcl.EvalContext) (queryrunner.QueryRunner, hcl.Diagnostics) {
+	retryPolicy, body, diags := queryrunner.DecodeRetryPolicy(body, ctx)
 	queryRunner := &QueryRunner{
-		name: name,
+		name:        name,
+		retryPolicy: retryPolicy,
 	}
-	diags := gohcl.DecodeBody(body, ctx, queryRunner)
+	diags = append(diags, gohcl.DecodeBody(body, ctx, queryRunner)...)
 	if diags.HasErrors() {
 		return nil, diags
 	}
@@ -62,8 +64,9 @@ func BuildQueryRunner(name string, body hcl.Body, ctx *hcl.EvalContext) (queryru
 }
 
 type QueryRunner struct {
-	client *s3.Client
-	name   string
+	client      *s3.Client
+	name        string
+	retryPolicy queryrunner.RetryPolicy
 
 	Region *string `hcl:"region"`
 }
@@ -117,9 +120,12 @@ func (r *QueryRunner) Prepare(base *queryrunner.QueryBase) (queryrunner.Prepared
 		QueryBase: base,
 		runner:    r,
 	}
-	body := base.Remain()
 	ctx := base.NewEvalContext(nil, nil)
-	diags := gohcl.DecodeBody(body, ctx, q)
+	body, diags := base.DecodeRetryPolicy(base.Remain(), ctx)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	diags = append(diags, gohcl.DecodeBody(body, ctx, q)...)
 	if diags.HasErrors() {
 		return nil, diags
 	}
@@ -299,6 +305,68 @@ type runQueryParameters struct {
 }
 
 func (q *PreparedQuery) Run(ctx context.Context, variables map[string]cty.Value, functions map[string]function.Function) (*queryrunner.QueryResult, error) {
+	return queryrunner.CollectStream(ctx, q, variables, functions)
+}
+
+func (q *PreparedQuery) Stream(ctx context.Context, variables map[string]cty.Value, functions map[string]function.Function, w queryrunner.RowWriter) (*queryrunner.QueryResult, error) {
+	params, err := q.render(variables, functions)
+	if err != nil {
+		return nil, err
+	}
+	return q.runner.RunQuery(ctx, params, w)
+}
+
+// Render returns the expression and the target objects of S3 Select without running it.
+func (q *PreparedQuery) Render(ctx context.Context, variables map[string]cty.Value, functions map[string]function.Function) (*queryrunner.RenderedQuery, error) {
+	params, err := q.render(variables, functions)
+	if err != nil {
+		return nil, err
+	}
+	attributes := map[string]interface{}{
+		"bucket_name":         params.bucket,
+		"object_key_prefix":   params.objectKeyPrefix,
+		"object_key_suffix":   params.objectKeySuffix,
+		"input_serialization": inputSerializationAttributes(params.inputSerialization),
+	}
+	return q.NewRenderedQuery(params.expression, attributes), nil
+}
+
+// inputSerializationAttributes returns the input serialization in the shape of the query block.
+func inputSerializationAttributes(input *types.InputSerialization) map[string]interface{} {
+	attributes := map[string]interface{}{
+		"compression_type": string(input.CompressionType),
+	}
+	if input.CSV != nil {
+		csv := map[string]interface{}{
+			"allow_quoted_record_delimiter": input.CSV.AllowQuotedRecordDelimiter,
+			"file_header_info":              string(input.CSV.FileHeaderInfo),
+		}
+		if input.CSV.FieldDelimiter != nil {
+			csv["field_delimiter"] = *input.CSV.FieldDelimiter
+		}
+		if input.CSV.QuoteCharacter != nil {
+			csv["quote_character"] = *input.CSV.QuoteCharacter
+		}
+		if input.CSV.QuoteEscapeCharacter != nil {
+			csv["quote_escape_character"] = *input.CSV.QuoteEscapeCharacter
+		}
+		if input.CSV.RecordDelimiter != nil {
+			csv["record_delimiter"] = *input.CSV.RecordDelimiter
+		}
+		attributes["csv"] = csv
+	}
+	if input.JSON != nil {
+		attributes["json"] = map[string]interface{}{
+			"type": string(input.JSON.Type),
+		}
+	}
+	if input.Parquet != nil {
+		attributes["parquet"] = map[string]interface{}{}
+	}
+	return attributes
+}
+
+func (q *PreparedQuery) render(variables map[string]cty.Value, functions map[string]function.Function) (*runQueryParameters, error) {
 	evalCtx := q.NewEvalContext(variables, functions)
 	expressionValue, diags := q.Expression.Value(evalCtx)
 	if diags.HasErrors() {
@@ -367,10 +435,11 @@ func (q *PreparedQuery) Run(ctx context.Context, variables map[string]cty.Value,
 		scanLimitation:     q.scanLimit,
 		continueOnError:    q.ContinueOnError,
 	}
-	return q.runner.RunQuery(ctx, params)
+	return params, nil
 }
 
-func (r *QueryRunner) RunQuery(ctx context.Context, params *runQueryParameters) (*queryrunner.QueryResult, error) {
+// RunQuery selects objects and writes result rows to w, returned QueryResult has no rows.
+func (r *QueryRunner) RunQuery(ctx context.Context, params *runQueryParameters, w queryrunner.RowWriter) (*queryrunner.QueryResult, error) {
 	reqID := queryrunner.GetRequestID(ctx)
 	log.Printf("[info][%s] start s3 select expression `%s`", reqID, params.name)
 	log.Printf("[info][%s] location: s3://%s/%s*%s", reqID, params.bucket, params.objectKeyPrefix, params.objectKeySuffix)
@@ -383,8 +452,11 @@ func (r *QueryRunner) RunQuery(ctx context.Context, params *runQueryParameters)
 		Delimiter: aws.String("/"),
 	})
 	totalScanSize := uint64(0)
-	jsonLines := make([][]byte, 0)
+	totalLines := 0
 	apiCallCount := 0
+	// the rows already written from the failed objects are kept, so that the failed objects are reported in the statistics.
+	failedObjects := make([]string, 0)
+	mw := queryrunner.NewRowMapWriter(w)
 	extender := queryrunner.GetTimeoutExtender(ctx)
 	if err := extender.ExtendTimeout(ctx, 30*time.Second); err != nil {
 		log.Println("[warn] failed extend timeout:", err)
@@ -393,7 +465,12 @@ func (r *QueryRunner) RunQuery(ctx context.Context, params *runQueryParameters)
 		if totalScanSize > params.scanLimitation {
 			break
 		}
-		listOutput, err := p.NextPage(ctx)
+		var listOutput *s3.ListObjectsV2Output
+		err := queryrunner.Retry(ctx, r.retryPolicy, func(ctx context.Context) error {
+			var err error
+			listOutput, err = p.NextPage(ctx)
+			return err
+		})
 		if err != nil {
 			return nil, fmt.Errorf("list objects v2: %w", err)
 		}
@@ -409,45 +486,62 @@ func (r *QueryRunner) RunQuery(ctx context.Context, params *runQueryParameters)
 				log.Println("[warn] failed extend timeout:", err)
 			}
 			log.Printf("[debug][%s] start select object: s3://%s/%s (%s)", reqID, params.bucket, *content.Key, humanize.Bytes(uint64(content.Size)))
-			lines, err := r.selectObject(ctx, params.bucket, *content.Key, expression, params.inputSerialization)
+			lines, err := r.selectObject(ctx, params.bucket, *content.Key, expression, params.inputSerialization, mw)
 			totalScanSize += uint64(content.Size)
+			totalLines += lines
 			apiCallCount++
 			if err != nil {
 				if params.continueOnError {
-					log.Printf("[warn][%s] select object failed: %v", reqID, err)
+					log.Printf("[warn][%s] select object failed: s3://%s/%s (%d lines written): %v", reqID, params.bucket, *content.Key, lines, err)
+					failedObjects = append(failedObjects, fmt.Sprintf("s3://%s/%s", params.bucket, *content.Key))
 				} else {
 					return nil, fmt.Errorf("select object: %s : %w", *content.Key, err)
 				}
 			}
-			jsonLines = append(jsonLines, lines...)
-			log.Printf("[debug][%s] total scan size: %s, total lines: %d, total object count: %d", reqID, humanize.Bytes(totalScanSize), len(jsonLines), apiCallCount)
+			log.Printf("[debug][%s] total scan size: %s, total lines: %d, total object count: %d", reqID, humanize.Bytes(totalScanSize), totalLines, apiCallCount)
 		}
 	}
-	log.Printf("[info][%s] total scan size: %s, total lines: %d, total object count: %d", reqID, humanize.Bytes(totalScanSize), len(jsonLines), apiCallCount)
+	log.Printf("[info][%s] total scan size: %s, total lines: %d, total object count: %d", reqID, humanize.Bytes(totalScanSize), totalLines, apiCallCount)
 
-	return queryrunner.NewQueryResultWithJSONLines(params.name, params.expression, jsonLines), nil
+	result := queryrunner.NewQueryResultWithColumns(params.name, params.expression, mw.Columns(), nil)
+	result.Stats = &queryrunner.Stats{
+		BytesScanned: int64(totalScanSize),
+		Extra: map[string]interface{}{
+			"object_count": apiCallCount,
+		},
+	}
+	if len(failedObjects) > 0 {
+		result.Stats.Extra["failed_objects"] = failedObjects
+	}
+	return result, nil
 }
 
-func (r *QueryRunner) selectObject(ctx context.Context, bucket string, key string, expression string, inputSerialization *types.InputSerialization) ([][]byte, error) {
-	selectOutput, err := r.client.SelectObjectContent(ctx, &s3.SelectObjectContentInput{
-		Bucket:             aws.String(bucket),
-		Key:                aws.String(key),
-		Expression:         aws.String(expression),
-		ExpressionType:     types.ExpressionTypeSql,
-		InputSerialization: inputSerialization,
-		OutputSerialization: &types.OutputSerialization{
-			JSON: &types.JSONOutput{
-				RecordDelimiter: aws.String("\n"),
+// selectObject writes selected JSON lines to mw as soon as decoded, and returns the number of written lines.
+func (r *QueryRunner) selectObject(ctx context.Context, bucket string, key string, expression string, inputSerialization *types.InputSerialization, mw *queryrunner.RowMapWriter) (int, error) {
+	var selectOutput *s3.SelectObjectContentOutput
+	err := queryrunner.Retry(ctx, r.retryPolicy, func(ctx context.Context) error {
+		var err error
+		selectOutput, err = r.client.SelectObjectContent(ctx, &s3.SelectObjectContentInput{
+			Bucket:             aws.String(bucket),
+			Key:                aws.String(key),
+			Expression:         aws.String(expression),
+			ExpressionType:     types.ExpressionTypeSql,
+			InputSerialization: inputSerialization,
+			OutputSerialization: &types.OutputSerialization{
+				JSON: &types.JSONOutput{
+					RecordDelimiter: aws.String("\n"),
+				},
 			},
-		},
+		})
+		return err
 	})
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
 	stream := selectOutput.GetStream()
 	defer stream.Close()
 
-	lines := make([][]byte, 0)
+	lines := 0
 	pr, pw := io.Pipe()
 
 	eg, egctx := errgroup.WithContext(ctx)
@@ -471,12 +565,17 @@ func (r *QueryRunner) selectObject(ctx context.Context, bucket string, key strin
 	for decoder.More() {
 		var v json.RawMessage
 		if err := decoder.Decode(&v); err != nil {
-			return nil, err
+			pr.CloseWithError(err)
+			return lines, err
 		}
-		lines = append(lines, v)
+		if err := mw.WriteJSONLine(v); err != nil {
+			pr.CloseWithError(err)
+			return lines, err
+		}
+		lines++
 	}
 	if err := eg.Wait(); err != nil {
-		return nil, err
+		return lines, err
 	}
 	return lines, nil
 }
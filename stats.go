@@ -0,0 +1,150 @@
+package queryrunner
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/zclconf/go-cty/cty"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+)
+
+// Stats is the execution statistics of a query run.
+// StartTime, EndTime, Duration, RowsReturned and Retries are recorded by RunQuery, StreamQuery and FetchQuery,
+// and the other fields are set by the query runner.
+type Stats struct {
+	StartTime    time.Time     `json:"start_time"`
+	EndTime      time.Time     `json:"end_time"`
+	Duration     time.Duration `json:"-"`
+	RowsReturned int64         `json:"rows_returned"`
+	Retries      int           `json:"retries,omitempty"`
+	// BytesScanned is the bytes scanned by the backend, it is 0 if the backend does not report it.
+	BytesScanned int64 `json:"bytes_scanned,omitempty"`
+	// QueryID is the backend query ID, such as Athena query execution ID or Redshift statement ID.
+	QueryID string `json:"query_id,omitempty"`
+	// Extra is the runner specific statistics.
+	Extra map[string]interface{} `json:"extra,omitempty"`
+}
+
+func (s *Stats) MarshalJSON() ([]byte, error) {
+	type alias Stats
+	return json.Marshal(struct {
+		*alias
+		Duration string `json:"duration"`
+	}{
+		alias:    (*alias)(s),
+		Duration: s.Duration.String(),
+	})
+}
+
+// String returns the statistics as `key=value` pairs.
+func (s *Stats) String() string {
+	parts := []string{
+		fmt.Sprintf("duration=%s", s.Duration),
+		fmt.Sprintf("rows_returned=%d", s.RowsReturned),
+	}
+	if s.Retries > 0 {
+		parts = append(parts, fmt.Sprintf("retries=%d", s.Retries))
+	}
+	if s.BytesScanned > 0 {
+		parts = append(parts, fmt.Sprintf("bytes_scanned=%s", humanize.Bytes(uint64(s.BytesScanned))))
+	}
+	if s.QueryID != "" {
+		parts = append(parts, fmt.Sprintf("query_id=%s", s.QueryID))
+	}
+	keys := make([]string, 0, len(s.Extra))
+	for key := range s.Extra {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		parts = append(parts, fmt.Sprintf("%s=%v", key, s.Extra[key]))
+	}
+	return strings.Join(parts, " ")
+}
+
+// MarshalCTYValue returns the statistics as `query.<name>.stats` object.
+func (s *Stats) MarshalCTYValue() cty.Value {
+	if s == nil {
+		return cty.NullVal(cty.DynamicPseudoType)
+	}
+	extra := cty.EmptyObjectVal
+	if len(s.Extra) > 0 {
+		if bs, err := json.Marshal(s.Extra); err == nil {
+			if t, err := ctyjson.ImpliedType(bs); err == nil {
+				if v, err := ctyjson.Unmarshal(bs, t); err == nil {
+					extra = v
+				}
+			}
+		}
+	}
+	return cty.ObjectVal(map[string]cty.Value{
+		"start_time":    cty.StringVal(s.StartTime.Format(time.RFC3339Nano)),
+		"end_time":      cty.StringVal(s.EndTime.Format(time.RFC3339Nano)),
+		"duration":      cty.StringVal(s.Duration.String()),
+		"rows_returned": cty.NumberIntVal(s.RowsReturned),
+		"retries":       cty.NumberIntVal(int64(s.Retries)),
+		"bytes_scanned": cty.NumberIntVal(s.BytesScanned),
+		"query_id":      cty.StringVal(s.QueryID),
+		"extra":         extra,
+	})
+}
+
+// runRecorder records the retries and the statistics of a query run.
+type runRecorder struct {
+	retries   *int64
+	startTime time.Time
+	rows      int64
+}
+
+func startRun(ctx context.Context, query PreparedQuery) (context.Context, *runRecorder) {
+	ctx, retries := retryContext(ctx, query)
+	return ctx, &runRecorder{
+		retries:   retries,
+		startTime: time.Now(),
+	}
+}
+
+// RowWriter returns w that counts written rows.
+func (r *runRecorder) RowWriter(w RowWriter) RowWriter {
+	return &countingRowWriter{w: w, rows: &r.rows}
+}
+
+// finish sets the statistics including the retries to result, rows is the number of rows not written by RowWriter.
+func (r *runRecorder) finish(result *QueryResult, rows int) {
+	endTime := time.Now()
+	stats := &Stats{}
+	if result.Stats != nil {
+		copied := *result.Stats
+		stats = &copied
+	}
+	// monotonic clock readings are stripped, so that the stats are same after stored in the cache.
+	stats.StartTime = r.startTime.Round(0)
+	stats.EndTime = endTime.Round(0)
+	stats.Duration = endTime.Sub(r.startTime)
+	stats.RowsReturned = atomic.LoadInt64(&r.rows) + int64(rows)
+	stats.Retries = loadRetries(r.retries)
+	result.Stats = stats
+}
+
+type countingRowWriter struct {
+	w    RowWriter
+	rows *int64
+}
+
+func (w *countingRowWriter) WriteColumns(columns Columns) error {
+	return w.w.WriteColumns(columns)
+}
+
+func (w *countingRowWriter) WriteRow(row []interface{}) error {
+	if err := w.w.WriteRow(row); err != nil {
+		return err
+	}
+	atomic.AddInt64(w.rows, 1)
+	return nil
+}
@@ -0,0 +1,57 @@
+package queryrunner_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/mashiike/queryrunner"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamQueryStats(t *testing.T) {
+	q := &streamingDummyQuery{
+		lines: []string{
+			`{"id": 1, "name": "hoge"}`,
+			`{"id": 2, "name": "fuga"}`,
+		},
+	}
+	result, err := queryrunner.StreamQuery(context.Background(), q, nil, nil, queryrunner.NewJSONLinesRowWriter(io.Discard))
+	require.NoError(t, err)
+	require.NotNil(t, result.Stats)
+	require.EqualValues(t, 2, result.Stats.RowsReturned)
+	require.False(t, result.Stats.StartTime.After(result.Stats.EndTime))
+
+	result, err = queryrunner.StreamQuery(context.Background(), &collectOnlyDummyQuery{}, nil, nil, queryrunner.NewJSONLinesRowWriter(io.Discard))
+	require.NoError(t, err)
+	require.EqualValues(t, 2, result.Stats.RowsReturned)
+}
+
+func TestStatsFormat(t *testing.T) {
+	stats := &queryrunner.Stats{
+		StartTime:    time.Date(2023, 4, 1, 0, 0, 0, 0, time.UTC),
+		EndTime:      time.Date(2023, 4, 1, 0, 0, 1, 500000000, time.UTC),
+		Duration:     1500 * time.Millisecond,
+		RowsReturned: 10,
+		BytesScanned: 2048,
+		QueryID:      "query-execution-id",
+		Extra: map[string]interface{}{
+			"records_scanned": 100,
+			"records_matched": 10,
+		},
+	}
+	require.Equal(t, "duration=1.5s rows_returned=10 bytes_scanned=2.0 kB query_id=query-execution-id records_matched=10 records_scanned=100", stats.String())
+	bs, err := json.Marshal(stats)
+	require.NoError(t, err)
+	require.JSONEq(t, `{
+		"start_time": "2023-04-01T00:00:00Z",
+		"end_time": "2023-04-01T00:00:01.5Z",
+		"duration": "1.5s",
+		"rows_returned": 10,
+		"bytes_scanned": 2048,
+		"query_id": "query-execution-id",
+		"extra": {"records_matched": 10, "records_scanned": 100}
+	}`, string(bs))
+}
@@ -0,0 +1,323 @@
+package queryrunner
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+)
+
+// RowWriter receives a query result row by row.
+// WriteColumns is called before the first WriteRow, and may be called again when new columns are found.
+// columns are only appended, so rows written before are treated as null for the appended columns.
+type RowWriter interface {
+	WriteColumns(columns Columns) error
+	WriteRow(row []interface{}) error
+}
+
+// StreamingQuery is a PreparedQuery that writes rows to RowWriter without holding the whole result in memory.
+// The returned QueryResult has no Rows, rows are written to the RowWriter.
+type StreamingQuery interface {
+	PreparedQuery
+	Stream(ctx context.Context, variables map[string]cty.Value, functions map[string]function.Function, w RowWriter) (*QueryResult, error)
+}
+
+// CollectStream runs StreamingQuery and collects all rows into QueryResult.
+// it is intended to implement PreparedQuery.Run on top of StreamingQuery.Stream.
+func CollectStream(ctx context.Context, query StreamingQuery, variables map[string]cty.Value, functions map[string]function.Function) (*QueryResult, error) {
+	collector := &rowCollector{}
+	result, err := query.Stream(ctx, variables, functions, collector)
+	if err != nil {
+		return nil, err
+	}
+	return collector.QueryResult(result), nil
+}
+
+// StreamQuery runs query and writes rows to w, variables, cache and fixture recording are handled as RunQuery.
+// if the query is not StreamingQuery, the query result is written to w after collected.
+func StreamQuery(ctx context.Context, query PreparedQuery, variables map[string]cty.Value, functions map[string]function.Function, w RowWriter) (*QueryResult, error) {
+	variables, err := EvaluateVariables(query, variables)
+	if err != nil {
+		return nil, err
+	}
+	cache, err := newQueryCache(ctx, query, variables, functions)
+	if err != nil {
+		return nil, err
+	}
+	if cache != nil {
+		if result, ok := cache.Load(ctx); ok {
+			if err := recordFixture(ctx, result); err != nil {
+				return nil, err
+			}
+			return writeResult(result, w)
+		}
+	}
+	release, err := acquireRunner(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	ctx, recorder := startRun(ctx, query)
+	streaming, ok := query.(StreamingQuery)
+	if !ok {
+		result, err := query.Run(ctx, variables, functions)
+		if err != nil {
+			return nil, err
+		}
+		recorder.finish(result, len(result.Rows))
+		if cache != nil {
+			cache.Store(ctx, result)
+		}
+		if err := recordFixture(ctx, result); err != nil {
+			return nil, err
+		}
+		return writeResult(result, w)
+	}
+	if cache == nil && GetFixtureRecorder(ctx) == nil {
+		summary, err := streaming.Stream(ctx, variables, functions, recorder.RowWriter(w))
+		if err != nil {
+			return nil, err
+		}
+		recorder.finish(summary, 0)
+		return summary, nil
+	}
+	// rows are collected to store in the cache or record as a fixture while they are written to w.
+	collector := &rowCollector{}
+	summary, err := streaming.Stream(ctx, variables, functions, recorder.RowWriter(&teeRowWriter{w: w, tee: collector}))
+	if err != nil {
+		return nil, err
+	}
+	recorder.finish(summary, 0)
+	result := collector.QueryResult(summary)
+	if cache != nil {
+		cache.Store(ctx, result)
+	}
+	if err := recordFixture(ctx, result); err != nil {
+		return nil, err
+	}
+	return summary, nil
+}
+
+// writeResult writes all rows of result to w, and returns the result without rows.
+func writeResult(result *QueryResult, w RowWriter) (*QueryResult, error) {
+	if err := result.WriteRows(w); err != nil {
+		return nil, err
+	}
+	summary := *result
+	summary.Rows = nil
+	return &summary, nil
+}
+
+// WriteRows writes columns and all rows to w.
+func (qr *QueryResult) WriteRows(w RowWriter) error {
+	if err := w.WriteColumns(qr.Columns); err != nil {
+		return err
+	}
+	for _, row := range qr.Rows {
+		if err := w.WriteRow(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type rowCollector struct {
+	columns Columns
+	rows    [][]interface{}
+}
+
+func (c *rowCollector) WriteColumns(columns Columns) error {
+	c.columns = columns
+	return nil
+}
+
+func (c *rowCollector) WriteRow(row []interface{}) error {
+	c.rows = append(c.rows, row)
+	return nil
+}
+
+// QueryResult returns a copy of summary filled with collected rows.
+// rows written before columns were appended are padded with null.
+func (c *rowCollector) QueryResult(summary *QueryResult) *QueryResult {
+	result := *summary
+	if result.Columns == nil {
+		result.Columns = c.columns
+	}
+	if result.Columns == nil {
+		result.Columns = make(Columns, 0)
+	}
+	rows := make([][]interface{}, 0, len(c.rows))
+	for _, row := range c.rows {
+		if len(row) < len(result.Columns) {
+			padded := make([]interface{}, len(result.Columns))
+			copy(padded, row)
+			row = padded
+		}
+		rows = append(rows, row)
+	}
+	result.Rows = rows
+	return &result
+}
+
+// RowMapWriter adapts rows whose shape is not known in advance, such as JSON objects, to RowWriter.
+// columns are appended in the order they are found, and column types are inferred from values.
+type RowMapWriter struct {
+	// TypeHints fixes the column type of the named columns instead of inferring from values.
+	TypeHints map[string]ColumnType
+
+	w       RowWriter
+	columns Columns
+	index   map[string]int
+	fixed   []bool
+	count   int
+}
+
+func NewRowMapWriter(w RowWriter) *RowMapWriter {
+	return &RowMapWriter{
+		w:     w,
+		index: make(map[string]int),
+	}
+}
+
+// WriteFields writes a row that consists of named values, names and values must be same length.
+func (mw *RowMapWriter) WriteFields(names []string, values []interface{}) error {
+	if len(names) != len(values) {
+		return fmt.Errorf("names and values length mismatch: %d != %d", len(names), len(values))
+	}
+	appended := false
+	for _, name := range names {
+		if _, ok := mw.index[name]; ok {
+			continue
+		}
+		mw.index[name] = len(mw.columns)
+		column := Column{
+			Name:     name,
+			Nullable: mw.count > 0,
+		}
+		hint, ok := mw.TypeHints[name]
+		if ok {
+			column.Type = hint
+		}
+		mw.columns = append(mw.columns, column)
+		mw.fixed = append(mw.fixed, ok)
+		appended = true
+	}
+	row := make([]interface{}, len(mw.columns))
+	seen := make([]bool, len(mw.columns))
+	for i, name := range names {
+		index := mw.index[name]
+		v := normalizeValue(values[i])
+		row[index] = v
+		seen[index] = v != nil
+		if !mw.fixed[index] {
+			mw.columns[index].Type = mergeColumnType(mw.columns[index].Type, ColumnTypeOf(v))
+		}
+	}
+	for i, ok := range seen {
+		if !ok {
+			mw.columns[i].Nullable = true
+		}
+	}
+	mw.count++
+	if appended {
+		if err := mw.w.WriteColumns(mw.Columns()); err != nil {
+			return err
+		}
+	}
+	return mw.w.WriteRow(row)
+}
+
+// WriteRowMap writes a row as map, new columns in the row are appended in sorted order.
+func (mw *RowMapWriter) WriteRowMap(rowMap map[string]interface{}) error {
+	names := make([]string, 0, len(rowMap))
+	for name := range rowMap {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	values := make([]interface{}, 0, len(names))
+	for _, name := range names {
+		values = append(values, rowMap[name])
+	}
+	return mw.WriteFields(names, values)
+}
+
+// WriteJSONLine writes a JSON object as a row, new columns are appended in the order of object keys.
+func (mw *RowMapWriter) WriteJSONLine(line []byte) error {
+	names, rowMap, err := decodeJSONObject(line)
+	if err != nil {
+		return err
+	}
+	values := make([]interface{}, 0, len(names))
+	for _, name := range names {
+		values = append(values, rowMap[name])
+	}
+	return mw.WriteFields(names, values)
+}
+
+// Columns returns columns found so far with inferred types.
+func (mw *RowMapWriter) Columns() Columns {
+	columns := make(Columns, len(mw.columns))
+	copy(columns, mw.columns)
+	for i := range columns {
+		if columns[i].Type == "" {
+			columns[i].Type = ColumnTypeUnknown
+		}
+	}
+	return columns
+}
+
+// JSONLinesRowWriter is a RowWriter that writes each row as a JSON object line.
+type JSONLinesRowWriter struct {
+	w       io.Writer
+	columns []string
+}
+
+func NewJSONLinesRowWriter(w io.Writer) *JSONLinesRowWriter {
+	return &JSONLinesRowWriter{
+		w: w,
+	}
+}
+
+func (w *JSONLinesRowWriter) WriteColumns(columns Columns) error {
+	w.columns = jsonColumnNames(columns)
+	return nil
+}
+
+// WriteRow writes a row with one Write call, so that rows from concurrent writers are not mixed.
+func (w *JSONLinesRowWriter) WriteRow(row []interface{}) error {
+	v := make(map[string]interface{}, len(w.columns))
+	for i, column := range w.columns {
+		if i < len(row) {
+			v[column] = jsonValue(row[i])
+		} else {
+			v[column] = nil
+		}
+	}
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(v); err != nil {
+		return err
+	}
+	_, err := w.w.Write(buf.Bytes())
+	return err
+}
+
+// jsonColumnNames returns column names for JSON object keys, duplicated names are numbered.
+func jsonColumnNames(columns Columns) []string {
+	names := make([]string, 0, len(columns))
+	duplicate := make(map[string]int, len(columns))
+	for _, column := range columns {
+		if index, ok := duplicate[column.Name]; ok {
+			names = append(names, fmt.Sprintf("%s%d", column.Name, index))
+			duplicate[column.Name]++
+		} else {
+			names = append(names, column.Name)
+			duplicate[column.Name] = 1
+		}
+	}
+	return names
+}
@@ -0,0 +1,93 @@
+package queryrunner_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/mashiike/queryrunner"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+)
+
+type streamingDummyQuery struct {
+	*queryrunner.QueryBase
+	lines []string
+}
+
+func (q *streamingDummyQuery) Run(ctx context.Context, variables map[string]cty.Value, functions map[string]function.Function) (*queryrunner.QueryResult, error) {
+	return queryrunner.CollectStream(ctx, q, variables, functions)
+}
+
+func (q *streamingDummyQuery) Stream(ctx context.Context, variables map[string]cty.Value, functions map[string]function.Function, w queryrunner.RowWriter) (*queryrunner.QueryResult, error) {
+	mw := queryrunner.NewRowMapWriter(w)
+	for _, line := range q.lines {
+		if err := mw.WriteJSONLine([]byte(line)); err != nil {
+			return nil, err
+		}
+	}
+	return queryrunner.NewQueryResultWithColumns("streaming", "dummy", mw.Columns(), nil), nil
+}
+
+func TestCollectStream(t *testing.T) {
+	q := &streamingDummyQuery{
+		lines: []string{
+			`{"id": 1, "name": "hoge"}`,
+			`{"id": 2, "name": "fuga", "score": 1.5}`,
+			`{"name": "piyo", "id": 3}`,
+		},
+	}
+	result, err := q.Run(context.Background(), nil, nil)
+	require.NoError(t, err)
+	require.EqualValues(t, &queryrunner.QueryResult{
+		Name:  "streaming",
+		Query: "dummy",
+		Columns: queryrunner.Columns{
+			{Name: "id", Type: queryrunner.ColumnTypeInteger},
+			{Name: "name", Type: queryrunner.ColumnTypeString},
+			{Name: "score", Type: queryrunner.ColumnTypeFloat, Nullable: true},
+		},
+		Rows: [][]interface{}{
+			{int64(1), "hoge", nil},
+			{int64(2), "fuga", 1.5},
+			{int64(3), "piyo", nil},
+		},
+	}, result)
+}
+
+func TestStreamQueryJSONLines(t *testing.T) {
+	q := &streamingDummyQuery{
+		lines: []string{
+			`{"id": 1, "name": "hoge"}`,
+			`{"id": 2, "name": "fuga", "score": 1.5}`,
+		},
+	}
+	var builder strings.Builder
+	result, err := queryrunner.StreamQuery(context.Background(), q, nil, nil, queryrunner.NewJSONLinesRowWriter(&builder))
+	require.NoError(t, err)
+	require.Nil(t, result.Rows)
+	require.Equal(t, 3, len(result.Columns))
+	expected := strings.TrimSpace(`
+{"id":1,"name":"hoge"}
+{"id":2,"name":"fuga","score":1.5}
+`) + "\n"
+	require.Equal(t, expected, builder.String())
+}
+
+type collectOnlyDummyQuery struct {
+	*queryrunner.QueryBase
+}
+
+func (q *collectOnlyDummyQuery) Run(ctx context.Context, variables map[string]cty.Value, functions map[string]function.Function) (*queryrunner.QueryResult, error) {
+	return queryrunner.NewQueryResult("collect_only", "dummy", []string{"id"}, [][]string{{"1"}, {"2"}}), nil
+}
+
+func TestStreamQueryNotStreaming(t *testing.T) {
+	var builder strings.Builder
+	result, err := queryrunner.StreamQuery(context.Background(), &collectOnlyDummyQuery{}, nil, nil, queryrunner.NewJSONLinesRowWriter(&builder))
+	require.NoError(t, err)
+	require.Nil(t, result.Rows)
+	require.Equal(t, "collect_only", result.Name)
+	require.Equal(t, "{\"id\":\"1\"}\n{\"id\":\"2\"}\n", builder.String())
+}
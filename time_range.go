@@ -0,0 +1,75 @@
+package queryrunner
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+)
+
+const (
+	// DefaultStartTime is the expression used when `start_time` attribute is omitted.
+	DefaultStartTime = `now() - duration("15m")`
+	// DefaultEndTime is the expression used when `end_time` attribute is omitted.
+	DefaultEndTime = `now()`
+)
+
+// DefaultTimeRange returns `start_time` and `end_time` expressions, the omitted ones are replaced with DefaultStartTime and DefaultEndTime.
+func DefaultTimeRange(startTime hcl.Expression, endTime hcl.Expression, ctx *hcl.EvalContext) (hcl.Expression, hcl.Expression, hcl.Diagnostics) {
+	var diags hcl.Diagnostics
+	startTime, parseDiags := defaultTimeExpression(startTime, ctx, DefaultStartTime, "default_start_time.hcl")
+	diags = append(diags, parseDiags...)
+	endTime, parseDiags = defaultTimeExpression(endTime, ctx, DefaultEndTime, "default_end_time.hcl")
+	diags = append(diags, parseDiags...)
+	return startTime, endTime, diags
+}
+
+func defaultTimeExpression(expr hcl.Expression, ctx *hcl.EvalContext, src string, filename string) (hcl.Expression, hcl.Diagnostics) {
+	value, _ := expr.Value(ctx)
+	if !value.IsKnown() || !value.IsNull() {
+		return expr, nil
+	}
+	return hclsyntax.ParseExpression([]byte(src), filename, hcl.InitialPos)
+}
+
+// EvaluateTimeRange evaluates `start_time` and `end_time` expressions, the values are unix epoch seconds.
+func EvaluateTimeRange(startTime hcl.Expression, endTime hcl.Expression, ctx *hcl.EvalContext) (time.Time, time.Time, hcl.Diagnostics) {
+	start, diags := evaluateTime("start_time", startTime, ctx)
+	if diags.HasErrors() {
+		return time.Time{}, time.Time{}, diags
+	}
+	end, diags := evaluateTime("end_time", endTime, ctx)
+	if diags.HasErrors() {
+		return time.Time{}, time.Time{}, diags
+	}
+	return start, end, nil
+}
+
+func evaluateTime(name string, expr hcl.Expression, ctx *hcl.EvalContext) (time.Time, hcl.Diagnostics) {
+	value, diags := expr.Value(ctx)
+	if diags.HasErrors() {
+		return time.Time{}, diags
+	}
+	if !value.IsKnown() {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  fmt.Sprintf("Invalid %s template", name),
+			Detail:   fmt.Sprintf("%s is unknown", name),
+			Subject:  expr.Range().Ptr(),
+		})
+		return time.Time{}, diags
+	}
+	if value.IsNull() || value.Type() != cty.Number {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  fmt.Sprintf("Invalid %s template", name),
+			Detail:   fmt.Sprintf("%s is not number", name),
+			Subject:  expr.Range().Ptr(),
+		})
+		return time.Time{}, diags
+	}
+	epoch, _ := value.AsBigFloat().Float64()
+	return time.Unix(0, int64(epoch*float64(time.Second))), diags
+}
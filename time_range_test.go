@@ -0,0 +1,30 @@
+package queryrunner_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/mashiike/hclconfig"
+	"github.com/mashiike/queryrunner"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestTimeRange(t *testing.T) {
+	ctx := hclconfig.NewEvalContext()
+	startTime, endTime, diags := queryrunner.DefaultTimeRange(hcl.StaticExpr(cty.NullVal(cty.Number), hcl.Range{}), hcl.StaticExpr(cty.NullVal(cty.Number), hcl.Range{}), ctx)
+	require.False(t, diags.HasErrors())
+	start, end, diags := queryrunner.EvaluateTimeRange(startTime, endTime, ctx)
+	require.False(t, diags.HasErrors())
+	require.InDelta(t, 15*time.Minute, end.Sub(start), float64(time.Second))
+
+	startTime, _ = hclsyntax.ParseExpression([]byte(`1666224000`), "start_time.hcl", hcl.InitialPos)
+	endTime, _ = hclsyntax.ParseExpression([]byte(`"now"`), "end_time.hcl", hcl.InitialPos)
+	startTime, endTime, diags = queryrunner.DefaultTimeRange(startTime, endTime, ctx)
+	require.False(t, diags.HasErrors())
+	_, _, diags = queryrunner.EvaluateTimeRange(startTime, endTime, ctx)
+	require.True(t, diags.HasErrors())
+	require.Equal(t, "end_time is not number", diags.Errs()[0].(*hcl.Diagnostic).Detail)
+}
@@ -0,0 +1,394 @@
+package timestream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/timestreamquery"
+	"github.com/aws/aws-sdk-go-v2/service/timestreamquery/types"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/gohcl"
+	"github.com/mashiike/queryrunner"
+	"github.com/samber/lo"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+)
+
+const TypeName = "timestream"
+
+func init() {
+	err := queryrunner.Register(&queryrunner.QueryRunnerDefinition{
+		TypeName:             TypeName,
+		BuildQueryRunnerFunc: BuildQueryRunner,
+	})
+	if err != nil {
+		panic(fmt.Errorf("register timestream query runner:%w", err))
+	}
+}
+
+// Client is the subset of Timestream Query API used by the query runner.
+type Client interface {
+	timestreamquery.QueryAPIClient
+	CancelQuery(ctx context.Context, params *timestreamquery.CancelQueryInput, optFns ...func(*timestreamquery.Options)) (*timestreamquery.CancelQueryOutput, error)
+}
+
+func BuildQueryRunner(name string, body hcl.Body, ctx *hcl.EvalContext) (queryrunner.QueryRunner, hcl.Diagnostics) {
+	waiterSettings, body, diags := queryrunner.DecodeWaiterSettings(body, ctx)
+	retryPolicy, body, retryDiags := queryrunner.DecodeRetryPolicy(body, ctx)
+	diags = append(diags, retryDiags...)
+	queryRunner := &QueryRunner{
+		name:           name,
+		waiterSettings: waiterSettings,
+		retryPolicy:    retryPolicy,
+	}
+	diags = append(diags, gohcl.DecodeBody(body, ctx, queryRunner)...)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	optFns := make([]func(*config.LoadOptions) error, 0)
+	if queryRunner.Region != nil {
+		optFns = append(optFns, config.WithRegion(*queryRunner.Region))
+	}
+	awsCfg, err := config.LoadDefaultConfig(context.Background(), optFns...)
+	if err != nil {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "initialize aws client",
+			Detail:   fmt.Sprintf("failed load aws default config:%v", err),
+			Subject:  body.MissingItemRange().Ptr(),
+		})
+		return nil, diags
+	}
+	queryRunner.client = timestreamquery.NewFromConfig(awsCfg)
+	return queryRunner, diags
+}
+
+type QueryRunner struct {
+	client         Client
+	name           string
+	waiterSettings queryrunner.WaiterSettings
+	retryPolicy    queryrunner.RetryPolicy
+
+	Region *string `hcl:"region"`
+}
+
+func (r *QueryRunner) Name() string {
+	return r.name
+}
+
+func (r *QueryRunner) Type() string {
+	return TypeName
+}
+
+type PreparedQuery struct {
+	*queryrunner.QueryBase
+	runner *QueryRunner
+
+	Query hcl.Expression `hcl:"query"`
+}
+
+func (r *QueryRunner) Prepare(base *queryrunner.QueryBase) (queryrunner.PreparedQuery, hcl.Diagnostics) {
+	log.Printf("[debug] prepare `%s` with timestream query_runner", base.Name())
+	q := &PreparedQuery{
+		QueryBase: base,
+		runner:    r,
+	}
+	ctx := base.NewEvalContext(nil, nil)
+	body, diags := base.DecodeWaiterSettings(ctx)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	body, retryDiags := base.DecodeRetryPolicy(body, ctx)
+	diags = append(diags, retryDiags...)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	diags = append(diags, gohcl.DecodeBody(body, ctx, q)...)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	value, _ := q.Query.Value(ctx)
+	if value.IsKnown() && value.Type() == cty.String && value.AsString() == "" {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid query template",
+			Detail:   "query is empty",
+			Subject:  q.Query.Range().Ptr(),
+		})
+		return nil, diags
+	}
+	return q, diags
+}
+
+func (q *PreparedQuery) Run(ctx context.Context, variables map[string]cty.Value, functions map[string]function.Function) (*queryrunner.QueryResult, error) {
+	return queryrunner.CollectStream(ctx, q, variables, functions)
+}
+
+func (q *PreparedQuery) Stream(ctx context.Context, variables map[string]cty.Value, functions map[string]function.Function, w queryrunner.RowWriter) (*queryrunner.QueryResult, error) {
+	ctx = queryrunner.WithWaiterSettings(ctx, q.WaiterSettings())
+	query, err := q.render(variables, functions)
+	if err != nil {
+		return nil, err
+	}
+	return q.runner.RunQuery(ctx, q.Name(), query, w)
+}
+
+// Render returns the query sent to Timestream without running it.
+func (q *PreparedQuery) Render(ctx context.Context, variables map[string]cty.Value, functions map[string]function.Function) (*queryrunner.RenderedQuery, error) {
+	query, err := q.render(variables, functions)
+	if err != nil {
+		return nil, err
+	}
+	return q.NewRenderedQuery(query, nil), nil
+}
+
+func (q *PreparedQuery) render(variables map[string]cty.Value, functions map[string]function.Function) (string, error) {
+	value, diags := q.Query.Value(q.NewEvalContext(variables, functions))
+	if diags.HasErrors() {
+		return "", diags
+	}
+	if !value.IsKnown() {
+		return "", errors.New("query is unknown")
+	}
+	if value.Type() != cty.String {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid query template",
+			Detail:   "query is not string",
+			Subject:  q.Query.Range().Ptr(),
+		})
+		return "", diags
+	}
+	return value.AsString(), nil
+}
+
+// RunQuery executes query and writes result rows to w, returned QueryResult has no rows.
+// the pages are read by NextToken until the query finishes, the pages without rows are polled by the waiter settings.
+// the query is cancelled when it is timeout or canceled.
+func (r *QueryRunner) RunQuery(ctx context.Context, name string, query string, w queryrunner.RowWriter) (*queryrunner.QueryResult, error) {
+	reqID := queryrunner.GetRequestID(ctx)
+	log.Printf("[info][%s] start timestream query `%s`", reqID, name)
+	log.Printf("[debug][%s] query: %s", reqID, query)
+	queryStart := time.Now()
+	waiter := queryrunner.NewWaiter(ctx, r.waiterSettings)
+	queryCtx, cancel := context.WithTimeout(ctx, waiter.Timeout)
+	defer cancel()
+	var (
+		queryID     string
+		nextToken   *string
+		columnInfo  []types.ColumnInfo
+		columns     queryrunner.Columns
+		queryStatus *types.QueryStatus
+	)
+	for {
+		// the first page is requested without the timeout, so that the query ID to cancel the query is known.
+		pageCtx := queryCtx
+		if queryID == "" {
+			pageCtx = ctx
+		}
+		input := &timestreamquery.QueryInput{
+			QueryString: aws.String(query),
+			NextToken:   nextToken,
+		}
+		var output *timestreamquery.QueryOutput
+		var err error
+		if nextToken == nil {
+			// the first request starts the query, so it is not retried.
+			output, err = r.client.Query(pageCtx, input)
+		} else {
+			err = queryrunner.Retry(pageCtx, r.retryPolicy, func(ctx context.Context) error {
+				var err error
+				output, err = r.client.Query(ctx, input)
+				return err
+			})
+		}
+		if err != nil {
+			if queryCtx.Err() != nil && queryID != "" {
+				return nil, r.cancelQuery(ctx, name, queryID)
+			}
+			return nil, fmt.Errorf("query:%w", err)
+		}
+		queryID = aws.ToString(output.QueryId)
+		if output.QueryStatus != nil {
+			queryStatus = output.QueryStatus
+			log.Printf("[debug][%s] wating timestream query `%s` progress=%.1f%% elapsed_time=%s", reqID, name, queryStatus.ProgressPercentage, time.Since(queryStart))
+		}
+		if columns == nil && len(output.ColumnInfo) > 0 {
+			columnInfo = output.ColumnInfo
+			columns = lo.Map(columnInfo, func(c types.ColumnInfo, _ int) queryrunner.Column {
+				return queryrunner.Column{
+					Name:     aws.ToString(c.Name),
+					Type:     columnType(c.Type),
+					Nullable: true,
+				}
+			})
+			if err := w.WriteColumns(columns); err != nil {
+				return nil, fmt.Errorf("write columns:%w", err)
+			}
+		}
+		for _, row := range output.Rows {
+			values := make([]interface{}, len(columns))
+			for i, datum := range row.Data {
+				if i >= len(columns) {
+					break
+				}
+				values[i] = datumValue(columnInfo[i].Type, datum)
+			}
+			if err := w.WriteRow(values); err != nil {
+				return nil, fmt.Errorf("write row:%w", err)
+			}
+		}
+		if output.NextToken == nil {
+			break
+		}
+		nextToken = output.NextToken
+		if len(output.Rows) == 0 {
+			// the query is still running.
+			if !waiter.Continue(queryCtx) {
+				return nil, r.cancelQuery(ctx, name, queryID)
+			}
+			continue
+		}
+		if queryCtx.Err() != nil {
+			return nil, r.cancelQuery(ctx, name, queryID)
+		}
+	}
+	log.Printf("[info][%s] success timestream query `%s`, elapsed_time=%s", reqID, name, time.Since(queryStart))
+	result := queryrunner.NewQueryResultWithColumns(name, query, columns, nil)
+	if columns == nil {
+		result = queryrunner.NewEmptyQueryResult(name, query)
+	}
+	result.Stats = queryStats(queryID, queryStatus)
+	return result, nil
+}
+
+func (r *QueryRunner) cancelQuery(ctx context.Context, name string, queryID string) error {
+	log.Printf("[info][%s] timeout or cancel timestream query `%s`", queryrunner.GetRequestID(ctx), name)
+	cancelCtx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	_, err := r.client.CancelQuery(cancelCtx, &timestreamquery.CancelQueryInput{
+		QueryId: aws.String(queryID),
+	})
+	if err != nil {
+		return fmt.Errorf("cancel query: %w", err)
+	}
+	return errors.New("query timeout")
+}
+
+// queryStats returns the statistics of the finished query.
+func queryStats(queryID string, status *types.QueryStatus) *queryrunner.Stats {
+	stats := &queryrunner.Stats{
+		QueryID: queryID,
+	}
+	if status != nil {
+		stats.BytesScanned = status.CumulativeBytesScanned
+		stats.Extra = map[string]interface{}{
+			"bytes_metered": status.CumulativeBytesMetered,
+		}
+	}
+	return stats
+}
+
+func columnType(t *types.Type) queryrunner.ColumnType {
+	if t == nil {
+		return queryrunner.ColumnTypeUnknown
+	}
+	if t.ArrayColumnInfo != nil || t.RowColumnInfo != nil || t.TimeSeriesMeasureValueColumnInfo != nil {
+		return queryrunner.ColumnTypeJSON
+	}
+	switch t.ScalarType {
+	case types.ScalarTypeBigint, types.ScalarTypeInteger:
+		return queryrunner.ColumnTypeInteger
+	case types.ScalarTypeDouble:
+		return queryrunner.ColumnTypeFloat
+	case types.ScalarTypeBoolean:
+		return queryrunner.ColumnTypeBoolean
+	case types.ScalarTypeTimestamp, types.ScalarTypeDate, types.ScalarTypeTime:
+		return queryrunner.ColumnTypeTimestamp
+	case types.ScalarTypeUnknown:
+		return queryrunner.ColumnTypeUnknown
+	default:
+		return queryrunner.ColumnTypeString
+	}
+}
+
+// datumValue converts the datum into the Go value of the type.
+// arrays are converted to slices, rows to maps by the field names, and time series to slices of `{"time": ..., "value": ...}`.
+func datumValue(t *types.Type, datum types.Datum) interface{} {
+	if aws.ToBool(datum.NullValue) {
+		return nil
+	}
+	if t == nil {
+		t = &types.Type{}
+	}
+	switch {
+	case datum.ScalarValue != nil:
+		return scalarValue(t.ScalarType, *datum.ScalarValue)
+	case datum.ArrayValue != nil:
+		var elemType *types.Type
+		if t.ArrayColumnInfo != nil {
+			elemType = t.ArrayColumnInfo.Type
+		}
+		return lo.Map(datum.ArrayValue, func(d types.Datum, _ int) interface{} {
+			return datumValue(elemType, d)
+		})
+	case datum.RowValue != nil:
+		fields := make(map[string]interface{}, len(datum.RowValue.Data))
+		for i, d := range datum.RowValue.Data {
+			fieldName := fmt.Sprintf("_%d", i)
+			var fieldType *types.Type
+			if i < len(t.RowColumnInfo) {
+				if t.RowColumnInfo[i].Name != nil {
+					fieldName = *t.RowColumnInfo[i].Name
+				}
+				fieldType = t.RowColumnInfo[i].Type
+			}
+			fields[fieldName] = datumValue(fieldType, d)
+		}
+		return fields
+	case datum.TimeSeriesValue != nil:
+		var measureType *types.Type
+		if t.TimeSeriesMeasureValueColumnInfo != nil {
+			measureType = t.TimeSeriesMeasureValueColumnInfo.Type
+		}
+		return lo.Map(datum.TimeSeriesValue, func(p types.TimeSeriesDataPoint, _ int) interface{} {
+			var value interface{}
+			if p.Value != nil {
+				value = datumValue(measureType, *p.Value)
+			}
+			return map[string]interface{}{
+				"time":  aws.ToString(p.Time),
+				"value": value,
+			}
+		})
+	default:
+		return nil
+	}
+}
+
+// scalarValue converts the scalar value into the Go value of the scalar type, it falls back to the string as is.
+func scalarValue(scalarType types.ScalarType, value string) interface{} {
+	switch scalarType {
+	case types.ScalarTypeBigint, types.ScalarTypeInteger:
+		if i, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return i
+		}
+	case types.ScalarTypeDouble:
+		// NaN and Infinity are kept as the string, that can not be encoded to JSON as a number.
+		if f, err := strconv.ParseFloat(value, 64); err == nil && !math.IsNaN(f) && !math.IsInf(f, 0) {
+			return f
+		}
+	case types.ScalarTypeBoolean:
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+	}
+	return value
+}
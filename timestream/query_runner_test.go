@@ -0,0 +1,248 @@
+package timestream
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/timestreamquery"
+	"github.com/aws/aws-sdk-go-v2/service/timestreamquery/types"
+	"github.com/aws/smithy-go"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/mashiike/hclconfig"
+	"github.com/mashiike/queryrunner"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+type stubClient struct {
+	queryInputs []*timestreamquery.QueryInput
+	pages       []*timestreamquery.QueryOutput
+	delay       time.Duration
+	errors      []error
+	cancelInput *timestreamquery.CancelQueryInput
+	cancelled   bool
+}
+
+func (c *stubClient) Query(ctx context.Context, params *timestreamquery.QueryInput, optFns ...func(*timestreamquery.Options)) (*timestreamquery.QueryOutput, error) {
+	c.queryInputs = append(c.queryInputs, params)
+	if len(c.errors) > 0 {
+		err := c.errors[0]
+		c.errors = c.errors[1:]
+		if err != nil {
+			return nil, err
+		}
+	}
+	if c.delay > 0 {
+		select {
+		case <-time.After(c.delay):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	index := 0
+	if params.NextToken != nil {
+		index = len(*params.NextToken)
+	}
+	return c.pages[index], nil
+}
+
+func (c *stubClient) CancelQuery(ctx context.Context, params *timestreamquery.CancelQueryInput, optFns ...func(*timestreamquery.Options)) (*timestreamquery.CancelQueryOutput, error) {
+	c.cancelInput = params
+	c.cancelled = true
+	return &timestreamquery.CancelQueryOutput{}, nil
+}
+
+func loadQuery(t *testing.T, name string, client Client) *PreparedQuery {
+	t.Helper()
+	parser := hclparse.NewParser()
+	file, diags := parser.ParseHCLFile("testdata/config.hcl")
+	require.False(t, diags.HasErrors())
+	queries, _, diags := queryrunner.DecodeBody(file.Body, hclconfig.NewEvalContext("./"))
+	if !assert.False(t, diags.HasErrors()) {
+		var builder strings.Builder
+		w := hcl.NewDiagnosticTextWriter(&builder, parser.Files(), 400, false)
+		w.WriteDiagnostics(diags)
+		t.Log(builder.String())
+		t.FailNow()
+	}
+	query, ok := queries.Get(name)
+	require.True(t, ok)
+	q, ok := query.(*PreparedQuery)
+	require.True(t, ok)
+	q.runner.client = client
+	return q
+}
+
+func scalar(v string) types.Datum {
+	return types.Datum{ScalarValue: aws.String(v)}
+}
+
+func TestRun(t *testing.T) {
+	columnInfo := []types.ColumnInfo{
+		{Name: aws.String("hostname"), Type: &types.Type{ScalarType: types.ScalarTypeVarchar}},
+		{Name: aws.String("t"), Type: &types.Type{ScalarType: types.ScalarTypeTimestamp}},
+		{Name: aws.String("cpu"), Type: &types.Type{ScalarType: types.ScalarTypeDouble}},
+	}
+	client := &stubClient{
+		pages: []*timestreamquery.QueryOutput{
+			{
+				QueryId:     aws.String("query-id"),
+				ColumnInfo:  columnInfo,
+				QueryStatus: &types.QueryStatus{ProgressPercentage: 50},
+				NextToken:   aws.String("1"),
+			},
+			{
+				QueryId:    aws.String("query-id"),
+				ColumnInfo: columnInfo,
+				Rows: []types.Row{
+					{Data: []types.Datum{scalar("host-1"), scalar("2023-04-01 00:00:00.000000000"), scalar("12.5")}},
+					{Data: []types.Datum{scalar("host-2"), scalar("2023-04-01 00:00:00.000000000"), {NullValue: aws.Bool(true)}}},
+				},
+				QueryStatus: &types.QueryStatus{
+					ProgressPercentage:     100,
+					CumulativeBytesScanned: 2048,
+					CumulativeBytesMetered: 10000000,
+				},
+			},
+		},
+	}
+	q := loadQuery(t, "cpu_utilization", client)
+	result, err := q.Run(context.Background(), map[string]cty.Value{
+		"var": cty.ObjectVal(map[string]cty.Value{
+			"minutes": cty.NumberIntVal(15),
+		}),
+	}, nil)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(client.queryInputs))
+	require.Equal(t, `SELECT hostname, bin(time, 1m) AS t, avg(measure_value::double) AS cpu FROM "metrics"."host" WHERE time > ago(15m) GROUP BY 1, 2`, *client.queryInputs[0].QueryString)
+	require.Equal(t, "1", *client.queryInputs[1].NextToken)
+	require.EqualValues(t, queryrunner.Columns{
+		{Name: "hostname", Type: queryrunner.ColumnTypeString, Nullable: true},
+		{Name: "t", Type: queryrunner.ColumnTypeTimestamp, Nullable: true},
+		{Name: "cpu", Type: queryrunner.ColumnTypeFloat, Nullable: true},
+	}, result.Columns)
+	require.EqualValues(t, [][]interface{}{
+		{"host-1", "2023-04-01 00:00:00.000000000", 12.5},
+		{"host-2", "2023-04-01 00:00:00.000000000", nil},
+	}, result.Rows)
+	require.Equal(t, "query-id", result.Stats.QueryID)
+	require.EqualValues(t, 2048, result.Stats.BytesScanned)
+	require.False(t, client.cancelled)
+}
+
+func TestRunTimeoutDuringFirstPage(t *testing.T) {
+	client := &stubClient{
+		delay: 50 * time.Millisecond,
+		pages: []*timestreamquery.QueryOutput{
+			{
+				QueryId:     aws.String("query-id"),
+				QueryStatus: &types.QueryStatus{ProgressPercentage: 10},
+				NextToken:   aws.String("1"),
+			},
+		},
+	}
+	q := loadQuery(t, "slow_query", client)
+	_, err := q.Run(context.Background(), nil, nil)
+	require.EqualError(t, err, "query timeout")
+	require.Equal(t, 1, len(client.queryInputs))
+	require.True(t, client.cancelled)
+	require.Equal(t, "query-id", *client.cancelInput.QueryId)
+}
+
+func TestRunPolling(t *testing.T) {
+	columnInfo := []types.ColumnInfo{
+		{Name: aws.String("cnt"), Type: &types.Type{ScalarType: types.ScalarTypeBigint}},
+	}
+	client := &stubClient{
+		pages: []*timestreamquery.QueryOutput{
+			{
+				QueryId:   aws.String("query-id"),
+				NextToken: aws.String("1"),
+			},
+			{
+				QueryId:   aws.String("query-id"),
+				NextToken: aws.String("22"),
+			},
+			{
+				QueryId:    aws.String("query-id"),
+				ColumnInfo: columnInfo,
+				Rows: []types.Row{
+					{Data: []types.Datum{scalar("3")}},
+				},
+			},
+		},
+	}
+	q := loadQuery(t, "polling_query", client)
+	start := time.Now()
+	result, err := q.Run(context.Background(), nil, nil)
+	require.NoError(t, err)
+	// the pages without rows are polled by 20ms and 40ms of poll_min_interval doubled.
+	require.GreaterOrEqual(t, time.Since(start), 60*time.Millisecond)
+	require.Equal(t, 3, len(client.queryInputs))
+	require.EqualValues(t, [][]interface{}{{int64(3)}}, result.Rows)
+	require.False(t, client.cancelled)
+}
+
+func TestRunRetry(t *testing.T) {
+	throttling := &smithy.GenericAPIError{Code: "ThrottlingException", Message: "Rate exceeded"}
+	pages := []*timestreamquery.QueryOutput{
+		{
+			QueryId:   aws.String("query-id"),
+			NextToken: aws.String("1"),
+		},
+		{
+			QueryId: aws.String("query-id"),
+		},
+	}
+	client := &stubClient{
+		pages:  pages,
+		errors: []error{throttling},
+	}
+	q := loadQuery(t, "query_with_retry", client)
+	_, err := queryrunner.RunQuery(context.Background(), q, nil, nil)
+	require.EqualError(t, err, "query:api error ThrottlingException: Rate exceeded")
+	require.Equal(t, 1, len(client.queryInputs), "the first request starting the query is not retried")
+
+	client = &stubClient{
+		pages:  pages,
+		errors: []error{nil, throttling},
+	}
+	q = loadQuery(t, "query_with_retry", client)
+	result, err := queryrunner.RunQuery(context.Background(), q, nil, nil)
+	require.NoError(t, err)
+	require.Equal(t, 3, len(client.queryInputs))
+	require.Equal(t, 1, result.Stats.Retries)
+}
+
+func TestDatumValue(t *testing.T) {
+	t.Run("array", func(t *testing.T) {
+		typ := &types.Type{ArrayColumnInfo: &types.ColumnInfo{Type: &types.Type{ScalarType: types.ScalarTypeBigint}}}
+		require.Equal(t, queryrunner.ColumnTypeJSON, columnType(typ))
+		value := datumValue(typ, types.Datum{ArrayValue: []types.Datum{scalar("1"), scalar("2")}})
+		require.EqualValues(t, []interface{}{int64(1), int64(2)}, value)
+	})
+	t.Run("row", func(t *testing.T) {
+		typ := &types.Type{RowColumnInfo: []types.ColumnInfo{
+			{Name: aws.String("region"), Type: &types.Type{ScalarType: types.ScalarTypeVarchar}},
+			{Name: aws.String("healthy"), Type: &types.Type{ScalarType: types.ScalarTypeBoolean}},
+		}}
+		value := datumValue(typ, types.Datum{RowValue: &types.Row{Data: []types.Datum{scalar("ap-northeast-1"), scalar("true")}}})
+		require.EqualValues(t, map[string]interface{}{"region": "ap-northeast-1", "healthy": true}, value)
+	})
+	t.Run("time series", func(t *testing.T) {
+		typ := &types.Type{TimeSeriesMeasureValueColumnInfo: &types.ColumnInfo{Type: &types.Type{ScalarType: types.ScalarTypeDouble}}}
+		value := datumValue(typ, types.Datum{TimeSeriesValue: []types.TimeSeriesDataPoint{
+			{Time: aws.String("2023-04-01 00:00:00.000000000"), Value: &types.Datum{ScalarValue: aws.String("0.5")}},
+			{Time: aws.String("2023-04-01 00:01:00.000000000"), Value: &types.Datum{ScalarValue: aws.String("NaN")}},
+		}})
+		require.EqualValues(t, []interface{}{
+			map[string]interface{}{"time": "2023-04-01 00:00:00.000000000", "value": 0.5},
+			map[string]interface{}{"time": "2023-04-01 00:01:00.000000000", "value": "NaN"},
+		}, value)
+	})
+}
@@ -0,0 +1,32 @@
+query_runner "timestream" "default" {
+  region = "ap-northeast-1"
+}
+
+query "cpu_utilization" {
+  runner = query_runner.timestream.default
+  query  = "SELECT hostname, bin(time, 1m) AS t, avg(measure_value::double) AS cpu FROM \"metrics\".\"host\" WHERE time > ago(${var.minutes}m) GROUP BY 1, 2"
+}
+
+query "slow_query" {
+  runner            = query_runner.timestream.default
+  query             = "SELECT count(*) AS cnt FROM \"metrics\".\"host\""
+  timeout           = "10ms"
+  poll_min_interval = "1ms"
+  jitter            = "0s"
+}
+
+query "polling_query" {
+  runner            = query_runner.timestream.default
+  query             = "SELECT count(*) AS cnt FROM \"metrics\".\"host\""
+  poll_min_interval = "20ms"
+  jitter            = "0s"
+}
+
+query "query_with_retry" {
+  runner = query_runner.timestream.default
+  query  = "SELECT count(*) AS cnt FROM \"metrics\".\"host\""
+  retry {
+    max_attempts = 3
+    backoff      = "1ms"
+  }
+}
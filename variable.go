@@ -0,0 +1,394 @@
+package queryrunner
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/ext/typeexpr"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+)
+
+// Variable is an input of queries declared by `variable "name" {}` block.
+// queries refer to the value as `var.name`.
+type Variable struct {
+	Name        string
+	Description string
+	Type        cty.Type
+	// Default is cty.NilVal when the variable has no default, that means the variable is required.
+	Default     cty.Value
+	Validations []*VariableValidation
+	DeclRange   hcl.Range
+
+	evalCtx *hcl.EvalContext
+}
+
+// VariableValidation is a custom validation rule declared by `validation {}` block in `variable` block.
+type VariableValidation struct {
+	Condition    hcl.Expression
+	ErrorMessage hcl.Expression
+	DeclRange    hcl.Range
+}
+
+// Required returns true if the variable has no default value.
+func (v *Variable) Required() bool {
+	return v.Default == cty.NilVal
+}
+
+// TypeString returns the type constraint as written in HCL, e.g. `list(string)`.
+func (v *Variable) TypeString() string {
+	return typeexpr.TypeString(v.Type)
+}
+
+// DefaultString returns the default value as JSON, it is empty if the variable is required.
+func (v *Variable) DefaultString() string {
+	if v.Required() {
+		return ""
+	}
+	bs, err := ctyjson.Marshal(v.Default, v.Default.Type())
+	if err != nil {
+		return v.Default.GoString()
+	}
+	return string(bs)
+}
+
+var variableBlockSchema = &hcl.BodySchema{
+	Attributes: []hcl.AttributeSchema{
+		{
+			Name: "type",
+		},
+		{
+			Name: "default",
+		},
+		{
+			Name: "description",
+		},
+	},
+	Blocks: []hcl.BlockHeaderSchema{
+		{
+			Type: "validation",
+		},
+	},
+}
+
+var variableValidationBlockSchema = &hcl.BodySchema{
+	Attributes: []hcl.AttributeSchema{
+		{
+			Name:     "condition",
+			Required: true,
+		},
+		{
+			Name:     "error_message",
+			Required: true,
+		},
+	},
+}
+
+// DecodeVariable decodes `variable` block.
+func DecodeVariable(block *hcl.Block, ctx *hcl.EvalContext) (*Variable, hcl.Diagnostics) {
+	v := &Variable{
+		Name:      block.Labels[0],
+		Type:      cty.DynamicPseudoType,
+		DeclRange: block.DefRange,
+		evalCtx:   ctx,
+	}
+	var diags hcl.Diagnostics
+	if !hclsyntax.ValidIdentifier(v.Name) {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid variable name",
+			Detail:   "A name must start with a letter or underscore and may contain only letters, digits, underscores, and dashes.",
+			Subject:  block.LabelRanges[0].Ptr(),
+		})
+	}
+	content, contentDiags := block.Body.Content(variableBlockSchema)
+	diags = append(diags, contentDiags...)
+	if attr, ok := content.Attributes["type"]; ok {
+		ty, typeDiags := typeexpr.TypeConstraint(attr.Expr)
+		diags = append(diags, typeDiags...)
+		if !typeDiags.HasErrors() {
+			v.Type = ty
+		}
+	}
+	if attr, ok := content.Attributes["description"]; ok {
+		value, valueDiags := attr.Expr.Value(ctx)
+		diags = append(diags, valueDiags...)
+		if !valueDiags.HasErrors() {
+			if !value.IsKnown() || value.Type() != cty.String || value.IsNull() {
+				diags = append(diags, &hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  "Invalid description",
+					Detail:   "description is not string",
+					Subject:  attr.Expr.Range().Ptr(),
+				})
+			} else {
+				v.Description = value.AsString()
+			}
+		}
+	}
+	if attr, ok := content.Attributes["default"]; ok {
+		value, valueDiags := attr.Expr.Value(ctx)
+		diags = append(diags, valueDiags...)
+		if !valueDiags.HasErrors() {
+			converted, err := convert.Convert(value, v.Type)
+			if err != nil {
+				diags = append(diags, &hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  "Invalid default value for variable",
+					Detail:   fmt.Sprintf("This default value is not compatible with the variable's type constraint: %s.", err),
+					Subject:  attr.Expr.Range().Ptr(),
+				})
+			} else {
+				v.Default = converted
+			}
+		}
+	}
+	for _, block := range content.Blocks {
+		validationContent, validationDiags := block.Body.Content(variableValidationBlockSchema)
+		diags = append(diags, validationDiags...)
+		if validationDiags.HasErrors() {
+			continue
+		}
+		validation := &VariableValidation{
+			Condition:    validationContent.Attributes["condition"].Expr,
+			ErrorMessage: validationContent.Attributes["error_message"].Expr,
+			DeclRange:    block.DefRange,
+		}
+		for _, traversal := range validation.Condition.Variables() {
+			if traversal.RootName() != "var" {
+				continue
+			}
+			if name, ok := traversalName(traversal); !ok || name != v.Name {
+				diags = append(diags, &hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  "Invalid reference in variable validation",
+					Detail:   fmt.Sprintf("The condition for variable %q can only refer to the variable itself, using var.%s.", v.Name, v.Name),
+					Subject:  traversal.SourceRange().Ptr(),
+				})
+			}
+		}
+		v.Validations = append(v.Validations, validation)
+	}
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	return v, diags
+}
+
+// Evaluate returns the value of the variable from input, the default value is used if input is null.
+// the value is converted into the type and checked by validations.
+func (v *Variable) Evaluate(input cty.Value) (cty.Value, hcl.Diagnostics) {
+	var diags hcl.Diagnostics
+	if input.IsNull() {
+		if v.Required() {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "No value for required variable",
+				Detail:   fmt.Sprintf("The input variable %q is not set, and has no default value.", v.Name),
+				Subject:  v.DeclRange.Ptr(),
+			})
+			return cty.NilVal, diags
+		}
+		input = v.Default
+	}
+	value, err := convert.Convert(input, v.Type)
+	if err != nil {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid value for variable",
+			Detail:   fmt.Sprintf("The value for variable %q is not compatible with the variable's type constraint: %s.", v.Name, err),
+			Subject:  v.DeclRange.Ptr(),
+		})
+		return cty.NilVal, diags
+	}
+	evalCtx := v.evalCtx.NewChild()
+	evalCtx.Variables = map[string]cty.Value{
+		"var": cty.ObjectVal(map[string]cty.Value{
+			v.Name: value,
+		}),
+	}
+	for _, validation := range v.Validations {
+		result, conditionDiags := validation.Condition.Value(evalCtx)
+		diags = append(diags, conditionDiags...)
+		if conditionDiags.HasErrors() {
+			continue
+		}
+		if !result.IsKnown() || result.IsNull() || result.Type() != cty.Bool {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid variable validation result",
+				Detail:   "The validation condition must be a known bool value.",
+				Subject:  validation.Condition.Range().Ptr(),
+			})
+			continue
+		}
+		if result.True() {
+			continue
+		}
+		message, messageDiags := validation.ErrorMessage.Value(evalCtx)
+		diags = append(diags, messageDiags...)
+		detail := fmt.Sprintf("The value for variable %q is invalid.", v.Name)
+		if !messageDiags.HasErrors() && message.IsKnown() && !message.IsNull() && message.Type() == cty.String {
+			detail = message.AsString()
+		}
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid value for variable",
+			Detail:   detail,
+			Subject:  validation.DeclRange.Ptr(),
+		})
+	}
+	if diags.HasErrors() {
+		return cty.NilVal, diags
+	}
+	return value, diags
+}
+
+// Variables is a list of declared variables.
+type Variables []*Variable
+
+func (vs Variables) Get(name string) (*Variable, bool) {
+	for _, v := range vs {
+		if v.Name == name {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+// Evaluate returns the `var` object for the variables from input.
+// input is the `var` object given from outside, such as variables JSON. attributes not declared are ignored.
+func (vs Variables) Evaluate(input cty.Value) (cty.Value, hcl.Diagnostics) {
+	var diags hcl.Diagnostics
+	var inputs map[string]cty.Value
+	if input != cty.NilVal && !input.IsNull() && input.IsKnown() {
+		ty := input.Type()
+		if !ty.IsObjectType() && !ty.IsMapType() {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid variables",
+				Detail:   fmt.Sprintf("variables must be an object, got %s", ty.FriendlyName()),
+			})
+			return cty.NilVal, diags
+		}
+		inputs = input.AsValueMap()
+	}
+	for name := range inputs {
+		if _, ok := vs.Get(name); !ok {
+			log.Printf("[debug] variable `%s` is not declared, ignored", name)
+		}
+	}
+	values := make(map[string]cty.Value, len(vs))
+	for _, v := range vs {
+		value, ok := inputs[v.Name]
+		if !ok {
+			value = cty.NullVal(cty.DynamicPseudoType)
+		}
+		evaluated, evalDiags := v.Evaluate(value)
+		diags = append(diags, evalDiags...)
+		if evalDiags.HasErrors() {
+			continue
+		}
+		values[v.Name] = evaluated
+	}
+	if diags.HasErrors() {
+		return cty.NilVal, diags
+	}
+	return cty.ObjectVal(values), diags
+}
+
+// EvaluateVariables returns variables for running the query, `var` object is replaced by the declared variables of the query.
+// when no variable is declared, variables are returned as is.
+func EvaluateVariables(query PreparedQuery, variables map[string]cty.Value) (map[string]cty.Value, error) {
+	declared := query.Variables()
+	if declared == nil {
+		return variables, nil
+	}
+	evaluated := make(map[string]cty.Value, len(variables)+1)
+	for key, value := range variables {
+		evaluated[key] = value
+	}
+	value, diags := declared.Evaluate(variables["var"])
+	if diags.HasErrors() {
+		return nil, fmt.Errorf("query `%s`: %w", query.Name(), diags)
+	}
+	evaluated["var"] = value
+	return evaluated, nil
+}
+
+// traversalName returns the name of `var.name` or `var["name"]` like traversal.
+func traversalName(traversal hcl.Traversal) (string, bool) {
+	if len(traversal) < 2 {
+		return "", false
+	}
+	switch step := traversal[1].(type) {
+	case hcl.TraverseAttr:
+		return step.Name, true
+	case hcl.TraverseIndex:
+		if step.Key.Type() == cty.String && step.Key.IsKnown() && !step.Key.IsNull() {
+			return step.Key.AsString(), true
+		}
+	}
+	return "", false
+}
+
+// referencedVariables returns declared variables referred in the body.
+// when the body refers to `var` itself, all declared variables are returned.
+func referencedVariables(body hcl.Body, declared Variables) (Variables, hcl.Diagnostics) {
+	var diags hcl.Diagnostics
+	traversals, ok := bodyTraversals(body)
+	if !ok {
+		return declared, diags
+	}
+	names := make(map[string]bool)
+	for _, traversal := range traversals {
+		if traversal.RootName() != "var" {
+			continue
+		}
+		name, ok := traversalName(traversal)
+		if !ok {
+			return declared, diags
+		}
+		if _, ok := declared.Get(name); !ok {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Reference to undeclared input variable",
+				Detail:   fmt.Sprintf("An input variable with the name %q has not been declared. This variable can be declared with a variable %q {} block.", name, name),
+				Subject:  traversal.SourceRange().Ptr(),
+			})
+			continue
+		}
+		names[name] = true
+	}
+	referenced := make(Variables, 0, len(names))
+	for _, v := range declared {
+		if names[v.Name] {
+			referenced = append(referenced, v)
+		}
+	}
+	return referenced, diags
+}
+
+// bodyTraversals returns all traversals in the attributes and nested blocks of the body.
+// the second return value is false if the body is not native syntax, such as JSON.
+func bodyTraversals(body hcl.Body) ([]hcl.Traversal, bool) {
+	syntaxBody, ok := body.(*hclsyntax.Body)
+	if !ok {
+		return nil, false
+	}
+	var traversals []hcl.Traversal
+	for _, attr := range syntaxBody.Attributes {
+		traversals = append(traversals, attr.Expr.Variables()...)
+	}
+	for _, block := range syntaxBody.Blocks {
+		nested, ok := bodyTraversals(block.Body)
+		if !ok {
+			return nil, false
+		}
+		traversals = append(traversals, nested...)
+	}
+	return traversals, true
+}
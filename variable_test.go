@@ -0,0 +1,173 @@
+package queryrunner_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/gohcl"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/mashiike/hclconfig"
+	"github.com/mashiike/queryrunner"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func decodeVariablesConfig(t *testing.T, src string) (queryrunner.PreparedQueries, hcl.Diagnostics) {
+	t.Helper()
+	err := queryrunner.Register(&queryrunner.QueryRunnerDefinition{
+		TypeName: "dummy",
+		BuildQueryRunnerFunc: func(name string, body hcl.Body, ctx *hcl.EvalContext) (queryrunner.QueryRunner, hcl.Diagnostics) {
+			runner := &dummyQueryRunner{
+				name: name,
+			}
+			diags := gohcl.DecodeBody(body, ctx, runner)
+			return runner, diags
+		},
+	})
+	require.NoError(t, err)
+	parser := hclparse.NewParser()
+	file, diags := parser.ParseHCL([]byte(src), "config.hcl")
+	require.False(t, diags.HasErrors())
+	queries, _, diags := queryrunner.DecodeBody(file.Body, hclconfig.NewEvalContext())
+	return queries, diags
+}
+
+func TestVariables(t *testing.T) {
+	queries, diags := decodeVariablesConfig(t, `
+	variable "user_id" {
+		type        = number
+		description = "target user id"
+		validation {
+			condition     = var.user_id > 0
+			error_message = "user_id must be positive."
+		}
+	}
+
+	variable "status" {
+		type    = string
+		default = "active"
+	}
+
+	variable "unused" {
+		type = string
+	}
+
+	query_runner "dummy" "default" {
+		columns = ["id", "status"]
+	}
+
+	query "users" {
+		runner = query_runner.dummy.default
+		rows = [
+			[ "${var.user_id}", var.status ],
+		]
+	}
+	`)
+	if !assert.False(t, diags.HasErrors()) {
+		t.Log(diags.Error())
+		t.FailNow()
+	}
+	query, ok := queries.Get("users")
+	require.True(t, ok)
+	variables := query.Variables()
+	require.Equal(t, 2, len(variables))
+	require.Equal(t, "user_id", variables[0].Name)
+	require.Equal(t, "number", variables[0].TypeString())
+	require.Equal(t, "target user id", variables[0].Description)
+	require.True(t, variables[0].Required())
+	require.Equal(t, "status", variables[1].Name)
+	require.False(t, variables[1].Required())
+	require.Equal(t, `"active"`, variables[1].DefaultString())
+
+	result, err := queryrunner.RunQuery(context.Background(), query, map[string]cty.Value{
+		"var": cty.ObjectVal(map[string]cty.Value{
+			"user_id": cty.StringVal("12"),
+			"extra":   cty.True,
+		}),
+	}, nil)
+	require.NoError(t, err)
+	require.EqualValues(t, [][]interface{}{{"12", "active"}}, result.Rows)
+
+	cases := []struct {
+		name     string
+		input    cty.Value
+		expected string
+	}{
+		{
+			name:     "missing",
+			input:    cty.NullVal(cty.DynamicPseudoType),
+			expected: `The input variable "user_id" is not set, and has no default value.`,
+		},
+		{
+			name: "mistyped",
+			input: cty.ObjectVal(map[string]cty.Value{
+				"user_id": cty.StringVal("hoge"),
+			}),
+			expected: `The value for variable "user_id" is not compatible with the variable's type constraint: a number is required.`,
+		},
+		{
+			name: "validation",
+			input: cty.ObjectVal(map[string]cty.Value{
+				"user_id": cty.NumberIntVal(-1),
+			}),
+			expected: "user_id must be positive.",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := queryrunner.RunQuery(context.Background(), query, map[string]cty.Value{
+				"var": c.input,
+			}, nil)
+			require.Error(t, err)
+			require.Contains(t, err.Error(), c.expected)
+		})
+	}
+}
+
+func TestVariablesUndeclared(t *testing.T) {
+	_, diags := decodeVariablesConfig(t, `
+	variable "user_id" {
+		type = number
+	}
+
+	query_runner "dummy" "default" {
+		columns = ["id"]
+	}
+
+	query "users" {
+		runner = query_runner.dummy.default
+		rows = [
+			[ var.user_name ],
+		]
+	}
+	`)
+	require.True(t, diags.HasErrors())
+	require.True(t, strings.HasPrefix(diags.Errs()[0].(*hcl.Diagnostic).Detail, `An input variable with the name "user_name" has not been declared.`))
+}
+
+func TestVariablesNotDeclared(t *testing.T) {
+	queries, diags := decodeVariablesConfig(t, `
+	query_runner "dummy" "default" {
+		columns = ["id"]
+	}
+
+	query "users" {
+		runner = query_runner.dummy.default
+		rows = [
+			[ var == null ? "none" : var.user_name ],
+		]
+	}
+	`)
+	require.False(t, diags.HasErrors())
+	query, ok := queries.Get("users")
+	require.True(t, ok)
+	require.Nil(t, query.Variables())
+	result, err := queryrunner.RunQuery(context.Background(), query, map[string]cty.Value{
+		"var": cty.NullVal(cty.DynamicPseudoType),
+	}, nil)
+	require.NoError(t, err)
+	require.EqualValues(t, [][]interface{}{{"none"}}, result.Rows)
+}
@@ -4,10 +4,15 @@ import (
 	"context"
 	crand "crypto/rand"
 	"encoding/binary"
+	"fmt"
 	"log"
 	"math/rand"
 	"sync"
 	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/zclconf/go-cty/cty"
 )
 
 type Waiter struct {
@@ -73,3 +78,148 @@ func (w *Waiter) randomJitter() time.Duration {
 	}
 	return time.Duration(w.rand.Int63n(jitter))
 }
+
+// WaiterSettings overrides the default settings of Waiter, nil fields are not overridden.
+type WaiterSettings struct {
+	Timeout         *time.Duration
+	PollMinInterval *time.Duration
+	PollMaxInterval *time.Duration
+	Jitter          *time.Duration
+}
+
+// DefaultWaiterSettings is used when neither query_runner nor query block has the settings.
+var DefaultWaiterSettings = WaiterSettings{
+	Timeout:         aws.Duration(15 * time.Minute),
+	PollMinInterval: aws.Duration(100 * time.Microsecond),
+	PollMaxInterval: aws.Duration(5 * time.Second),
+	Jitter:          aws.Duration(200 * time.Millisecond),
+}
+
+// Merge returns the settings overridden by the non-nil fields of other.
+func (s WaiterSettings) Merge(other WaiterSettings) WaiterSettings {
+	if other.Timeout != nil {
+		s.Timeout = other.Timeout
+	}
+	if other.PollMinInterval != nil {
+		s.PollMinInterval = other.PollMinInterval
+	}
+	if other.PollMaxInterval != nil {
+		s.PollMaxInterval = other.PollMaxInterval
+	}
+	if other.Jitter != nil {
+		s.Jitter = other.Jitter
+	}
+	return s
+}
+
+var waiterSettingsSchema = &hcl.BodySchema{
+	Attributes: []hcl.AttributeSchema{
+		{
+			Name: "timeout",
+		},
+		{
+			Name: "poll_min_interval",
+		},
+		{
+			Name: "poll_max_interval",
+		},
+		{
+			Name: "jitter",
+		},
+	},
+}
+
+// DecodeWaiterSettings decodes timeout, poll_min_interval, poll_max_interval and jitter attributes in body, the remain body is returned for the other attributes.
+func DecodeWaiterSettings(body hcl.Body, ctx *hcl.EvalContext) (WaiterSettings, hcl.Body, hcl.Diagnostics) {
+	var settings WaiterSettings
+	content, remain, diags := body.PartialContent(waiterSettingsSchema)
+	if diags.HasErrors() {
+		return settings, remain, diags
+	}
+	for _, attr := range content.Attributes {
+		d, durationDiags := decodeDurationAttribute(attr, ctx, attr.Name == "jitter")
+		diags = append(diags, durationDiags...)
+		if durationDiags.HasErrors() {
+			continue
+		}
+		switch attr.Name {
+		case "timeout":
+			settings.Timeout = &d
+		case "poll_min_interval":
+			settings.PollMinInterval = &d
+		case "poll_max_interval":
+			settings.PollMaxInterval = &d
+		case "jitter":
+			settings.Jitter = &d
+		}
+	}
+	if settings.PollMinInterval != nil && settings.PollMaxInterval != nil && *settings.PollMinInterval > *settings.PollMaxInterval {
+		attr := content.Attributes["poll_max_interval"]
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid poll_max_interval",
+			Detail:   "poll_max_interval must be greater than or equal to poll_min_interval",
+			Subject:  attr.Expr.Range().Ptr(),
+		})
+	}
+	return settings, remain, diags
+}
+
+func decodeDurationAttribute(attr *hcl.Attribute, ctx *hcl.EvalContext, allowZero bool) (time.Duration, hcl.Diagnostics) {
+	value, diags := attr.Expr.Value(ctx)
+	if diags.HasErrors() {
+		return 0, diags
+	}
+	if !value.IsKnown() || value.IsNull() || value.Type() != cty.String {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  fmt.Sprintf("Invalid %s", attr.Name),
+			Detail:   fmt.Sprintf(`%s is not string, please write as %s = "5m"`, attr.Name, attr.Name),
+			Subject:  attr.Expr.Range().Ptr(),
+		})
+		return 0, diags
+	}
+	d, err := time.ParseDuration(value.AsString())
+	if err != nil || d < 0 || (d == 0 && !allowZero) {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  fmt.Sprintf("Invalid %s", attr.Name),
+			Detail:   fmt.Sprintf("%s must be a positive duration, e.g. \"5m\": %q", attr.Name, value.AsString()),
+			Subject:  attr.Expr.Range().Ptr(),
+		})
+		return 0, diags
+	}
+	return d, diags
+}
+
+var waiterSettingsContextKey contextKey = "__queryrunner_waiter_settings"
+
+// WithWaiterSettings sets the settings of the query, that override the settings of the query runner in NewWaiter.
+func WithWaiterSettings(ctx context.Context, settings WaiterSettings) context.Context {
+	return context.WithValue(ctx, waiterSettingsContextKey, settings)
+}
+
+// NewWaiter returns Waiter started now, the settings are merged in order of DefaultWaiterSettings, runnerSettings and the settings of ctx.
+// the timeout is shortened to the deadline of ctx when it is earlier.
+func NewWaiter(ctx context.Context, runnerSettings WaiterSettings) *Waiter {
+	settings := DefaultWaiterSettings.Merge(runnerSettings)
+	if querySettings, ok := ctx.Value(waiterSettingsContextKey).(WaiterSettings); ok {
+		settings = settings.Merge(querySettings)
+	}
+	w := &Waiter{
+		StartTime: time.Now(),
+		MinDelay:  *settings.PollMinInterval,
+		MaxDelay:  *settings.PollMaxInterval,
+		Timeout:   *settings.Timeout,
+		Jitter:    *settings.Jitter,
+	}
+	if w.MaxDelay < w.MinDelay {
+		w.MaxDelay = w.MinDelay
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		if remaining := deadline.Sub(w.StartTime); remaining < w.Timeout {
+			w.Timeout = remaining
+		}
+	}
+	return w
+}
@@ -0,0 +1,96 @@
+package queryrunner_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/mashiike/hclconfig"
+	"github.com/mashiike/queryrunner"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewWaiter(t *testing.T) {
+	parser := hclparse.NewParser()
+	file, diags := parser.ParseHCL([]byte(`
+	timeout           = "30m"
+	poll_min_interval = "1s"
+	jitter            = "0s"
+	database          = "default"
+	`), "runner.hcl")
+	require.False(t, diags.HasErrors())
+	runnerSettings, remain, diags := queryrunner.DecodeWaiterSettings(file.Body, hclconfig.NewEvalContext())
+	require.False(t, diags.HasErrors(), diags.Error())
+	attrs, diags := remain.JustAttributes()
+	require.False(t, diags.HasErrors(), diags.Error())
+	require.Len(t, attrs, 1)
+
+	queries, diags := decodeVariablesConfig(t, `
+	query_runner "dummy" "default" {
+		columns = ["id"]
+	}
+
+	query "quick" {
+		runner  = query_runner.dummy.default
+		timeout = "10s"
+		rows    = []
+	}
+	`)
+	require.False(t, diags.HasErrors(), diags.Error())
+	query, ok := queries.Get("quick")
+	require.True(t, ok)
+	querySettings := query.(interface {
+		WaiterSettings() queryrunner.WaiterSettings
+	}).WaiterSettings()
+
+	waiter := queryrunner.NewWaiter(context.Background(), runnerSettings)
+	require.Equal(t, 30*time.Minute, waiter.Timeout)
+	require.Equal(t, time.Second, waiter.MinDelay)
+	require.Equal(t, 5*time.Second, waiter.MaxDelay)
+	require.Equal(t, time.Duration(0), waiter.Jitter)
+
+	ctx := queryrunner.WithWaiterSettings(context.Background(), querySettings)
+	waiter = queryrunner.NewWaiter(ctx, runnerSettings)
+	require.Equal(t, 10*time.Second, waiter.Timeout)
+	require.Equal(t, time.Second, waiter.MinDelay)
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+	waiter = queryrunner.NewWaiter(ctx, runnerSettings)
+	require.LessOrEqual(t, waiter.Timeout, 3*time.Second)
+}
+
+func TestDecodeWaiterSettingsInvalid(t *testing.T) {
+	cases := []struct {
+		src    string
+		detail string
+	}{
+		{
+			src:    `timeout = "0s"`,
+			detail: `timeout must be a positive duration, e.g. "5m": "0s"`,
+		},
+		{
+			src:    `timeout = 10`,
+			detail: `timeout is not string, please write as timeout = "5m"`,
+		},
+		{
+			src: `
+			poll_min_interval = "10s"
+			poll_max_interval = "1s"
+			`,
+			detail: "poll_max_interval must be greater than or equal to poll_min_interval",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.src, func(t *testing.T) {
+			parser := hclparse.NewParser()
+			file, diags := parser.ParseHCL([]byte(c.src), "runner.hcl")
+			require.False(t, diags.HasErrors())
+			_, _, diags = queryrunner.DecodeWaiterSettings(file.Body, hclconfig.NewEvalContext())
+			require.True(t, diags.HasErrors())
+			require.Equal(t, c.detail, diags.Errs()[0].(*hcl.Diagnostic).Detail)
+		})
+	}
+}